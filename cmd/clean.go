@@ -4,15 +4,22 @@ import (
 	"context"
 	"fmt"
 	"github.com/briandowns/spinner"
-	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/redis"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/retention"
 	"github.com/spf13/cobra"
 	"os"
+	"slices"
+	"strings"
 	"time"
 )
 
-var delConfig bool
+var (
+	delConfig    bool
+	cleanBefore  string
+	cleanDataset []string
+)
 
 var CleanCmd = &cobra.Command{
 	Use:   "clean",
@@ -22,14 +29,23 @@ var CleanCmd = &cobra.Command{
 
 func init() {
 	CleanCmd.PersistentFlags().BoolVar(&delConfig, "config", false, "Delete config")
+	CleanCmd.PersistentFlags().StringVar(&cleanBefore, "before", "", "Only delete dated collections before the date, e.g. 2024-11-01 or \"2024-11-01 15:00\"")
+	CleanCmd.PersistentFlags().StringSliceVar(&cleanDataset, "dataset", nil, "Only clean the given datasets: streams,devices,useragent,proxy,suspected,user_events,features")
 }
 
 func cleanRun(cmd *cobra.Command, args []string) {
-	// 连接 MongoDB
-	if err := mongo.Setup(); err != nil {
-		fmt.Printf("🚨 mongo 连接失败: %v\n", err)
+	// 连接存储
+	if err := storage.SetupClient(); err != nil {
+		fmt.Printf("🚨 存储连接失败: %v\n", err)
 		os.Exit(1)
 	}
+	defer storage.Close()
+
+	// 按日期清理按时间分集合的数据
+	if cleanBefore != "" {
+		cleanCollectionsBefore()
+		return
+	}
 
 	// 初始化 spinner
 	spinner := spinner.New(spinner.CharSets[36], 100*time.Millisecond)
@@ -50,6 +66,20 @@ func cleanRun(cmd *cobra.Command, args []string) {
 		tables = append(tables, types.MongoDatabaseConfigs)
 	}
 
+	// 仅清空指定的数据集，不清理 redis
+	if len(cleanDataset) > 0 {
+		selected := make([]string, 0, len(cleanDataset))
+		for _, name := range cleanDataset {
+			if !slices.Contains(tables, name) {
+				spinner.Stop()
+				fmt.Printf("🚨 未知的数据集 %s，可选: %s\n", name, strings.Join(tables, ","))
+				os.Exit(1)
+			}
+			selected = append(selected, name)
+		}
+		tables = selected
+	}
+
 	// 清空 MongoDB 操作
 	for _, table := range tables {
 		time.Sleep(time.Second / 2)
@@ -58,7 +88,7 @@ func cleanRun(cmd *cobra.Command, args []string) {
 		fmt.Printf("🔄 正在清空 %s 表...\n", table)
 
 		// 执行删除操作
-		err := mongo.GetMongoClient().Database(table).Drop(mongo.Context)
+		err := storage.Datasets().DropDatabase(context.TODO(), table)
 		if err != nil {
 			// 如果删除失败，打印失败信息
 			fmt.Printf("❌ 清空 %s 表失败: %v\n", table, err)
@@ -71,6 +101,12 @@ func cleanRun(cmd *cobra.Command, args []string) {
 		spinner.Start()
 	}
 
+	if len(cleanDataset) > 0 {
+		spinner.Stop()
+		fmt.Println("\n🎉 指定数据集清空操作完成！")
+		return
+	}
+
 	// 需要清空的 Redis 键集合
 	setKeys := []string{
 		types.ZSetIP,
@@ -112,6 +148,7 @@ func cleanRun(cmd *cobra.Command, args []string) {
 	scanKeys := []string{
 		types.HashAnalyzeIP,
 		types.SetIPDevices,
+		types.ZSetIPDevices,
 		types.KeyDiscoverIP,
 		types.KeyDevicesMobileIP,
 		types.KeyDevicesPcIP,
@@ -177,3 +214,50 @@ func cleanRun(cmd *cobra.Command, args []string) {
 	spinner.Stop()
 	fmt.Println("\n🎉 所有表格清空操作完成！")
 }
+
+// 删除指定日期前按时间分集合的数据，集合时段需全部早于该日期
+func cleanCollectionsBefore() {
+	before, err := parseDate(cleanBefore)
+	if err != nil {
+		fmt.Printf("🚨 日期格式错误: %s，示例: 2024-11-01 或 \"2024-11-01 15:00\"\n", cleanBefore)
+		os.Exit(1)
+	}
+
+	datasets := retention.Datasets
+	if len(cleanDataset) > 0 {
+		datasets = make([]retention.Dataset, 0, len(cleanDataset))
+		for _, name := range cleanDataset {
+			d, ok := retention.Find(name)
+			if !ok {
+				fmt.Printf("🚨 数据集 %s 不按时间分集合，无法按日期清理\n", name)
+				os.Exit(1)
+			}
+			datasets = append(datasets, d)
+		}
+	}
+
+	fmt.Printf("🔄 正在删除 %s 之前的数据...\n", before.Format("2006-01-02 15:04"))
+	total := 0
+	for _, d := range datasets {
+		dropped, err := d.Drop(before)
+		for _, name := range dropped {
+			fmt.Printf("✅ 已删除 %s.%s\n", d.Database, name)
+		}
+		if err != nil {
+			fmt.Printf("❌ 清理 %s 失败: %v\n", d.Name, err)
+		}
+		total += len(dropped)
+	}
+	fmt.Printf("\n🎉 共删除 %d 个集合\n", total)
+}
+
+func parseDate(value string) (time.Time, error) {
+	var err error
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05"} {
+		var t time.Time
+		if t, err = time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/archive"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 归档导出
+// 将存储中已有的按时间分集合的数据按小时分区导出为 Parquet、CSV 或 JSONL 文件，
+// 与抓包进程的定时归档使用相同的路径与结构，已归档的分区只导出之后新增的文档
+
+var (
+	exportDataset     []string
+	exportFrom        string
+	exportTo          string
+	exportFormat      string
+	exportCompression string
+	exportOutput      string
+	exportForce       bool
+)
+
+var ExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export sessions to Parquet/CSV/JSONL archives",
+	Run:   exportRun,
+}
+
+func init() {
+	names := make([]string, 0, len(archive.Datasets))
+	for _, d := range archive.Datasets {
+		names = append(names, d.Name)
+	}
+	ExportCmd.Flags().StringSliceVar(&exportDataset, "dataset", []string{"streams"}, "Datasets to export: "+strings.Join(names, ","))
+	ExportCmd.Flags().StringVar(&exportFrom, "from", "", "Export hours from the date, e.g. 2024-11-01 or \"2024-11-01 15:00\"")
+	ExportCmd.Flags().StringVar(&exportTo, "to", "", "Export hours before the date, default now")
+	ExportCmd.Flags().StringVarP(&exportFormat, "format", "f", "", "Output format: parquet, csv, jsonl, default from config")
+	ExportCmd.Flags().StringVar(&exportCompression, "compression", "", "parquet: snappy, zstd, gzip, none; csv/jsonl: gzip, none")
+	ExportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Archive directory, default from config")
+	ExportCmd.Flags().BoolVar(&exportForce, "force", false, "Rewrite existing partitions into a single file")
+}
+
+func exportRun(cmd *cobra.Command, args []string) {
+	opts := archive.DefaultOptions()
+	if exportFormat != "" {
+		opts.Format, opts.Compression = exportFormat, ""
+	}
+	if exportCompression != "" {
+		opts.Compression = exportCompression
+	}
+	if exportOutput != "" {
+		opts.Path = exportOutput
+	}
+	opts.Force = exportForce
+	if err := opts.Validate(); err != nil {
+		fmt.Printf("🚨 %v\n", err)
+		os.Exit(1)
+	}
+
+	var from time.Time
+	to := time.Now()
+	var err error
+	if exportFrom != "" {
+		if from, err = parseDate(exportFrom); err != nil {
+			fmt.Printf("🚨 日期格式错误: %s，示例: 2024-11-01 或 \"2024-11-01 15:00\"\n", exportFrom)
+			os.Exit(1)
+		}
+	}
+	if exportTo != "" {
+		if to, err = parseDate(exportTo); err != nil {
+			fmt.Printf("🚨 日期格式错误: %s，示例: 2024-11-01 或 \"2024-11-01 15:00\"\n", exportTo)
+			os.Exit(1)
+		}
+	}
+
+	datasets := make([]archive.Dataset, 0, len(exportDataset))
+	for _, name := range exportDataset {
+		d, ok := archive.Find(name)
+		if !ok {
+			fmt.Printf("🚨 未知的数据集 %s\n", name)
+			os.Exit(1)
+		}
+		datasets = append(datasets, d)
+	}
+
+	// 连接存储
+	if err = storage.SetupClient(); err != nil {
+		fmt.Printf("🚨 存储连接失败: %v\n", err)
+		os.Exit(1)
+	}
+	defer storage.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var files, skipped int
+	var rows int64
+	for _, d := range datasets {
+		fmt.Printf("🔄 正在导出 %s...\n", d.Name)
+		err = d.Export(ctx, from, to, opts, func(r archive.Result) {
+			if r.Skipped {
+				skipped++
+				return
+			}
+			files++
+			rows += r.Rows
+			fmt.Printf("✅ %s %d 行 -> %s\n", r.Hour.Format("2006-01-02 15:00"), r.Rows, r.Path)
+		})
+		if err != nil {
+			fmt.Printf("❌ 导出 %s 失败: %v\n", d.Name, err)
+			break
+		}
+	}
+	fmt.Printf("\n🎉 共导出 %d 个文件 %d 行，跳过无新增文档的分区 %d 个\n", files, rows, skipped)
+	if err != nil {
+		os.Exit(1)
+	}
+}
@@ -58,6 +58,8 @@ func init() {
 	rootCmd.AddCommand(RestartCmd)
 	rootCmd.AddCommand(CleanCmd)
 	rootCmd.AddCommand(NicCmd)
+	rootCmd.AddCommand(SimulateCmd)
+	rootCmd.AddCommand(ExportCmd)
 }
 
 func rootRunFunc(c *cobra.Command, args []string) {
@@ -6,10 +6,16 @@ import (
 	"github.com/briandowns/spinner"
 	"github.com/dot-xiaoyuan/dpi-analyze/internal/analyze"
 	"github.com/dot-xiaoyuan/dpi-analyze/internal/socket/handler"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/alert"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/ants"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/archive"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture"
-	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
-	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/redis"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/baseline"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/record"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/resolve"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/state"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/exemption"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/i18n"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/policy"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/uaparser"
@@ -17,8 +23,12 @@ import (
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/components/features/brands"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/components/features/brands_keyword"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/components/features/brands_root"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/components/features/oui"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/export"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/retention"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/spill"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/users"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/utils"
 	v3 "github.com/robfig/cron/v3"
@@ -201,6 +211,22 @@ func handleGracefulExit() {
 	ants.Release()
 	zap.L().Info("Release goroutine pool")
 
+	// 结束进行中的录制
+	record.Close()
+
+	// IP 状态变更写回 redis
+	state.Close()
+
+	// 未写入的会话等记录落盘，下次启动重放
+	if err := spill.Close(); err != nil {
+		zap.L().Error("Failed to close spill queues", zap.Error(err))
+	}
+
+	// 关闭存储，保存内存 redis 快照
+	if err := storage.Close(); err != nil {
+		zap.L().Error("Failed to close storage", zap.Error(err))
+	}
+
 	// 刷新日志并退出
 	_ = zap.L().Sync()
 	time.Sleep(500 * time.Millisecond)
@@ -211,7 +237,7 @@ func handleGracefulExit() {
 // 加载所有组件并使用 Spinner 提示
 func loadComponents() {
 	var err error
-	if err = redis.Setup(); err != nil {
+	if err = storage.Setup(); err != nil {
 		os.Exit(1)
 	}
 
@@ -219,12 +245,6 @@ func loadComponents() {
 		os.Exit(1)
 	}
 
-	//if config.UseMongo {
-	if err = mongo.Setup(); err != nil {
-		os.Exit(1)
-	}
-	//}
-
 	if err = policy.Setup(); err != nil {
 		//os.Exit(1)
 	}
@@ -248,12 +268,60 @@ func loadComponents() {
 	if err = brands_root.Setup(); err != nil {
 		os.Exit(1)
 	}
+
+	if err = oui.Setup(); err != nil {
+		os.Exit(1)
+	}
+	// 设备实体库
+	if err = resolve.SetupIdentity(); err != nil {
+		os.Exit(1)
+	}
+
+	// 豁免名单
+	if err = exemption.Setup(); err != nil {
+		os.Exit(1)
+	}
+
+	// 代理处置状态
+	if err = users.SetupEnforcement(); err != nil {
+		os.Exit(1)
+	}
+
+	// 告警
+	alert.LookupUser = func(ip string) (string, int) {
+		user := users.FindUser(ip)
+		return user.UserName, user.ProductsID
+	}
+	if err = alert.Setup(); err != nil {
+		os.Exit(1)
+	}
+
+	// SIEM 导出
+	export.LookupUserName = users.FindUserName
+	if err = export.Setup(); err != nil {
+		zap.L().Error("Failed to setup export", zap.Error(err))
+		os.Exit(1)
+	}
+
+	// 用户行为基线
+	if err = baseline.Setup(); err != nil {
+		os.Exit(1)
+	}
+
+	// 定向录制
+	if err = record.Setup(); err != nil {
+		os.Exit(1)
+	}
 	// 注册unix路由
 	handler.InitHandlers()
 
 	// 在线用户同步组件
 	// 1.运行后先清除遗留数据
-	// 2.首次加载先全量加载一次，然后定时同步
+	// 2.首次加载先全量加载一次，然后定时对账
+	if err = users.SetupSources(); err != nil {
+		zap.L().Error("Failed to setup user sources", zap.Error(err))
+		os.Exit(1)
+	}
 	userSync := users.UserSync{}
 	userSync.CleanUp()
 	_ = ants.Submit(func() {
@@ -263,11 +331,51 @@ func loadComponents() {
 		}
 	})
 
-	_, err = cron.AddJob("@every 30m", userSync)
+	_, err = cron.AddJob("@every "+users.SyncInterval().String(), userSync)
 	if err != nil {
 		zap.L().Error("Failed to start user sync job", zap.Error(err))
 		os.Exit(1)
 	}
+	// redis 中断恢复后立即对账
+	go users.WatchRedis()
+
+	_, err = cron.AddFunc("@every "+baseline.Interval().String(), baseline.Update)
+	if err != nil {
+		zap.L().Error("Failed to start baseline job", zap.Error(err))
+		os.Exit(1)
+	}
+
+	// 过期数据清理
+	if !config.Cfg.Retention.Disable {
+		go retention.Prune()
+		_, err = cron.AddFunc("@every "+retention.Interval().String(), retention.Prune)
+		if err != nil {
+			zap.L().Error("Failed to start retention job", zap.Error(err))
+			os.Exit(1)
+		}
+	}
+
+	// 按小时归档
+	if config.Cfg.Archive.Enable {
+		if err = archive.Setup(); err != nil {
+			zap.L().Error("Failed to setup archive", zap.Error(err))
+			os.Exit(1)
+		}
+		go archive.Run()
+		_, err = cron.AddFunc("@every "+archive.Interval().String(), archive.Run)
+		if err != nil {
+			zap.L().Error("Failed to start archive job", zap.Error(err))
+			os.Exit(1)
+		}
+	}
+
+	// 授权到期检查
+	go alert.CheckLicense()
+	_, err = cron.AddFunc("@every 12h", alert.CheckLicense)
+	if err != nil {
+		zap.L().Error("Failed to start license check job", zap.Error(err))
+		os.Exit(1)
+	}
 	cron.Start()
 
 	go socket.StartServer()
@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/internal/analyze"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/ants"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/member"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/resolve"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/uaparser"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/components/features/application"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/components/features/brands"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/components/features/brands_keyword"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/components/features/brands_root"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/components/features/oui"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/simulate"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/users"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/utils"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 策略模拟
+// 以当前策略与候选策略分别回放抓包文件并对比判定结果，两次回放在独立子进程中进行，
+// 使用内存 redis 且不写入 mongo、不下发处置
+
+var (
+	simPcaps    []string
+	simPolicy   string
+	simBaseline string
+	simUsers    string
+	simIPNet    []string
+	simProduct  int
+	simBPF      string
+	simOutput   string
+	simWorker   bool
+)
+
+var SimulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Replay captures against candidate policy",
+	Run:   simulateRun,
+}
+
+func init() {
+	SimulateCmd.Flags().StringSliceVar(&simPcaps, "pcap", nil, "pcap files to replay")
+	SimulateCmd.Flags().StringVar(&simPolicy, "policy", "", "candidate policy json file")
+	SimulateCmd.Flags().StringVar(&simBaseline, "baseline", "", "baseline policy json file, default current policy")
+	SimulateCmd.Flags().StringVar(&simUsers, "users", "", "user list csv (ip,user_name,products_id[,user_mac])")
+	SimulateCmd.Flags().StringSliceVar(&simIPNet, "ipnet", nil, "user subnets, e.g. 10.0.0.0/8")
+	SimulateCmd.Flags().IntVar(&simProduct, "product", 0, "products id for ips not in user list")
+	SimulateCmd.Flags().StringVar(&simBPF, "bpf", "", "Berkeley packet filter")
+	SimulateCmd.Flags().StringVarP(&simOutput, "output", "o", "", "write report json to file")
+	SimulateCmd.Flags().BoolVar(&simWorker, "worker", false, "replay with the given policy only")
+	_ = SimulateCmd.Flags().MarkHidden("worker")
+	_ = SimulateCmd.MarkFlagRequired("pcap")
+}
+
+func simulateRun(cmd *cobra.Command, args []string) {
+	if simWorker {
+		if err := simulateWorker(); err != nil {
+			fmt.Printf("🚨 回放失败: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	report, err := simulateCompare()
+	if err != nil {
+		fmt.Printf("🚨 模拟失败: %v\n", err)
+		os.Exit(1)
+	}
+	if simOutput != "" {
+		if err = simulate.WriteJSON(simOutput, report); err != nil {
+			fmt.Printf("🚨 写入报告失败: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	printReport(report)
+}
+
+// 父进程：准备两组策略，分别启动子进程回放并对比
+func simulateCompare() (simulate.Report, error) {
+	report := simulate.Report{Files: simPcaps, StartTime: time.Now()}
+
+	var (
+		current simulate.Candidate
+		err     error
+	)
+	if simBaseline != "" {
+		current, err = simulate.ReadCandidate(simBaseline)
+	} else {
+		if err = storage.SetupClient(); err != nil {
+			return report, err
+		}
+		current, err = simulate.Current()
+	}
+	if err != nil {
+		return report, fmt.Errorf("load current policy: %w", err)
+	}
+	candidate := current
+	if simPolicy != "" {
+		c, err := simulate.ReadCandidate(simPolicy)
+		if err != nil {
+			return report, fmt.Errorf("load candidate policy: %w", err)
+		}
+		candidate = c.Merge(current)
+	}
+
+	dir, err := os.MkdirTemp("", "dpi-simulate-")
+	if err != nil {
+		return report, err
+	}
+	defer os.RemoveAll(dir)
+
+	results := make([]simulate.Result, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i, c := range []simulate.Candidate{current, candidate} {
+		wg.Add(1)
+		go func(i int, c simulate.Candidate) {
+			defer wg.Done()
+			results[i], errs[i] = runWorker(dir, strconv.Itoa(i), c)
+		}(i, c)
+	}
+	wg.Wait()
+	if err = errors.Join(errs...); err != nil {
+		return report, err
+	}
+
+	report.Current, report.Candidate = results[0], results[1]
+	report.Proxy, report.Suspected = simulate.Compare(report.Current, report.Candidate)
+	report.EndTime = time.Now()
+	return report, nil
+}
+
+// 启动子进程以指定策略回放
+func runWorker(dir, name string, c simulate.Candidate) (simulate.Result, error) {
+	policyFile := filepath.Join(dir, name+"-policy.json")
+	resultFile := filepath.Join(dir, name+"-result.json")
+	if err := simulate.WriteJSON(policyFile, c); err != nil {
+		return simulate.Result{}, err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return simulate.Result{}, err
+	}
+	args := []string{"simulate", "--worker", "--policy", policyFile, "--output", resultFile}
+	for _, pcap := range simPcaps {
+		args = append(args, "--pcap", pcap)
+	}
+	for _, ipNet := range simIPNet {
+		args = append(args, "--ipnet", ipNet)
+	}
+	if simUsers != "" {
+		args = append(args, "--users", simUsers)
+	}
+	if simProduct != 0 {
+		args = append(args, "--product", strconv.Itoa(simProduct))
+	}
+	if simBPF != "" {
+		args = append(args, "--bpf", simBPF)
+	}
+	out, err := exec.Command(exe, args...).CombinedOutput()
+	if err != nil {
+		return simulate.Result{}, fmt.Errorf("worker %s: %w: %s", name, err, out)
+	}
+	return simulate.ReadResult(resultFile)
+}
+
+// 子进程：载入策略并回放
+func simulateWorker() error {
+	if err := storage.SetupOffline(); err != nil {
+		return err
+	}
+	if err := ants.Setup(10); err != nil {
+		return err
+	}
+
+	candidate, err := simulate.ReadCandidate(simPolicy)
+	if err != nil {
+		return err
+	}
+	candidate.Apply()
+
+	// 特征库缺失时仅影响设备识别，不影响回放
+	for _, setup := range []func() error{
+		uaparser.Setup,
+		application.Setup,
+		brands.Setup,
+		brands_keyword.Setup,
+		brands_root.Setup,
+		oui.Setup,
+		resolve.SetupIdentity,
+		users.SetupEnforcement,
+	} {
+		if err = setup(); err != nil {
+			zap.L().Warn("Simulate component setup failed", zap.Error(err))
+		}
+	}
+
+	config.UseUA = config.Cfg.UseUA
+	config.UseTTL = config.Cfg.UseTTL
+	config.UseFeature = config.Cfg.UseFeature
+	config.IgnoreMissing = config.Cfg.IgnoreMissing
+	for _, cidr := range simIPNet {
+		_, ipNet, err := utils.GetSubnetInfo(cidr)
+		if err != nil {
+			return err
+		}
+		config.IPNet = append(config.IPNet, ipNet)
+	}
+	// 未指定网段时仅分析名单内用户
+	config.FollowOnlyOnlineUsers = len(config.IPNet) == 0
+
+	var list []types.User
+	if simUsers != "" {
+		if list, err = simulate.ReadUsers(simUsers); err != nil {
+			return err
+		}
+	}
+	users.SetupSimulation(list, simProduct)
+
+	var (
+		mu     sync.Mutex
+		result = simulate.Result{Proxy: []types.ProxyRecord{}, Suspected: []types.SuspectedRecord{}}
+	)
+	resolve.ProxyRecorder = func(record types.ProxyRecord) {
+		mu.Lock()
+		defer mu.Unlock()
+		result.Proxy = append(result.Proxy, record)
+	}
+	member.SuspectedRecorder = func(record types.SuspectedRecord) {
+		if record.Username == "" {
+			record.Username = users.FindUserName(record.IP)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		result.Suspected = append(result.Suspected, record)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assembly := analyze.NewAnalyzer()
+	if err = capture.Replay(ctx, simPcaps, simBPF, assembly); err != nil {
+		return err
+	}
+	assembly.Assembler.FlushAll()
+	assembly.Factory.WaitGoRoutines()
+	ants.Wait(10 * time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+	result.Packets = capture.PacketsCount
+	return simulate.WriteJSON(simOutput, result)
+}
+
+func printReport(report simulate.Report) {
+	fmt.Printf("回放文件: %v\n", report.Files)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"类型", "当前策略", "候选策略", "新增", "移除"})
+	table.Append([]string{"代理", strconv.Itoa(len(report.Current.Proxy)), strconv.Itoa(len(report.Candidate.Proxy)),
+		fmt.Sprint(report.Proxy.Added), fmt.Sprint(report.Proxy.Removed)})
+	table.Append([]string{"疑似", strconv.Itoa(len(report.Current.Suspected)), strconv.Itoa(len(report.Candidate.Suspected)),
+		fmt.Sprint(report.Suspected.Added), fmt.Sprint(report.Suspected.Removed)})
+	table.Render()
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/member"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/resolve"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/exemption"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/i18n"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/components/features"
@@ -63,7 +64,14 @@ func NewAnalyzer() *Analyze {
 }
 
 func (a *Analyze) HandlePacket(packet gopacket.Packet) {
-	if packet.NetworkLayer() == nil || packet.TransportLayer() == nil {
+	if packet.NetworkLayer() == nil {
+		return
+	}
+	// NDP 报文无传输层，用于关联 IPv6 地址与设备
+	if packet.TransportLayer() == nil {
+		if ipv6, ok := packet.NetworkLayer().(*layers.IPv6); ok && packet.Layer(layers.LayerTypeICMPv6) != nil {
+			_ = ants.Submit(func() { handleNDP(packet, ipv6.SrcIP) })
+		}
 		return
 	}
 	// 累加总流量
@@ -109,12 +117,25 @@ func (a *Analyze) HandlePacket(packet gopacket.Packet) {
 		srcPort, dstPort = "", ""
 	}
 
-	// user_ip 转储缓存
-	var userIP, tranIP, userMac string
-	if users.ExitsUser(ip) {
-		userIP, tranIP, userMac = ip, dip, ethernet.SrcMac
-	} else if users.ExitsUser(dip) {
-		userIP, tranIP, userMac = dip, ip, ethernet.DstMac
+	// RADIUS 计费报文来自 NAS，不属于在线用户流量，在用户过滤前处理
+	if udpLayer := packet.Layer(layers.LayerTypeUDP); udpLayer != nil {
+		if users.HandleRadius(dstPort, udpLayer.(*layers.UDP).Payload) {
+			return
+		}
+		// DHCPv6 应答由服务器发出，在用户过滤前处理
+		if dhcpLayer := packet.Layer(layers.LayerTypeDHCPv6); dhcpLayer != nil {
+			dhcp, mac := dhcpLayer.(*layers.DHCPv6), ethernet.DstMac
+			_ = ants.Submit(func() { handleDHCPv6(dhcp, mac) })
+		}
+	}
+
+	// user_ip 转储缓存，userIP 为用户标识，IPv6 地址按前缀归属到用户
+	var userIP, userAddr, tranIP, userMac string
+	var upstream bool
+	if key, ok := users.ResolveUser(ip); ok {
+		userIP, userAddr, tranIP, userMac, upstream = key, ip, dip, ethernet.SrcMac, true
+	} else if key, ok = users.ResolveUser(dip); ok {
+		userIP, userAddr, tranIP, userMac = key, dip, ip, ethernet.DstMac
 	}
 	// 仅关注在线用户 如果在线用户中不存在该IP跳过该数据包
 	if config.FollowOnlyOnlineUsers {
@@ -123,11 +144,18 @@ func (a *Analyze) HandlePacket(packet gopacket.Packet) {
 		}
 	} else {
 		if len(config.IPNet) > 0 && utils.IsIPInRange(srcIPNet) {
-			userIP, tranIP, userMac = ip, dip, ethernet.SrcMac
+			// 未归属用户的 IPv6 地址以设备状态键聚合，隐私地址轮换后状态不丢失
+			userIP, userAddr, tranIP, userMac, upstream = resolve.CanonicalIPv6(ip), ip, dip, ethernet.SrcMac, true
 		} else {
 			return
 		}
 	}
+	// 豁免的用户网段、MAC、目的地址不做检测
+	if exemption.MatchIP(userIP) || (userAddr != userIP && exemption.MatchIP(userAddr)) ||
+		exemption.MatchMac(userMac) || exemption.MatchDestination(tranIP) {
+		exemption.Skip(exemption.PointPacket)
+		return
+	}
 	// mDNS
 	if udpLayer := packet.Layer(layers.LayerTypeUDP); udpLayer != nil {
 		if (srcPort == "5353" || dstPort == "5353") &&
@@ -160,7 +188,20 @@ func (a *Analyze) HandlePacket(packet gopacket.Packet) {
 								Field: types.Mac,
 								Value: device.MAC,
 							})
+							resolve.AnalyzeByMac(userIP, device.MAC)
 						}
+						// 设备实体
+						resolve.ObserveDevice(types.DeviceObservation{
+							IP:          userIP,
+							Mac:         device.MAC,
+							Source:      types.MDNSProperty,
+							OriginValue: device.Name,
+							Attributes: map[string]string{
+								types.AttrName:  device.Name,
+								types.AttrType:  device.Type,
+								types.AttrClass: string(resolve.ClassifyText(device.Services, device.Type, device.Name)),
+							},
+						})
 					})
 				}
 			}
@@ -190,7 +231,7 @@ func (a *Analyze) HandlePacket(packet gopacket.Packet) {
 	}
 	trafficMap.Update(transmission)
 
-	if config.UseTTL && userIP == ip {
+	if config.UseTTL && upstream {
 		_ = ants.Submit(func() { // 插入 IP hash TTL表
 			member.Store(member.Hash{
 				IP:    userIP,
@@ -200,21 +241,25 @@ func (a *Analyze) HandlePacket(packet gopacket.Packet) {
 			// 如果TTL = 127，则记录设备为win
 			if internet.TTL >= 126 && internet.TTL <= 128 {
 				// 判断缓存中是否有
-				if !member.GetAnalyze(ip) {
+				if !member.GetAnalyze(userIP) {
 					resolve.AnalyzeByTTL(userIP, internet.TTL)
-					member.PutAnalyze(ip)
+					member.PutAnalyze(userIP)
 				}
 			}
 		})
 	}
 
-	if len(userMac) > 0 && userIP == ip {
+	if len(userMac) > 0 && upstream {
 		_ = ants.Submit(func() { // 插入 IP hash Mac表
 			member.Store(member.Hash{
 				IP:    userIP,
 				Field: types.Mac,
 				Value: userMac,
 			})
+			resolve.AnalyzeByMac(userIP, userMac)
+			if srcIPNet.To4() == nil {
+				resolve.LinkIPv6(userAddr, userMac, nil, types.LinkSrcMac)
+			}
 		})
 	}
 
@@ -231,11 +276,11 @@ func (a *Analyze) HandlePacket(packet gopacket.Packet) {
 		udp := udpLayer.(*layers.UDP)
 
 		layerType := CheckUDP(userIP, tranIP, udp)
-		// dhcp协议日志输出
-		//if layerType == layers.LayerTypeDHCPv4 {
-		//	dhcp := packet.Layer(layers.LayerTypeDHCPv4).(*layers.DHCPv4)
-		//	zap.L().Debug("dhcp", zap.Any("layer", dhcp))
-		//}
+		// dhcp 客户端标识用于设备关联
+		if dhcpLayer := packet.Layer(layers.LayerTypeDHCPv4); dhcpLayer != nil {
+			dhcp := dhcpLayer.(*layers.DHCPv4)
+			_ = ants.Submit(func() { handleDHCP(userIP, dhcp) })
+		}
 		if layerType == layers.LayerTypeDNS {
 			dnsLayer := packet.Layer(layers.LayerTypeDNS)
 			if dnsLayer != nil {
@@ -0,0 +1,70 @@
+package analyze
+
+import (
+	"encoding/hex"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/resolve"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/google/gopacket/layers"
+	"strings"
+)
+
+// DHCP 设备观测
+// client identifier(61) 作为强关联键，hostname(12) 作为设备名，vendor class(60) 推断操作系统
+
+func handleDHCP(userIP string, dhcp *layers.DHCPv4) {
+	ip := userIP
+	if ip == "" {
+		// 未关联到在线用户时，使用分配或请求的地址
+		switch {
+		case !dhcp.YourClientIP.IsUnspecified():
+			ip = dhcp.YourClientIP.String()
+		case !dhcp.ClientIP.IsUnspecified():
+			ip = dhcp.ClientIP.String()
+		}
+	}
+	if ip == "" {
+		return
+	}
+
+	obs := types.DeviceObservation{
+		IP:         ip,
+		Mac:        dhcp.ClientHWAddr.String(),
+		Source:     types.DHCPProperty,
+		Attributes: make(map[string]string),
+	}
+	for _, opt := range dhcp.Options {
+		switch opt.Type {
+		case layers.DHCPOptClientID:
+			if len(opt.Data) > 0 {
+				obs.Keys = append(obs.Keys, types.KeyDHCPClient+hex.EncodeToString(opt.Data))
+			}
+		case layers.DHCPOptHostname:
+			obs.Attributes[types.AttrName] = string(opt.Data)
+		case layers.DHCPOptClassID:
+			obs.OriginValue = string(opt.Data)
+			obs.Attributes[types.AttrOs] = osByVendorClass(obs.OriginValue)
+		}
+	}
+	if len(obs.Keys) == 0 && len(obs.Attributes) == 0 {
+		return
+	}
+	if class := resolve.ClassifyText(obs.Attributes[types.AttrName], obs.OriginValue); class != types.ClassUnknown {
+		obs.Attributes[types.AttrClass] = string(class)
+	}
+	resolve.ObserveDevice(obs)
+}
+
+// 根据 vendor class 推断操作系统
+func osByVendorClass(vendor string) string {
+	v := strings.ToLower(vendor)
+	switch {
+	case strings.HasPrefix(v, "msft"):
+		return "Windows"
+	case strings.HasPrefix(v, "android-dhcp"):
+		return "Android"
+	case strings.HasPrefix(v, "dhcpcd"):
+		return "Linux"
+	default:
+		return ""
+	}
+}
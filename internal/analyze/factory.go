@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/member"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/resolve"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/protocols"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/users"
@@ -27,13 +28,13 @@ func (f *Factory) New(netFlow, tcpFlow gopacket.Flow, tcp *layers.TCP, ac reasse
 	// 会话数累加
 	capture.SessionCount++
 
-	// 根据在线用户进行缓存
+	// 根据在线用户进行缓存，userIP 为用户标识
 	srcIP, dstIP := netFlow.Src().String(), netFlow.Dst().String()
 	var userIP, tranIP string
-	if users.ExitsUser(srcIP) {
-		userIP, tranIP = srcIP, dstIP
-	} else if users.ExitsUser(dstIP) {
-		userIP, tranIP = dstIP, srcIP
+	if key, ok := users.ResolveUser(srcIP); ok {
+		userIP, tranIP = key, dstIP
+	} else if key, ok = users.ResolveUser(dstIP); ok {
+		userIP, tranIP = key, srcIP
 	}
 	member.Increment(types.Feature{ // 会话数
 		IP:    userIP,
@@ -52,6 +53,7 @@ func (f *Factory) New(netFlow, tcpFlow gopacket.Flow, tcp *layers.TCP, ac reasse
 		OptChecker:   reassembly.NewTCPOptionCheck(),
 		SrcIP:        srcIP,
 		DstIP:        dstIP,
+		UserIP:       clientKey(srcIP),
 		ProtocolFlags: types.ProtocolFlags{
 			TCP: types.TCPFlags{
 				SYN: tcp.SYN,
@@ -115,3 +117,11 @@ func (f *Factory) WaitGoRoutines() {
 	//time.Sleep(time.Second * 3)
 	f.wg.Wait()
 }
+
+// 客户端地址所属用户标识，不属于在线用户时使用设备状态键或原地址
+func clientKey(ip string) string {
+	if key, ok := users.ResolveUser(ip); ok {
+		return key
+	}
+	return resolve.CanonicalIPv6(ip)
+}
@@ -0,0 +1,105 @@
+package analyze
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/resolve"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/users"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"net"
+)
+
+// IPv6 地址关联观测
+// NDP 报文携带发送方或目标的链路层地址，DHCPv6 应答携带客户端 DUID 与分配的地址
+
+const (
+	iaNAHeader = 12 // IAID(4) + T1(4) + T2(4)
+	iaTAHeader = 4  // IAID(4)
+	iaAddrLen  = 24 // 地址(16) + preferred(4) + valid(4)
+)
+
+// NS/NA/RS 中的链路层地址选项
+func handleNDP(packet gopacket.Packet, src net.IP) {
+	var target net.IP
+	var options layers.ICMPv6Options
+	var want layers.ICMPv6Opt
+	switch {
+	case packet.Layer(layers.LayerTypeICMPv6NeighborSolicitation) != nil:
+		ns := packet.Layer(layers.LayerTypeICMPv6NeighborSolicitation).(*layers.ICMPv6NeighborSolicitation)
+		// 重复地址检测的源地址为未指定地址，由 LinkIPv6 过滤
+		target, options, want = src, ns.Options, layers.ICMPv6OptSourceAddress
+	case packet.Layer(layers.LayerTypeICMPv6NeighborAdvertisement) != nil:
+		na := packet.Layer(layers.LayerTypeICMPv6NeighborAdvertisement).(*layers.ICMPv6NeighborAdvertisement)
+		target, options, want = na.TargetAddress, na.Options, layers.ICMPv6OptTargetAddress
+	case packet.Layer(layers.LayerTypeICMPv6RouterSolicitation) != nil:
+		rs := packet.Layer(layers.LayerTypeICMPv6RouterSolicitation).(*layers.ICMPv6RouterSolicitation)
+		target, options, want = src, rs.Options, layers.ICMPv6OptSourceAddress
+	default:
+		return
+	}
+	for _, opt := range options {
+		if opt.Type == want && len(opt.Data) == 6 {
+			resolve.LinkIPv6(target.String(), net.HardwareAddr(opt.Data).String(), nil, types.LinkNDP)
+			return
+		}
+	}
+}
+
+// DHCPv6 应答中的 DUID 与 IA_NA/IA_TA 地址
+func handleDHCPv6(dhcp *layers.DHCPv6, mac string) {
+	if dhcp.MsgType != layers.DHCPv6MsgTypeReply {
+		return
+	}
+	var duid []byte
+	var addrs []net.IP
+	for _, opt := range dhcp.Options {
+		switch opt.Code {
+		case layers.DHCPv6OptClientID:
+			duid = opt.Data
+		case layers.DHCPv6OptIANA:
+			addrs = append(addrs, iaAddresses(opt.Data, iaNAHeader)...)
+		case layers.DHCPv6OptIATA:
+			addrs = append(addrs, iaAddresses(opt.Data, iaTAHeader)...)
+		}
+	}
+	if len(duid) == 0 || len(addrs) == 0 {
+		return
+	}
+	// 应答由服务器发往客户端，目的MAC为客户端
+	for _, addr := range addrs {
+		resolve.LinkIPv6(addr.String(), mac, duid, types.LinkDHCPv6)
+		ip := resolve.CanonicalIPv6(addr.String())
+		if key, ok := users.ResolveUser(addr.String()); ok {
+			ip = key
+		}
+		resolve.ObserveDevice(types.DeviceObservation{
+			IP:     ip,
+			Mac:    mac,
+			Source: types.DHCPProperty,
+			Keys:   []string{types.KeyDUID + hex.EncodeToString(duid)},
+		})
+	}
+}
+
+// 解析 IA 选项中嵌套的 IAADDR 选项
+func iaAddresses(data []byte, header int) []net.IP {
+	if len(data) < header {
+		return nil
+	}
+	var addrs []net.IP
+	data = data[header:]
+	for len(data) >= 4 {
+		code := layers.DHCPv6Opt(binary.BigEndian.Uint16(data[0:2]))
+		length := int(binary.BigEndian.Uint16(data[2:4]))
+		if len(data) < 4+length {
+			break
+		}
+		if code == layers.DHCPv6OptIAAddr && length >= iaAddrLen {
+			addrs = append(addrs, net.IP(data[4:20]))
+		}
+		data = data[4+length:]
+	}
+	return addrs
+}
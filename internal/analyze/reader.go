@@ -3,6 +3,7 @@ package analyze
 import (
 	"bufio"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/ants"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/bus"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/member"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/resolve"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
@@ -135,11 +136,8 @@ func (sr *StreamReader) saveSessionData() {
 		ApplicationProtocol: sr.Parent.ApplicationProtocol,
 		Metadata:            sr.Parent.Metadata,
 	}
-	select {
-	case sessions.SessionQueue <- sessionData:
-	default:
-
-	}
+	bus.SessionClosed.Publish(sessionData)
+	sessions.SessionQueue.Push(sessionData)
 	sr.Parent.Wg.Done()
 }
 
@@ -162,15 +160,15 @@ func (sr *StreamReader) SetTlsInfo(sni, version, cipherSuite string) {
 		sr.Parent.Metadata.TlsInfo.Sni = sni
 		_ = ants.Submit(func() { // 统计SNI
 			member.Increment(types.Feature{ // SNI
-				IP:    sr.Parent.SrcIP,
+				IP:    sr.Parent.UserIP,
 				Field: types.SNI,
 				Value: utils.FormatDomain(sni),
 			})
 		})
 		// 开始品牌匹配
-		if ok, domain := features.HandleFeatureMatch(sni, sr.Parent.SrcIP, types.DeviceRecord{}); ok {
+		if ok, domain := features.HandleFeatureMatch(sni, sr.Parent.UserIP, types.DeviceRecord{}); ok {
 			resolve.Handle(types.DeviceRecord{
-				IP:           sr.Parent.SrcIP,
+				IP:           sr.Parent.UserIP,
 				OriginChanel: types.Device,
 				OriginValue:  sni,
 				Os:           "",
@@ -199,7 +197,7 @@ func (sr *StreamReader) SetTlsInfo(sni, version, cipherSuite string) {
 		sr.Parent.Metadata.TlsInfo.Version = version
 		_ = ants.Submit(func() {
 			member.Increment(types.Feature{ // TLS version
-				IP:    sr.Parent.SrcIP,
+				IP:    sr.Parent.UserIP,
 				Field: types.TLSVersion,
 				Value: version,
 			})
@@ -209,7 +207,7 @@ func (sr *StreamReader) SetTlsInfo(sni, version, cipherSuite string) {
 		sr.Parent.Metadata.TlsInfo.CipherSuite = cipherSuite
 		_ = ants.Submit(func() {
 			member.Increment(types.Feature{ // 加密套件
-				IP:    sr.Parent.SrcIP,
+				IP:    sr.Parent.UserIP,
 				Field: types.CipherSuite,
 				Value: cipherSuite,
 			})
@@ -248,10 +246,10 @@ func (sr *StreamReader) SetHttpInfo(host, userAgent, contentType, upgrade string
 	if config.UseUA && len(userAgent) > 0 && !sr.isUaSaved {
 		sr.isUaSaved = true
 		_ = ants.Submit(func() {
-			uaStr := resolve.AnalyzeByUserAgent(sr.Parent.SrcIP, userAgent, host)
+			uaStr := resolve.AnalyzeByUserAgent(sr.Parent.UserIP, userAgent, host)
 			if len(uaStr) > 0 {
 				member.Store(member.Hash{
-					IP:    sr.Parent.SrcIP,
+					IP:    sr.Parent.UserIP,
 					Field: types.UserAgent,
 					Value: uaStr,
 				})
@@ -262,7 +260,7 @@ func (sr *StreamReader) SetHttpInfo(host, userAgent, contentType, upgrade string
 	if host != "" && host != "<no-request-seen>" && !strings.HasPrefix(host, "/") {
 		_ = ants.Submit(func() { // 统计 http
 			member.Increment(types.Feature{ // HTTP
-				IP:    sr.Parent.SrcIP,
+				IP:    sr.Parent.UserIP,
 				Field: types.HTTP,
 				Value: utils.FormatDomain(host),
 			})
@@ -29,6 +29,7 @@ type Stream struct {
 	Metadata            types.Metadata
 	SrcIP               string                 `bson:"src_ip"`
 	DstIP               string                 `bson:"dst_ip"`
+	UserIP              string                 `bson:"user_ip"`    // 客户端所属用户标识，特征与设备状态以此为键
 	RejectFSM           int                    `bson:"reject_fsm"` // FSM (Finite State Machine)有限状态机
 	RejectConnFsm       int                    `bson:"reject_conn_fsm"`
 	RejectOpt           int                    `bson:"reject_opt"`
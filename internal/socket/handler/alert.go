@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/alert"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket/models"
+	"net/http"
+)
+
+// 告警
+
+func AlertList(raw json.RawMessage) any {
+	return map[string]any{
+		"list":     alert.History(),
+		"stats":    alert.GetStats(),
+		"channels": alert.Channels(),
+	}
+}
+
+func AlertTest(raw json.RawMessage) any {
+	var params struct {
+		Channel string `json:"channel"`
+	}
+	res := &models.Response{
+		Code: http.StatusBadRequest,
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	if err := alert.Test(params.Channel); err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	res.Code = http.StatusOK
+	res.Message = "send successful!"
+	return res
+}
+
+func AlertSilenceList(raw json.RawMessage) any {
+	return alert.Silences()
+}
+
+func AlertSilenceAdd(raw json.RawMessage) any {
+	var params types.AlertSilence
+	res := &models.Response{
+		Code: http.StatusBadRequest,
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	s, err := alert.AddSilence(params)
+	if err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	res.Code = http.StatusOK
+	res.Data = s
+	return res
+}
+
+func AlertSilenceDelete(raw json.RawMessage) any {
+	var params struct {
+		ID string `json:"id"`
+	}
+	res := &models.Response{
+		Code: http.StatusBadRequest,
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	if err := alert.DeleteSilence(params.ID); err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	res.Code = http.StatusOK
+	res.Message = "delete successful!"
+	return res
+}
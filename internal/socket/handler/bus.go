@@ -0,0 +1,16 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/bus"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/export"
+)
+
+// 内部事件总线
+
+func BusStats(raw json.RawMessage) any {
+	return map[string]any{
+		"topics": bus.GetStats(),
+		"export": export.GetStats(),
+	}
+}
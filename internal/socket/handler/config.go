@@ -2,7 +2,7 @@ package handler
 
 import (
 	"encoding/json"
-	mongodb "github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
 	"go.uber.org/zap"
 )
@@ -17,14 +17,14 @@ func ConfigUpdate(raw json.RawMessage) any {
 		return err
 	}
 
-	err = mongodb.UpdateNestedConfig(config.Cfg, updates)
+	err = storage.UpdateNestedConfig(config.Cfg, updates)
 	if err != nil {
 		zap.L().Error("config update error", zap.Error(err))
 		return err
 	}
 
 	zap.L().Info("config update done", zap.Any("config", config.Cfg))
-	err = mongodb.Store2Mongo()
+	err = storage.StoreConfig()
 	if err != nil {
 		zap.L().Error("config update error", zap.Error(err))
 		return err
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket/models"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/users"
+	"net/http"
+)
+
+// 代理处置
+
+type EnforcementRequest struct {
+	UserName string `json:"user_name"`
+	Remark   string `json:"remark"`
+}
+
+func EnforcementList(raw json.RawMessage) any {
+	return users.ListEnforcement()
+}
+
+func EnforcementDetail(raw json.RawMessage) any {
+	var req EnforcementRequest
+	res := &models.Response{
+		Code: http.StatusBadRequest,
+	}
+	if err := json.Unmarshal(raw, &req); err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	state, err := users.GetEnforcement(req.UserName)
+	if err != nil {
+		res.Code = http.StatusNotFound
+		res.Message = err.Error()
+		return res
+	}
+	res.Code = http.StatusOK
+	res.Data = state
+	return res
+}
+
+func EnforcementReset(raw json.RawMessage) any {
+	var req EnforcementRequest
+	res := &models.Response{
+		Code: http.StatusBadRequest,
+	}
+	if err := json.Unmarshal(raw, &req); err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	if err := users.ResetEnforcement(req.UserName, req.Remark); err != nil {
+		res.Code = http.StatusNotFound
+		res.Message = err.Error()
+		return res
+	}
+	res.Code = http.StatusOK
+	res.Message = "reset successful!"
+	return res
+}
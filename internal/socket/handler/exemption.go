@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/exemption"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket/models"
+	"net/http"
+)
+
+// 豁免名单
+
+func ExemptionList(raw json.RawMessage) any {
+	return map[string]any{
+		"list":    exemption.List(),
+		"skipped": exemption.Skipped(),
+	}
+}
+
+func ExemptionAdd(raw json.RawMessage) any {
+	var params types.Exemption
+	res := &models.Response{
+		Code: http.StatusBadRequest,
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	e, err := exemption.Add(params)
+	if err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	res.Code = http.StatusOK
+	res.Data = e
+	return res
+}
+
+func ExemptionDelete(raw json.RawMessage) any {
+	var params struct {
+		ID string `json:"id"`
+	}
+	res := &models.Response{
+		Code: http.StatusBadRequest,
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	if err := exemption.Delete(params.ID); err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	res.Code = http.StatusOK
+	res.Message = "delete successful!"
+	return res
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/components/features/brands"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/components/features/brands_keyword"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/components/features/brands_root"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/components/features/oui"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/loader"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket/models"
 	"net/http"
@@ -50,6 +51,13 @@ func FeatureLibrary(raw json.RawMessage) any {
 			Module:  "brands_root",
 			History: brands_root.Manager.Loader.History(),
 		},
+		{
+			Name:    "MAC厂商特征",
+			Count:   len(oui.Vendors),
+			Version: oui.LoaderManger.Version(),
+			Module:  "oui",
+			History: oui.LoaderManger.History(),
+		},
 	}
 
 	return res
@@ -87,6 +95,9 @@ func FeatureUpdate(raw json.RawMessage) any {
 	case "brands_root":
 		err = brands_root.Manager.Update(req.Filepath)
 		break
+	case "oui":
+		err = oui.Update(req.Filepath)
+		break
 	default:
 		err = errors.New("invalid module")
 		break
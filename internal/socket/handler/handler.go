@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket"
 	"go.uber.org/zap"
 )
@@ -16,5 +17,29 @@ func InitHandlers() {
 	socket.RegisterHandler(socket.ConfigList, ConfigList)
 	socket.RegisterHandler(socket.FeatureLibrary, FeatureLibrary)
 	socket.RegisterHandler(socket.FeatureUpdate, FeatureUpdate)
+	socket.RegisterHandler(socket.EnforcementList, EnforcementList)
+	socket.RegisterHandler(socket.EnforcementDetail, EnforcementDetail)
+	socket.RegisterHandler(socket.EnforcementReset, EnforcementReset)
+	socket.RegisterHandler(socket.ExemptionList, ExemptionList)
+	socket.RegisterHandler(socket.ExemptionAdd, ExemptionAdd)
+	socket.RegisterHandler(socket.ExemptionDelete, ExemptionDelete)
+	socket.RegisterHandler(socket.ObserverHistory, ObserverHistory)
+	socket.RegisterHandler(socket.AlertList, AlertList)
+	socket.RegisterHandler(socket.AlertTest, AlertTest)
+	socket.RegisterHandler(socket.AlertSilenceList, AlertSilenceList)
+	socket.RegisterHandler(socket.AlertSilenceAdd, AlertSilenceAdd)
+	socket.RegisterHandler(socket.AlertSilenceDelete, AlertSilenceDelete)
+	socket.RegisterHandler(socket.BusStats, BusStats)
+	socket.RegisterHandler(socket.UserReconcileStats, UserReconcileStats)
+	socket.RegisterHandler(socket.UserReconcile, UserReconcile)
+	socket.RegisterHandler(socket.Storage, storage.HandleRemote)
+	socket.RegisterHandler(socket.SpillStats, SpillStats)
+	socket.RegisterHandler(socket.StateStats, StateStats)
+	socket.RegisterHandler(socket.RecordList, RecordList)
+	socket.RegisterHandler(socket.RecordStart, RecordStart)
+	socket.RegisterHandler(socket.RecordStop, RecordStop)
+	socket.RegisterHandler(socket.RecordDetail, RecordDetail)
+	socket.RegisterHandler(socket.RecordFile, RecordFile)
+	socket.RegisterHandler(socket.RecordDelete, RecordDelete)
 	zap.L().Info("Unix socket handler initialized")
 }
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/member"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/observer"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/resolve"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket/models"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/users"
 	"go.uber.org/zap"
 )
 
@@ -13,6 +15,12 @@ func IPDetail(raw json.RawMessage) any {
 
 	var ip string
 	_ = json.Unmarshal(raw, &ip)
+	// 临时地址查询其设备或用户的状态
+	if key, ok := users.ResolveUser(ip); ok {
+		ip = key
+	} else {
+		ip = resolve.CanonicalIPv6(ip)
+	}
 
 	res := models.IPDetail{
 		Detail: member.GetHashForRedis(ip),
@@ -21,6 +29,7 @@ func IPDetail(raw json.RawMessage) any {
 			Mac: observer.MacObserver.GetHistory(ip),
 			Ua:  observer.UaObserver.GetHistory(ip),
 		},
+		IPv6: resolve.GetIPv6Links(ip),
 	}
 
 	return res
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/observer"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket/models"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/utils"
+	"net/http"
 )
 
 func Observer(raw json.RawMessage) any {
@@ -26,6 +28,55 @@ func Observer(raw json.RawMessage) any {
 		break
 	case types.Device:
 		res.TotalCount, res.Result, _ = observer.DeviceObserver.Traversal(p)
+	case types.RandomMac:
+		res.TotalCount, res.Result, _ = observer.RandomMacObserver.Traversal(p)
 	}
 	return res
 }
+
+// ObserverHistoryRequest 观察者历史查询
+type ObserverHistoryRequest struct {
+	Type types.Property `json:"type"` // 为空时查询全部观察者
+	observer.HistoryQuery
+}
+
+func ObserverHistory(raw json.RawMessage) any {
+	var p ObserverHistoryRequest
+	res := &models.Response{
+		Code: http.StatusBadRequest,
+	}
+	if err := json.Unmarshal(raw, &p); err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	if p.IP == "" && p.Mac == "" {
+		res.Message = "ip or mac is required"
+		return res
+	}
+
+	result := make(map[types.Property]any)
+	var err error
+	if p.Type == "" || p.Type == types.TTL {
+		result[types.TTL], err = observer.TTLObserver.Query(p.HistoryQuery)
+	}
+	if err == nil && (p.Type == "" || p.Type == types.Mac) {
+		result[types.Mac], err = observer.MacObserver.Query(p.HistoryQuery)
+	}
+	if err == nil && (p.Type == "" || p.Type == types.UserAgent) {
+		result[types.UserAgent], err = observer.UaObserver.Query(p.HistoryQuery)
+	}
+	if err == nil && (p.Type == "" || p.Type == types.Device) {
+		result[types.Device], err = observer.DeviceObserver.Query(p.HistoryQuery)
+	}
+	if err == nil && (p.Type == "" || p.Type == types.RandomMac) {
+		result[types.RandomMac], err = observer.RandomMacObserver.Query(p.HistoryQuery)
+	}
+	if err != nil {
+		res.Code = http.StatusInternalServerError
+		res.Message = err.Error()
+		return res
+	}
+	res.Code = http.StatusOK
+	res.Data = result
+	return res
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/record"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket/models"
+	"net/http"
+)
+
+// 定向录制
+
+type RecordRequest struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Operator string `json:"operator"`
+}
+
+const recordListLimit = 100
+
+func RecordList(raw json.RawMessage) any {
+	res := &models.Response{
+		Code: http.StatusBadRequest,
+	}
+	list, err := record.List(recordListLimit)
+	if err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	used, quota := record.Usage()
+	res.Code = http.StatusOK
+	res.Data = map[string]any{
+		"list":  list,
+		"used":  used,
+		"quota": quota,
+	}
+	return res
+}
+
+func RecordStart(raw json.RawMessage) any {
+	var req types.RecordRequest
+	res := &models.Response{
+		Code: http.StatusBadRequest,
+	}
+	if err := json.Unmarshal(raw, &req); err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	rec, err := record.Start(req)
+	if err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	res.Code = http.StatusOK
+	res.Data = rec
+	return res
+}
+
+func RecordStop(raw json.RawMessage) any {
+	var req RecordRequest
+	res := &models.Response{
+		Code: http.StatusBadRequest,
+	}
+	if err := json.Unmarshal(raw, &req); err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	rec, err := record.Stop(req.ID, req.Operator)
+	if err != nil {
+		res.Code = recordErrorCode(err)
+		res.Message = err.Error()
+		return res
+	}
+	res.Code = http.StatusOK
+	res.Data = rec
+	return res
+}
+
+func RecordDetail(raw json.RawMessage) any {
+	var req RecordRequest
+	res := &models.Response{
+		Code: http.StatusBadRequest,
+	}
+	if err := json.Unmarshal(raw, &req); err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	rec, err := record.Get(req.ID)
+	if err != nil {
+		res.Code = recordErrorCode(err)
+		res.Message = err.Error()
+		return res
+	}
+	res.Code = http.StatusOK
+	res.Data = rec
+	return res
+}
+
+// RecordFile 校验下载的文件并记录审计，返回文件路径
+func RecordFile(raw json.RawMessage) any {
+	var req RecordRequest
+	res := &models.Response{
+		Code: http.StatusBadRequest,
+	}
+	if err := json.Unmarshal(raw, &req); err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	path, err := record.File(req.ID, req.Name, req.Operator)
+	if err != nil {
+		res.Code = recordErrorCode(err)
+		res.Message = err.Error()
+		return res
+	}
+	res.Code = http.StatusOK
+	res.Data = path
+	return res
+}
+
+func RecordDelete(raw json.RawMessage) any {
+	var req RecordRequest
+	res := &models.Response{
+		Code: http.StatusBadRequest,
+	}
+	if err := json.Unmarshal(raw, &req); err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	if err := record.Delete(req.ID, req.Operator); err != nil {
+		res.Code = recordErrorCode(err)
+		res.Message = err.Error()
+		return res
+	}
+	res.Code = http.StatusOK
+	res.Message = "delete successful!"
+	return res
+}
+
+func recordErrorCode(err error) int {
+	switch {
+	case errors.Is(err, record.ErrNotFound), errors.Is(err, record.ErrFileNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, record.ErrRunning):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/spill"
+)
+
+// 批量写入队列
+
+func SpillStats(raw json.RawMessage) any {
+	return spill.GetStats()
+}
@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/state"
+)
+
+// IP 状态
+
+func StateStats(raw json.RawMessage) any {
+	return state.GetStats()
+}
@@ -3,8 +3,10 @@ package handler
 import (
 	"encoding/json"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket/models"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/users"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/utils"
+	"net/http"
 )
 
 func UserList(raw json.RawMessage) any {
@@ -17,3 +19,23 @@ func UserList(raw json.RawMessage) any {
 	res.TotalCount, res.Result, _ = users.Traversal(p)
 	return res
 }
+
+// UserReconcileStats 在线用户对账统计
+func UserReconcileStats(raw json.RawMessage) any {
+	return users.GetReconcileStats()
+}
+
+// UserReconcile 立即对账在线用户
+func UserReconcile(raw json.RawMessage) any {
+	res := &models.Response{
+		Code: http.StatusOK,
+	}
+	result, err := users.Reconcile(users.TriggerManual)
+	if err != nil {
+		res.Code = http.StatusInternalServerError
+		res.Message = err.Error()
+		return res
+	}
+	res.Data = result
+	return res
+}
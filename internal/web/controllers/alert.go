@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/dot-xiaoyuan/dpi-analyze/internal/web/common"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket/models"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// AlertList 最近告警、统计与通道
+func AlertList() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bytes, err := socket.SendUnixMessage(socket.AlertList, nil)
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res any
+		_ = json.Unmarshal(bytes, &res)
+		common.SuccessResponse(c, res)
+	}
+}
+
+// AlertTest 向指定通道发送测试告警
+func AlertTest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Channel string `json:"channel" binding:"required"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		bytes, err := socket.SendUnixMessage(socket.AlertTest, req)
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res models.Response
+		_ = json.Unmarshal(bytes, &res)
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// AlertSilenceList 告警静默列表
+func AlertSilenceList() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bytes, err := socket.SendUnixMessage(socket.AlertSilenceList, nil)
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res any
+		_ = json.Unmarshal(bytes, &res)
+		common.SuccessResponse(c, res)
+	}
+}
+
+// AlertSilenceAdd 新增告警静默
+func AlertSilenceAdd() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req types.AlertSilence
+		if err := c.BindJSON(&req); err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		bytes, err := socket.SendUnixMessage(socket.AlertSilenceAdd, req)
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res models.Response
+		_ = json.Unmarshal(bytes, &res)
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// AlertSilenceDelete 删除告警静默
+func AlertSilenceDelete() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bytes, err := socket.SendUnixMessage(socket.AlertSilenceDelete, gin.H{"id": c.Param("id")})
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res models.Response
+		_ = json.Unmarshal(bytes, &res)
+		c.JSON(http.StatusOK, res)
+	}
+}
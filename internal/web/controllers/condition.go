@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// 前端列表查询提交的 condition 为 JSON 字符串，各接口只接受自己支持的字段，
+// 出现未知字段时视为非法条件
+
+// 非空判断 {"$ne": null}
+type notNull struct {
+	Ne *struct{} `json:"$ne"`
+}
+
+// 不区分大小写的包含匹配 {"$regex": "...", "$options": "i"}
+type regexMatch struct {
+	Regex   string `json:"$regex"`
+	Options string `json:"$options"`
+}
+
+// 会话流 / 应用识别
+type sessionCondition struct {
+	SrcIP   string      `json:"src_ip"`
+	DstIP   string      `json:"dst_ip"`
+	SrcPort json.Number `json:"src_port"`
+	DstPort json.Number `json:"dst_port"`
+	SNI     *notNull    `json:"metadata.tls_info.sni"`
+	Host    *notNull    `json:"metadata.http_info.host"`
+}
+
+// UserAgent 记录
+type useragentCondition struct {
+	IP   string      `json:"ip"`
+	Host *regexMatch `json:"host"`
+}
+
+// 代理 / 可疑判定记录
+type judgeCondition struct {
+	IP       string `json:"ip"`
+	Username string `json:"username"`
+}
+
+// 用户上下线事件
+type userEventCondition struct {
+	IP       string `json:"ip"`
+	UserName string `json:"user_name"`
+	UserMac  string `json:"user_mac"`
+	Action   int    `json:"action"`
+}
+
+// parseCondition 解析 condition，为空时返回零值
+func parseCondition[T any](condition string) (T, error) {
+	var cond T
+	if strings.TrimSpace(condition) == "" {
+		return cond, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(condition)))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&cond)
+	return cond, err
+}
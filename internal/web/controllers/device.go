@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"github.com/dot-xiaoyuan/dpi-analyze/internal/web/common"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// DeviceInventory 设备库列表，支持按IP、用户名、MAC过滤
+func DeviceInventory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pagination := utils.NewPagination(c.Query("page"), c.Query("pageSize"))
+
+		query := storage.IdentityQuery{
+			IP:        c.Query("ip"),
+			UserName:  c.Query("user_name"),
+			NoChanges: true,
+			Page:      storage.Page{Skip: (pagination.Page - 1) * pagination.Limit, Limit: pagination.Limit},
+		}
+		if mac := c.Query("mac"); mac != "" {
+			query.Keys = []string{types.KeyMac + strings.ToLower(mac)}
+		}
+
+		devices, count, err := storage.Devices().FindIdentities(context.TODO(), query)
+		if err != nil {
+			common.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if devices == nil {
+			devices = make([]types.DeviceIdentity, 0)
+		}
+		pagination.TotalCount = count
+		pagination.Result = devices
+		common.SuccessResponse(c, pagination)
+	}
+}
+
+// DeviceInventoryDetail 设备详情，包含IP绑定与属性变化历史
+func DeviceInventoryDetail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		device, err := storage.Devices().GetIdentity(context.TODO(), c.Param("id"))
+		if errors.Is(err, storage.ErrNotFound) {
+			common.ErrorResponse(c, http.StatusNotFound, "device not found")
+			return
+		}
+		if err != nil {
+			common.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		common.SuccessResponse(c, device)
+	}
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/dot-xiaoyuan/dpi-analyze/internal/web/common"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket/models"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type EnforcementRequest struct {
+	UserName string `json:"user_name" binding:"required"`
+	Remark   string `json:"remark"`
+}
+
+// EnforcementList 处置状态列表
+func EnforcementList() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bytes, err := socket.SendUnixMessage(socket.EnforcementList, nil)
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res any
+		_ = json.Unmarshal(bytes, &res)
+		common.SuccessResponse(c, res)
+	}
+}
+
+// EnforcementDetail 用户处置详情
+func EnforcementDetail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.Query("user_name")
+		if username == "" {
+			common.ErrorResponse(c, http.StatusBadRequest, "user_name is empty")
+			return
+		}
+		bytes, err := socket.SendUnixMessage(socket.EnforcementDetail, EnforcementRequest{UserName: username})
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res models.Response
+		_ = json.Unmarshal(bytes, &res)
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// EnforcementReset 重置用户处置状态
+func EnforcementReset() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req EnforcementRequest
+		if err := c.BindJSON(&req); err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		bytes, err := socket.SendUnixMessage(socket.EnforcementReset, req)
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res models.Response
+		_ = json.Unmarshal(bytes, &res)
+		c.JSON(http.StatusOK, res)
+	}
+}
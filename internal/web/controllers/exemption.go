@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/dot-xiaoyuan/dpi-analyze/internal/web/common"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket/models"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// ExemptionList 豁免名单及跳过统计
+func ExemptionList() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bytes, err := socket.SendUnixMessage(socket.ExemptionList, nil)
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res any
+		_ = json.Unmarshal(bytes, &res)
+		common.SuccessResponse(c, res)
+	}
+}
+
+// ExemptionAdd 新增豁免条目
+func ExemptionAdd() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req types.Exemption
+		if err := c.BindJSON(&req); err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		bytes, err := socket.SendUnixMessage(socket.ExemptionAdd, req)
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res models.Response
+		_ = json.Unmarshal(bytes, &res)
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// ExemptionDelete 删除豁免条目
+func ExemptionDelete() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bytes, err := socket.SendUnixMessage(socket.ExemptionDelete, gin.H{"id": c.Param("id")})
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res models.Response
+		_ = json.Unmarshal(bytes, &res)
+		c.JSON(http.StatusOK, res)
+	}
+}
@@ -1,19 +1,17 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/dot-xiaoyuan/dpi-analyze/internal/web/common"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/member"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/resolve"
-	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket/models"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
-	"log"
 	"net/http"
 	"strconv"
 	"time"
@@ -59,19 +57,10 @@ func IPDetail() gin.HandlerFunc {
 }
 
 func getFeature(ip string) (any, error) {
-	collection := mongo.GetMongoClient().Database(types.MongoDatabaseFeatures).Collection(types.OnlineUsersFeature)
-
-	// 查询条件
-	filter := bson.D{{"ip", ip}}
-	// 执行查询
-	cursor, err := collection.Find(mongo.Context, filter)
+	results, err := storage.Features().FindFeatures(context.TODO(), ip)
 	if err != nil {
 		return nil, err
 	}
-	var results []types.FeatureSet
-	if err = cursor.All(mongo.Context, &results); err != nil {
-		log.Fatal(err)
-	}
 	var charts []types.Chart
 	for _, result := range results {
 		charts = append(charts, result.Total...)
@@ -80,18 +69,5 @@ func getFeature(ip string) (any, error) {
 }
 
 func getDevicesLogs(ip string) (any, error) {
-	collection := mongo.GetMongoClient().Database(types.MongoDatabaseDevices).Collection(time.Now().Format("06_01_02"))
-
-	// 查询条件
-	filter := bson.D{{"ip", ip}}
-	// 执行查询
-	cursor, err := collection.Find(mongo.Context, filter, options.Find().SetSort(bson.D{{"last_seen", -1}}))
-	if err != nil {
-		return nil, err
-	}
-	var results []types.DeviceRecordByFront
-	if err = cursor.All(mongo.Context, &results); err != nil {
-		log.Fatal(err)
-	}
-	return results, nil
+	return storage.Devices().FindDeviceRecords(context.TODO(), time.Now().Format("06_01_02"), ip)
 }
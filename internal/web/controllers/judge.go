@@ -3,12 +3,9 @@ package controllers
 import (
 	"context"
 	"github.com/dot-xiaoyuan/dpi-analyze/internal/web/common"
-	mongodb "github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
-	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/utils"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
 	"net/http"
 	"strconv"
@@ -26,72 +23,27 @@ func JudgeRealtime() gin.HandlerFunc {
 
 		pagination := utils.NewPagination(strconv.Itoa(query.Page), strconv.Itoa(query.PageSize))
 
-		collection := query.Collection
-		// skip
-		skip := (pagination.Page - 1) * pagination.Limit
-
-		matchStage := bson.D{
-			{"$match", bson.D{}},
-		}
-
-		// 解析 Condition 字符串为 BSON
-		var condition bson.M
-		if err := bson.UnmarshalExtJSON([]byte(query.Condition), true, &condition); err != nil {
+		condition, err := parseCondition[judgeCondition](query.Condition)
+		if err != nil {
 			zap.L().Error("Invalid condition format", zap.Error(err))
 			common.ErrorResponse(c, http.StatusBadRequest, "Invalid condition format")
 			return
 		}
+		zap.L().Debug("condition", zap.Any("condition", condition))
 
-		if len(condition) > 0 {
-			matchStage = bson.D{
-				{"$match", condition},
-			}
-		}
-		zap.L().Debug("condition", zap.Any("condition", condition), zap.Any("match", matchStage))
-		//groupStage := bson.D{
-		//	{"$group", bson.D{}},
-		//}
-		//filterStage := bson.D{
-		//	//{"$and", []bson.D{}},
-		//}
-		//projectStage := bson.D{
-		//	//{"$project", bson.D{}},
-		//}
-		sortStage := bson.D{
-			{"$sort", bson.D{{"_id", -1}}},
-		}
-		limitStage := bson.D{
-			{"$limit", pagination.Limit},
-		}
-		skipStage := bson.D{
-			{"$skip", skip},
-		}
-		pipeline := mongo.Pipeline{matchStage, sortStage, skipStage, limitStage}
-
-		coll := mongodb.GetMongoClient().Database(types.MongoDatabaseProxy).Collection(collection)
-		cursor, err := coll.Aggregate(context.Background(), pipeline)
-
-		var result []types.ProxyRecord
+		result, total, err := storage.Judgements().FindProxies(context.Background(), query.Collection, storage.JudgeQuery{
+			IP:       condition.IP,
+			Username: condition.Username,
+			Page:     storage.Page{Skip: (pagination.Page - 1) * pagination.Limit, Limit: pagination.Limit},
+		})
 		if err != nil {
-			zap.L().Error("mongodb.Aggregate", zap.Error(err))
+			zap.L().Error("storage.FindProxies", zap.Error(err))
 			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
 			return
 		}
-		defer cursor.Close(context.Background())
-
-		for cursor.Next(context.Background()) {
-			var log types.ProxyRecord
-			cursor.Decode(&log)
-			result = append(result, log)
-		}
 
 		pagination.Result = result
-		pagination.TotalCount, err = coll.CountDocuments(context.Background(), condition)
-		if err != nil {
-			zap.L().Error("mongodb.cursor", zap.Error(err))
-			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
-			return
-		}
+		pagination.TotalCount = total
 		common.SuccessResponse(c, pagination)
 	}
 }
@@ -107,72 +59,27 @@ func JudgeSuspected() gin.HandlerFunc {
 
 		pagination := utils.NewPagination(strconv.Itoa(query.Page), strconv.Itoa(query.PageSize))
 
-		collection := query.Collection
-		// skip
-		skip := (pagination.Page - 1) * pagination.Limit
-
-		matchStage := bson.D{
-			{"$match", bson.D{}},
-		}
-
-		// 解析 Condition 字符串为 BSON
-		var condition bson.M
-		if err := bson.UnmarshalExtJSON([]byte(query.Condition), true, &condition); err != nil {
+		condition, err := parseCondition[judgeCondition](query.Condition)
+		if err != nil {
 			zap.L().Error("Invalid condition format", zap.Error(err))
 			common.ErrorResponse(c, http.StatusBadRequest, "Invalid condition format")
 			return
 		}
+		zap.L().Debug("condition", zap.Any("condition", condition))
 
-		if len(condition) > 0 {
-			matchStage = bson.D{
-				{"$match", condition},
-			}
-		}
-		zap.L().Debug("condition", zap.Any("condition", condition), zap.Any("match", matchStage))
-		//groupStage := bson.D{
-		//	{"$group", bson.D{}},
-		//}
-		//filterStage := bson.D{
-		//	//{"$and", []bson.D{}},
-		//}
-		//projectStage := bson.D{
-		//	//{"$project", bson.D{}},
-		//}
-		sortStage := bson.D{
-			{"$sort", bson.D{{"_id", -1}}},
-		}
-		limitStage := bson.D{
-			{"$limit", pagination.Limit},
-		}
-		skipStage := bson.D{
-			{"$skip", skip},
-		}
-		pipeline := mongo.Pipeline{matchStage, sortStage, skipStage, limitStage}
-
-		coll := mongodb.GetMongoClient().Database(types.MongoDatabaseSuspected).Collection(collection)
-		cursor, err := coll.Aggregate(context.Background(), pipeline)
-
-		var result []types.SuspectedRecord
+		result, total, err := storage.Judgements().FindSuspected(context.Background(), query.Collection, storage.JudgeQuery{
+			IP:       condition.IP,
+			Username: condition.Username,
+			Page:     storage.Page{Skip: (pagination.Page - 1) * pagination.Limit, Limit: pagination.Limit},
+		})
 		if err != nil {
-			zap.L().Error("mongodb.Aggregate", zap.Error(err))
+			zap.L().Error("storage.FindSuspected", zap.Error(err))
 			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
 			return
 		}
-		defer cursor.Close(context.Background())
-
-		for cursor.Next(context.Background()) {
-			var log types.SuspectedRecord
-			cursor.Decode(&log)
-			result = append(result, log)
-		}
 
 		pagination.Result = result
-		pagination.TotalCount, err = coll.CountDocuments(context.Background(), condition)
-		if err != nil {
-			zap.L().Error("mongodb.cursor", zap.Error(err))
-			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
-			return
-		}
+		pagination.TotalCount = total
 		common.SuccessResponse(c, pagination)
 	}
 }
@@ -4,7 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/dot-xiaoyuan/dpi-analyze/internal/web/common"
-	mongodb "github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/license"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
 	"github.com/gin-gonic/gin"
@@ -40,7 +40,7 @@ func LicenseUpdate() gin.HandlerFunc {
 			common.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 			return
 		}
-		err = mongodb.Store2Mongo()
+		err = storage.StoreConfig()
 		if err != nil {
 			common.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 			return
@@ -5,6 +5,7 @@ import (
 	"github.com/dot-xiaoyuan/dpi-analyze/internal/web/common"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket/models"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/utils"
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -51,3 +52,30 @@ func ObserverUa() gin.HandlerFunc {
 func ObserverDevice() gin.HandlerFunc {
 	return ObserverHandler(types.Device)
 }
+
+type ObserverHistoryRequest struct {
+	Type  types.Property `json:"type"`
+	IP    string         `json:"ip"`
+	Mac   string         `json:"mac"`
+	Start time.Time      `json:"start"`
+	End   time.Time      `json:"end"`
+}
+
+// ObserverHistory 按IP或MAC查询时间范围内的观察者历史
+func ObserverHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ObserverHistoryRequest
+		if err := c.BindJSON(&req); err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		bytes, err := socket.SendUnixMessage(socket.ObserverHistory, req)
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res models.Response
+		_ = json.Unmarshal(bytes, &res)
+		c.JSON(http.StatusOK, res)
+	}
+}
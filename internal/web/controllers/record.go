@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/dot-xiaoyuan/dpi-analyze/internal/web/common"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket/models"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// 定向录制
+// 录制由抓包进程执行，web 端发起、停止并下载文件，操作人取自登录用户并写入审计记录
+
+type RecordRequest struct {
+	ID       string `json:"id" binding:"required"`
+	Name     string `json:"name"`
+	Operator string `json:"operator"`
+}
+
+// RecordList 录制列表及磁盘占用
+func RecordList() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bytes, err := socket.SendUnixMessage(socket.RecordList, nil)
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res models.Response
+		_ = json.Unmarshal(bytes, &res)
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// RecordStart 发起录制
+func RecordStart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req types.RecordRequest
+		if err := c.BindJSON(&req); err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Operator = c.GetString("username")
+		bytes, err := socket.SendUnixMessage(socket.RecordStart, req)
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res models.Response
+		_ = json.Unmarshal(bytes, &res)
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// RecordStop 停止录制
+func RecordStop() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RecordRequest
+		if err := c.BindJSON(&req); err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Operator = c.GetString("username")
+		bytes, err := socket.SendUnixMessage(socket.RecordStop, req)
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res models.Response
+		_ = json.Unmarshal(bytes, &res)
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// RecordDetail 录制详情及审计事件
+func RecordDetail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bytes, err := socket.SendUnixMessage(socket.RecordDetail, RecordRequest{ID: c.Param("id")})
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res models.Response
+		_ = json.Unmarshal(bytes, &res)
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// RecordDownload 下载录制文件
+func RecordDownload() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := RecordRequest{ID: c.Param("id"), Name: c.Param("name"), Operator: c.GetString("username")}
+		bytes, err := socket.SendUnixMessage(socket.RecordFile, req)
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res models.Response
+		_ = json.Unmarshal(bytes, &res)
+		path, ok := res.Data.(string)
+		if res.Code != http.StatusOK || !ok {
+			c.JSON(http.StatusOK, res)
+			return
+		}
+		c.FileAttachment(path, req.Name)
+	}
+}
+
+// RecordDelete 删除录制文件
+func RecordDelete() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := RecordRequest{ID: c.Param("id"), Operator: c.GetString("username")}
+		bytes, err := socket.SendUnixMessage(socket.RecordDelete, req)
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res models.Response
+		_ = json.Unmarshal(bytes, &res)
+		c.JSON(http.StatusOK, res)
+	}
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/internal/web/common"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/simulate"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 策略模拟任务
+// 抓包与用户名单需先通过上传接口上传，任务在后台以 simulate 子命令执行
+
+type simulateRequest struct {
+	Pcaps     []string           `json:"pcaps" binding:"required"`
+	Users     string             `json:"users"`
+	IPNet     []string           `json:"ipnet"`
+	Product   int                `json:"product"`
+	BPF       string             `json:"bpf"`
+	Candidate simulate.Candidate `json:"candidate"`
+}
+
+type simulateJob struct {
+	ID        string           `json:"id"`
+	Status    string           `json:"status"` // running, done, failed
+	Error     string           `json:"error,omitempty"`
+	Report    *simulate.Report `json:"report,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+var simulateJobs = struct {
+	sync.RWMutex
+	seq  int
+	jobs map[string]*simulateJob
+}{jobs: make(map[string]*simulateJob)}
+
+func SimulateCreate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req simulateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		dir, err := os.MkdirTemp("", "dpi-simulate-job-")
+		if err != nil {
+			common.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		policyFile := filepath.Join(dir, "candidate.json")
+		reportFile := filepath.Join(dir, "report.json")
+		if err = simulate.WriteJSON(policyFile, req.Candidate); err != nil {
+			_ = os.RemoveAll(dir)
+			common.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		args := []string{"simulate", "--policy", policyFile, "--output", reportFile}
+		for _, pcap := range req.Pcaps {
+			args = append(args, "--pcap", uploadPath(pcap))
+		}
+		for _, ipNet := range req.IPNet {
+			args = append(args, "--ipnet", ipNet)
+		}
+		if req.Users != "" {
+			args = append(args, "--users", uploadPath(req.Users))
+		}
+		if req.Product != 0 {
+			args = append(args, "--product", strconv.Itoa(req.Product))
+		}
+		if req.BPF != "" {
+			args = append(args, "--bpf", req.BPF)
+		}
+
+		simulateJobs.Lock()
+		simulateJobs.seq++
+		job := &simulateJob{ID: strconv.Itoa(simulateJobs.seq), Status: "running", CreatedAt: time.Now()}
+		simulateJobs.jobs[job.ID] = job
+		simulateJobs.Unlock()
+
+		go runSimulateJob(job, dir, reportFile, args)
+		common.SuccessResponse(c, gin.H{"id": job.ID})
+	}
+}
+
+func SimulateList() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		simulateJobs.RLock()
+		defer simulateJobs.RUnlock()
+		list := make([]simulateJob, 0, len(simulateJobs.jobs))
+		for _, job := range simulateJobs.jobs {
+			item := *job
+			item.Report = nil
+			list = append(list, item)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].CreatedAt.After(list[j].CreatedAt)
+		})
+		common.SuccessResponse(c, list)
+	}
+}
+
+func SimulateDetail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		simulateJobs.RLock()
+		defer simulateJobs.RUnlock()
+		job, ok := simulateJobs.jobs[c.Param("id")]
+		if !ok {
+			common.ErrorResponse(c, http.StatusNotFound, "job not found")
+			return
+		}
+		common.SuccessResponse(c, job)
+	}
+}
+
+func runSimulateJob(job *simulateJob, dir, reportFile string, args []string) {
+	defer os.RemoveAll(dir)
+
+	var (
+		report simulate.Report
+		err    error
+	)
+	exe, err := os.Executable()
+	if err == nil {
+		var out []byte
+		if out, err = exec.Command(exe, args...).CombinedOutput(); err != nil {
+			err = fmt.Errorf("%w: %s", err, out)
+		} else {
+			report, err = readReport(reportFile)
+		}
+	}
+
+	simulateJobs.Lock()
+	defer simulateJobs.Unlock()
+	if err != nil {
+		job.Status, job.Error = "failed", err.Error()
+		return
+	}
+	job.Status, job.Report = "done", &report
+}
+
+func readReport(path string) (simulate.Report, error) {
+	var report simulate.Report
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return report, err
+	}
+	err = json.Unmarshal(data, &report)
+	return report, err
+}
+
+// 仅允许使用上传目录中的文件
+func uploadPath(name string) string {
+	return filepath.Join(config.UploadDir, filepath.Base(name))
+}
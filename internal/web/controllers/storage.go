@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/dot-xiaoyuan/dpi-analyze/internal/web/common"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/retention"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// StorageUsage 各数据集的存储占用与保留天数
+func StorageUsage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		usage, err := retention.GetUsage()
+		if err != nil {
+			common.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		common.SuccessResponse(c, gin.H{
+			"backend":  storage.Backend(),
+			"datasets": usage,
+		})
+	}
+}
+
+// StorageSpill 批量写入队列的写入、暂存、重放与丢弃统计
+func StorageSpill() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bytes, err := socket.SendUnixMessage(socket.SpillStats, nil)
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res any
+		_ = json.Unmarshal(bytes, &res)
+		common.SuccessResponse(c, res)
+	}
+}
+
+// StorageState IP 状态数量与写回 redis 统计
+func StorageState() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bytes, err := socket.SendUnixMessage(socket.StateStats, nil)
+		if err != nil {
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var res any
+		_ = json.Unmarshal(bytes, &res)
+		common.SuccessResponse(c, res)
+	}
+}
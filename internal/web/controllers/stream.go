@@ -3,12 +3,9 @@ package controllers
 import (
 	"context"
 	"github.com/dot-xiaoyuan/dpi-analyze/internal/web/common"
-	mongodb "github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
-	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/utils"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
 	"net/http"
 	"strconv"
@@ -34,80 +31,33 @@ func StreamList() gin.HandlerFunc {
 
 		pagination := utils.NewPagination(strconv.Itoa(query.Page), strconv.Itoa(query.PageSize))
 
-		collection := query.Collection
-		sortField := query.SortField
-		sortOrder := query.SortOrder
-		var orderBy int
-		if sortOrder == "descend" {
-			orderBy = -1
-		} else {
-			orderBy = 1
-		}
-		// skip
-		skip := (pagination.Page - 1) * pagination.Limit
-
-		matchStage := bson.D{
-			{"$match", bson.D{}},
-		}
-
-		// 解析 Condition 字符串为 BSON
-		var condition bson.M
-		if err := bson.UnmarshalExtJSON([]byte(query.Condition), true, &condition); err != nil {
+		condition, err := parseCondition[sessionCondition](query.Condition)
+		if err != nil {
 			zap.L().Error("Invalid condition format", zap.Error(err))
 			common.ErrorResponse(c, http.StatusBadRequest, "Invalid condition format")
 			return
 		}
-
-		if len(condition) > 0 {
-			matchStage = bson.D{
-				{"$match", condition},
-			}
-		}
-		zap.L().Debug("condition", zap.Any("condition", condition), zap.Any("match", matchStage))
-		//groupStage := bson.D{
-		//	{"$group", bson.D{}},
-		//}
-		//filterStage := bson.D{
-		//	//{"$and", []bson.D{}},
-		//}
-		//projectStage := bson.D{
-		//	//{"$project", bson.D{}},
-		//}
-		sortStage := bson.D{
-			{"$sort", bson.D{{sortField, orderBy}}},
-		}
-		limitStage := bson.D{
-			{"$limit", pagination.Limit},
-		}
-		skipStage := bson.D{
-			{"$skip", skip},
-		}
-		pipeline := mongo.Pipeline{matchStage, sortStage, skipStage, limitStage}
-
-		coll := mongodb.GetMongoClient().Database(types.MongoDatabaseStream).Collection(collection)
-		cursor, err := coll.Aggregate(context.Background(), pipeline)
-
-		var result []types.Sessions
+		zap.L().Debug("condition", zap.Any("condition", condition))
+
+		result, total, err := storage.Sessions().FindSessions(context.Background(), query.Collection, storage.SessionQuery{
+			SrcIP:   condition.SrcIP,
+			DstIP:   condition.DstIP,
+			SrcPort: condition.SrcPort.String(),
+			DstPort: condition.DstPort.String(),
+			SNI:     condition.SNI != nil,
+			Host:    condition.Host != nil,
+			Sort:    query.SortField,
+			Desc:    query.SortOrder == "descend",
+			Page:    storage.Page{Skip: (pagination.Page - 1) * pagination.Limit, Limit: pagination.Limit},
+		})
 		if err != nil {
-			zap.L().Error("mongodb.Aggregate", zap.Error(err))
+			zap.L().Error("storage.FindSessions", zap.Error(err))
 			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
 			return
 		}
-		defer cursor.Close(context.Background())
-
-		for cursor.Next(context.Background()) {
-			var log types.Sessions
-			cursor.Decode(&log)
-			result = append(result, log)
-		}
 
 		pagination.Result = result
-		pagination.TotalCount, err = coll.CountDocuments(context.Background(), condition)
-		if err != nil {
-			zap.L().Error("mongodb.cursor", zap.Error(err))
-			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
-			return
-		}
+		pagination.TotalCount = total
 		common.SuccessResponse(c, pagination)
 	}
 }
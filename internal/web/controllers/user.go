@@ -4,13 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/dot-xiaoyuan/dpi-analyze/internal/web/common"
-	mongodb "github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket/models"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/utils"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
 	"net/http"
 	"strconv"
@@ -52,72 +51,57 @@ func UserEventsLog() gin.HandlerFunc {
 
 		pagination := utils.NewPagination(strconv.Itoa(query.Page), strconv.Itoa(query.PageSize))
 
-		collection := query.Collection
-		// skip
-		skip := (pagination.Page - 1) * pagination.Limit
-
-		matchStage := bson.D{
-			{"$match", bson.D{}},
-		}
-
-		// 解析 Condition 字符串为 BSON
-		var condition bson.M
-		if err := bson.UnmarshalExtJSON([]byte(query.Condition), true, &condition); err != nil {
+		condition, err := parseCondition[userEventCondition](query.Condition)
+		if err != nil {
 			zap.L().Error("Invalid condition format", zap.Error(err))
 			common.ErrorResponse(c, http.StatusBadRequest, "Invalid condition format")
 			return
 		}
+		zap.L().Debug("condition", zap.Any("condition", condition))
 
-		if len(condition) > 0 {
-			matchStage = bson.D{
-				{"$match", condition},
-			}
-		}
-		zap.L().Debug("condition", zap.Any("condition", condition), zap.Any("match", matchStage))
-		//groupStage := bson.D{
-		//	{"$group", bson.D{}},
-		//}
-		//filterStage := bson.D{
-		//	//{"$and", []bson.D{}},
-		//}
-		//projectStage := bson.D{
-		//	//{"$project", bson.D{}},
-		//}
-		sortStage := bson.D{
-			{"$sort", bson.D{{"_id", -1}}},
-		}
-		limitStage := bson.D{
-			{"$limit", pagination.Limit},
-		}
-		skipStage := bson.D{
-			{"$skip", skip},
+		result, total, err := storage.Users().FindUserEvents(context.Background(), query.Collection, storage.UserEventQuery{
+			IP:       condition.IP,
+			UserName: condition.UserName,
+			UserMac:  condition.UserMac,
+			Action:   condition.Action,
+			Page:     storage.Page{Skip: (pagination.Page - 1) * pagination.Limit, Limit: pagination.Limit},
+		})
+		if err != nil {
+			zap.L().Error("storage.FindUserEvents", zap.Error(err))
+			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
 		}
-		pipeline := mongo.Pipeline{matchStage, sortStage, skipStage, limitStage}
 
-		coll := mongodb.GetMongoClient().Database(types.MongoDatabaseUserEvents).Collection(collection)
-		cursor, err := coll.Aggregate(context.Background(), pipeline)
+		pagination.Result = result
+		pagination.TotalCount = total
+		common.SuccessResponse(c, pagination)
+	}
+}
 
-		var result []types.UserEvent
+// UserReconcileStats 在线用户对账统计
+func UserReconcileStats() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bytes, err := socket.SendUnixMessage(socket.UserReconcileStats, nil)
 		if err != nil {
-			zap.L().Error("mongodb.Aggregate", zap.Error(err))
 			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
 			return
 		}
-		defer cursor.Close(context.Background())
-
-		for cursor.Next(context.Background()) {
-			var log types.UserEvent
-			cursor.Decode(&log)
-			result = append(result, log)
-		}
+		var res any
+		_ = json.Unmarshal(bytes, &res)
+		common.SuccessResponse(c, res)
+	}
+}
 
-		pagination.Result = result
-		pagination.TotalCount, err = coll.CountDocuments(context.Background(), condition)
+// UserReconcile 立即对账在线用户
+func UserReconcile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bytes, err := socket.SendUnixMessage(socket.UserReconcile, nil)
 		if err != nil {
-			zap.L().Error("mongodb.cursor", zap.Error(err))
 			common.ErrorResponse(c, http.StatusBadRequest, err.Error())
 			return
 		}
-		common.SuccessResponse(c, pagination)
+		var res models.Response
+		_ = json.Unmarshal(bytes, &res)
+		c.JSON(http.StatusOK, res)
 	}
 }
@@ -37,6 +37,12 @@ func Register(r *gin.Engine) {
 				terminal.POST("/application", controllers.Application())
 				terminal.POST("/detail", controllers.Detail())
 			}
+			// Device 设备库
+			device := api.Group("/device")
+			{
+				device.GET("/inventory", controllers.DeviceInventory())
+				device.GET("/inventory/:id", controllers.DeviceInventoryDetail())
+			}
 			// Judge 特征判定
 			feature := api.Group("/feature")
 			{
@@ -56,6 +62,51 @@ func Register(r *gin.Engine) {
 				policy.POST("/update", controllers.PolicyUpdate())
 			}
 
+			// enforcement 代理处置
+			enforcement := api.Group("/enforcement")
+			{
+				enforcement.GET("/list", controllers.EnforcementList())
+				enforcement.GET("/detail", controllers.EnforcementDetail())
+				enforcement.POST("/reset", controllers.EnforcementReset())
+			}
+
+			// exemption 豁免名单
+			exemption := api.Group("/exemption")
+			{
+				exemption.GET("/list", controllers.ExemptionList())
+				exemption.POST("/add", controllers.ExemptionAdd())
+				exemption.DELETE("/:id", controllers.ExemptionDelete())
+			}
+
+			// alert 告警
+			alert := api.Group("/alert")
+			{
+				alert.GET("/list", controllers.AlertList())
+				alert.POST("/test", controllers.AlertTest())
+				alert.GET("/silence/list", controllers.AlertSilenceList())
+				alert.POST("/silence/add", controllers.AlertSilenceAdd())
+				alert.DELETE("/silence/:id", controllers.AlertSilenceDelete())
+			}
+
+			// storage 存储占用、批量写入队列与 IP 状态写回
+			api.GET("/storage/usage", controllers.StorageUsage())
+			api.GET("/storage/spill", controllers.StorageSpill())
+			api.GET("/storage/state", controllers.StorageState())
+
+			// record 定向录制
+			record := api.Group("/record")
+			{
+				record.GET("/list", controllers.RecordList())
+				record.POST("/start", controllers.RecordStart())
+				record.POST("/stop", controllers.RecordStop())
+				record.GET("/:id", controllers.RecordDetail())
+				record.GET("/:id/file/:name", controllers.RecordDownload())
+				record.DELETE("/:id", controllers.RecordDelete())
+			}
+
+			// bus 内部事件总线
+			api.GET("/bus/stats", controllers.BusStats())
+
 			// log 日志管理
 			log := api.Group("/log")
 			{
@@ -74,6 +125,17 @@ func Register(r *gin.Engine) {
 			//api.GET("/ip/list", controllers.IPList())
 			//api.GET("/ip/detail", controllers.IPDetail())
 
+			// simulate 策略模拟
+			simulate := api.Group("/simulate")
+			{
+				simulate.GET("", controllers.SimulateList())
+				simulate.POST("", controllers.SimulateCreate())
+				simulate.GET("/:id", controllers.SimulateDetail())
+			}
+
+			// Observer 历史
+			api.POST("/observer/history", controllers.ObserverHistory())
+
 			// Observer
 			//observer := api.Group("/observer")
 			//{
@@ -88,6 +150,8 @@ func Register(r *gin.Engine) {
 			{
 				users.GET("/list", controllers.UserList())
 				users.GET("/events/log", controllers.UserEventsLog())
+				users.GET("/reconcile/stats", controllers.UserReconcileStats())
+				users.POST("/reconcile", controllers.UserReconcile())
 			}
 
 			// Licence 授权
@@ -6,7 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/dot-xiaoyuan/dpi-analyze/internal/web/router"
-	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/i18n"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
 	"github.com/gin-contrib/cors"
@@ -36,8 +36,10 @@ type Config struct {
 }
 
 func NewWebServer(c Config) {
-	zap.L().Info(i18n.T("Start Load Mongodb Component"))
-	if err := mongo.Setup(); err != nil {
+	zap.L().Info(i18n.T("Start Load Storage Component"))
+	// capture 未运行时 web 仍可启动，嵌入式存储只读提供历史数据
+	if err := storage.SetupRemote(); err != nil {
+		zap.L().Error("Failed setup storage", zap.Error(err))
 		os.Exit(1)
 	}
 	zap.L().Info(i18n.T("Starting Web Server"))
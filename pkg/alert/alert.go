@@ -0,0 +1,377 @@
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"go.uber.org/zap"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 告警管理
+// 检测链路通过 Fire 或总线事件投递告警，异步依次经过：静默 -> 去重 -> 路由 -> 通道限速 -> 发送
+// 最近的告警保留在内存中供页面查看
+
+const (
+	defaultDedup     = 30 * time.Minute
+	defaultRateLimit = 30
+	queueSize        = 1024
+	historySize      = 200
+)
+
+var (
+	ErrChannelNotFound = errors.New("alert channel not found")
+
+	// LookupUser 根据IP查询用户名与产品，由抓包服务注入，避免依赖用户组件
+	LookupUser func(ip string) (username string, product int)
+
+	manager = &alertManager{}
+)
+
+type alertManager struct {
+	mu       sync.Mutex
+	queue    chan types.Alert
+	channels map[string]Channel
+	limiters map[string]*limiter
+	dedup    map[string]time.Time
+	history  []types.Alert
+	stats    Stats
+}
+
+// Stats 告警统计
+type Stats struct {
+	Fired      int64 `json:"fired"`
+	Silenced   int64 `json:"silenced"`
+	Duplicated int64 `json:"duplicated"`
+	Limited    int64 `json:"limited"`
+	Dropped    int64 `json:"dropped"`
+	Sent       int64 `json:"sent"`
+	Failed     int64 `json:"failed"`
+}
+
+// Setup 加载静默规则与通道并启动告警处理
+func Setup() error {
+	if !config.Cfg.Alert.Enable {
+		zap.L().Info("告警未启用")
+		return nil
+	}
+	if err := loadSilences(); err != nil {
+		return err
+	}
+	channels, err := buildChannels(config.Cfg.Alert)
+	if err != nil {
+		zap.L().Error("加载告警通道失败", zap.Error(err))
+		return err
+	}
+
+	manager.mu.Lock()
+	manager.channels = channels
+	manager.limiters = make(map[string]*limiter, len(channels))
+	for name := range channels {
+		manager.limiters[name] = newLimiter(rateLimit())
+	}
+	manager.dedup = make(map[string]time.Time)
+	manager.queue = make(chan types.Alert, queueSize)
+	manager.mu.Unlock()
+
+	go manager.run()
+	subscribe()
+	zap.L().Info("告警组件加载完成", zap.Int("channels", len(channels)))
+	return nil
+}
+
+// Fire 投递告警，队列满时丢弃
+func Fire(a types.Alert) {
+	manager.mu.Lock()
+	queue := manager.queue
+	manager.mu.Unlock()
+	if queue == nil {
+		return
+	}
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+	if a.Username == "" && a.IP != "" && LookupUser != nil {
+		a.Username, a.ProductsID = LookupUser(a.IP)
+	}
+	if a.Fingerprint == "" {
+		a.Fingerprint = fingerprint(a)
+	}
+	select {
+	case queue <- a:
+	default:
+		manager.mu.Lock()
+		manager.stats.Dropped++
+		manager.mu.Unlock()
+		zap.L().Warn("告警队列已满，丢弃告警", zap.String("type", string(a.Type)), zap.String("title", a.Title))
+	}
+}
+
+// Test 向指定通道直接发送测试告警，不经过静默、去重与限速
+func Test(name string) error {
+	manager.mu.Lock()
+	ch, ok := manager.channels[name]
+	manager.mu.Unlock()
+	if !ok {
+		return ErrChannelNotFound
+	}
+	return ch.Send(types.Alert{
+		Type:        types.AlertTest,
+		Severity:    types.SeverityInfo,
+		Title:       "告警通道测试",
+		Message:     fmt.Sprintf("通道 %s 测试消息", name),
+		Fingerprint: "test",
+		Channels:    []string{name},
+		Time:        time.Now(),
+	})
+}
+
+// History 最近的告警，按时间倒序
+func History() []types.Alert {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	result := make([]types.Alert, 0, len(manager.history))
+	for i := len(manager.history) - 1; i >= 0; i-- {
+		result = append(result, manager.history[i])
+	}
+	return result
+}
+
+// GetStats 告警统计
+func GetStats() Stats {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	return manager.stats
+}
+
+// Channels 已配置的通道名称
+func Channels() []string {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	names := make([]string, 0, len(manager.channels))
+	for name := range manager.channels {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (m *alertManager) run() {
+	for a := range m.queue {
+		m.process(a)
+	}
+}
+
+func (m *alertManager) process(a types.Alert) {
+	now := time.Now()
+	m.mu.Lock()
+	m.stats.Fired++
+	if silenced(a, now) {
+		a.Silenced = true
+		m.stats.Silenced++
+		m.record(a)
+		m.mu.Unlock()
+		return
+	}
+	if until, ok := m.dedup[a.Fingerprint]; ok && now.Before(until) {
+		m.stats.Duplicated++
+		m.mu.Unlock()
+		return
+	}
+
+	var targets []Channel
+	for _, name := range route(a, m.channels) {
+		ch, ok := m.channels[name]
+		if !ok {
+			continue
+		}
+		if !m.limiters[name].allow(now) {
+			m.stats.Limited++
+			continue
+		}
+		targets = append(targets, ch)
+		a.Channels = append(a.Channels, name)
+	}
+	m.record(a)
+	// 去重只记录实际发出的告警，全部通道被限速时下次仍可发送
+	if len(targets) == 0 {
+		m.mu.Unlock()
+		return
+	}
+	m.cleanDedup(now)
+	d := &delivery{fingerprint: a.Fingerprint, until: now.Add(dedupWindow()), pending: len(targets)}
+	m.dedup[d.fingerprint] = d.until
+	m.mu.Unlock()
+
+	for _, ch := range targets {
+		go m.send(ch, a, d)
+	}
+}
+
+// delivery 一次告警的发送情况，全部通道发送失败时撤销去重
+type delivery struct {
+	fingerprint string
+	until       time.Time
+	pending     int
+	sent        bool
+}
+
+func (m *alertManager) send(ch Channel, a types.Alert, d *delivery) {
+	err := ch.Send(a)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d.pending--
+	if err == nil {
+		d.sent = true
+		m.stats.Sent++
+	} else {
+		m.stats.Failed++
+		zap.L().Error("告警发送失败", zap.String("channel", ch.Name()), zap.String("title", a.Title), zap.Error(err))
+	}
+	if d.pending == 0 && !d.sent && m.dedup[d.fingerprint].Equal(d.until) {
+		delete(m.dedup, d.fingerprint)
+	}
+}
+
+func (m *alertManager) record(a types.Alert) {
+	m.history = append(m.history, a)
+	if len(m.history) > historySize {
+		m.history = m.history[len(m.history)-historySize:]
+	}
+}
+
+func (m *alertManager) cleanDedup(now time.Time) {
+	if len(m.dedup) < queueSize {
+		return
+	}
+	for k, until := range m.dedup {
+		if now.After(until) {
+			delete(m.dedup, k)
+		}
+	}
+}
+
+// 按顺序匹配路由，未配置路由时发送至全部通道
+func route(a types.Alert, channels map[string]Channel) []string {
+	routes := config.Cfg.Alert.Routes
+	if len(routes) == 0 {
+		names := make([]string, 0, len(channels))
+		for name := range channels {
+			names = append(names, name)
+		}
+		return names
+	}
+	var names []string
+	seen := make(map[string]struct{})
+	for _, r := range routes {
+		if !matchRoute(r, a) {
+			continue
+		}
+		for _, name := range r.Channels {
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				names = append(names, name)
+			}
+		}
+		if !r.Continue {
+			break
+		}
+	}
+	return names
+}
+
+func matchRoute(r config.AlertRoute, a types.Alert) bool {
+	if r.Severity != "" && a.Severity.Level() < types.AlertSeverity(r.Severity).Level() {
+		return false
+	}
+	if len(r.Types) > 0 && !contains(r.Types, string(a.Type)) {
+		return false
+	}
+	if len(r.Products) > 0 && !contains(r.Products, a.ProductsID) {
+		return false
+	}
+	if len(r.Groups) > 0 {
+		matched := false
+		for _, g := range r.Groups {
+			if inGroup(g, a.Username) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// 用户是否属于用户组
+func inGroup(group, username string) bool {
+	if username == "" {
+		return false
+	}
+	for _, pattern := range config.Cfg.Alert.Groups[group] {
+		if ok, _ := path.Match(pattern, username); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains[T comparable](list []T, v T) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func fingerprint(a types.Alert) string {
+	subject := a.Username
+	if subject == "" {
+		subject = a.IP
+	}
+	return fmt.Sprintf("%s:%s:%s:%s", a.Type, subject, a.Reason, strconv.Itoa(a.Severity.Level()))
+}
+
+func dedupWindow() time.Duration {
+	if config.Cfg.Alert.Dedup > 0 {
+		return time.Duration(config.Cfg.Alert.Dedup) * time.Minute
+	}
+	return defaultDedup
+}
+
+func rateLimit() int {
+	if config.Cfg.Alert.RateLimit > 0 {
+		return config.Cfg.Alert.RateLimit
+	}
+	return defaultRateLimit
+}
+
+// 令牌桶，每分钟补充 rate 个
+type limiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate int) *limiter {
+	return &limiter{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+func (l *limiter) allow(now time.Time) bool {
+	l.tokens += now.Sub(l.last).Minutes() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
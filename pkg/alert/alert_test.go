@@ -0,0 +1,383 @@
+package alert
+
+import (
+	"bufio"
+	"errors"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/bus"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func init() {
+	if config.Cfg == nil {
+		config.Cfg = &config.Yaml{}
+	}
+}
+
+var testAlert = types.Alert{
+	Type:     types.AlertTest,
+	Severity: types.SeverityWarning,
+	Title:    "代理告警",
+	Message:  "检测到代理",
+	IP:       "10.0.0.1",
+	Username: "alice",
+	Reason:   "mobile",
+	Time:     time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC),
+}
+
+func TestWebhook(t *testing.T) {
+	var body, auth string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body, auth = string(data), r.Header.Get("Authorization")
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	ch, err := newWebhook(config.AlertWebhook{
+		Name:     "ops",
+		URL:      srv.URL,
+		Headers:  map[string]string{"Authorization": "Bearer token"},
+		Template: `{"text": {{json .Title}}, "user": {{json .Username}}, "time": {{json (time .Time)}}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ch.Send(testAlert); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"text": "代理告警", "user": "alice", "time": "2026-10-19T08:00:00Z"}`
+	if body != want || auth != "Bearer token" {
+		t.Fatalf("webhook got body %s auth %q", body, auth)
+	}
+
+	status = http.StatusBadGateway
+	if err = ch.Send(testAlert); err == nil {
+		t.Fatal("webhook with 502 response should fail")
+	}
+}
+
+func TestSyslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ch, err := newSyslog(config.AlertSyslog{Name: "soc", Network: "udp", Address: conn.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ch.Send(testAlert); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2048)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	// local0.warning = 16*8+4
+	for _, want := range []string{"<132>1 2026-10-19T08:00:00Z", "dpi-analyze", `ip="10.0.0.1"`, `username="alice"`, "代理告警: 检测到代理"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("syslog message %q missing %q", msg, want)
+		}
+	}
+}
+
+// 最小的 SMTP 服务端，记录收到的邮件
+type smtpServer struct {
+	ln     net.Listener
+	mu     sync.Mutex
+	from   string
+	to     []string
+	data   string
+	silent bool // 接受连接后不发送问候
+}
+
+func newSMTPServer(t *testing.T, silent bool) *smtpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{ln: ln, silent: silent}
+	t.Cleanup(func() { _ = ln.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpServer) handle(conn net.Conn) {
+	defer conn.Close()
+	if s.silent {
+		_, _ = io.Copy(io.Discard, conn)
+		return
+	}
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+	reply("220 test ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			reply("250 test")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = line
+			s.mu.Unlock()
+			reply("250 OK")
+		case "RCPT":
+			s.mu.Lock()
+			s.to = append(s.to, line)
+			s.mu.Unlock()
+			reply("250 OK")
+		case "DATA":
+			reply("354 go ahead")
+			var b strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				b.WriteString(l)
+			}
+			s.mu.Lock()
+			s.data = b.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSMTP(t *testing.T) {
+	srv := newSMTPServer(t, false)
+	ch := &smtpChannel{cfg: config.AlertSMTP{
+		Name: "mail",
+		Host: "127.0.0.1",
+		Port: srv.port(),
+		From: "dpi@example.com",
+		To:   []string{"a@example.com", "b@example.com"},
+	}}
+	if err := ch.Send(testAlert); err != nil {
+		t.Fatal(err)
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.from != "MAIL FROM:<dpi@example.com>" || len(srv.to) != 2 {
+		t.Fatalf("smtp envelope from %q to %q", srv.from, srv.to)
+	}
+	for _, want := range []string{"Subject: =?UTF-8?B?", "用户: alice", "IP: 10.0.0.1"} {
+		if !strings.Contains(srv.data, want) {
+			t.Errorf("smtp message missing %q", want)
+		}
+	}
+}
+
+func TestSMTPTimeout(t *testing.T) {
+	srv := newSMTPServer(t, true)
+	ch := &smtpChannel{cfg: config.AlertSMTP{Name: "mail", Host: "127.0.0.1", Port: srv.port(), Timeout: 1}}
+	start := time.Now()
+	err := ch.Send(testAlert)
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("smtp without greeting = %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("smtp timeout took %v", elapsed)
+	}
+}
+
+// 记录发送次数的通道
+type fakeChannel struct {
+	name string
+	mu   sync.Mutex
+	sent []types.Alert
+	err  error
+	done chan struct{}
+}
+
+func (f *fakeChannel) Name() string { return f.name }
+
+func (f *fakeChannel) Send(a types.Alert) error {
+	f.mu.Lock()
+	f.sent = append(f.sent, a)
+	err := f.err
+	f.mu.Unlock()
+	f.done <- struct{}{}
+	return err
+}
+
+func (f *fakeChannel) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-f.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("alert was not sent")
+	}
+}
+
+func (f *fakeChannel) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.sent)
+}
+
+func newTestManager(ch *fakeChannel, rate int) *alertManager {
+	return &alertManager{
+		channels: map[string]Channel{ch.name: ch},
+		limiters: map[string]*limiter{ch.name: newLimiter(rate)},
+		dedup:    make(map[string]time.Time),
+	}
+}
+
+func TestProcessDedup(t *testing.T) {
+	ch := &fakeChannel{name: "ops", done: make(chan struct{}, 10)}
+	m := newTestManager(ch, 10)
+	a := testAlert
+	a.Fingerprint = fingerprint(a)
+
+	m.process(a)
+	ch.wait(t)
+	m.process(a)
+	if n := ch.count(); n != 1 || m.stats.Duplicated != 1 {
+		t.Fatalf("duplicate alert sent %d times, duplicated %d", n, m.stats.Duplicated)
+	}
+}
+
+func TestProcessLimitedNotDeduplicated(t *testing.T) {
+	ch := &fakeChannel{name: "ops", done: make(chan struct{}, 10)}
+	m := newTestManager(ch, 1)
+	m.limiters[ch.name].tokens = 0
+	a := testAlert
+	a.Fingerprint = fingerprint(a)
+
+	m.process(a)
+	if m.stats.Limited != 1 || len(m.dedup) != 0 {
+		t.Fatalf("limited alert: limited %d, dedup %v", m.stats.Limited, m.dedup)
+	}
+	// 令牌恢复后同一告警仍可发送
+	m.limiters[ch.name].tokens = 1
+	m.process(a)
+	ch.wait(t)
+	if n := ch.count(); n != 1 {
+		t.Fatalf("alert after limit sent %d times", n)
+	}
+}
+
+func TestProcessFailedNotDeduplicated(t *testing.T) {
+	ch := &fakeChannel{name: "ops", done: make(chan struct{}, 10), err: errors.New("down")}
+	m := newTestManager(ch, 10)
+	a := testAlert
+	a.Fingerprint = fingerprint(a)
+
+	m.process(a)
+	ch.wait(t)
+	// 等待 send 记录失败
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		m.mu.Lock()
+		failed, deduped := m.stats.Failed, len(m.dedup)
+		m.mu.Unlock()
+		if failed == 1 && deduped == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("failed alert: failed %d, dedup %d", failed, deduped)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ch.mu.Lock()
+	ch.err = nil
+	ch.mu.Unlock()
+	m.process(a)
+	ch.wait(t)
+	if n := ch.count(); n != 2 {
+		t.Fatalf("alert retried after failure sent %d times", n)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	l := &limiter{rate: 2, tokens: 2, last: now}
+	for i, want := range []bool{true, true, false} {
+		if got := l.allow(now); got != want {
+			t.Fatalf("allow #%d = %v", i, got)
+		}
+	}
+	if !l.allow(now.Add(30 * time.Second)) {
+		t.Fatal("limiter should refill one token in 30s at 2/min")
+	}
+}
+
+// 检测链路发布的代理与疑似代理事件转换为告警
+func TestBusEvents(t *testing.T) {
+	manager.mu.Lock()
+	saved := manager.queue
+	manager.queue = make(chan types.Alert, 16)
+	queue := manager.queue
+	manager.mu.Unlock()
+	defer func() {
+		manager.mu.Lock()
+		manager.queue = saved
+		manager.mu.Unlock()
+	}()
+	LookupUser = func(ip string) (string, int) { return "bob", 7 }
+	defer func() { LookupUser = nil }()
+
+	subscribe()
+	bus.ProxyDetected.Publish(types.ProxyRecord{IP: "10.0.38.1", Username: "alice", Action: types.ActionEscalate, AllCount: 3})
+	bus.SuspectedDetected.Publish(types.SuspectedRecord{IP: "10.0.38.2", ReasonCategory: "sni",
+		ReasonDetail: types.ReasonDetail{Name: types.SNI, Description: "SNI 数量超过阈值"}})
+
+	got := make(map[types.AlertType]types.Alert)
+	for len(got) < 2 {
+		select {
+		case a := <-queue:
+			got[a.Type] = a
+		case <-time.After(time.Second):
+			t.Fatalf("alerts %+v", got)
+		}
+	}
+	if a := got[types.AlertProxy]; a.Severity != types.SeverityCritical || a.Username != "alice" || a.ProductsID != 7 || a.Reason != types.ActionEscalate {
+		t.Errorf("proxy alert %+v", a)
+	}
+	if a := got[types.AlertSuspected]; a.Username != "bob" || a.Message != "SNI 数量超过阈值" || a.Labels["feature"] != string(types.SNI) {
+		t.Errorf("suspected alert %+v", a)
+	}
+}
@@ -0,0 +1,297 @@
+package alert
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/syslog"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// 告警通道
+
+const defaultTimeout = 5 * time.Second
+
+// Channel 告警发送通道
+type Channel interface {
+	Name() string
+	Send(a types.Alert) error
+}
+
+func buildChannels(c config.Alert) (map[string]Channel, error) {
+	channels := make(map[string]Channel)
+	add := func(ch Channel) error {
+		if ch.Name() == "" {
+			return fmt.Errorf("alert channel name is empty")
+		}
+		if _, ok := channels[ch.Name()]; ok {
+			return fmt.Errorf("duplicate alert channel: %s", ch.Name())
+		}
+		channels[ch.Name()] = ch
+		return nil
+	}
+	for _, w := range c.Webhooks {
+		ch, err := newWebhook(w)
+		if err != nil {
+			return nil, err
+		}
+		if err = add(ch); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range c.Syslogs {
+		ch, err := newSyslog(s)
+		if err != nil {
+			return nil, err
+		}
+		if err = add(ch); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range c.SMTPs {
+		if err := add(&smtpChannel{cfg: s}); err != nil {
+			return nil, err
+		}
+	}
+	return channels, nil
+}
+
+// HTTP 回调
+
+type webhook struct {
+	cfg      config.AlertWebhook
+	template *template.Template
+	client   *http.Client
+}
+
+var templateFuncs = template.FuncMap{
+	// json 将值编码为json，用于模板中安全输出字符串
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"time": func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+}
+
+func newWebhook(c config.AlertWebhook) (*webhook, error) {
+	w := &webhook{cfg: c, client: &http.Client{Timeout: defaultTimeout}}
+	if c.Timeout > 0 {
+		w.client.Timeout = time.Duration(c.Timeout) * time.Second
+	}
+	if c.Template != "" {
+		tpl, err := template.New(c.Name).Funcs(templateFuncs).Parse(c.Template)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %s template: %w", c.Name, err)
+		}
+		w.template = tpl
+	}
+	return w, nil
+}
+
+func (w *webhook) Name() string {
+	return w.cfg.Name
+}
+
+func (w *webhook) Send(a types.Alert) error {
+	var body bytes.Buffer
+	if w.template != nil {
+		if err := w.template.Execute(&body, a); err != nil {
+			return err
+		}
+	} else if err := json.NewEncoder(&body).Encode(a); err != nil {
+		return err
+	}
+	method := w.cfg.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequest(method, w.cfg.URL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s: unexpected status %s", w.cfg.Name, resp.Status)
+	}
+	return nil
+}
+
+// syslog
+
+type syslogChannel struct {
+	cfg    config.AlertSyslog
+	writer *syslog.Writer
+}
+
+func newSyslog(c config.AlertSyslog) (*syslogChannel, error) {
+	writer, err := syslog.NewWriter(c.Network, c.Address, c.Insecure)
+	if err != nil {
+		return nil, fmt.Errorf("syslog %s: %w", c.Name, err)
+	}
+	if c.Facility == 0 {
+		c.Facility = syslog.FacilityLocal0
+	}
+	if c.AppName == "" {
+		c.AppName = "dpi-analyze"
+	}
+	return &syslogChannel{cfg: c, writer: writer}, nil
+}
+
+func (s *syslogChannel) Name() string {
+	return s.cfg.Name
+}
+
+func (s *syslogChannel) Send(a types.Alert) error {
+	params := map[string]string{
+		"type":     string(a.Type),
+		"severity": string(a.Severity),
+		"ip":       a.IP,
+		"username": a.Username,
+		"product":  strconv.Itoa(a.ProductsID),
+		"reason":   a.Reason,
+	}
+	return s.writer.Send(syslog.Message{
+		Facility:       s.cfg.Facility,
+		Severity:       syslogSeverity(a.Severity),
+		Time:           a.Time,
+		AppName:        s.cfg.AppName,
+		MsgID:          string(a.Type),
+		StructuredData: syslog.StructuredData("alert@32473", params, "type", "severity", "ip", "username", "product", "reason"),
+		Content:        fmt.Sprintf("%s: %s", a.Title, a.Message),
+	})
+}
+
+func syslogSeverity(s types.AlertSeverity) int {
+	switch s {
+	case types.SeverityCritical:
+		return syslog.SeverityCritical
+	case types.SeverityWarning:
+		return syslog.SeverityWarning
+	default:
+		return syslog.SeverityInfo
+	}
+}
+
+// 邮件
+
+type smtpChannel struct {
+	cfg config.AlertSMTP
+}
+
+func (s *smtpChannel) Name() string {
+	return s.cfg.Name
+}
+
+func (s *smtpChannel) Send(a types.Alert) error {
+	port := s.cfg.Port
+	if port == 0 {
+		port = 25
+	}
+	timeout := defaultTimeout
+	if s.cfg.Timeout > 0 {
+		timeout = time.Duration(s.cfg.Timeout) * time.Second
+	}
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: s.cfg.Host}
+
+	var conn net.Conn
+	var err error
+	if s.cfg.TLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, timeout)
+	}
+	if err != nil {
+		return err
+	}
+	// 整个会话的超时，避免服务端无响应时阻塞发送协程
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	// 与 smtp.SendMail 一致，服务端支持时使用 STARTTLS
+	if ok, _ := client.Extension("STARTTLS"); ok && !s.cfg.TLS {
+		if err = client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if s.cfg.Username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err = client.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(s.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range s.cfg.To {
+		if err = client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(s.message(a)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (s *smtpChannel) message(a types.Alert) []byte {
+	var b strings.Builder
+	subject := fmt.Sprintf("[%s] %s", strings.ToUpper(string(a.Severity)), a.Title)
+	fmt.Fprintf(&b, "From: %s\r\n", s.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.cfg.To, ", "))
+	fmt.Fprintf(&b, "Subject: =?UTF-8?B?%s?=\r\n", base64.StdEncoding.EncodeToString([]byte(subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", a.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	fmt.Fprintf(&b, "%s\r\n\r\n", a.Message)
+	fmt.Fprintf(&b, "类型: %s\r\n", a.Type)
+	fmt.Fprintf(&b, "级别: %s\r\n", a.Severity)
+	if a.Username != "" {
+		fmt.Fprintf(&b, "用户: %s\r\n", a.Username)
+	}
+	if a.IP != "" {
+		fmt.Fprintf(&b, "IP: %s\r\n", a.IP)
+	}
+	if a.Reason != "" {
+		fmt.Fprintf(&b, "原因: %s\r\n", a.Reason)
+	}
+	fmt.Fprintf(&b, "时间: %s\r\n", a.Time.Format("2006-01-02 15:04:05"))
+	return []byte(b.String())
+}
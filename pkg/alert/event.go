@@ -0,0 +1,52 @@
+package alert
+
+import (
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/bus"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+)
+
+// 订阅代理与疑似代理判定，检测链路只发布事件，无需依赖告警组件
+func subscribe() {
+	bus.ProxyDetected.Subscribe("alert_proxy", bus.Options{}, func(r types.ProxyRecord) {
+		Fire(proxyAlert(r))
+	})
+	bus.SuspectedDetected.Subscribe("alert_suspected", bus.Options{}, func(r types.SuspectedRecord) {
+		Fire(suspectedAlert(r))
+	})
+}
+
+// 代理告警，升级处置为严重
+func proxyAlert(r types.ProxyRecord) types.Alert {
+	severity := types.SeverityWarning
+	if r.Action == types.ActionEscalate || r.Action == types.ActionReapply {
+		severity = types.SeverityCritical
+	}
+	a := types.Alert{
+		Type:     types.AlertProxy,
+		Severity: severity,
+		Title:    "检测到代理共享",
+		Message:  fmt.Sprintf("用户 %s(%s) 活跃设备 %d 台，移动端 %d，PC %d", r.Username, r.IP, r.AllCount, r.MobileCount, r.PcCount),
+		IP:       r.IP,
+		Username: r.Username,
+		Reason:   r.Action,
+	}
+	if LookupUser != nil {
+		_, a.ProductsID = LookupUser(r.IP)
+	}
+	return a
+}
+
+// 疑似代理告警
+func suspectedAlert(r types.SuspectedRecord) types.Alert {
+	return types.Alert{
+		Type:     types.AlertSuspected,
+		Severity: types.SeverityInfo,
+		Title:    "疑似代理",
+		Message:  r.ReasonDetail.Description,
+		IP:       r.IP,
+		Username: r.Username,
+		Reason:   r.ReasonCategory,
+		Labels:   map[string]string{"feature": fmt.Sprint(r.ReasonDetail.Name)},
+	}
+}
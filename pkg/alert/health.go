@@ -0,0 +1,106 @@
+package alert
+
+import (
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/license"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"time"
+)
+
+// 授权与抓包健康告警
+
+const (
+	defaultLicenseDays = 15
+	defaultDropRate    = 0.05
+	defaultStall       = 5 * time.Minute
+)
+
+// CheckLicense 检查授权，无效、已过期或即将到期时告警
+func CheckLicense() {
+	if err := license.CheckLicense(); err != nil {
+		Fire(types.Alert{
+			Type:     types.AlertLicense,
+			Severity: types.SeverityCritical,
+			Title:    "授权无效",
+			Message:  err.Error(),
+			Reason:   "invalid",
+		})
+		return
+	}
+	expire := config.Cfg.License.ExpireTime
+	if expire.IsZero() {
+		return
+	}
+	days := config.Cfg.Alert.LicenseDays
+	if days <= 0 {
+		days = defaultLicenseDays
+	}
+	left := time.Until(expire)
+	if left > time.Duration(days)*24*time.Hour {
+		return
+	}
+	Fire(types.Alert{
+		Type:     types.AlertLicense,
+		Severity: types.SeverityWarning,
+		Title:    "授权即将到期",
+		Message:  fmt.Sprintf("授权将于 %s 到期，剩余 %d 天", expire.Format("2006-01-02"), int(left.Hours()/24)),
+		Reason:   "expiring",
+	})
+}
+
+// CaptureFailed 抓包设备打开或过滤规则设置失败
+func CaptureFailed(source string, err error) {
+	Fire(types.Alert{
+		Type:     types.AlertCapture,
+		Severity: types.SeverityCritical,
+		Title:    "抓包失败",
+		Message:  fmt.Sprintf("%s: %v", source, err),
+		Reason:   "failed",
+		Labels:   map[string]string{"source": source},
+	})
+}
+
+// CaptureDropped 周期内丢包率超过阈值时告警
+func CaptureDropped(nic string, received, dropped int) {
+	total := received + dropped
+	if total == 0 || dropped == 0 {
+		return
+	}
+	threshold := config.Cfg.Alert.DropRate
+	if threshold <= 0 {
+		threshold = defaultDropRate
+	}
+	rate := float64(dropped) / float64(total)
+	if rate < threshold {
+		return
+	}
+	Fire(types.Alert{
+		Type:     types.AlertCapture,
+		Severity: types.SeverityWarning,
+		Title:    "抓包丢包率过高",
+		Message:  fmt.Sprintf("网卡 %s 丢包率 %.2f%%，接收 %d，丢弃 %d", nic, rate*100, received, dropped),
+		Reason:   "dropped",
+		Labels:   map[string]string{"nic": nic},
+	})
+}
+
+// CaptureStalled 网卡持续无数据包时告警，返回是否已达到告警时长
+func CaptureStalled(nic string, idle time.Duration) bool {
+	stall := defaultStall
+	if config.Cfg.Alert.Stall > 0 {
+		stall = time.Duration(config.Cfg.Alert.Stall) * time.Minute
+	}
+	if idle < stall {
+		return false
+	}
+	Fire(types.Alert{
+		Type:     types.AlertCapture,
+		Severity: types.SeverityCritical,
+		Title:    "网卡无数据包",
+		Message:  fmt.Sprintf("网卡 %s 已 %s 未收到数据包", nic, idle.Truncate(time.Second)),
+		Reason:   "stalled",
+		Labels:   map[string]string{"nic": nic},
+	})
+	return true
+}
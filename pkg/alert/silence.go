@@ -0,0 +1,104 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 告警静默
+// 保存在 config.alert_silence 集合，启动时加载至内存
+
+var (
+	ErrSilenceNotFound = errors.New("silence not found")
+	ErrSilenceEmpty    = errors.New("silence requires at least one matcher")
+
+	silences   = make(map[string]types.AlertSilence)
+	silencesMu sync.RWMutex
+)
+
+func loadSilences() error {
+	list, err := storage.Alerts().Silences(context.TODO())
+	if err != nil {
+		zap.L().Error("加载告警静默失败", zap.Error(err))
+		return err
+	}
+	silencesMu.Lock()
+	for _, s := range list {
+		silences[s.ID] = s
+	}
+	silencesMu.Unlock()
+	return nil
+}
+
+// Silences 静默列表，按创建时间倒序
+func Silences() []types.AlertSilence {
+	silencesMu.RLock()
+	defer silencesMu.RUnlock()
+	result := make([]types.AlertSilence, 0, len(silences))
+	for _, s := range silences {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	return result
+}
+
+// AddSilence 新增或更新静默
+func AddSilence(s types.AlertSilence) (types.AlertSilence, error) {
+	if s.Type == "" && s.Username == "" && s.IP == "" && s.Reason == "" {
+		return s, ErrSilenceEmpty
+	}
+	if s.ID == "" {
+		s.ID = primitive.NewObjectID().Hex()
+	}
+	now := time.Now()
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = now
+	}
+	if s.StartsAt.IsZero() {
+		s.StartsAt = now
+	}
+	if err := storage.Alerts().SaveSilence(context.TODO(), s); err != nil {
+		zap.L().Error("保存告警静默失败", zap.Error(err))
+		return s, err
+	}
+	silencesMu.Lock()
+	silences[s.ID] = s
+	silencesMu.Unlock()
+	zap.L().Info("新增告警静默", zap.String("type", string(s.Type)), zap.String("username", s.Username), zap.String("comment", s.Comment))
+	return s, nil
+}
+
+// DeleteSilence 删除静默
+func DeleteSilence(id string) error {
+	silencesMu.Lock()
+	defer silencesMu.Unlock()
+	if _, ok := silences[id]; !ok {
+		return ErrSilenceNotFound
+	}
+	if err := storage.Alerts().DeleteSilence(context.TODO(), id); err != nil {
+		zap.L().Error("删除告警静默失败", zap.Error(err))
+		return err
+	}
+	delete(silences, id)
+	return nil
+}
+
+func silenced(a types.Alert, now time.Time) bool {
+	silencesMu.RLock()
+	defer silencesMu.RUnlock()
+	for _, s := range silences {
+		if s.Match(a, now) {
+			return true
+		}
+	}
+	return false
+}
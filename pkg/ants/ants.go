@@ -33,3 +33,11 @@ func Submit(task func()) error {
 func Release() {
 	Pool.Release()
 }
+
+// Wait 等待池中任务执行完成或超时
+func Wait(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for Pool.Running() > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,378 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/retention"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 归档
+// 会话流、设备、代理判定等按时间分集合的数据按小时分区转换为 Parquet、CSV 或 JSONL 文件，
+// 路径为 <目录>/<数据集>/v<结构版本>/date=<日期>/hour=<小时>/，可直接被 Spark、DuckDB 按分区读取。
+// 小时结束并等待延迟后归档，之后到达的文档写入同一分区的新文件(见 manifest.go)；
+// 文件先写入临时文件再重命名，中断不会留下不完整的分区
+
+const (
+	FormatParquet = "parquet"
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+
+	defaultInterval = 10 * time.Minute
+	defaultDelay    = 10 * time.Minute
+)
+
+// Dataset 可归档的数据集
+type Dataset struct {
+	retention.Dataset
+	Schema Schema `json:"schema"`
+	// 集合时段超过一小时的数据集按该时间字段切分小时
+	TimeField string `json:"time_field,omitempty"`
+}
+
+var Datasets = []Dataset{
+	dataset(sessionSchema, ""),
+	dataset(deviceSchema, "last_seen"),
+	dataset(proxySchema, "last_seen"),
+	dataset(suspectedSchema, "last_seen"),
+}
+
+var running sync.Mutex
+
+func dataset(schema Schema, timeField string) Dataset {
+	d, ok := retention.Find(schema.Dataset)
+	if !ok {
+		panic("archive: unknown dataset " + schema.Dataset)
+	}
+	return Dataset{Dataset: d, Schema: schema, TimeField: timeField}
+}
+
+// Find 按名称查找数据集
+func Find(name string) (Dataset, bool) {
+	for _, d := range Datasets {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return Dataset{}, false
+}
+
+// Options 归档输出
+type Options struct {
+	Path        string
+	Format      string
+	Compression string
+	Force       bool // 重新归档，覆盖已存在的分区文件
+}
+
+// Result 单个小时分区的归档结果
+type Result struct {
+	Dataset string
+	Hour    time.Time
+	Path    string
+	Rows    int64
+	Skipped bool // 分区已归档且没有新文档
+}
+
+// DefaultOptions 配置中的归档输出
+func DefaultOptions() Options {
+	c := config.Cfg.Archive
+	opts := Options{Path: c.Path, Format: c.Format, Compression: c.Compression}
+	if opts.Path == "" {
+		opts.Path = filepath.Join(config.Home, "data", "archive")
+	}
+	if opts.Format == "" {
+		opts.Format = FormatParquet
+	}
+	return opts
+}
+
+// Validate 检查输出格式与压缩方式
+func (o Options) Validate() error {
+	_, err := newWriter(io.Discard, sessionSchema, o.Format, o.Compression, "")
+	return err
+}
+
+// Partition 小时分区文件路径
+func (o Options) Partition(d Dataset, hour time.Time) string {
+	return o.part(d, hour, 0)
+}
+
+// 小时分区的第 n 个文件，首个文件不带序号
+func (o Options) part(d Dataset, hour time.Time, n int) string {
+	name := fmt.Sprintf("%s-%s", d.Name, hour.Format("2006010215"))
+	if n > 0 {
+		name += fmt.Sprintf("-%d", n)
+	}
+	name += "." + o.Format
+	if o.Format != FormatParquet && o.Compression != "none" {
+		name += ".gz"
+	}
+	return filepath.Join(o.Path, d.Name, fmt.Sprintf("v%d", d.Schema.Version),
+		"date="+hour.Format("2006-01-02"), "hour="+hour.Format("15"), name)
+}
+
+// Export 归档 [from, to) 内已结束的小时，from 为零值时从最早的集合开始
+func (d Dataset) Export(ctx context.Context, from, to time.Time, opts Options, fn func(Result)) error {
+	collections, err := d.Collections()
+	if err != nil {
+		return err
+	}
+	for _, collection := range collections {
+		start, end, _ := d.Span(collection)
+		for hour := start; hour.Before(end); hour = hour.Add(time.Hour) {
+			if hour.Before(from) || hour.Add(time.Hour).After(to) {
+				continue
+			}
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			result := Result{Dataset: d.Name, Hour: hour, Path: opts.Partition(d, hour)}
+			if err = d.export(ctx, collection, hour, opts, &result); err != nil {
+				return fmt.Errorf("archive %s %s: %w", d.Name, hour.Format("2006-01-02 15:00"), err)
+			}
+			if fn != nil {
+				fn(result)
+			}
+		}
+	}
+	return nil
+}
+
+// 归档单个小时，分区已有文件时只把未归档的文档写入新文件
+func (d Dataset) export(ctx context.Context, collection string, hour time.Time, opts Options, result *Result) error {
+	index := manifestPath(result.Path)
+	var archived map[string]struct{}
+	if _, err := os.Stat(result.Path); err == nil && !opts.Force {
+		count, ok, err := archivedCount(index)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// 没有归档记录的分区(早期版本生成)无法区分新文档
+			result.Skipped = true
+			return nil
+		}
+		total, err := storage.Datasets().CountRange(ctx, d.Database, collection, d.timeRange(hour))
+		if err != nil {
+			return err
+		}
+		if uint64(total) <= count {
+			result.Skipped = true
+			return nil
+		}
+		if archived, err = loadManifest(index); err != nil {
+			return err
+		}
+		n := 1
+		for result.Path = opts.part(d, hour, n); exists(result.Path); result.Path = opts.part(d, hour, n) {
+			n++
+		}
+	} else if err = d.clean(hour, opts); err != nil {
+		return err
+	}
+
+	late := archived != nil
+	if !late {
+		archived = make(map[string]struct{})
+	}
+	rows, err := d.archive(ctx, collection, hour, result.Path, opts, archived, late)
+	if err != nil {
+		return err
+	}
+	result.Rows = rows
+	if late && rows == 0 {
+		result.Skipped = true
+		return nil
+	}
+	// 分区文件已重命名，中断于此时下次会重复归档这些文档，不会丢失
+	return saveManifest(index, archived)
+}
+
+// 删除小时分区的其他文件与归档记录，重新归档前调用
+func (d Dataset) clean(hour time.Time, opts Options) error {
+	base := opts.Partition(d, hour)
+	name := filepath.Base(base)
+	stem, ext, _ := strings.Cut(name, ".")
+	entries, err := os.ReadDir(filepath.Dir(base))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() == manifestName || strings.HasPrefix(e.Name(), stem+"-") && strings.HasSuffix(e.Name(), "."+ext) {
+			if err = os.Remove(filepath.Join(filepath.Dir(base), e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// 小时内文档的时间范围，按小时分集合时不过滤
+func (d Dataset) timeRange(hour time.Time) storage.TimeRange {
+	if d.Period == retention.PeriodHour {
+		return storage.TimeRange{}
+	}
+	return storage.TimeRange{Field: d.TimeField, From: hour, To: hour.Add(time.Hour)}
+}
+
+// 写入单个分区文件，跳过 archived 中的文档并记录写入的 _id；
+// 分区已有文件且没有新文档时不生成文件
+func (d Dataset) archive(ctx context.Context, collection string, hour time.Time, path string, opts Options, archived map[string]struct{}, late bool) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := func() (int64, error) {
+		w, err := newWriter(f, d.Schema, opts.Format, opts.Compression, "dpi-analyze version "+config.Version)
+		if err != nil {
+			return 0, err
+		}
+		var rows int64
+		err = storage.Datasets().ScanRange(ctx, d.Database, collection, d.timeRange(hour), func(doc bson.Raw) error {
+			id := doc.Lookup("_id")
+			key := string(append([]byte{byte(id.Type)}, id.Value...))
+			if _, ok := archived[key]; ok {
+				return nil
+			}
+			if err := w.Write(d.Schema.row(doc)); err != nil {
+				return err
+			}
+			archived[key] = struct{}{}
+			rows++
+			return nil
+		})
+		if err != nil {
+			return rows, err
+		}
+		if err = w.Close(); err != nil {
+			return rows, err
+		}
+		return rows, f.Sync()
+	}()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && late && rows == 0 {
+		_ = os.Remove(tmp)
+		return 0, nil
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return rows, err
+	}
+	return rows, nil
+}
+
+type writer interface {
+	Write(row Row) error
+	Close() error
+}
+
+func newWriter(w io.Writer, schema Schema, format, compression, createdBy string) (writer, error) {
+	switch format {
+	case FormatParquet:
+		return newParquetWriter(w, schema, compression, createdBy)
+	case FormatCSV, FormatJSONL:
+		return newTextWriter(w, schema, format, compression)
+	}
+	return nil, fmt.Errorf("unsupported archive format %q", format)
+}
+
+// Interval 归档检查间隔
+func Interval() time.Duration {
+	if config.Cfg.Archive.Interval > 0 {
+		return time.Duration(config.Cfg.Archive.Interval) * time.Minute
+	}
+	return defaultInterval
+}
+
+// 小时结束后等待的时长，等待延迟写入与暂存重放
+func delay() time.Duration {
+	if config.Cfg.Archive.Delay > 0 {
+		return time.Duration(config.Cfg.Archive.Delay) * time.Minute
+	}
+	return defaultDelay
+}
+
+// 配置中启用归档的数据集，默认仅会话流
+func enabled() []Dataset {
+	names := config.Cfg.Archive.Datasets
+	if len(names) == 0 {
+		names = []string{sessionSchema.Dataset}
+	}
+	var list []Dataset
+	for _, d := range Datasets {
+		if slices.Contains(names, d.Name) {
+			list = append(list, d)
+		}
+	}
+	return list
+}
+
+// Run 归档已结束的小时，由抓包进程定时调用
+func Run() {
+	if !config.Cfg.Archive.Enable {
+		return
+	}
+	if !running.TryLock() {
+		zap.L().Warn("上次归档尚未完成，跳过本次")
+		return
+	}
+	defer running.Unlock()
+
+	opts := DefaultOptions()
+	to := time.Now().Add(-delay())
+	for _, d := range enabled() {
+		err := d.Export(context.Background(), time.Time{}, to, opts, func(r Result) {
+			if !r.Skipped {
+				zap.L().Info("归档完成", zap.String("dataset", r.Dataset), zap.Time("hour", r.Hour),
+					zap.String("path", r.Path), zap.Int64("rows", r.Rows))
+			}
+		})
+		if err != nil {
+			zap.L().Error("归档失败", zap.String("dataset", d.Name), zap.Error(err))
+		}
+	}
+}
+
+// Setup 检查归档配置
+func Setup() error {
+	c := config.Cfg.Archive
+	if !c.Enable {
+		return nil
+	}
+	for _, name := range c.Datasets {
+		if _, ok := Find(name); !ok {
+			return fmt.Errorf("archive: unknown dataset %q", name)
+		}
+	}
+	return DefaultOptions().Validate()
+}
@@ -0,0 +1,232 @@
+package archive
+
+import (
+	"context"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"github.com/parquet-go/parquet-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testHour = time.Date(2026, 10, 19, 8, 0, 0, 0, time.Local)
+
+func setupStorage(t *testing.T) {
+	t.Helper()
+	config.Cfg = &config.Yaml{}
+	config.Cfg.Storage.Backend = storage.BackendMemory
+	config.RunDir = t.TempDir()
+	if err := storage.SetupClient(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = storage.Close() })
+	// 内存存储在进程内只初始化一次，清空其他测试写入的文档
+	if err := storage.Datasets().DropDatabase(context.Background(), types.MongoDatabaseStream); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func insertSessions(t *testing.T, docs ...bson.M) {
+	t.Helper()
+	list := make([]bson.Raw, len(docs))
+	for i, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list[i] = raw
+	}
+	collection := testHour.Format(types.MongoCollectionStreamLayout)
+	if err := storage.Sessions().InsertSessions(context.Background(), collection, list); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 用 parquet-go 读取分区文件，返回按 id 列索引、按列名取值的行
+func readParquet(t *testing.T, path string) map[string]map[string]parquet.Value {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := parquet.OpenFile(f, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := file.Schema().Columns()
+	reader := parquet.NewReader(file)
+	defer reader.Close()
+
+	rows := make(map[string]map[string]parquet.Value)
+	buf := make([]parquet.Row, 16)
+	for {
+		n, err := reader.ReadRows(buf)
+		for _, row := range buf[:n] {
+			values := make(map[string]parquet.Value, len(row))
+			for _, v := range row.Clone() {
+				values[columns[v.Column()][0]] = v
+			}
+			rows[string(values["id"].ByteArray())] = values
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if int64(len(rows)) != file.NumRows() {
+		t.Fatalf("read %d rows, metadata has %d", len(rows), file.NumRows())
+	}
+	return rows
+}
+
+// 文件元数据：数据集、结构版本、时间列逻辑类型与列块压缩编码
+func checkMetadata(t *testing.T, path, compression string) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, _ := f.Stat()
+	file, err := parquet.OpenFile(f, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := file.Lookup("dpi.dataset"); v != "streams" {
+		t.Errorf("dpi.dataset = %q", v)
+	}
+	if v, _ := file.Lookup("dpi.schema.version"); v != "1" {
+		t.Errorf("dpi.schema.version = %q", v)
+	}
+	if leaf, ok := file.Schema().Lookup("start_time"); !ok || leaf.Node.Type().LogicalType().Timestamp == nil {
+		t.Errorf("start_time is not a timestamp column")
+	}
+	codec, _ := parquetCodec(compression)
+	for _, c := range file.Metadata().RowGroups[0].Columns {
+		if c.MetaData.Codec != codec.CompressionCodec() {
+			t.Fatalf("column %v codec %v, want %v", c.MetaData.PathInSchema, c.MetaData.Codec, codec.CompressionCodec())
+		}
+	}
+}
+
+func export(t *testing.T, d Dataset, opts Options) []Result {
+	t.Helper()
+	var results []Result
+	err := d.Export(context.Background(), time.Time{}, testHour.Add(2*time.Hour), opts, func(r Result) {
+		results = append(results, r)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("export got %d results, want 1", len(results))
+	}
+	return results
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	setupStorage(t)
+	id := primitive.NewObjectID()
+	start := testHour.Add(5 * time.Minute).Truncate(time.Millisecond)
+	insertSessions(t,
+		bson.M{
+			"_id": id, "src_ip": "10.0.0.1", "src_port": int32(443), "packet_count": int64(1) << 40,
+			"start_time":     primitive.NewDateTimeFromTime(start),
+			"protocol_flags": bson.M{"tcp": bson.M{"syn": true}},
+			"metadata":       bson.M{"http_info": bson.M{"urls": bson.A{"/a", "/b"}}},
+		},
+		bson.M{"_id": "empty"},
+	)
+	d, _ := Find("streams")
+
+	for _, compression := range []string{"snappy", "zstd", "gzip", "none"} {
+		t.Run(compression, func(t *testing.T) {
+			opts := Options{Path: t.TempDir(), Format: FormatParquet, Compression: compression}
+			r := export(t, d, opts)[0]
+			if r.Rows != 2 || r.Skipped {
+				t.Fatalf("result %+v", r)
+			}
+			rows := readParquet(t, r.Path)
+			if len(rows) != 2 {
+				t.Fatalf("read %d rows", len(rows))
+			}
+			full, empty := rows[id.Hex()], rows["empty"]
+			if full == nil || empty == nil {
+				t.Fatalf("rows %v", rows)
+			}
+			if string(full["src_ip"].ByteArray()) != "10.0.0.1" {
+				t.Errorf("src_ip = %s", full["src_ip"])
+			}
+			if full["src_port"].Int32() != 443 || full["packet_count"].Int64() != 1<<40 {
+				t.Errorf("integer columns: src_port %s packet_count %s", full["src_port"], full["packet_count"])
+			}
+			if full["start_time"].Int64() != start.UnixMicro() {
+				t.Errorf("start_time = %d, want %d", full["start_time"].Int64(), start.UnixMicro())
+			}
+			if !full["tcp_syn"].Boolean() || !full["tcp_ack"].IsNull() {
+				t.Errorf("bool columns: tcp_syn %s tcp_ack %s", full["tcp_syn"], full["tcp_ack"])
+			}
+			if string(full["http_urls"].ByteArray()) != `["/a","/b"]` {
+				t.Errorf("http_urls = %s", full["http_urls"])
+			}
+			for _, name := range []string{"src_ip", "src_port", "packet_count", "start_time", "tcp_syn"} {
+				if !empty[name].IsNull() {
+					t.Errorf("missing %s = %s, want null", name, empty[name])
+				}
+			}
+			checkMetadata(t, r.Path, compression)
+		})
+	}
+}
+
+func TestLateRows(t *testing.T) {
+	setupStorage(t)
+	insertSessions(t, bson.M{"_id": "a", "src_ip": "10.0.0.1"}, bson.M{"_id": "b", "src_ip": "10.0.0.2"})
+	d, _ := Find("streams")
+	opts := Options{Path: t.TempDir(), Format: FormatParquet}
+	base := opts.Partition(d, testHour)
+
+	if r := export(t, d, opts)[0]; r.Path != base || r.Rows != 2 {
+		t.Fatalf("first export %+v", r)
+	}
+	if r := export(t, d, opts)[0]; !r.Skipped {
+		t.Fatalf("export without new rows %+v", r)
+	}
+
+	// 分区文件生成后到达的文档写入新文件
+	insertSessions(t, bson.M{"_id": "c", "src_ip": "10.0.0.3"})
+	r := export(t, d, opts)[0]
+	if r.Skipped || r.Rows != 1 || r.Path != opts.part(d, testHour, 1) {
+		t.Fatalf("late export %+v", r)
+	}
+	rows := readParquet(t, r.Path)
+	if _, ok := rows["c"]; len(rows) != 1 || !ok {
+		t.Fatalf("late part rows %v", rows)
+	}
+	if r = export(t, d, opts)[0]; !r.Skipped {
+		t.Fatalf("export after late part %+v", r)
+	}
+
+	// 覆盖时合并为单个文件
+	opts.Force = true
+	if r = export(t, d, opts)[0]; r.Path != base || r.Rows != 3 {
+		t.Fatalf("forced export %+v", r)
+	}
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(base), "*"))
+	if len(files) != 2 || len(readParquet(t, base)) != 3 {
+		t.Fatalf("partition files after force %v", files)
+	}
+}
@@ -0,0 +1,107 @@
+package archive
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// 分区归档记录
+// 小时分区目录下的 _archived 记录已写入分区文件的文档 _id，文件头为数量。
+// 分区文件生成后才到达的文档(延迟写入、暂存重放)写入同目录的新分区文件，不重复归档已写入的文档。
+// 以 _ 开头的文件会被 Spark、DuckDB 读取目录时忽略
+
+const manifestName = "_archived"
+
+func manifestPath(partition string) string {
+	return filepath.Join(filepath.Dir(partition), manifestName)
+}
+
+// 已归档的文档数量，记录不存在时 ok 为 false
+func archivedCount(path string) (count uint64, ok bool, err error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+	var head [8]byte
+	if _, err = io.ReadFull(f, head[:]); err != nil {
+		return 0, false, err
+	}
+	return binary.BigEndian.Uint64(head[:]), true, nil
+}
+
+// 读取已归档的 _id，键为 bson 类型字节与值
+func loadManifest(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var head [8]byte
+	if _, err = io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+	count := binary.BigEndian.Uint64(head[:])
+	ids := make(map[string]struct{}, count)
+	for i := uint64(0); i < count; i++ {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		id := make([]byte, n)
+		if _, err = io.ReadFull(r, id); err != nil {
+			return nil, err
+		}
+		ids[string(id)] = struct{}{}
+	}
+	return ids, nil
+}
+
+// 写入归档记录，先写临时文件再重命名
+func saveManifest(path string, ids map[string]struct{}) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = func() error {
+		w := bufio.NewWriter(f)
+		var buf [binary.MaxVarintLen64]byte
+		binary.BigEndian.PutUint64(buf[:8], uint64(len(ids)))
+		if _, err := w.Write(buf[:8]); err != nil {
+			return err
+		}
+		for id := range ids {
+			n := binary.PutUvarint(buf[:], uint64(len(id)))
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+			if _, err := w.WriteString(id); err != nil {
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		return f.Sync()
+	}()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
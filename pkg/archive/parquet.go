@@ -0,0 +1,126 @@
+package archive
+
+import (
+	"fmt"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"io"
+	"time"
+)
+
+// Parquet 写入
+// 由 parquet-go 按数据集结构生成扁平 schema，所有列为 OPTIONAL，页内容按配置压缩；
+// 数据集名称与结构版本写入文件的 key/value 元数据
+
+const (
+	rowGroupRows = 50000
+	writeBatch   = 256
+)
+
+type parquetWriter struct {
+	w       *parquet.GenericWriter[any]
+	columns []int // 数据集列 -> parquet 叶子列
+	types   []ColumnType
+	rows    []parquet.Row
+}
+
+func parquetCodec(compression string) (compress.Codec, error) {
+	switch compression {
+	case "", "snappy":
+		return &parquet.Snappy, nil
+	case "zstd":
+		return &parquet.Zstd, nil
+	case "gzip":
+		return &parquet.Gzip, nil
+	case "none":
+		return &parquet.Uncompressed, nil
+	}
+	return nil, fmt.Errorf("unsupported parquet compression %q", compression)
+}
+
+// 列类型对应的 parquet 节点，JSON 列以 UTF8 字符串保存
+func parquetNode(typ ColumnType) parquet.Node {
+	switch typ {
+	case TypeInt32:
+		return parquet.Int(32)
+	case TypeInt64:
+		return parquet.Int(64)
+	case TypeDouble:
+		return parquet.Leaf(parquet.DoubleType)
+	case TypeBool:
+		return parquet.Leaf(parquet.BooleanType)
+	case TypeTimestamp:
+		return parquet.Timestamp(parquet.Microsecond)
+	}
+	return parquet.String()
+}
+
+func newParquetWriter(w io.Writer, schema Schema, compression, createdBy string) (*parquetWriter, error) {
+	codec, err := parquetCodec(compression)
+	if err != nil {
+		return nil, err
+	}
+	group := make(parquet.Group, len(schema.Columns))
+	for _, c := range schema.Columns {
+		group[c.Name] = parquet.Optional(parquetNode(c.Type))
+	}
+	ps := parquet.NewSchema("schema", group)
+	p := &parquetWriter{
+		columns: make([]int, len(schema.Columns)),
+		types:   make([]ColumnType, len(schema.Columns)),
+	}
+	for i, c := range schema.Columns {
+		leaf, _ := ps.Lookup(c.Name)
+		p.columns[i], p.types[i] = leaf.ColumnIndex, c.Type
+	}
+	p.w = parquet.NewGenericWriter[any](w,
+		ps,
+		parquet.Compression(codec),
+		parquet.MaxRowsPerRowGroup(rowGroupRows),
+		&parquet.WriterConfig{CreatedBy: createdBy},
+		parquet.KeyValueMetadata("dpi.dataset", schema.Dataset),
+		parquet.KeyValueMetadata("dpi.schema.version", fmt.Sprint(schema.Version)),
+	)
+	return p, nil
+}
+
+func (p *parquetWriter) Write(row Row) error {
+	values := make(parquet.Row, len(row))
+	for i, v := range row {
+		column := p.columns[i]
+		if v == nil {
+			values[column] = parquet.NullValue().Level(0, 0, column)
+			continue
+		}
+		var value parquet.Value
+		switch p.types[i] {
+		case TypeTimestamp:
+			value = parquet.Int64Value(v.(time.Time).UnixMicro())
+		default:
+			value = parquet.ValueOf(v)
+		}
+		values[column] = value.Level(0, 1, column)
+	}
+	p.rows = append(p.rows, values)
+	if len(p.rows) >= writeBatch {
+		return p.flush()
+	}
+	return nil
+}
+
+func (p *parquetWriter) flush() error {
+	if len(p.rows) == 0 {
+		return nil
+	}
+	_, err := p.w.WriteRows(p.rows)
+	p.rows = p.rows[:0]
+	return err
+}
+
+// Close 写出剩余行与文件尾
+func (p *parquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	return p.w.Close()
+}
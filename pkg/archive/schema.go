@@ -0,0 +1,259 @@
+package archive
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 归档结构
+// 每个数据集的列固定并带版本号，版本号写入分区路径与 Parquet 元数据；
+// 列的增删或类型变化需要升级版本，旧版本的文件保留在原路径下
+
+// ColumnType 列类型
+type ColumnType string
+
+const (
+	TypeString    ColumnType = "string"
+	TypeInt32     ColumnType = "int32"
+	TypeInt64     ColumnType = "int64"
+	TypeDouble    ColumnType = "double"
+	TypeBool      ColumnType = "bool"
+	TypeTimestamp ColumnType = "timestamp" // UTC 微秒
+	TypeJSON      ColumnType = "json"      // 数组、嵌套文档，以 JSON 字符串保存
+)
+
+// Column 列，Path 为 bson 字段路径
+type Column struct {
+	Name string     `json:"name"`
+	Type ColumnType `json:"type"`
+	Path []string   `json:"path"`
+}
+
+// Schema 数据集结构
+type Schema struct {
+	Dataset string   `json:"dataset"`
+	Version int      `json:"version"`
+	Columns []Column `json:"columns"`
+}
+
+func col(name string, typ ColumnType, path ...string) Column {
+	if len(path) == 0 {
+		path = []string{name}
+	}
+	return Column{Name: name, Type: typ, Path: path}
+}
+
+var sessionSchema = Schema{
+	Dataset: "streams",
+	Version: 1,
+	Columns: []Column{
+		col("id", TypeString, "_id"),
+		col("ident", TypeString),
+		col("session_id", TypeString),
+		col("src_ip", TypeString),
+		col("dst_ip", TypeString),
+		col("src_port", TypeInt32),
+		col("dst_port", TypeInt32),
+		col("protocol", TypeString),
+		col("application_protocol", TypeString),
+		col("packet_count", TypeInt64),
+		col("byte_count", TypeInt64),
+		col("miss_bytes", TypeInt64),
+		col("out_of_order_packets", TypeInt64),
+		col("out_of_order_bytes", TypeInt64),
+		col("overlap_bytes", TypeInt64),
+		col("overlap_packets", TypeInt64),
+		col("start_time", TypeTimestamp),
+		col("end_time", TypeTimestamp),
+		col("tcp_syn", TypeBool, "protocol_flags", "tcp", "syn"),
+		col("tcp_ack", TypeBool, "protocol_flags", "tcp", "ack"),
+		col("tcp_fin", TypeBool, "protocol_flags", "tcp", "fin"),
+		col("tcp_rst", TypeBool, "protocol_flags", "tcp", "rst"),
+		col("udp_dns", TypeBool, "protocol_flags", "udp", "is_dns"),
+		col("http_host", TypeString, "metadata", "http_info", "host"),
+		col("http_user_agent", TypeString, "metadata", "http_info", "user_agent"),
+		col("http_urls", TypeJSON, "metadata", "http_info", "urls"),
+		col("http_content_type", TypeString, "metadata", "http_info", "content_type"),
+		col("http_upgrade", TypeString, "metadata", "http_info", "upgrade"),
+		col("dns_query_name", TypeString, "metadata", "dns_info", "query_name"),
+		col("dns_response_ip", TypeString, "metadata", "dns_info", "response_ip"),
+		col("tls_version", TypeString, "metadata", "tls_info", "version"),
+		col("tls_cipher_suite", TypeString, "metadata", "tls_info", "cipher_suite"),
+		col("tls_sni", TypeString, "metadata", "tls_info", "sni"),
+		col("rtp_codec", TypeString, "metadata", "rtp_info", "codec"),
+		col("rtp_bitrate", TypeString, "metadata", "rtp_info", "bitrate"),
+		col("app_name", TypeString, "metadata", "application_info", "app_name"),
+		col("app_category", TypeString, "metadata", "application_info", "app_category"),
+	},
+}
+
+var deviceSchema = Schema{
+	Dataset: "devices",
+	Version: 1,
+	Columns: []Column{
+		col("id", TypeString, "_id"),
+		col("ip", TypeString),
+		col("origin_chanel", TypeString),
+		col("origin_value", TypeString),
+		col("type", TypeString),
+		col("class", TypeString),
+		col("os", TypeString),
+		col("version", TypeString),
+		col("device", TypeString),
+		col("brand", TypeString),
+		col("model", TypeString),
+		col("description", TypeString),
+		col("remark", TypeString),
+		col("last_seen", TypeTimestamp),
+	},
+}
+
+var proxySchema = Schema{
+	Dataset: "proxy",
+	Version: 1,
+	Columns: []Column{
+		col("id", TypeString, "_id"),
+		col("ip", TypeString),
+		col("username", TypeString),
+		col("all_count", TypeInt64),
+		col("mobile_count", TypeInt64),
+		col("pc_count", TypeInt64),
+		col("class_count", TypeJSON),
+		col("action", TypeString),
+		col("devices", TypeJSON),
+		col("last_seen", TypeTimestamp),
+	},
+}
+
+var suspectedSchema = Schema{
+	Dataset: "suspected",
+	Version: 1,
+	Columns: []Column{
+		col("id", TypeString, "_id"),
+		col("ip", TypeString),
+		col("username", TypeString),
+		col("reason_category", TypeString),
+		col("reason_name", TypeString, "reason_detail", "name"),
+		col("reason_value", TypeString, "reason_detail", "value"),
+		col("reason_threshold", TypeString, "reason_detail", "threshold"),
+		col("reason_description", TypeString, "reason_detail", "description"),
+		col("reason_extra_info", TypeString, "reason_detail", "extra_info"),
+		col("tags", TypeJSON),
+		col("context_device", TypeString, "context", "device"),
+		col("remark", TypeString),
+		col("baseline", TypeJSON),
+		col("last_seen", TypeTimestamp),
+	},
+}
+
+// Row 按列顺序排列的值，空值为 nil，
+// 其余为 string、int32、int64、float64、bool 或 time.Time
+type Row []any
+
+// row 按结构从 bson 文档取值，缺失或无法转换的值为空
+func (s Schema) row(doc bson.Raw) Row {
+	row := make(Row, len(s.Columns))
+	for i, c := range s.Columns {
+		rv, err := doc.LookupErr(c.Path...)
+		if err != nil || rv.Type == bsontype.Null || rv.Type == bsontype.Undefined {
+			continue
+		}
+		row[i] = convert(c.Type, rv)
+	}
+	return row
+}
+
+func convert(typ ColumnType, rv bson.RawValue) any {
+	switch typ {
+	case TypeString:
+		return toString(rv)
+	case TypeInt32:
+		if v, ok := toInt(rv); ok && v == int64(int32(v)) {
+			return int32(v)
+		}
+	case TypeInt64:
+		if v, ok := toInt(rv); ok {
+			return v
+		}
+	case TypeDouble:
+		switch rv.Type {
+		case bsontype.Double:
+			return rv.Double()
+		case bsontype.Int32, bsontype.Int64:
+			v, _ := toInt(rv)
+			return float64(v)
+		}
+	case TypeBool:
+		if b, ok := rv.BooleanOK(); ok {
+			return b
+		}
+	case TypeTimestamp:
+		if ms, ok := rv.DateTimeOK(); ok {
+			t := time.UnixMilli(ms).UTC()
+			// 零值时间视为空
+			if t.Year() > 1 {
+				return t
+			}
+		}
+	case TypeJSON:
+		if s, err := toJSON(rv); err == nil {
+			return s
+		}
+	}
+	return nil
+}
+
+// 字符串列，非字符串的值转为文本
+func toString(rv bson.RawValue) any {
+	switch rv.Type {
+	case bsontype.String:
+		return rv.StringValue()
+	case bsontype.ObjectID:
+		return rv.ObjectID().Hex()
+	case bsontype.Int32, bsontype.Int64:
+		v, _ := toInt(rv)
+		return strconv.FormatInt(v, 10)
+	case bsontype.Double:
+		return strconv.FormatFloat(rv.Double(), 'f', -1, 64)
+	case bsontype.Boolean:
+		return strconv.FormatBool(rv.Boolean())
+	case bsontype.DateTime:
+		return rv.Time().UTC().Format(time.RFC3339Nano)
+	}
+	if s, err := toJSON(rv); err == nil {
+		return s
+	}
+	return nil
+}
+
+func toInt(rv bson.RawValue) (int64, bool) {
+	switch rv.Type {
+	case bsontype.Int32:
+		return int64(rv.Int32()), true
+	case bsontype.Int64:
+		return rv.Int64(), true
+	case bsontype.Double:
+		return int64(rv.Double()), true
+	case bsontype.String:
+		v, err := strconv.ParseInt(strings.TrimSpace(rv.StringValue()), 10, 64)
+		return v, err == nil
+	}
+	return 0, false
+}
+
+// 以宽松扩展 JSON 编码
+func toJSON(rv bson.RawValue) (string, error) {
+	data, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: rv}}, false, false)
+	if err != nil {
+		return "", err
+	}
+	const prefix = `{"v":`
+	if len(data) < len(prefix)+1 || string(data[:len(prefix)]) != prefix {
+		return "", errors.New("unexpected extended json")
+	}
+	return string(data[len(prefix) : len(data)-1]), nil
+}
@@ -0,0 +1,125 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// CSV、JSONL 写入
+// CSV 首行为列名，空值为空字符串；JSONL 每行一个对象，JSON 列嵌入为原始 JSON。
+// 时间为 UTC RFC3339，gzip 压缩时整个文件为一个 gzip 流
+
+const timeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+type textWriter struct {
+	schema Schema
+	csv    *csv.Writer
+	buf    *bufio.Writer
+	gz     *gzip.Writer
+	record []string
+}
+
+func newTextWriter(w io.Writer, schema Schema, format, compression string) (*textWriter, error) {
+	t := &textWriter{schema: schema}
+	switch compression {
+	case "", "gzip":
+		t.gz = gzip.NewWriter(w)
+		w = t.gz
+	case "none":
+	default:
+		return nil, fmt.Errorf("unsupported %s compression %q", format, compression)
+	}
+	t.buf = bufio.NewWriterSize(w, 256<<10)
+	if format == FormatCSV {
+		t.csv = csv.NewWriter(t.buf)
+		t.record = make([]string, len(schema.Columns))
+		for i, c := range schema.Columns {
+			t.record[i] = c.Name
+		}
+		if err := t.csv.Write(t.record); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *textWriter) Write(row Row) error {
+	if t.csv != nil {
+		for i, v := range row {
+			t.record[i] = textValue(v)
+		}
+		return t.csv.Write(t.record)
+	}
+
+	line := make([]byte, 0, 512)
+	line = append(line, '{')
+	for i, c := range t.schema.Columns {
+		if i > 0 {
+			line = append(line, ',')
+		}
+		line = strconv.AppendQuote(line, c.Name)
+		line = append(line, ':')
+		switch v := row[i].(type) {
+		case nil:
+			line = append(line, "null"...)
+		case string:
+			if c.Type == TypeJSON {
+				line = append(line, v...)
+				break
+			}
+			data, _ := json.Marshal(v)
+			line = append(line, data...)
+		case time.Time:
+			line = append(line, '"')
+			line = v.AppendFormat(line, timeLayout)
+			line = append(line, '"')
+		default:
+			line = append(line, textValue(v)...)
+		}
+	}
+	line = append(line, '}', '\n')
+	_, err := t.buf.Write(line)
+	return err
+}
+
+func (t *textWriter) Close() error {
+	if t.csv != nil {
+		t.csv.Flush()
+		if err := t.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if err := t.buf.Flush(); err != nil {
+		return err
+	}
+	if t.gz != nil {
+		return t.gz.Close()
+	}
+	return nil
+}
+
+func textValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(timeLayout)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,271 @@
+package bus
+
+import (
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"go.uber.org/zap"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// 内部事件总线
+// 按主题发布订阅，每个订阅者拥有独立缓冲与消费协程，缓冲满时按丢弃策略处理，
+// 慢消费者不会阻塞生产方（block 策略除外）；新增消费者只需订阅主题，无需修改生产方
+
+type Policy string
+
+const (
+	PolicyBlock      Policy = "block"       // 阻塞发布方，用于不可丢失的状态同步
+	PolicyDropNewest Policy = "drop_newest" // 丢弃新事件
+	PolicyDropOldest Policy = "drop_oldest" // 丢弃缓冲中最旧的事件
+
+	defaultBuffer = 1024
+)
+
+// Options 订阅选项，零值使用配置中的默认值
+type Options struct {
+	Buffer int
+	Policy Policy
+}
+
+var (
+	registry   = make(map[string]topicStats)
+	registryMu sync.RWMutex
+)
+
+type topicStats interface {
+	stats() TopicStats
+}
+
+// TopicStats 主题统计
+type TopicStats struct {
+	Topic       string            `json:"topic"`
+	Published   int64             `json:"published"`
+	Subscribers []SubscriberStats `json:"subscribers"`
+}
+
+// SubscriberStats 订阅者统计
+type SubscriberStats struct {
+	Name      string `json:"name"`
+	Policy    Policy `json:"policy"`
+	Buffer    int    `json:"buffer"`
+	Queued    int    `json:"queued"`
+	Delivered int64  `json:"delivered"`
+	Dropped   int64  `json:"dropped"`
+	Handled   int64  `json:"handled"`
+	Panics    int64  `json:"panics"`
+}
+
+// Topic 类型化主题
+type Topic[T any] struct {
+	name      string
+	mu        sync.RWMutex
+	subs      []*subscriber[T]
+	published atomic.Int64
+}
+
+type subscriber[T any] struct {
+	name      string
+	policy    Policy
+	queue     chan T
+	filter    func(T) bool
+	handler   func(T)
+	delivered atomic.Int64
+	dropped   atomic.Int64
+	handled   atomic.Int64
+	panics    atomic.Int64
+}
+
+// Subscription 订阅句柄
+type Subscription struct {
+	close func()
+}
+
+// Close 取消订阅，缓冲中剩余事件处理完后消费协程退出
+func (s *Subscription) Close() {
+	s.close()
+}
+
+// NewTopic 创建主题并注册到统计
+func NewTopic[T any](name string) *Topic[T] {
+	t := &Topic[T]{name: name}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("duplicate bus topic: %s", name))
+	}
+	registry[name] = t
+	return t
+}
+
+// Name 主题名称
+func (t *Topic[T]) Name() string {
+	return t.name
+}
+
+// Subscribe 订阅主题，handler 在订阅者独立协程中顺序执行
+func (t *Topic[T]) Subscribe(name string, opts Options, handler func(T)) *Subscription {
+	return t.SubscribeWhere(name, opts, nil, handler)
+}
+
+// SubscribeWhere 带过滤的订阅，filter 在发布方执行，未命中的事件不占用缓冲
+func (t *Topic[T]) SubscribeWhere(name string, opts Options, filter func(T) bool, handler func(T)) *Subscription {
+	opts = resolve(name, opts)
+	s := &subscriber[T]{
+		name:    name,
+		policy:  opts.Policy,
+		queue:   make(chan T, opts.Buffer),
+		filter:  filter,
+		handler: handler,
+	}
+	t.mu.Lock()
+	t.subs = append(t.subs, s)
+	t.mu.Unlock()
+	go s.run()
+	zap.L().Debug("bus subscribe", zap.String("topic", t.name), zap.String("subscriber", name),
+		zap.Int("buffer", opts.Buffer), zap.String("policy", string(opts.Policy)))
+
+	var once sync.Once
+	return &Subscription{close: func() {
+		once.Do(func() {
+			t.mu.Lock()
+			for i, sub := range t.subs {
+				if sub == s {
+					t.subs = append(t.subs[:i:i], t.subs[i+1:]...)
+					break
+				}
+			}
+			t.mu.Unlock()
+			close(s.queue)
+		})
+	}}
+}
+
+// Publish 发布事件
+func (t *Topic[T]) Publish(v T) {
+	t.published.Add(1)
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, s := range t.subs {
+		if s.filter != nil && !s.filter(v) {
+			continue
+		}
+		s.deliver(v)
+	}
+}
+
+func (t *Topic[T]) stats() TopicStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	result := TopicStats{Topic: t.name, Published: t.published.Load(), Subscribers: make([]SubscriberStats, 0, len(t.subs))}
+	for _, s := range t.subs {
+		result.Subscribers = append(result.Subscribers, SubscriberStats{
+			Name:      s.name,
+			Policy:    s.policy,
+			Buffer:    cap(s.queue),
+			Queued:    len(s.queue),
+			Delivered: s.delivered.Load(),
+			Dropped:   s.dropped.Load(),
+			Handled:   s.handled.Load(),
+			Panics:    s.panics.Load(),
+		})
+	}
+	return result
+}
+
+func (s *subscriber[T]) deliver(v T) {
+	switch s.policy {
+	case PolicyBlock:
+		s.queue <- v
+	case PolicyDropOldest:
+		select {
+		case s.queue <- v:
+		default:
+			// 腾出一个位置后重试，并发发布时仍可能失败
+			select {
+			case <-s.queue:
+				s.dropped.Add(1)
+			default:
+			}
+			select {
+			case s.queue <- v:
+			default:
+				s.dropped.Add(1)
+				return
+			}
+		}
+	default:
+		select {
+		case s.queue <- v:
+		default:
+			s.dropped.Add(1)
+			return
+		}
+	}
+	s.delivered.Add(1)
+}
+
+func (s *subscriber[T]) run() {
+	for v := range s.queue {
+		s.handle(v)
+	}
+}
+
+// 单个事件处理异常不影响后续消费
+func (s *subscriber[T]) handle(v T) {
+	defer func() {
+		if r := recover(); r != nil {
+			if n := s.panics.Add(1); n == 1 || n%1000 == 0 {
+				zap.L().Error("bus subscriber panic", zap.String("subscriber", s.name), zap.Int64("panics", n), zap.Any("recover", r))
+			}
+		}
+	}()
+	s.handler(v)
+	s.handled.Add(1)
+}
+
+// 合并订阅选项：配置中按名称的覆盖 > 代码指定 > 配置默认值 > 内置默认值
+func resolve(name string, opts Options) Options {
+	var c config.EventBus
+	if config.Cfg != nil {
+		c = config.Cfg.EventBus
+	}
+	if override, ok := c.Subscribers[name]; ok {
+		if override.Buffer > 0 {
+			opts.Buffer = override.Buffer
+		}
+		if override.Policy != "" {
+			opts.Policy = Policy(override.Policy)
+		}
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = c.Buffer
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = defaultBuffer
+	}
+	if opts.Policy == "" {
+		opts.Policy = Policy(c.Policy)
+	}
+	switch opts.Policy {
+	case PolicyBlock, PolicyDropNewest, PolicyDropOldest:
+	default:
+		opts.Policy = PolicyDropNewest
+	}
+	return opts
+}
+
+// GetStats 各主题统计
+func GetStats() []TopicStats {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	result := make([]TopicStats, 0, len(registry))
+	for _, t := range registry {
+		result = append(result, t.stats())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Topic < result[j].Topic
+	})
+	return result
+}
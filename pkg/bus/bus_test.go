@@ -0,0 +1,181 @@
+package bus
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var topicSeq atomic.Int64
+
+// 主题名称全局唯一，重复执行测试时追加序号
+func newTestTopic(t *testing.T) *Topic[int] {
+	return NewTopic[int](fmt.Sprintf("test_%s_%d", t.Name(), topicSeq.Add(1)))
+}
+
+// 处理第一个事件时阻塞，直到 release 后顺序处理其余事件
+type gatedHandler struct {
+	started chan struct{}
+	gate    chan struct{}
+	mu      sync.Mutex
+	got     []int
+	done    chan struct{}
+	want    int
+}
+
+func newGatedHandler(want int) *gatedHandler {
+	return &gatedHandler{started: make(chan struct{}), gate: make(chan struct{}), done: make(chan struct{}), want: want}
+}
+
+func (h *gatedHandler) handle(v int) {
+	h.mu.Lock()
+	h.got = append(h.got, v)
+	n := len(h.got)
+	h.mu.Unlock()
+	if n == 1 {
+		close(h.started)
+		<-h.gate
+	}
+	if n == h.want {
+		close(h.done)
+	}
+}
+
+func (h *gatedHandler) wait(t *testing.T) []int {
+	t.Helper()
+	select {
+	case <-h.done:
+	case <-time.After(time.Second):
+		t.Fatal("events not handled")
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]int(nil), h.got...)
+}
+
+func subscriberStats(topic *Topic[int]) SubscriberStats {
+	return topic.stats().Subscribers[0]
+}
+
+func TestDropNewest(t *testing.T) {
+	topic := newTestTopic(t)
+	h := newGatedHandler(3)
+	sub := topic.Subscribe("drop_newest", Options{Buffer: 2, Policy: PolicyDropNewest}, h.handle)
+	defer sub.Close()
+
+	topic.Publish(1)
+	<-h.started
+	for v := 2; v <= 4; v++ {
+		topic.Publish(v)
+	}
+	close(h.gate)
+	if got := fmt.Sprint(h.wait(t)); got != "[1 2 3]" {
+		t.Fatalf("handled %s", got)
+	}
+	if s := subscriberStats(topic); s.Dropped != 1 || s.Delivered != 3 || s.Policy != PolicyDropNewest || s.Buffer != 2 {
+		t.Fatalf("stats %+v", s)
+	}
+}
+
+func TestDropOldest(t *testing.T) {
+	topic := newTestTopic(t)
+	h := newGatedHandler(3)
+	sub := topic.Subscribe("drop_oldest", Options{Buffer: 2, Policy: PolicyDropOldest}, h.handle)
+	defer sub.Close()
+
+	topic.Publish(1)
+	<-h.started
+	for v := 2; v <= 4; v++ {
+		topic.Publish(v)
+	}
+	close(h.gate)
+	if got := fmt.Sprint(h.wait(t)); got != "[1 3 4]" {
+		t.Fatalf("handled %s", got)
+	}
+	if s := subscriberStats(topic); s.Dropped != 1 || s.Delivered != 4 {
+		t.Fatalf("stats %+v", s)
+	}
+}
+
+func TestBlock(t *testing.T) {
+	topic := newTestTopic(t)
+	h := newGatedHandler(3)
+	sub := topic.Subscribe("block", Options{Buffer: 1, Policy: PolicyBlock}, h.handle)
+	defer sub.Close()
+
+	topic.Publish(1)
+	<-h.started
+	topic.Publish(2)
+	published := make(chan struct{})
+	go func() {
+		topic.Publish(3)
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("publish returned while the buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(h.gate)
+	<-published
+	if got := fmt.Sprint(h.wait(t)); got != "[1 2 3]" {
+		t.Fatalf("handled %s", got)
+	}
+	if s := subscriberStats(topic); s.Dropped != 0 || s.Delivered != 3 {
+		t.Fatalf("stats %+v", s)
+	}
+}
+
+func TestClose(t *testing.T) {
+	topic := newTestTopic(t)
+	h := newGatedHandler(2)
+	sub := topic.Subscribe("close", Options{Buffer: 4}, h.handle)
+
+	topic.Publish(1)
+	<-h.started
+	topic.Publish(2)
+	sub.Close()
+	sub.Close()
+	// 取消订阅后不再投递，缓冲中剩余事件仍会处理
+	topic.Publish(3)
+	if n := len(topic.stats().Subscribers); n != 0 {
+		t.Fatalf("%d subscribers after close", n)
+	}
+	close(h.gate)
+	if got := fmt.Sprint(h.wait(t)); got != "[1 2]" {
+		t.Fatalf("handled %s", got)
+	}
+	if s := topic.stats(); s.Published != 3 {
+		t.Fatalf("published %d", s.Published)
+	}
+}
+
+func TestFilterAndPanic(t *testing.T) {
+	topic := newTestTopic(t)
+	h := newGatedHandler(2)
+	close(h.gate)
+	sub := topic.SubscribeWhere("filter", Options{}, func(v int) bool { return v%2 == 0 }, func(v int) {
+		if v == 2 {
+			panic("boom")
+		}
+		h.handle(v)
+	})
+	defer sub.Close()
+
+	for v := 1; v <= 6; v++ {
+		topic.Publish(v)
+	}
+	if got := fmt.Sprint(h.wait(t)); got != "[4 6]" {
+		t.Fatalf("handled %s", got)
+	}
+	// 处理计数在 handler 返回后更新
+	deadline := time.Now().Add(time.Second)
+	for subscriberStats(topic).Handled != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if s := subscriberStats(topic); s.Delivered != 3 || s.Panics != 1 || s.Handled != 2 {
+		t.Fatalf("stats %+v", s)
+	}
+}
@@ -0,0 +1,20 @@
+package bus
+
+import "github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+
+// 主题
+
+var (
+	// PropertyChanged IP属性（TTL、MAC、UA等）变化
+	PropertyChanged = NewTopic[types.PropertyChange]("property_changed")
+	// DeviceDiscovered 发现新设备或设备信息更新
+	DeviceDiscovered = NewTopic[types.DeviceRecord]("device_discovered")
+	// SessionClosed 会话结束
+	SessionClosed = NewTopic[types.Sessions]("session_closed")
+	// ProxyDetected 代理判定
+	ProxyDetected = NewTopic[types.ProxyRecord]("proxy_detected")
+	// SuspectedDetected 疑似代理
+	SuspectedDetected = NewTopic[types.SuspectedRecord]("suspected_detected")
+	// UserEvents 用户上下线
+	UserEvents = NewTopic[types.UserEvent]("user_event")
+)
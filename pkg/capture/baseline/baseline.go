@@ -0,0 +1,360 @@
+package baseline
+
+import (
+	"context"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/member"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/resolve"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/users"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 用户行为基线
+// 定期读取 features.online_users 中的特征快照，按用户汇总为一个样本：
+// 1.各特征类型的访问次数与不同数值数量，维护指数加权均值与方差
+// 2.各时段的总访问次数，用于按时段(季节性)判断
+// 3.常用设备集合
+// 样本相对基线显著偏高时记录疑似代理，原因为 behaviour_anomaly，偏离的指标不计入基线
+
+const (
+	defaultInterval   = 10 * time.Minute
+	defaultAlpha      = 0.05
+	defaultZScore     = 3
+	defaultMinSamples = 36
+	defaultNewDevices = 2
+	maxDevices        = 50
+)
+
+var (
+	baselines = make(map[string]*types.UserBaseline)
+	mu        sync.Mutex
+	running   sync.Mutex
+	lastID    primitive.ObjectID
+)
+
+// 一个用户在本次更新中的样本
+type sample struct {
+	ip       string
+	count    map[types.FeatureType]int
+	distinct map[types.FeatureType]map[string]struct{}
+	total    int
+	devices  map[string]struct{}
+}
+
+// Setup 加载用户基线
+func Setup() error {
+	list, err := storage.Features().Baselines(context.TODO())
+	if err != nil {
+		zap.L().Error("加载用户基线失败", zap.Error(err))
+		return err
+	}
+
+	mu.Lock()
+	for i := range list {
+		baselines[list[i].UserName] = &list[i]
+	}
+	mu.Unlock()
+	// 从一个周期前的快照开始
+	lastID = primitive.NewObjectIDFromTimestamp(time.Now().Add(-Interval()))
+
+	zap.L().Info("加载用户基线完成", zap.Int("count", len(list)))
+	return nil
+}
+
+// Interval 基线更新间隔
+func Interval() time.Duration {
+	if config.Cfg.Baseline.Interval > 0 {
+		return time.Duration(config.Cfg.Baseline.Interval) * time.Minute
+	}
+	return defaultInterval
+}
+
+// Get 获取用户基线
+func Get(username string) (types.UserBaseline, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	b, ok := baselines[username]
+	if !ok {
+		return types.UserBaseline{}, false
+	}
+	return copyBaseline(b), true
+}
+
+// Update 读取新的特征快照，检测偏离并更新基线
+func Update() {
+	// 上一次更新未完成时跳过
+	if !running.TryLock() {
+		return
+	}
+	defer running.Unlock()
+
+	samples, err := collect()
+	if err != nil {
+		zap.L().Error("读取特征快照失败", zap.Error(err))
+		return
+	}
+	now := time.Now()
+	for username, s := range samples {
+		b := update(username, s, now)
+		save(b)
+	}
+	zap.L().Debug("用户基线更新完成", zap.Int("users", len(samples)))
+}
+
+// 按用户汇总上次更新之后的特征快照
+func collect() (map[string]*sample, error) {
+	samples := make(map[string]*sample)
+	err := storage.Features().ScanFeatures(context.TODO(), lastID, func(id primitive.ObjectID, doc types.FeatureSet) error {
+		lastID = id
+		username := users.FindUserName(doc.IP)
+		if username == "" {
+			return nil
+		}
+		s, ok := samples[username]
+		if !ok {
+			s = &sample{
+				ip:       doc.IP,
+				count:    make(map[types.FeatureType]int),
+				distinct: make(map[types.FeatureType]map[string]struct{}),
+				devices:  make(map[string]struct{}),
+			}
+			samples[username] = s
+			for _, d := range resolve.GetIdentities(doc.IP) {
+				s.devices[d.ID] = struct{}{}
+			}
+		}
+		for ft, list := range doc.Features {
+			if s.distinct[ft] == nil {
+				s.distinct[ft] = make(map[string]struct{})
+			}
+			for _, f := range list {
+				s.count[ft] += f.Count
+				s.total += f.Count
+				s.distinct[ft][f.Value] = struct{}{}
+			}
+		}
+		return nil
+	})
+	return samples, err
+}
+
+// 检测偏离后更新基线，返回更新后的副本
+func update(username string, s *sample, now time.Time) types.UserBaseline {
+	mu.Lock()
+	b, ok := baselines[username]
+	if !ok {
+		b = &types.UserBaseline{
+			UserName: username,
+			Features: make(map[types.FeatureType]types.FeatureBaseline),
+			Devices:  make(map[string]int),
+		}
+		baselines[username] = b
+	}
+
+	anomalies, skip := detect(b, s, now)
+	if len(anomalies) > 0 {
+		evidence := copyBaseline(b)
+		mu.Unlock()
+		report(username, s.ip, anomalies, &evidence, now)
+		mu.Lock()
+	}
+
+	alpha := getAlpha()
+	for ft, count := range s.count {
+		if skip[string(ft)] {
+			continue
+		}
+		fb := b.Features[ft]
+		fb.Count.Add(float64(count), alpha)
+		fb.Distinct.Add(float64(len(s.distinct[ft])), alpha)
+		b.Features[ft] = fb
+	}
+	if !skip["hour"] {
+		b.Hours[now.Hour()].Add(float64(s.total), alpha)
+	}
+	if !skip["devices"] {
+		for id := range s.devices {
+			b.Devices[id]++
+		}
+		trimDevices(b)
+	}
+	b.Samples++
+	b.UpdatedAt = now
+	result := copyBaseline(b)
+	mu.Unlock()
+	return result
+}
+
+// 偏离判定，仅关注高于基线的偏离；返回偏离明细及不计入基线的指标
+func detect(b *types.UserBaseline, s *sample, now time.Time) ([]types.ReasonDetail, map[string]bool) {
+	skip := make(map[string]bool)
+	minSamples := getMinSamples()
+	if b.Samples < minSamples {
+		return nil, skip
+	}
+	threshold := getZScore()
+
+	var anomalies []types.ReasonDetail
+	for ft, count := range s.count {
+		fb, ok := b.Features[ft]
+		if !ok || fb.Count.Samples < minSamples {
+			continue
+		}
+		if z := fb.Count.ZScore(float64(count)); z >= threshold {
+			anomalies = append(anomalies, types.ReasonDetail{
+				Name:        ft,
+				Value:       count,
+				Threshold:   round(fb.Count.Mean),
+				Description: fmt.Sprintf("%s访问次数偏离基线%.1f倍标准差", ft, z),
+			})
+			skip[string(ft)] = true
+			continue
+		}
+		distinct := len(s.distinct[ft])
+		if z := fb.Distinct.ZScore(float64(distinct)); z >= threshold {
+			anomalies = append(anomalies, types.ReasonDetail{
+				Name:        ft,
+				Value:       distinct,
+				Threshold:   round(fb.Distinct.Mean),
+				Description: fmt.Sprintf("%s不同数值数量偏离基线%.1f倍标准差", ft, z),
+			})
+			skip[string(ft)] = true
+		}
+	}
+
+	// 时段样本较少，按每个时段平均样本数判断是否生效
+	hour := b.Hours[now.Hour()]
+	if hour.Samples >= max(minSamples/24, 3) {
+		if z := hour.ZScore(float64(s.total)); z >= threshold {
+			anomalies = append(anomalies, types.ReasonDetail{
+				Name:        "hour",
+				Value:       s.total,
+				Threshold:   round(hour.Mean),
+				Description: fmt.Sprintf("%d时段总访问次数偏离基线%.1f倍标准差", now.Hour(), z),
+			})
+			skip["hour"] = true
+		}
+	}
+
+	typical := make(map[string]struct{})
+	for _, id := range b.TypicalDevices() {
+		typical[id] = struct{}{}
+	}
+	var unknown []string
+	for id := range s.devices {
+		if _, ok := typical[id]; !ok {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(typical) > 0 && len(unknown) >= getNewDevices() {
+		sort.Strings(unknown)
+		anomalies = append(anomalies, types.ReasonDetail{
+			Name:        "devices",
+			Value:       len(unknown),
+			Threshold:   getNewDevices(),
+			Description: fmt.Sprintf("出现%d个非常用设备", len(unknown)),
+			ExtraInfo:   strings.Join(unknown, ","),
+		})
+		skip["devices"] = true
+	}
+	return anomalies, skip
+}
+
+// 记录行为偏离，以偏离最大的指标为主要原因，其余作为标签
+func report(username, ip string, anomalies []types.ReasonDetail, evidence *types.UserBaseline, now time.Time) {
+	tags := make([]string, 0, len(anomalies))
+	for _, a := range anomalies {
+		tags = append(tags, fmt.Sprint(a.Name))
+	}
+	record := types.SuspectedRecord{
+		IP:             ip,
+		Username:       username,
+		ReasonCategory: types.ReasonBehaviourAnomaly,
+		ReasonDetail:   anomalies[0],
+		Tags:           tags,
+		Context:        types.Context{},
+		Remark:         "用户行为偏离基线",
+		Baseline:       evidence,
+		LastSeen:       now,
+	}
+	_ = member.SaveSuspected(record)
+	zap.L().Info("用户行为偏离基线", zap.String("username", username), zap.Strings("tags", tags))
+}
+
+// 持久化用户基线
+func save(b types.UserBaseline) {
+	if err := storage.Features().SaveBaseline(context.TODO(), b); err != nil {
+		zap.L().Error("保存用户基线失败", zap.String("username", b.UserName), zap.Error(err))
+	}
+}
+
+// 仅保留出现次数最多的设备
+func trimDevices(b *types.UserBaseline) {
+	if len(b.Devices) <= maxDevices {
+		return
+	}
+	ids := make([]string, 0, len(b.Devices))
+	for id := range b.Devices {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return b.Devices[ids[i]] > b.Devices[ids[j]]
+	})
+	for _, id := range ids[maxDevices:] {
+		delete(b.Devices, id)
+	}
+}
+
+func copyBaseline(b *types.UserBaseline) types.UserBaseline {
+	c := *b
+	c.Features = make(map[types.FeatureType]types.FeatureBaseline, len(b.Features))
+	for k, v := range b.Features {
+		c.Features[k] = v
+	}
+	c.Devices = make(map[string]int, len(b.Devices))
+	for k, v := range b.Devices {
+		c.Devices[k] = v
+	}
+	return c
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func getAlpha() float64 {
+	if a := config.Cfg.Baseline.Alpha; a > 0 && a < 1 {
+		return a
+	}
+	return defaultAlpha
+}
+
+func getZScore() float64 {
+	if config.Cfg.Baseline.ZScore > 0 {
+		return config.Cfg.Baseline.ZScore
+	}
+	return defaultZScore
+}
+
+func getMinSamples() int {
+	if config.Cfg.Baseline.MinSamples > 0 {
+		return config.Cfg.Baseline.MinSamples
+	}
+	return defaultMinSamples
+}
+
+func getNewDevices() int {
+	if config.Cfg.Baseline.NewDevices > 0 {
+		return config.Cfg.Baseline.NewDevices
+	}
+	return defaultNewDevices
+}
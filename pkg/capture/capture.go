@@ -3,8 +3,10 @@ package capture
 import (
 	"context"
 	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/alert"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/member"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/observer"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/record"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/i18n"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/utils"
@@ -12,6 +14,7 @@ import (
 	"github.com/google/gopacket/pcap"
 	"go.uber.org/zap"
 	"sync"
+	"time"
 )
 
 // 数据包捕获和抓取
@@ -70,6 +73,7 @@ func StartCapture(ctx context.Context, c Config, handler PacketHandler, done cha
 
 	if Err != nil {
 		zap.L().Error("Failed to open capture device", zap.Error(Err))
+		alert.CaptureFailed(c.Nic+c.OffLine, Err)
 		done <- struct{}{}
 		return
 	}
@@ -78,6 +82,7 @@ func StartCapture(ctx context.Context, c Config, handler PacketHandler, done cha
 		Err = Handle.SetBPFFilter(c.BerkeleyPacketFilter)
 		if Err != nil {
 			zap.L().Error("berkeley packet filter panic", zap.Error(Err))
+			alert.CaptureFailed("bpf", Err)
 			done <- struct{}{}
 			return
 		}
@@ -99,6 +104,8 @@ func StartCapture(ctx context.Context, c Config, handler PacketHandler, done cha
 		zap.L().Fatal("Decoder not found", zap.String("decoder", decoderName))
 		return
 	}
+	// 定向录制文件的接口描述
+	record.SetLink(Handle.LinkType(), Handle.SnapLen(), c.Nic+c.OffLine)
 
 	source := gopacket.NewPacketSource(Handle, Decoder)
 	source.Lazy = true
@@ -107,6 +114,9 @@ func StartCapture(ctx context.Context, c Config, handler PacketHandler, done cha
 	packets := source.Packets()
 
 	go handler.FlushStream(ctx)
+	if c.OffLine == "" {
+		go watchHealth(ctx, Handle, c.Nic)
+	}
 	//go func() {
 	//	ticker := time.NewTicker(time.Minute * 5)
 	//	defer ticker.Stop()
@@ -136,6 +146,8 @@ func StartCapture(ctx context.Context, c Config, handler PacketHandler, done cha
 			}
 
 			PacketsCount++
+			// 定向录制，无进行中的录制时直接返回
+			record.Packet(packet)
 			mu.Lock()
 			// 因为需要重组，所以不能使用go协程进行异步处理
 			handler.HandlePacket(packet)
@@ -143,3 +155,33 @@ func StartCapture(ctx context.Context, c Config, handler PacketHandler, done cha
 		}
 	}
 }
+
+// 网卡抓包健康检查，丢包率过高或持续无数据包时告警
+func watchHealth(ctx context.Context, handle *pcap.Handle, nic string) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	var last pcap.Stats
+	lastCount, lastActive := PacketsCount, time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			stats, err := handle.Stats()
+			if err == nil {
+				alert.CaptureDropped(nic, stats.PacketsReceived-last.PacketsReceived,
+					stats.PacketsDropped-last.PacketsDropped+stats.PacketsIfDropped-last.PacketsIfDropped)
+				last = *stats
+			}
+			if PacketsCount != lastCount {
+				lastCount, lastActive = PacketsCount, now
+				continue
+			}
+			// 告警后重新计时，避免每分钟重复告警
+			if alert.CaptureStalled(nic, now.Sub(lastActive)) {
+				lastActive = now
+			}
+		}
+	}
+}
@@ -1,7 +1,8 @@
 package member
 
 import (
-	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/observer"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/bus"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/state"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
 	"sync"
 	"time"
@@ -18,7 +19,6 @@ var (
 	DeviceNameCache sync.Map
 	DeviceTypeCache sync.Map
 	Mutex           sync.Map
-	Events          = make(chan PropertyChangeEvent, 100)
 )
 
 // IP锁
@@ -27,67 +27,38 @@ func getIPMutex(ip string) *sync.RWMutex {
 	return val.(*sync.RWMutex)
 }
 
-// PropertyChangeEvent 属性变化事件结构
-type PropertyChangeEvent struct {
-	IP       string
-	OldValue any
-	NewValue any
-	Property types.Property
+// 需要持久化并由观察者记录的属性
+var trackedProperties = map[types.Property]bool{
+	types.TTL:       true,
+	types.Mac:       true,
+	types.UserAgent: true,
+	types.Device:    true,
 }
 
-// ChangeEventIP IP 属性变化事件
-func ChangeEventIP(events <-chan PropertyChangeEvent) {
-	for e := range events {
-		if handler, ok := handlers[e.Property]; ok {
-			handler(e)
-			// update redis
-			storeHash2Redis(e.IP, e.Property, e.NewValue)
-		}
-	}
+// 属性变化同步到状态，由状态写回 redis
+func storeChange(e types.PropertyChange) {
+	state.SetProperty(e.IP, e.Property, e.NewValue)
+}
+
+func isTracked(e types.PropertyChange) bool {
+	return trackedProperties[e.Property]
 }
 
-// 具体属性变化事件触发方法
-var handlers = map[types.Property]func(e PropertyChangeEvent){
-	types.TTL: func(event PropertyChangeEvent) {
-		//zap.L().Debug("TTL Changed", zap.String("IP", event.IP), zap.Any("old", event.OldValue), zap.Any("new", event.NewValue))
-		// 发送到 TTL 观察者 Channel
-		observer.TTLEvents <- observer.ChangeObserverEvent[uint8]{
-			IP:   event.IP,
-			Prev: event.OldValue.(uint8),
-			Curr: event.NewValue.(uint8),
-		}
-	},
-	types.Mac: func(event PropertyChangeEvent) {
-		//zap.L().Debug("MAC Changed", zap.String("IP", event.IP), zap.Any("old", event.OldValue), zap.Any("new", event.NewValue))
-		// 发送到 Mac 观察者 Channel
-		observer.MacEvents <- observer.ChangeObserverEvent[string]{
-			IP:   event.IP,
-			Prev: event.OldValue.(string),
-			Curr: event.NewValue.(string),
-		}
-	},
-	types.UserAgent: func(event PropertyChangeEvent) {
-		//zap.L().Debug("UA Changed", zap.String("IP", event.IP), zap.Any("old", event.OldValue), zap.Any("new", event.NewValue))
-		// 发送到 Ua 观察者 Channel
-		observer.UaEvents <- observer.ChangeObserverEvent[string]{
-			IP:   event.IP,
-			Prev: event.OldValue.(string),
-			Curr: event.NewValue.(string),
-		}
-	},
-	types.Device: func(event PropertyChangeEvent) {
-		//zap.L().Debug("UA Changed", zap.String("IP", event.IP), zap.Any("old", event.OldValue), zap.Any("new", event.NewValue))
-		// 发送到 Ua 观察者 Channel
-		observer.DeviceEvents <- observer.ChangeObserverEvent[types.DeviceRecord]{
-			IP:   event.IP,
-			Prev: event.OldValue.(types.DeviceRecord),
-			Curr: event.NewValue.(types.DeviceRecord),
-		}
-	},
+// GetMac 获取IP当前的MAC
+func GetMac(ip string) string {
+	if v, ok := getMemory(ip, &MacCache); ok {
+		return v.(string)
+	}
+	return ""
 }
 
 func Setup() {
-	go ChangeEventIP(Events)
+	// 状态淘汰的 IP 同时清理缓存
+	state.Setup(decodeProperty)
+	state.OnEvict(DelMemory)
+	// 状态同步不可丢失，默认阻塞策略
+	bus.PropertyChanged.SubscribeWhere("member_state", bus.Options{Buffer: 4096, Policy: bus.PolicyBlock}, isTracked, storeChange)
 	EnsureIndexOnce()
 	go StartFlushScheduler(time.Minute)
+	go StartWindowSweeper(5 * time.Minute)
 }
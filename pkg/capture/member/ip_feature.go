@@ -1,11 +1,12 @@
 package member
 
 import (
-	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
+	"context"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/exemption"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/spill"
 	"go.mongodb.org/mongo-driver/bson"
-	mgo "go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 	"sync"
 	"time"
@@ -16,6 +17,11 @@ var (
 	featureCaches = make(map[string]*types.FeatureSet) // IP为key的特征集合缓存
 	cacheLock     sync.RWMutex                         // 缓存锁
 	indexOnce     sync.Once
+	// 特征快照写入队列，写入失败或队列满时落盘暂存
+	featureQueue = spill.NewFixed("features", types.MongoDatabaseFeatures, types.OnlineUsersFeature, 10000, 100,
+		func(ctx context.Context, _ string, docs []bson.Raw) error {
+			return storage.Features().InsertFeatures(ctx, docs)
+		})
 )
 
 // GetFeatureSet 获取或创建IP对应的FeatureSet
@@ -48,7 +54,18 @@ func DelFeatureSet(ip string) {
 }
 
 // Increment 增量统计特征访问频率
+// 滑动窗口用于阈值检测，featureCaches 仅作为 mongo 快照
 func Increment(f types.Feature) {
+	// 豁免的IP或目的地址不计数，如校园CDN的SNI
+	if exemption.MatchIP(f.IP) || (isDestination(f.Field) && exemption.MatchDestination(f.Value)) {
+		exemption.Skip(exemption.PointFeature)
+		return
+	}
+	if len(f.IP) > 0 {
+		// trigger 按窗口内计数触发
+		TriggerSuspected(f.IP, f.Field, RecordWindow(f))
+	}
+
 	featureSet := GetFeatureSet(f.IP)
 
 	cacheLock.Lock()
@@ -79,8 +96,6 @@ func Increment(f types.Feature) {
 
 			// 更新 Total 中的 Chart 数据
 			updateChart(featureSet, f.Field, featureList[i].Count)
-			// trigger 触发特征数量
-			TriggerSuspected(featureSet.IP, f.Field, featureList[i].Count)
 			return
 		}
 	}
@@ -97,20 +112,21 @@ func FlushToMongo() {
 	cacheLock.Lock()
 	defer cacheLock.Unlock()
 
-	// 遍历缓存并插入MongoDB
-	var docs []interface{}
+	// 遍历缓存写入队列，锁内编码避免与 Increment 并发修改
 	for ip, featureSet := range featureCaches {
-		docs = append(docs, featureSet)
+		raw, err := bson.Marshal(featureSet)
+		if err != nil {
+			zap.L().Error("encode feature set failed", zap.String("ip", ip), zap.Error(err))
+		} else {
+			featureQueue.Push(bson.Raw(raw))
+		}
 		delete(featureCaches, ip) // 清空缓存
 	}
-	err := batchInsertToMongo(docs)
-	if err != nil {
-		zap.L().Error("batch insert to mongo failed", zap.Error(err))
-	}
 }
 
 // StartFlushScheduler 刷新时间窗口，记录到mongodb
 func StartFlushScheduler(interval time.Duration) {
+	featureQueue.Start(1)
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
@@ -136,44 +152,9 @@ func updateChart(featureSet *types.FeatureSet, industry types.FeatureType, newCo
 	})
 }
 
-// TTL索引
+// 特征快照30分钟过期
 func ensureIndex() error {
-	collection := mongo.GetMongoClient().Database(types.MongoDatabaseFeatures).Collection(types.OnlineUsersFeature)
-	_, err :=
-		collection.Indexes().CreateMany(
-			mongo.Context,
-			[]mgo.IndexModel{
-				{
-					Keys: bson.D{{"ip", 1}},
-				},
-				{
-					Keys:    bson.D{{"last_seen", 1}},
-					Options: options.Index().SetExpireAfterSeconds(60 * 30),
-				},
-			},
-		)
-	return err
-}
-
-// 批量插入到mongodb
-func batchInsertToMongo(docs []interface{}) error {
-	collection := mongo.GetMongoClient().Database(types.MongoDatabaseFeatures).Collection(types.OnlineUsersFeature)
-
-	batchSize := 100
-	for i := 0; i < len(docs); i += batchSize {
-		end := i + batchSize
-		if end > len(docs) {
-			end = len(docs)
-		}
-
-		// 批量插入
-		_, err := collection.InsertMany(mongo.Context, docs[i:end])
-		if err != nil {
-			zap.L().Error("Batch insert to mongo failed", zap.Error(err))
-			return err
-		}
-	}
-	return nil
+	return storage.Features().SetFeatureExpire(context.TODO(), 30*time.Minute)
 }
 
 // EnsureIndexOnce 设置索引
@@ -184,3 +165,8 @@ func EnsureIndexOnce() {
 		}
 	})
 }
+
+// 特征值是否为目的地址
+func isDestination(ft types.FeatureType) bool {
+	return ft == types.SNI || ft == types.HTTP || ft == types.DNS
+}
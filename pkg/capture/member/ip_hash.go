@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/bus"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/state"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/redis"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
 	v9 "github.com/redis/go-redis/v9"
+	"strconv"
 	"sync"
-	"time"
 )
 
 // IP Hash
@@ -60,13 +62,11 @@ func Store(i interface{}) {
 	mutex.Lock()
 	defer mutex.Unlock()
 	if !ok {
-		// memory 不存在,进行缓存
+		// memory 不存在,进行缓存，由状态写回 redis
 		putMemory(hash.IP, m, v)
-		// 查询 redis
-		oldVal, ok = getPropertyForRedis(hash.IP, hash.Field)
-		if !ok {
-			// redis 也不存在
-			storeHash2Redis(hash.IP, hash.Field, v)
+		// 重启后缓存为空，与状态中恢复的上次运行的值比较
+		if oldVal, ok = state.GetProperty(hash.IP, hash.Field); !ok {
+			state.SetProperty(hash.IP, hash.Field, v)
 			return
 		}
 	}
@@ -75,16 +75,29 @@ func Store(i interface{}) {
 	}
 	// 数值不一致， 更新缓存并推送事件
 	putMemory(hash.IP, m, v)
-	// 推送至channel
-	Events <- PropertyChangeEvent{
+	// 发布属性变化
+	bus.PropertyChanged.Publish(types.PropertyChange{
 		IP:       hash.IP,
+		Mac:      GetMac(hash.IP),
+		Property: hash.Field,
 		OldValue: oldVal,
 		NewValue: v,
-		Property: hash.Field,
-	}
+	})
 	return
 }
 
+// 将 redis 中的属性还原为缓存中的类型，用户名等其他字段不属于 IP 状态
+func decodeProperty(property types.Property, value string) (any, bool) {
+	switch property {
+	case types.TTL:
+		ttl, err := strconv.ParseUint(value, 10, 8)
+		return uint8(ttl), err == nil
+	case types.Mac, types.UserAgent, types.Device, types.DeviceName, types.DeviceType:
+		return value, true
+	}
+	return nil, false
+}
+
 // 从缓存中获取
 func getMemory(ip string, m *sync.Map) (any, bool) {
 	val, ok := m.Load(ip)
@@ -117,19 +130,7 @@ func DelMemory(ip string) {
 	DeviceNameCache.Delete(ip)
 	DeviceTypeCache.Delete(ip)
 	MacCache.Delete(ip)
-}
-
-// 从redis获取属性
-func getPropertyForRedis(ip string, property types.Property) (any, bool) {
-	rdb := redis.GetRedisClient()
-	ctx := context.TODO()
-	key := fmt.Sprintf(types.HashAnalyzeIP, ip)
-
-	val, err := rdb.HMGet(ctx, key, string(property)).Result()
-	if errors.Is(err, v9.Nil) || len(val) == 1 {
-		return nil, false
-	}
-	return val[1], true
+	state.Delete(ip)
 }
 
 // GetHashForRedis 从redis获取hash
@@ -145,21 +146,6 @@ func GetHashForRedis(ip string) map[string]string {
 	return val
 }
 
-// 存储ip hash 至redis
-func storeHash2Redis(ip string, property types.Property, value any) {
-	rdb := redis.GetRedisClient()
-	ctx := context.TODO()
-	key := fmt.Sprintf(types.HashAnalyzeIP, ip)
-
-	// z_set 有序集合
-	rdb.ZAdd(ctx, types.ZSetIP, v9.Z{
-		Score:  float64(time.Now().Unix()),
-		Member: ip,
-	}).Val()
-	// info hash
-	rdb.HSet(ctx, key, string(property), value).Val()
-}
-
 func CleanUp() {
 	rdb := redis.GetRedisClient()
 	ctx := context.TODO()
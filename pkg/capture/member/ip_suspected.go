@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/allegro/bigcache"
-	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/bus"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/clock"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
 	"go.uber.org/zap"
@@ -16,6 +18,8 @@ import (
 var (
 	suspectedCache *bigcache.BigCache
 	once           sync.Once
+	// SuspectedRecorder 设置后疑似记录交由其处理而不写入mongo，用于模拟回放
+	SuspectedRecorder func(record types.SuspectedRecord)
 )
 
 func GetSuspectedCache() *bigcache.BigCache {
@@ -38,11 +42,35 @@ func GetSuspectedCache() *bigcache.BigCache {
 
 // 疑似代理
 
-func TriggerSuspected(ip string, ft types.FeatureType, count int) {
+// TriggerSuspected 根据窗口统计判断是否超过阈值
+// threshold 为窗口内相同数值次数阈值，distinct_threshold 为窗口内不同数值数量阈值
+func TriggerSuspected(ip string, ft types.FeatureType, wc WindowCount) {
 	pf := getThreshold(ft)
-	if pf.Threshold == 0 {
+	if pf.Threshold == 0 && pf.DistinctThreshold == 0 {
 		return
 	}
+
+	var detail types.ReasonDetail
+	switch {
+	case pf.Threshold > 0 && wc.Count > pf.Threshold:
+		detail = types.ReasonDetail{
+			Name:        ft,
+			Value:       wc.Count,
+			Threshold:   pf.Threshold,
+			Description: fmt.Sprintf("%s内%s相同数值次数超过限定阈值:%d", wc.Window, ft, pf.Threshold),
+			ExtraInfo:   wc.Value,
+		}
+	case pf.DistinctThreshold > 0 && wc.Distinct > pf.DistinctThreshold:
+		detail = types.ReasonDetail{
+			Name:        ft,
+			Value:       wc.Distinct,
+			Threshold:   pf.DistinctThreshold,
+			Description: fmt.Sprintf("%s内%s不同数值数量超过限定阈值:%d", wc.Window, ft, pf.DistinctThreshold),
+		}
+	default:
+		return
+	}
+
 	// 检查缓存是否存在
 	_, err := GetSuspectedCache().Get(ip)
 	if err != nil {
@@ -55,38 +83,43 @@ func TriggerSuspected(ip string, ft types.FeatureType, count int) {
 		// 如果缓存已存在，直接返回
 		return
 	}
-	if count > pf.Threshold {
-		// 超过阈值，记录疑似代理
-		record := types.SuspectedRecord{
-			IP: ip,
-			//Username:       username,
-			ReasonCategory: "protocol_threshold",
-			ReasonDetail: types.ReasonDetail{
-				Name:        ft,
-				Value:       count,
-				Threshold:   pf.Threshold,
-				Description: fmt.Sprintf("短时间内%s次数超过限定阈值:%d", ft, pf.Threshold),
-			},
-			Tags:     []string{pf.Normal},
-			Context:  types.Context{},
-			Remark:   pf.Remark,
-			LastSeen: time.Now(),
-		}
-		_, err = mongo.GetMongoClient().Database(types.MongoDatabaseSuspected).
-			Collection(time.Now().Format("06_01")).
-			InsertOne(context.TODO(), record)
-		if err != nil {
-			zap.L().Error("failed to insert suspected record", zap.String("ip", ip), zap.Error(err))
-			return
-		}
 
-		// 缓存
-		err = GetSuspectedCache().Set(ip, []byte("cached"))
-		if err != nil {
-			zap.L().Error("failed to insert suspected record", zap.String("ip", ip), zap.Error(err))
-			return
-		}
+	// 超过阈值，记录疑似代理
+	record := types.SuspectedRecord{
+		IP: ip,
+		//Username:       username,
+		ReasonCategory: "protocol_threshold",
+		ReasonDetail:   detail,
+		Tags:           []string{pf.Normal},
+		Context:        types.Context{},
+		Remark:         pf.Remark,
+		LastSeen:       clock.Now(),
+	}
+	if err = SaveSuspected(record); err != nil {
+		return
+	}
+
+	// 缓存
+	err = GetSuspectedCache().Set(ip, []byte("cached"))
+	if err != nil {
+		zap.L().Error("failed to insert suspected record", zap.String("ip", ip), zap.Error(err))
+		return
+	}
+}
+
+// SaveSuspected 记录疑似代理，按月分表
+func SaveSuspected(record types.SuspectedRecord) error {
+	if SuspectedRecorder != nil {
+		SuspectedRecorder(record)
+		return nil
+	}
+	err := storage.Judgements().InsertSuspected(context.TODO(), time.Now().Format(types.MongoCollectionMonthlyLayout), record)
+	if err != nil {
+		zap.L().Error("failed to insert suspected record", zap.String("ip", record.IP), zap.Error(err))
+		return err
 	}
+	bus.SuspectedDetected.Publish(record)
+	return nil
 }
 
 // 获取协议的阈值
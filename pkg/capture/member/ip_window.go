@@ -0,0 +1,177 @@
+package member
+
+import (
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/clock"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"sync"
+	"time"
+)
+
+// 滑动窗口计数
+// 每个 IP/特征 维护一个环形桶，桶内记录数值出现次数，窗口滑动时扣减过期桶
+// 用于疑似代理阈值检测，与 FlushToMongo 的快照互不影响。
+// 窗口按 IP 分别加锁，不同 IP 的计数互不阻塞
+
+const (
+	windowBuckets       = 12               // 每个窗口划分的桶数
+	defaultWindowLength = 60 * time.Second // 未配置窗口时的默认长度
+	windowIdleTimeout   = 30 * time.Minute // 窗口空闲超过该时长将被回收
+)
+
+var windows sync.Map // IP -> *ipWindows
+
+// ipWindows 单个IP各特征的窗口
+type ipWindows struct {
+	mu       sync.Mutex
+	features map[types.FeatureType]*slidingWindow
+	removed  bool // 已从 windows 删除，持有者需重新获取
+}
+
+// WindowCount 窗口统计结果
+type WindowCount struct {
+	Value    string        // 本次计数的特征值
+	Count    int           // 窗口内该特征值出现次数
+	Distinct int           // 窗口内不同特征值数量
+	Window   time.Duration // 窗口长度
+}
+
+// slidingWindow 滑动窗口
+type slidingWindow struct {
+	length   time.Duration
+	span     time.Duration // 单个桶的时长
+	buckets  [windowBuckets]windowBucket
+	totals   map[string]int // 窗口内各数值总计数
+	lastSeen time.Time
+}
+
+type windowBucket struct {
+	start  time.Time
+	counts map[string]int
+}
+
+func newSlidingWindow(length time.Duration) *slidingWindow {
+	if length <= 0 {
+		length = defaultWindowLength
+	}
+	return &slidingWindow{
+		length: length,
+		span:   length / windowBuckets,
+		totals: make(map[string]int),
+	}
+}
+
+// add 记录一次数值并返回窗口统计
+func (w *slidingWindow) add(now time.Time, value string) WindowCount {
+	w.expire(now)
+
+	start := now.Truncate(w.span)
+	idx := int(start.UnixNano()/int64(w.span)) % windowBuckets
+	b := &w.buckets[idx]
+	if !b.start.Equal(start) {
+		// 桶已过期或未初始化，重置
+		w.drop(b)
+		b.start = start
+		b.counts = make(map[string]int)
+	}
+	b.counts[value]++
+	w.totals[value]++
+	w.lastSeen = now
+
+	return WindowCount{
+		Value:    value,
+		Count:    w.totals[value],
+		Distinct: len(w.totals),
+		Window:   w.length,
+	}
+}
+
+// expire 扣减超出窗口的桶
+func (w *slidingWindow) expire(now time.Time) {
+	border := now.Add(-w.length)
+	for i := range w.buckets {
+		b := &w.buckets[i]
+		if b.counts != nil && !b.start.After(border) {
+			w.drop(b)
+		}
+	}
+}
+
+// drop 从总计中扣减桶内计数
+func (w *slidingWindow) drop(b *windowBucket) {
+	for v, c := range b.counts {
+		if w.totals[v] -= c; w.totals[v] <= 0 {
+			delete(w.totals, v)
+		}
+	}
+	b.counts = nil
+}
+
+// RecordWindow 记录特征至滑动窗口并返回统计
+func RecordWindow(f types.Feature) WindowCount {
+	for {
+		v, _ := windows.LoadOrStore(f.IP, &ipWindows{features: make(map[types.FeatureType]*slidingWindow)})
+		iw := v.(*ipWindows)
+		iw.mu.Lock()
+		// 与回收并发时重新获取
+		if iw.removed {
+			iw.mu.Unlock()
+			continue
+		}
+		w, ok := iw.features[f.Field]
+		if !ok {
+			w = newSlidingWindow(getWindowLength(f.Field))
+			iw.features[f.Field] = w
+		}
+		count := w.add(clock.Now(), f.Value)
+		iw.mu.Unlock()
+		return count
+	}
+}
+
+// DelWindow 删除IP的窗口状态
+func DelWindow(ip string) {
+	if v, ok := windows.LoadAndDelete(ip); ok {
+		iw := v.(*ipWindows)
+		iw.mu.Lock()
+		iw.removed = true
+		iw.mu.Unlock()
+	}
+}
+
+// sweepWindows 回收长时间空闲的窗口
+func sweepWindows(now time.Time) {
+	windows.Range(func(key, value any) bool {
+		iw := value.(*ipWindows)
+		iw.mu.Lock()
+		for ft, w := range iw.features {
+			if now.Sub(w.lastSeen) > w.length+windowIdleTimeout {
+				delete(iw.features, ft)
+			}
+		}
+		if len(iw.features) == 0 && !iw.removed {
+			iw.removed = true
+			windows.CompareAndDelete(key, value)
+		}
+		iw.mu.Unlock()
+		return true
+	})
+}
+
+// StartWindowSweeper 定期回收空闲窗口
+func StartWindowSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		sweepWindows(clock.Now())
+	}
+}
+
+// 获取特征的窗口长度
+func getWindowLength(ft types.FeatureType) time.Duration {
+	pf := getThreshold(ft)
+	if pf.Window <= 0 {
+		return defaultWindowLength
+	}
+	return time.Duration(pf.Window) * time.Second
+}
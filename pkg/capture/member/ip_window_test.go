@@ -0,0 +1,177 @@
+package member
+
+import (
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"sync"
+	"testing"
+	"time"
+)
+
+func init() {
+	if config.Cfg == nil {
+		config.Cfg = &config.Yaml{}
+	}
+}
+
+func TestSlidingWindowRotation(t *testing.T) {
+	w := newSlidingWindow(time.Minute)
+	// 按桶长对齐的起点，12 个 5 秒的桶
+	t0 := time.Unix(1792396800, 0)
+	slot := func(at time.Time) int {
+		return int(at.Truncate(w.span).UnixNano()/int64(w.span)) % windowBuckets
+	}
+	steps := []struct {
+		at       time.Duration
+		value    string
+		count    int
+		distinct int
+	}{
+		{0, "a", 1, 1},
+		{5 * time.Second, "a", 2, 1},
+		{30 * time.Second, "b", 1, 2},
+		// 一分钟后回到起点的桶，起点桶的计数已扣减
+		{60 * time.Second, "a", 2, 2},
+		// 5 秒与 30 秒的桶过期
+		{95 * time.Second, "c", 1, 2},
+		// 全部过期
+		{200 * time.Second, "c", 1, 1},
+	}
+	for _, s := range steps {
+		wc := w.add(t0.Add(s.at), s.value)
+		if wc.Count != s.count || wc.Distinct != s.distinct || wc.Window != time.Minute {
+			t.Fatalf("add %s at +%v = %+v, want count %d distinct %d", s.value, s.at, wc, s.count, s.distinct)
+		}
+		if len(w.totals) != wc.Distinct {
+			t.Fatalf("totals %v after +%v", w.totals, s.at)
+		}
+	}
+	if slot(t0) != slot(t0.Add(time.Minute)) {
+		t.Fatal("a window length apart should share a ring slot")
+	}
+	live := 0
+	for _, b := range w.buckets {
+		if b.counts != nil {
+			live++
+		}
+	}
+	if live != 1 {
+		t.Fatalf("%d live buckets after expiry, want 1", live)
+	}
+}
+
+func TestSlidingWindowDefaultLength(t *testing.T) {
+	w := newSlidingWindow(0)
+	if w.length != defaultWindowLength || w.span != defaultWindowLength/windowBuckets {
+		t.Fatalf("length %v span %v", w.length, w.span)
+	}
+}
+
+func TestDistinctThreshold(t *testing.T) {
+	config.Cfg.Thresholds.SNI = config.ProtocolFeature{DistinctThreshold: 3, Window: 60}
+	defer func() { config.Cfg.Thresholds.SNI = config.ProtocolFeature{} }()
+
+	var records []types.SuspectedRecord
+	SuspectedRecorder = func(r types.SuspectedRecord) { records = append(records, r) }
+	defer func() { SuspectedRecorder = nil }()
+
+	ip := "10.0.26.1"
+	// 同一 IP 的疑似记录在缓存有效期内只记录一次
+	_ = GetSuspectedCache().Delete(ip)
+	defer DelWindow(ip)
+	for i := 1; i <= 4; i++ {
+		f := types.Feature{IP: ip, Field: types.SNI, Value: fmt.Sprintf("host%d.example.com", i)}
+		wc := RecordWindow(f)
+		if wc.Distinct != i || wc.Count != 1 {
+			t.Fatalf("record %d: %+v", i, wc)
+		}
+		TriggerSuspected(ip, types.SNI, wc)
+		// 不同数值数量等于阈值时不触发
+		if want := max(i-3, 0); len(records) != want {
+			t.Fatalf("after %d distinct values: %d records, want %d", i, len(records), want)
+		}
+	}
+	d := records[0].ReasonDetail
+	if d.Name != types.SNI || d.Value != 4 || d.Threshold != 3 {
+		t.Fatalf("reason %+v", d)
+	}
+
+	// 重复数值不增加不同数值数量
+	wc := RecordWindow(types.Feature{IP: ip, Field: types.SNI, Value: "host1.example.com"})
+	if wc.Distinct != 4 || wc.Count != 2 {
+		t.Fatalf("repeat value %+v", wc)
+	}
+}
+
+func TestSweepWindows(t *testing.T) {
+	ip := "10.0.26.2"
+	RecordWindow(types.Feature{IP: ip, Field: types.SNI, Value: "a"})
+	sweepWindows(time.Now())
+	if _, ok := windows.Load(ip); !ok {
+		t.Fatal("active window swept")
+	}
+	sweepWindows(time.Now().Add(defaultWindowLength + windowIdleTimeout + time.Minute))
+	if _, ok := windows.Load(ip); ok {
+		t.Fatal("idle window not swept")
+	}
+	if wc := RecordWindow(types.Feature{IP: ip, Field: types.SNI, Value: "a"}); wc.Count != 1 {
+		t.Fatalf("window after sweep %+v", wc)
+	}
+	DelWindow(ip)
+}
+
+// 记录、删除与回收并发时，计数不会写入已删除的窗口
+func TestWindowConcurrentSweep(t *testing.T) {
+	ips := []string{"10.0.26.10", "10.0.26.11", "10.0.26.12", "10.0.26.13"}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, ip := range ips {
+		wg.Add(2)
+		go func(ip string) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				RecordWindow(types.Feature{IP: ip, Field: types.SNI, Value: "a"})
+			}
+		}(ip)
+		go func(ip string) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				DelWindow(ip)
+			}
+		}(ip)
+	}
+	swept := make(chan struct{})
+	go func() {
+		defer close(swept)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				// 所有窗口均视为空闲
+				sweepWindows(time.Now().Add(24 * time.Hour))
+			}
+		}
+	}()
+	wg.Wait()
+	close(stop)
+	<-swept
+
+	windows.Range(func(key, value any) bool {
+		iw := value.(*ipWindows)
+		iw.mu.Lock()
+		defer iw.mu.Unlock()
+		if iw.removed {
+			t.Errorf("removed window for %v still in map", key)
+		}
+		return true
+	})
+	for _, ip := range ips {
+		DelWindow(ip)
+		if wc := RecordWindow(types.Feature{IP: ip, Field: types.SNI, Value: "a"}); wc.Count != 1 {
+			t.Errorf("%s after delete: %+v", ip, wc)
+		}
+		DelWindow(ip)
+	}
+}
@@ -0,0 +1,131 @@
+package observer
+
+import (
+	"context"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/redis"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	v9 "github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+	"time"
+)
+
+// 观察者历史持久化
+// 每次变化写入 observer.<ttl|mac|ua|device> 集合，按保留时长自动清理
+
+const (
+	defaultRetention = 7 * 24 * time.Hour
+	defaultCapacity  = 10000
+)
+
+// HistoryRecord 持久化的变化记录
+type HistoryRecord[T any] struct {
+	IP    string    `json:"ip" bson:"ip"`
+	Mac   string    `json:"mac" bson:"mac"`
+	Time  time.Time `json:"time" bson:"time"`
+	Prev  T         `json:"prev" bson:"prev"`
+	Value T         `json:"value" bson:"value"`
+}
+
+// HistoryQuery 历史查询条件，IP和MAC至少一个
+type HistoryQuery struct {
+	IP    string    `json:"ip"`
+	Mac   string    `json:"mac"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// save 持久化变化记录
+func (ob *observer[T]) save(e ChangeObserverEvent[T], t time.Time) {
+	err := storage.Observers().InsertObserverHistory(context.TODO(), ob.Collection, HistoryRecord[T]{
+		IP:    e.IP,
+		Mac:   e.Mac,
+		Time:  t,
+		Prev:  e.Prev,
+		Value: e.Curr,
+	})
+	if err != nil {
+		zap.L().Error("保存观察者历史失败", zap.String("collection", ob.Collection), zap.Error(err))
+	}
+}
+
+// recent 获取保留期内最近的 MaxCount 条记录，按时间正序
+func (ob *observer[T]) recent(ip string) []HistoryRecord[T] {
+	records, err := ob.find(storage.ObserverQuery{
+		IP:    ip,
+		Start: time.Now().Add(-getRetention()),
+		Desc:  true,
+		Limit: int64(ob.MaxCount),
+	})
+	if err != nil {
+		zap.L().Error("查询观察者历史失败", zap.String("collection", ob.Collection), zap.Error(err))
+		return nil
+	}
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records
+}
+
+// Query 按IP或MAC查询任意时间范围内的变化历史
+func (ob *observer[T]) Query(q HistoryQuery) ([]HistoryRecord[T], error) {
+	return ob.find(storage.ObserverQuery{IP: q.IP, Mac: q.Mac, Start: q.Start, End: q.End})
+}
+
+func (ob *observer[T]) find(q storage.ObserverQuery) ([]HistoryRecord[T], error) {
+	docs, err := storage.Observers().FindObserverHistory(context.TODO(), ob.Collection, q)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]HistoryRecord[T], 0, len(docs))
+	for _, doc := range docs {
+		var record HistoryRecord[T]
+		if err = bson.Unmarshal(doc, &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// restore 设置保留时长并从存储恢复保留期内IP的有序集合
+func (ob *observer[T]) restore() {
+	ctx := context.TODO()
+	observers := storage.Observers()
+
+	if err := observers.SetObserverRetention(ctx, ob.Collection, getRetention()); err != nil {
+		zap.L().Error("更新观察者TTL索引失败", zap.String("collection", ob.Collection), zap.Error(err))
+	}
+
+	rows, err := observers.ObserverLastSeen(ctx, ob.Collection, time.Now().Add(-getRetention()))
+	if err != nil {
+		zap.L().Error("恢复观察者历史失败", zap.String("collection", ob.Collection), zap.Error(err))
+		return
+	}
+
+	rdb := redis.GetRedisClient()
+	pipe := rdb.Pipeline()
+	for ip, last := range rows {
+		pipe.ZAdd(ctx, ob.Table, v9.Z{Score: float64(last.Unix()), Member: ip})
+	}
+	if _, err = pipe.Exec(ctx); err != nil {
+		zap.L().Error("恢复观察者索引失败", zap.String("table", ob.Table), zap.Error(err))
+		return
+	}
+	zap.L().Info("恢复观察者历史", zap.String("collection", ob.Collection), zap.Int("count", len(rows)))
+}
+
+func getRetention() time.Duration {
+	if config.Cfg.Observer.Retention <= 0 {
+		return defaultRetention
+	}
+	return time.Duration(config.Cfg.Observer.Retention) * time.Hour
+}
+
+func getCapacity() int {
+	if config.Cfg.Observer.Capacity <= 0 {
+		return defaultCapacity
+	}
+	return config.Cfg.Observer.Capacity
+}
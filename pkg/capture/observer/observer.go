@@ -1,9 +1,12 @@
 package observer
 
 import (
+	"container/list"
 	"context"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/bus"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/redis"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/components/features/oui"
 	v9 "github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"math"
@@ -20,20 +23,18 @@ const (
 var (
 	cacheMutex sync.Mutex
 
-	TTLObserver    = newObserver[uint8](types.ZSetObserverTTL, MaxTTLCount, false)
-	MacObserver    = newObserver[string](types.ZSetObserverMac, MaxMacCount, true)
-	UaObserver     = newObserver[string](types.ZSetObserverUa, MaxUaCount, true)
-	DeviceObserver = newObserver[types.DeviceRecord](types.ZSetObserverDevice, MaxMacCount, true)
-
-	TTLEvents    = make(chan ChangeObserverEvent[uint8], 100)
-	MacEvents    = make(chan ChangeObserverEvent[string], 100)
-	UaEvents     = make(chan ChangeObserverEvent[string], 100)
-	DeviceEvents = make(chan ChangeObserverEvent[types.DeviceRecord], 100)
+	TTLObserver    = newObserver[uint8](types.ZSetObserverTTL, "ttl", MaxTTLCount, false)
+	MacObserver    = newObserver[string](types.ZSetObserverMac, "mac", MaxMacCount, true)
+	UaObserver     = newObserver[string](types.ZSetObserverUa, "ua", MaxUaCount, true)
+	DeviceObserver = newObserver[types.DeviceRecord](types.ZSetObserverDevice, "device", MaxMacCount, true)
+	// 随机MAC单独记录，避免系统隐私功能造成的MAC变化被误判为共享
+	RandomMacObserver = newObserver[string](types.ZSetObserverRandom, "random_mac", MaxMacCount, true)
 )
 
 // ChangeObserverEvent 观察事件
 type ChangeObserverEvent[T any] struct {
 	IP   string
+	Mac  string // 变化时IP对应的MAC，用于按MAC查询历史
 	Prev T
 	Curr T
 }
@@ -53,38 +54,103 @@ type changeRecord[T any] struct {
 }
 
 // observer 观察者
+// HistoryCache 为内存LRU缓存，完整历史持久化在mongo，未命中时从mongo恢复
 type observer[T any] struct {
-	HistoryCache           map[string]*changeHistory[T]
+	HistoryCache           map[string]*list.Element
+	lru                    *list.List
 	MaxCount               int
 	Table                  string
+	Collection             string
 	FocusOnlyOnDifferences bool
 }
 
+// lruEntry LRU节点
+type lruEntry[T any] struct {
+	ip      string
+	history *changeHistory[T]
+}
+
 // newObserver 创建一个观察者
-func newObserver[T any](table string, maxCount int, focusOnlyOnDifference bool) *observer[T] {
+func newObserver[T any](table, collection string, maxCount int, focusOnlyOnDifference bool) *observer[T] {
 	return &observer[T]{
-		HistoryCache:           make(map[string]*changeHistory[T]),
+		HistoryCache:           make(map[string]*list.Element),
+		lru:                    list.New(),
 		MaxCount:               maxCount,
 		Table:                  table,
+		Collection:             collection,
 		FocusOnlyOnDifferences: focusOnlyOnDifference,
 	}
 }
 
+// fetch 缓存未命中时从mongo读取历史，查询期间不持有 cacheMutex
+func (ob *observer[T]) fetch(ip string) []HistoryRecord[T] {
+	cacheMutex.Lock()
+	_, ok := ob.HistoryCache[ip]
+	cacheMutex.Unlock()
+	if ok {
+		return nil
+	}
+	return ob.recent(ip)
+}
+
+// load 获取缓存历史，未命中时以 fetch 的结果建立缓存，调用方需持有 cacheMutex
+// 查询期间其他协程可能已建立缓存，此时以缓存为准，records 丢弃
+func (ob *observer[T]) load(ip string, records []HistoryRecord[T], create bool) (*changeHistory[T], bool) {
+	if el, ok := ob.HistoryCache[ip]; ok {
+		ob.lru.MoveToFront(el)
+		return el.Value.(*lruEntry[T]).history, true
+	}
+	if len(records) == 0 && !create {
+		return nil, false
+	}
+	history := &changeHistory[T]{
+		Changes:      make([]changeRecord[T], 0, ob.MaxCount),
+		ValueChanges: make([]uint, 0, ob.MaxCount),
+	}
+	for _, r := range records {
+		ob.append(history, r.Time, r.Value)
+	}
+	ob.put(ip, history)
+	return history, true
+}
+
+// put 写入缓存，超出容量淘汰最久未使用
+func (ob *observer[T]) put(ip string, history *changeHistory[T]) {
+	ob.HistoryCache[ip] = ob.lru.PushFront(&lruEntry[T]{ip: ip, history: history})
+	for ob.lru.Len() > getCapacity() {
+		el := ob.lru.Back()
+		ob.lru.Remove(el)
+		delete(ob.HistoryCache, el.Value.(*lruEntry[T]).ip)
+	}
+}
+
+// evict 删除缓存
+func (ob *observer[T]) evict(ip string) {
+	if el, ok := ob.HistoryCache[ip]; ok {
+		ob.lru.Remove(el)
+		delete(ob.HistoryCache, ip)
+	}
+}
+
 // recordChange 记录变化
 func (ob *observer[T]) recordChange(e ChangeObserverEvent[T]) {
+	now := time.Now()
+	// 先更新缓存再持久化，避免从mongo恢复时重复计入本次记录
+	defer ob.save(e, now)
+
+	// redis 与 mongo 的读写均不持有 cacheMutex，锁内只更新缓存
+	ob.store2Redis(e.IP, now)
+	records := ob.fetch(e.IP)
+
 	cacheMutex.Lock()
 	defer cacheMutex.Unlock()
 
-	history, ok := ob.HistoryCache[e.IP]
-	if !ok {
-		ob.store2Redis(e.IP)
-		history = &changeHistory[T]{
-			Changes:      make([]changeRecord[T], 0, ob.MaxCount),
-			ValueChanges: make([]uint, 0, ob.MaxCount),
-		}
-		ob.HistoryCache[e.IP] = history
-	}
+	history, _ := ob.load(e.IP, records, true)
+	ob.append(history, now, e.Curr)
+}
 
+// append 追加变化记录
+func (ob *observer[T]) append(history *changeHistory[T], t time.Time, value T) {
 	//if !ob.FocusOnlyOnDifferences {
 	if len(history.Changes) == ob.MaxCount {
 		history.Changes = history.Changes[1:]
@@ -96,13 +162,13 @@ func (ob *observer[T]) recordChange(e ChangeObserverEvent[T]) {
 		history.ValueChanges = history.ValueChanges[1:]
 	}
 	history.Changes = append(history.Changes, changeRecord[T]{
-		Time:  time.Now(),
-		Value: e.Curr,
+		Time:  t,
+		Value: value,
 	})
 	//}
 
 	if ob.Table == types.ZSetObserverTTL {
-		if v, ok := any(e.Curr).(uint8); ok {
+		if v, ok := any(value).(uint8); ok {
 			num := append(history.ValueChanges, uint(v))
 			history.ValueChanges = num
 			history.MovingAverage, history.IsProxy = detectProxyUsingSMA(num, 3, 3)
@@ -142,31 +208,65 @@ func movingAverage(num []uint, windowSize int) []float64 {
 
 // GetHistory 获取变化历史记录
 func (ob *observer[T]) GetHistory(ip string) *changeHistory[T] {
+	records := ob.fetch(ip)
+
 	cacheMutex.Lock()
 	defer cacheMutex.Unlock()
 
-	if history, ok := ob.HistoryCache[ip]; ok {
+	if history, ok := ob.load(ip, records, false); ok {
 		return history
 	}
 	return nil
 }
 
 // store2Redis 保存IP到Redis
-func (ob *observer[T]) store2Redis(ip string) {
+func (ob *observer[T]) store2Redis(ip string, t time.Time) {
 	rdb := redis.GetRedisClient()
 	ctx := context.TODO()
 
 	rdb.ZAdd(ctx, ob.Table, v9.Z{
-		Score:  float64(time.Now().Unix()),
+		Score:  float64(t.Unix()),
 		Member: ip,
 	}).Val()
 }
 
-// watchChange 观察事件channel
-func (ob *observer[T]) watchChange(events <-chan ChangeObserverEvent[T]) {
-	for e := range events {
-		ob.recordChange(e)
+// observe 将属性变化转换为观察事件，类型不符时忽略
+func (ob *observer[T]) observe(e types.PropertyChange) {
+	prev, ok := e.OldValue.(T)
+	if !ok {
+		return
+	}
+	curr, ok := e.NewValue.(T)
+	if !ok {
+		return
+	}
+	ob.recordChange(ChangeObserverEvent[T]{
+		IP:   e.IP,
+		Mac:  e.Mac,
+		Prev: prev,
+		Curr: curr,
+	})
+}
+
+// subscribe 订阅指定属性的变化
+func (ob *observer[T]) subscribe(filter func(types.PropertyChange) bool) {
+	bus.PropertyChanged.SubscribeWhere("observer_"+ob.Collection, bus.Options{}, filter, ob.observe)
+}
+
+func property(p types.Property) func(types.PropertyChange) bool {
+	return func(e types.PropertyChange) bool {
+		return e.Property == p
+	}
+}
+
+// 随机MAC单独记录，其余进入 Mac 观察者
+func randomMac(e types.PropertyChange) bool {
+	if e.Property != types.Mac {
+		return false
 	}
+	prev, _ := e.OldValue.(string)
+	curr, _ := e.NewValue.(string)
+	return oui.IsRandomized(prev) || oui.IsRandomized(curr)
 }
 
 type WebResult[T any] struct {
@@ -203,9 +303,13 @@ func (ob *observer[T]) Traversal(c types.Condition) (int64, interface{}, error)
 	ips := zRangCmd.Val()
 	var result []WebResult[T]
 	for _, ip := range ips {
+		history := ob.GetHistory(ip.Member.(string))
+		if history == nil {
+			continue
+		}
 		wr := WebResult[T]{
 			IP:      ip.Member.(string),
-			History: *ob.GetHistory(ip.Member.(string)),
+			History: *history,
 		}
 		result = append(result, wr)
 	}
@@ -213,12 +317,20 @@ func (ob *observer[T]) Traversal(c types.Condition) (int64, interface{}, error)
 }
 
 func Setup() {
-	// 程序运行前清空有序集合
+	// 程序运行前清空有序集合，再从mongo恢复保留期内的索引
 	CleanUp()
-	go TTLObserver.watchChange(TTLEvents)
-	go MacObserver.watchChange(MacEvents)
-	go UaObserver.watchChange(UaEvents)
-	go DeviceObserver.watchChange(DeviceEvents)
+	TTLObserver.restore()
+	MacObserver.restore()
+	UaObserver.restore()
+	DeviceObserver.restore()
+	RandomMacObserver.restore()
+	TTLObserver.subscribe(property(types.TTL))
+	MacObserver.subscribe(func(e types.PropertyChange) bool {
+		return e.Property == types.Mac && !randomMac(e)
+	})
+	UaObserver.subscribe(property(types.UserAgent))
+	DeviceObserver.subscribe(property(types.Device))
+	RandomMacObserver.subscribe(randomMac)
 }
 
 func CleanUp() {
@@ -226,4 +338,17 @@ func CleanUp() {
 	redis.GetRedisClient().Del(context.TODO(), types.ZSetObserverMac).Val()
 	redis.GetRedisClient().Del(context.TODO(), types.ZSetObserverUa).Val()
 	redis.GetRedisClient().Del(context.TODO(), types.ZSetObserverDevice).Val()
+	redis.GetRedisClient().Del(context.TODO(), types.ZSetObserverRandom).Val()
+}
+
+// Prune 用户下线后释放内存中的历史，持久化记录保留
+func Prune(ip string) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	TTLObserver.evict(ip)
+	MacObserver.evict(ip)
+	UaObserver.evict(ip)
+	DeviceObserver.evict(ip)
+	RandomMacObserver.evict(ip)
 }
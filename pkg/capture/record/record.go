@@ -0,0 +1,513 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/users"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 定向录制
+// 运维在 web 端按用户、IP 或 MAC 发起录制，抓包循环将匹配的数据包复制后交给录制协程写入 pcapng 文件，
+// 文件超过大小后滚动，每个文件的节头注释记录录制编号、目标、操作人与分片序号。
+// 同时进行的录制数与录制目录总占用受限，每次录制及其停止、下载、删除写入 audit.recording 审计记录
+
+const (
+	defaultMaxConcurrent = 2
+	defaultQuota         = 2048 // MB
+	defaultFileSize      = 64   // MB
+	defaultDuration      = 300  // 秒
+	defaultMaxDuration   = 3600 // 秒
+
+	queueSize = 4096
+	fileExt   = ".pcapng"
+
+	userCacheTTL  = 10 * time.Second
+	userCacheSize = 4096
+)
+
+var (
+	ErrDisabled      = errors.New("packet recording is disabled")
+	ErrInvalidTarget = errors.New("invalid record target")
+	ErrInvalidValue  = errors.New("invalid record value")
+	ErrTooMany       = errors.New("too many recordings in progress")
+	ErrQuota         = errors.New("record disk quota exceeded")
+	ErrNotFound      = errors.New("recording not found")
+	ErrRunning       = errors.New("recording is still running")
+	ErrFileNotFound  = errors.New("record file not found")
+)
+
+var (
+	mu     sync.Mutex                  // 串行化发起与结束
+	active atomic.Pointer[[]*recorder] // 进行中的录制，抓包循环无锁读取
+	used   atomic.Int64                // 录制目录占用字节数
+
+	link = struct {
+		sync.RWMutex
+		linkType layers.LinkType
+		snapLen  uint32
+		source   string
+	}{linkType: layers.LinkTypeEthernet, snapLen: 65535}
+)
+
+// Setup 统计录制目录占用，上次进程退出时未结束的录制标记为中断
+func Setup() error {
+	if config.Cfg.Record.Disable {
+		return nil
+	}
+	if err := os.MkdirAll(Path(), 0750); err != nil {
+		zap.L().Error("创建录制目录失败", zap.String("path", Path()), zap.Error(err))
+		return err
+	}
+	used.Store(dirSize(Path()))
+
+	interrupted, err := storage.Recordings().FindRecordings(context.TODO(), types.RecordRunning, 0)
+	if err != nil {
+		zap.L().Error("查询中断的录制失败", zap.Error(err))
+		return err
+	}
+	// 最后一个文件的大小与未滚动前写入的文件只在目录中，按目录重建文件列表
+	for _, rec := range interrupted {
+		rec.Status, rec.Files, rec.EndTime = types.RecordInterrupted, scanFiles(rec), time.Now()
+		if err = storage.Recordings().UpdateRecording(context.TODO(), rec); err != nil {
+			zap.L().Error("更新中断的录制失败", zap.String("id", rec.ID), zap.Error(err))
+			return err
+		}
+	}
+	zap.L().Info("定向录制已启用", zap.String("path", Path()), zap.Int64("used", used.Load()), zap.Int64("quota", quota()))
+	return nil
+}
+
+// SetLink 设置抓包设备的链路类型与截断长度，写入 pcapng 接口描述
+func SetLink(linkType layers.LinkType, snapLen int, source string) {
+	link.Lock()
+	defer link.Unlock()
+
+	link.linkType, link.source = linkType, source
+	if snapLen > 0 {
+		link.snapLen = uint32(snapLen)
+	}
+}
+
+// Packet 抓包循环中调用，匹配的数据包复制后进入录制队列，队列已满时丢弃并计数
+func Packet(p gopacket.Packet) {
+	list := active.Load()
+	if list == nil || len(*list) == 0 {
+		return
+	}
+	for _, r := range *list {
+		if !r.match(p) {
+			continue
+		}
+		// 抓包源未拷贝数据，需要复制后再交给录制协程
+		data := append([]byte(nil), p.Data()...)
+		select {
+		case r.queue <- packet{ci: p.Metadata().CaptureInfo, data: data}:
+		default:
+			r.dropped.Add(1)
+		}
+	}
+}
+
+// Start 发起录制
+func Start(req types.RecordRequest) (types.Recording, error) {
+	if config.Cfg.Record.Disable {
+		return types.Recording{}, ErrDisabled
+	}
+	match, value, err := matcher(req.Target, req.Value)
+	if err != nil {
+		return types.Recording{}, err
+	}
+	duration := req.Duration
+	if duration <= 0 {
+		duration = getDuration()
+	}
+	duration = min(duration, getMaxDuration())
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(list()) >= getMaxConcurrent() {
+		return types.Recording{}, ErrTooMany
+	}
+	if used.Load() >= quota() {
+		return types.Recording{}, ErrQuota
+	}
+
+	now := time.Now()
+	r := &recorder{
+		rec: types.Recording{
+			ID:        primitive.NewObjectID().Hex(),
+			Target:    req.Target,
+			Value:     value,
+			Duration:  duration,
+			MaxBytes:  max(req.MaxBytes, 0),
+			Remark:    req.Remark,
+			Operator:  req.Operator,
+			Status:    types.RecordRunning,
+			Files:     []types.RecordFile{},
+			Events:    []types.RecordEvent{{Action: "start", Operator: req.Operator, Time: now}},
+			StartTime: now,
+		},
+		match: match,
+		queue: make(chan packet, queueSize),
+		stop:  make(chan string, 1),
+		done:  make(chan struct{}),
+	}
+	if err = os.MkdirAll(r.dir(), 0750); err != nil {
+		return types.Recording{}, err
+	}
+	if err = r.rotate(); err != nil {
+		_ = os.RemoveAll(r.dir())
+		return types.Recording{}, err
+	}
+	// 审计记录写入失败时不录制
+	if err = storage.Recordings().InsertRecording(context.TODO(), r.rec); err != nil {
+		_ = r.closeFile()
+		_ = os.RemoveAll(r.dir())
+		used.Store(dirSize(Path()))
+		zap.L().Error("保存录制审计记录失败", zap.Error(err))
+		return types.Recording{}, err
+	}
+
+	next := append(list(), r)
+	active.Store(&next)
+	go r.run(time.Duration(duration) * time.Second)
+
+	zap.L().Info("开始定向录制", zap.String("id", r.rec.ID), zap.String("target", string(r.rec.Target)),
+		zap.String("value", value), zap.Int("duration", duration), zap.Int64("max_bytes", r.rec.MaxBytes),
+		zap.String("operator", req.Operator))
+	return r.snapshot(), nil
+}
+
+// Stop 停止录制并等待文件写完
+func Stop(id, operator string) (types.Recording, error) {
+	r := find(id)
+	if r == nil {
+		return types.Recording{}, ErrNotFound
+	}
+	event := types.RecordEvent{Action: "stop", Operator: operator, Time: time.Now()}
+	r.event(event)
+	audit(id, event)
+	select {
+	case r.stop <- types.RecordReasonStopped:
+	default:
+	}
+	<-r.done
+	return r.snapshot(), nil
+}
+
+// List 最近的录制，进行中的录制为实时统计
+func List(limit int64) ([]types.Recording, error) {
+	result, err := storage.Recordings().FindRecordings(context.TODO(), "", limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range result {
+		if r := find(result[i].ID); r != nil {
+			result[i] = r.snapshot()
+		}
+	}
+	return result, nil
+}
+
+// Get 录制详情
+func Get(id string) (types.Recording, error) {
+	if r := find(id); r != nil {
+		return r.snapshot(), nil
+	}
+	rec, err := storage.Recordings().GetRecording(context.TODO(), id)
+	if err != nil {
+		return rec, ErrNotFound
+	}
+	return rec, nil
+}
+
+// File 下载录制文件，返回文件路径并记录下载审计，进行中的录制不能下载正在写入的文件
+func File(id, name, operator string) (string, error) {
+	rec, err := Get(id)
+	if err != nil {
+		return "", err
+	}
+	if rec.Status == types.RecordDeleted {
+		return "", ErrFileNotFound
+	}
+	for i, f := range rec.Files {
+		if f.Name != name {
+			continue
+		}
+		if rec.Status == types.RecordRunning && i == len(rec.Files)-1 {
+			return "", ErrRunning
+		}
+		path := filepath.Join(Path(), id, name)
+		if _, err = os.Stat(path); err != nil {
+			return "", ErrFileNotFound
+		}
+		audit(id, types.RecordEvent{Action: "download", Operator: operator, Detail: name, Time: time.Now()})
+		return path, nil
+	}
+	return "", ErrFileNotFound
+}
+
+// Delete 删除录制文件，审计记录保留
+func Delete(id, operator string) error {
+	if find(id) != nil {
+		return ErrRunning
+	}
+	rec, err := Get(id)
+	if err != nil {
+		return err
+	}
+	if rec.Status == types.RecordDeleted {
+		return nil
+	}
+	if err = os.RemoveAll(filepath.Join(Path(), rec.ID)); err != nil {
+		return err
+	}
+	used.Store(dirSize(Path()))
+	rec.Status = types.RecordDeleted
+	save(rec)
+	audit(id, types.RecordEvent{Action: "delete", Operator: operator, Time: time.Now()})
+	zap.L().Info("删除定向录制", zap.String("id", id), zap.String("operator", operator))
+	return nil
+}
+
+// Usage 录制目录占用与配额，单位字节
+func Usage() (int64, int64) {
+	return used.Load(), quota()
+}
+
+// Close 停止所有录制，抓包进程退出时调用
+func Close() {
+	for _, r := range list() {
+		select {
+		case r.stop <- types.RecordReasonShutdown:
+		default:
+		}
+	}
+	for _, r := range list() {
+		<-r.done
+	}
+}
+
+// Path 录制目录
+func Path() string {
+	if config.Cfg.Record.Path != "" {
+		return config.Cfg.Record.Path
+	}
+	return filepath.Join(config.Home, "data", "record")
+}
+
+// 按目标类型生成匹配函数，返回规范化后的目标值
+func matcher(target types.RecordTarget, value string) (func(gopacket.Packet) bool, string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, "", ErrInvalidValue
+	}
+	switch target {
+	case types.RecordUser:
+		m := &userMatcher{name: value, cache: make(map[string]userMatch)}
+		return func(p gopacket.Packet) bool {
+			src, dst := addresses(p)
+			return m.match(src) || m.match(dst)
+		}, value, nil
+	case types.RecordIP:
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, "", ErrInvalidValue
+		}
+		addr = addr.Unmap()
+		ip := net.IP(addr.AsSlice())
+		return func(p gopacket.Packet) bool {
+			src, dst := addresses(p)
+			return ip.Equal(src) || ip.Equal(dst)
+		}, addr.String(), nil
+	case types.RecordMac:
+		hw, err := net.ParseMAC(value)
+		if err != nil {
+			return nil, "", ErrInvalidValue
+		}
+		return func(p gopacket.Packet) bool {
+			eth, ok := p.LinkLayer().(*layers.Ethernet)
+			return ok && (string(eth.SrcMAC) == string(hw) || string(eth.DstMAC) == string(hw))
+		}, hw.String(), nil
+	}
+	return nil, "", ErrInvalidTarget
+}
+
+func addresses(p gopacket.Packet) (net.IP, net.IP) {
+	switch l := p.NetworkLayer().(type) {
+	case *layers.IPv4:
+		return l.SrcIP, l.DstIP
+	case *layers.IPv6:
+		return l.SrcIP, l.DstIP
+	}
+	return nil, nil
+}
+
+func list() []*recorder {
+	if l := active.Load(); l != nil {
+		return append([]*recorder(nil), *l...)
+	}
+	return nil
+}
+
+func find(id string) *recorder {
+	for _, r := range list() {
+		if r.rec.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+func remove(r *recorder) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	next := make([]*recorder, 0)
+	for _, item := range list() {
+		if item != r {
+			next = append(next, item)
+		}
+	}
+	active.Store(&next)
+}
+
+// 追加审计事件
+func audit(id string, event types.RecordEvent) {
+	if err := storage.Recordings().AddRecordEvent(context.TODO(), id, event); err != nil {
+		zap.L().Error("保存录制审计事件失败", zap.String("id", id), zap.String("action", event.Action), zap.Error(err))
+	}
+}
+
+// 更新审计记录的状态、统计与文件列表
+func save(rec types.Recording) {
+	if err := storage.Recordings().UpdateRecording(context.TODO(), rec); err != nil {
+		zap.L().Error("保存录制记录失败", zap.String("id", rec.ID), zap.Error(err))
+	}
+}
+
+// 录制目录中的分片文件，包数取自已保存的文件列表
+func scanFiles(rec types.Recording) []types.RecordFile {
+	packets := make(map[string]int64, len(rec.Files))
+	for _, f := range rec.Files {
+		packets[f.Name] = f.Packets
+	}
+	files := []types.RecordFile{}
+	entries, _ := os.ReadDir(filepath.Join(Path(), rec.ID))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, rec.ID+"-") || !strings.HasSuffix(name, fileExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, types.RecordFile{Name: name, Size: info.Size(), Packets: packets[name]})
+	}
+	return files
+}
+
+func dirSize(path string) int64 {
+	var size int64
+	_ = filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+func quota() int64 {
+	if config.Cfg.Record.Quota > 0 {
+		return int64(config.Cfg.Record.Quota) << 20
+	}
+	return defaultQuota << 20
+}
+
+func fileSize() int64 {
+	if config.Cfg.Record.FileSize > 0 {
+		return int64(config.Cfg.Record.FileSize) << 20
+	}
+	return defaultFileSize << 20
+}
+
+func getMaxConcurrent() int {
+	if config.Cfg.Record.MaxConcurrent > 0 {
+		return config.Cfg.Record.MaxConcurrent
+	}
+	return defaultMaxConcurrent
+}
+
+func getDuration() int {
+	if config.Cfg.Record.Duration > 0 {
+		return config.Cfg.Record.Duration
+	}
+	return defaultDuration
+}
+
+func getMaxDuration() int {
+	if config.Cfg.Record.MaxDuration > 0 {
+		return config.Cfg.Record.MaxDuration
+	}
+	return defaultMaxDuration
+}
+
+func formatTarget(target types.RecordTarget, value string) string {
+	return fmt.Sprintf("%s %s", target, value)
+}
+
+// 按用户录制时缓存每个 IP 的解析结果，过期后重新解析以感知上下线
+type userMatcher struct {
+	mu    sync.Mutex
+	name  string
+	cache map[string]userMatch
+}
+
+type userMatch struct {
+	ok bool
+	at time.Time
+}
+
+func (m *userMatcher) match(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	key := ip.String()
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.cache[key]; ok && now.Sub(c.at) < userCacheTTL {
+		return c.ok
+	}
+	ok := false
+	// IPv6 地址按前缀归属到用户
+	if k, found := users.ResolveUser(key); found {
+		if user, loaded := users.OnlineUsers.Load(k); loaded {
+			ok = user.(types.User).UserName == m.name
+		}
+	}
+	if len(m.cache) >= userCacheSize {
+		clear(m.cache)
+	}
+	m.cache[key] = userMatch{ok: ok, at: now}
+	return ok
+}
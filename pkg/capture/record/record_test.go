@@ -0,0 +1,263 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/users"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var (
+	macA = net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	macB = net.HardwareAddr{0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb}
+)
+
+func setup(t *testing.T) {
+	t.Helper()
+	config.Cfg = &config.Yaml{}
+	config.Cfg.Storage.Backend = storage.BackendMemory
+	config.Cfg.Record.Path = t.TempDir()
+	config.Cfg.Record.FileSize = 1
+	config.RunDir = t.TempDir()
+	if err := storage.SetupClient(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = storage.Close() })
+	// 内存存储在进程内只初始化一次，清空其他测试写入的记录
+	if err := storage.Datasets().DropDatabase(context.Background(), types.MongoDatabaseAudit); err != nil {
+		t.Fatal(err)
+	}
+	if err := Setup(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 以太网 IPv4 UDP 数据包，负载首字节为序号
+func newPacket(t *testing.T, src, dst string, seq int, size int) gopacket.Packet {
+	t.Helper()
+	eth := &layers.Ethernet{SrcMAC: macA, DstMAC: macB, EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.ParseIP(src), DstIP: net.ParseIP(dst)}
+	udp := &layers.UDP{SrcPort: 40000, DstPort: 40001}
+	_ = udp.SetNetworkLayerForChecksum(ip)
+	payload := make([]byte, size)
+	payload[0] = byte(seq)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, udp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LinkTypeEthernet, gopacket.Default)
+	md := p.Metadata()
+	md.Timestamp = time.Unix(1792396800, int64(seq))
+	md.CaptureLength, md.Length = len(buf.Bytes()), len(buf.Bytes())
+	return p
+}
+
+func TestRotationRoundTrip(t *testing.T) {
+	setup(t)
+	rec, err := Start(types.RecordRequest{Target: types.RecordIP, Value: "10.0.0.1", Duration: 60, Operator: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const total = 1500
+	for i := 0; i < total; i++ {
+		Packet(newPacket(t, "10.0.0.1", "10.0.0.2", i, 1400))
+		// 不匹配的数据包不录制
+		Packet(newPacket(t, "10.0.0.3", "10.0.0.2", i, 100))
+	}
+
+	// 滚动后审计记录中即有已写完的分片
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		saved, err := storage.Recordings().GetRecording(context.Background(), rec.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.Status == types.RecordRunning && len(saved.Files) >= 2 && saved.Files[0].Packets > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("files not saved while running: %+v", saved.Files)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if rec, err = Stop(rec.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Packets != total || rec.Dropped != 0 || len(rec.Files) < 2 {
+		t.Fatalf("recording %d packets %d dropped %d files", rec.Packets, rec.Dropped, len(rec.Files))
+	}
+
+	var read int64
+	for _, f := range rec.Files {
+		file, err := os.Open(filepath.Join(Path(), rec.ID, f.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := pcapgo.NewNgReader(file, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.LinkType() != layers.LinkTypeEthernet {
+			t.Errorf("%s link type %v", f.Name, r.LinkType())
+		}
+		var packets int64
+		for {
+			data, ci, err := r.ReadPacketData()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+			p := gopacket.NewPacket(data, layers.LinkTypeEthernet, gopacket.Default)
+			app := p.ApplicationLayer()
+			if app == nil || int64(app.Payload()[0]) != read%256 || ci.Timestamp.Nanosecond() != int(read) {
+				t.Fatalf("%s packet %d out of order", f.Name, read)
+			}
+			packets++
+			read++
+		}
+		info, _ := file.Stat()
+		_ = file.Close()
+		if packets != f.Packets || info.Size() != f.Size {
+			t.Errorf("%s: read %d packets %d bytes, recorded %d packets %d bytes", f.Name, packets, info.Size(), f.Packets, f.Size)
+		}
+	}
+	if read != total {
+		t.Fatalf("read %d packets, want %d", read, total)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	setup(t)
+	config.Cfg.Record.MaxConcurrent = 1
+	req := types.RecordRequest{Target: types.RecordIP, Value: "10.0.0.1", Duration: 60}
+	rec, err := Start(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Start(req); !errors.Is(err, ErrTooMany) {
+		t.Fatalf("second recording = %v, want ErrTooMany", err)
+	}
+	if _, err = Stop(rec.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	used.Store(quota())
+	defer used.Store(dirSize(Path()))
+	if _, err = Start(req); !errors.Is(err, ErrQuota) {
+		t.Fatalf("recording over quota = %v, want ErrQuota", err)
+	}
+}
+
+func TestInterruptedFiles(t *testing.T) {
+	setup(t)
+	id := "interrupted"
+	dir := filepath.Join(Path(), id)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{id + "-001" + fileExt: 100, id + "-002" + fileExt: 50} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := storage.Recordings().InsertRecording(context.Background(), types.Recording{
+		ID:     id,
+		Status: types.RecordRunning,
+		Files:  []types.RecordFile{{Name: id + "-001" + fileExt, Size: 10, Packets: 3}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Setup(); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.RecordFile{{Name: id + "-001" + fileExt, Size: 100, Packets: 3}, {Name: id + "-002" + fileExt, Size: 50}}
+	if rec.Status != types.RecordInterrupted || len(rec.Files) != 2 || rec.Files[0] != want[0] || rec.Files[1] != want[1] {
+		t.Fatalf("interrupted recording %s files %+v", rec.Status, rec.Files)
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	p := newPacket(t, "10.0.0.1", "10.0.0.2", 0, 10)
+	cases := []struct {
+		target types.RecordTarget
+		value  string
+		want   string
+		match  bool
+		err    error
+	}{
+		{types.RecordIP, "10.0.0.1", "10.0.0.1", true, nil},
+		{types.RecordIP, " 10.0.0.2 ", "10.0.0.2", true, nil},
+		{types.RecordIP, "::ffff:10.0.0.2", "10.0.0.2", true, nil},
+		{types.RecordIP, "10.0.0.3", "10.0.0.3", false, nil},
+		{types.RecordIP, "10.0.0", "", false, ErrInvalidValue},
+		{types.RecordMac, "00:11:22:33:44:55", "00:11:22:33:44:55", true, nil},
+		{types.RecordMac, "66-77-88-99-AA-BB", "66:77:88:99:aa:bb", true, nil},
+		{types.RecordMac, "00:00:00:00:00:01", "00:00:00:00:00:01", false, nil},
+		{types.RecordMac, "zz", "", false, ErrInvalidValue},
+		{types.RecordIP, " ", "", false, ErrInvalidValue},
+		{"port", "80", "", false, ErrInvalidTarget},
+	}
+	for _, c := range cases {
+		match, value, err := matcher(c.target, c.value)
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s %q: err %v, want %v", c.target, c.value, err, c.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if value != c.want || match(p) != c.match {
+			t.Errorf("%s %q: value %q match %v, want %q %v", c.target, c.value, value, match(p), c.want, c.match)
+		}
+	}
+}
+
+func TestUserMatcher(t *testing.T) {
+	p := newPacket(t, "10.0.0.1", "10.0.0.2", 0, 10)
+	users.OnlineUsers.Store("10.0.0.2", types.User{UserName: "alice", IP: "10.0.0.2"})
+	defer users.OnlineUsers.Delete("10.0.0.2")
+
+	match, value, err := matcher(types.RecordUser, " alice ")
+	if err != nil || value != "alice" {
+		t.Fatalf("value %q err %v", value, err)
+	}
+	if !match(p) {
+		t.Fatal("online user not matched")
+	}
+	other, _, _ := matcher(types.RecordUser, "bob")
+	if other(p) {
+		t.Fatal("other user matched")
+	}
+
+	// 缓存有效期内不重新解析，过期后感知下线
+	users.OnlineUsers.Delete("10.0.0.2")
+	if !match(p) {
+		t.Fatal("cached result not used")
+	}
+	m := &userMatcher{name: "alice", cache: map[string]userMatch{
+		"10.0.0.2": {ok: true, at: time.Now().Add(-userCacheTTL)},
+	}}
+	if m.match(net.ParseIP("10.0.0.2")) {
+		t.Fatal("expired cache entry used")
+	}
+}
@@ -0,0 +1,274 @@
+package record
+
+import (
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcapgo"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 单个录制的写入协程
+// 数据包按到达顺序写入当前文件，超过文件大小后滚动；字节上限与磁盘配额在写入前检查，
+// 达到上限即结束录制；滚动与结束时统计与文件列表写回审计记录
+
+type packet struct {
+	ci   gopacket.CaptureInfo
+	data []byte
+}
+
+type recorder struct {
+	mu    sync.Mutex // 保护 rec
+	rec   types.Recording
+	match func(gopacket.Packet) bool
+
+	queue   chan packet
+	stop    chan string
+	done    chan struct{}
+	dropped atomic.Int64
+
+	file   *os.File
+	writer *pcapgo.NgWriter
+	size   int64 // 当前文件已写入字节数
+}
+
+var hostname, _ = os.Hostname()
+
+func (r *recorder) run(duration time.Duration) {
+	defer close(r.done)
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	// 定期刷新缓冲，已滚动的文件之外当前文件也能看到进度
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var reason string
+	var err error
+loop:
+	for {
+		select {
+		case p := <-r.queue:
+			if reason, err = r.write(p); reason != "" {
+				break loop
+			}
+		case <-ticker.C:
+			if err = r.writer.Flush(); err != nil {
+				reason = types.RecordReasonError
+				break loop
+			}
+		case <-timer.C:
+			reason = types.RecordReasonDuration
+			break loop
+		case reason = <-r.stop:
+			break loop
+		}
+	}
+
+	// 到期或停止时写完已进入队列的数据包
+	if err == nil && reason != types.RecordReasonBytes && reason != types.RecordReasonQuota {
+	drain:
+		for {
+			select {
+			case p := <-r.queue:
+				if next, e := r.write(p); next != "" {
+					if e != nil {
+						reason, err = next, e
+					}
+					break drain
+				}
+			default:
+				break drain
+			}
+		}
+	}
+	r.finish(reason, err)
+}
+
+func (r *recorder) write(p packet) (string, error) {
+	n := int64(len(p.data))
+	if r.rec.MaxBytes > 0 && r.rec.Bytes+n > r.rec.MaxBytes {
+		return types.RecordReasonBytes, nil
+	}
+	// 增强包块头尾32字节，数据按4字节对齐
+	block := 32 + (n+3)&^3
+	if used.Load()+block > quota() {
+		return types.RecordReasonQuota, nil
+	}
+	if r.size+block > fileSize() && r.rec.Files[len(r.rec.Files)-1].Packets > 0 {
+		if err := r.rotate(); err != nil {
+			return types.RecordReasonError, err
+		}
+	}
+
+	ci := p.ci
+	ci.InterfaceIndex, ci.CaptureLength = 0, len(p.data)
+	ci.Length = max(ci.Length, ci.CaptureLength)
+	if err := r.writer.WritePacket(ci, p.data); err != nil {
+		return types.RecordReasonError, err
+	}
+	r.size += block
+	used.Add(block)
+
+	r.mu.Lock()
+	r.rec.Packets++
+	r.rec.Bytes += n
+	f := &r.rec.Files[len(r.rec.Files)-1]
+	f.Packets++
+	f.Size = r.size
+	r.mu.Unlock()
+	return "", nil
+}
+
+// 关闭当前文件并创建下一个分片，节头与接口描述记录录制信息
+func (r *recorder) rotate() error {
+	if err := r.closeFile(); err != nil {
+		return err
+	}
+	part := len(r.rec.Files) + 1
+	name := fmt.Sprintf("%s-%03d%s", r.rec.ID, part, fileExt)
+	path := filepath.Join(r.dir(), name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+
+	link.RLock()
+	intf := pcapgo.NgInterface{
+		Name:                link.source,
+		Description:         "dpi-analyze recording " + formatTarget(r.rec.Target, r.rec.Value),
+		Filter:              filter(r.rec.Target, r.rec.Value),
+		OS:                  runtime.GOOS,
+		LinkType:            link.linkType,
+		SnapLength:          link.snapLen,
+		TimestampResolution: 9,
+	}
+	link.RUnlock()
+	comment := fmt.Sprintf("recording=%s target=%s value=%s operator=%s part=%d start=%s",
+		r.rec.ID, r.rec.Target, r.rec.Value, r.rec.Operator, part, r.rec.StartTime.Format(time.RFC3339))
+	if r.rec.Remark != "" {
+		comment += " remark=" + r.rec.Remark
+	}
+	w, err := pcapgo.NewNgWriterInterface(f, intf, pcapgo.NgWriterOptions{
+		SectionInfo: pcapgo.NgSectionInfo{
+			Hardware:    hostname,
+			OS:          runtime.GOOS,
+			Application: "dpi-analyze " + config.Version,
+			Comment:     comment,
+		},
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	var info os.FileInfo
+	if err == nil {
+		info, err = f.Stat()
+	}
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return err
+	}
+
+	r.file, r.writer, r.size = f, w, info.Size()
+	used.Add(r.size)
+	r.mu.Lock()
+	r.rec.Files = append(r.rec.Files, types.RecordFile{Name: name, Size: r.size})
+	r.mu.Unlock()
+	// 首个文件随审计记录一起写入；之后每次滚动保存文件列表，进程异常退出时已写完的分片仍可下载
+	if part > 1 {
+		save(r.snapshot())
+	}
+	return nil
+}
+
+// 刷新缓冲并落盘，按实际文件大小校正占用
+func (r *recorder) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.writer.Flush()
+	if err == nil {
+		err = r.file.Sync()
+	}
+	if info, statErr := r.file.Stat(); statErr == nil {
+		used.Add(info.Size() - r.size)
+		r.mu.Lock()
+		r.rec.Files[len(r.rec.Files)-1].Size = info.Size()
+		r.mu.Unlock()
+	}
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	r.file, r.writer, r.size = nil, nil, 0
+	return err
+}
+
+func (r *recorder) finish(reason string, err error) {
+	if closeErr := r.closeFile(); err == nil && closeErr != nil {
+		reason, err = types.RecordReasonError, closeErr
+	}
+
+	r.mu.Lock()
+	r.rec.Status = types.RecordDone
+	if err != nil {
+		r.rec.Status, r.rec.Error = types.RecordFailed, err.Error()
+	}
+	r.rec.Reason = reason
+	r.rec.Dropped = r.dropped.Load()
+	r.rec.EndTime = time.Now()
+	r.mu.Unlock()
+
+	event := types.RecordEvent{Action: "finish", Detail: reason, Time: time.Now()}
+	r.event(event)
+	rec := r.snapshot()
+	save(rec)
+	audit(rec.ID, event)
+	remove(r)
+	zap.L().Info("定向录制结束", zap.String("id", rec.ID), zap.String("status", rec.Status),
+		zap.String("reason", reason), zap.Int64("packets", rec.Packets), zap.Int64("bytes", rec.Bytes),
+		zap.Int64("dropped", rec.Dropped), zap.Int("files", len(rec.Files)), zap.Error(err))
+}
+
+// 追加审计事件到内存中的记录，持久化由调用方完成
+func (r *recorder) event(e types.RecordEvent) {
+	r.mu.Lock()
+	r.rec.Events = append(r.rec.Events, e)
+	r.mu.Unlock()
+}
+
+// 当前状态的拷贝，丢包数为实时值
+func (r *recorder) snapshot() types.Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec := r.rec
+	rec.Files = append([]types.RecordFile(nil), r.rec.Files...)
+	rec.Events = append([]types.RecordEvent(nil), r.rec.Events...)
+	if rec.Status == types.RecordRunning {
+		rec.Dropped = r.dropped.Load()
+	}
+	return rec
+}
+
+func (r *recorder) dir() string {
+	return filepath.Join(Path(), r.rec.ID)
+}
+
+// pcapng 接口描述中的 BPF 过滤条件，用户目标的地址会变化，不写过滤条件
+func filter(target types.RecordTarget, value string) string {
+	switch target {
+	case types.RecordIP:
+		return "host " + value
+	case types.RecordMac:
+		return "ether host " + value
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package capture
+
+import (
+	"context"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/member"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/observer"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/clock"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcap"
+	"go.uber.org/zap"
+)
+
+// Replay 依次回放多个离线文件，观察者与成员组件只初始化一次，状态在文件之间保留
+func Replay(ctx context.Context, files []string, bpf string, handler PacketHandler) error {
+	clock.SetReplay()
+	observer.CleanUp()
+	observer.Setup()
+	member.Setup()
+	go handler.FlushStream(ctx)
+
+	for _, file := range files {
+		if err := replayFile(ctx, file, bpf, handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func replayFile(ctx context.Context, file, bpf string, handler PacketHandler) error {
+	handle, err := pcap.OpenOffline(file)
+	if err != nil {
+		zap.L().Error("Failed to open offline file", zap.String("file", file), zap.Error(err))
+		return err
+	}
+	defer handle.Close()
+
+	if bpf != "" {
+		if err = handle.SetBPFFilter(bpf); err != nil {
+			return err
+		}
+	}
+	zap.L().Info("Replay offline file", zap.String("file", file))
+
+	source := gopacket.NewPacketSource(handle, handle.LinkType())
+	source.Lazy = true
+	source.NoCopy = true
+	for packet := range source.Packets() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		PacketsCount++
+		clock.Advance(packet.Metadata().Timestamp)
+		handler.HandlePacket(packet)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package resolve
+
+import (
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"strings"
+	"unicode"
+)
+
+// 设备分类
+// 依次根据 UA、品牌库信息、mDNS/DHCP 类型与系统指纹推断设备类别，无法判断时参考同IP设备实体
+// 文本与关键字按相同规则分词后整词匹配，避免 microsoft 命中 cros、canonical 命中 canon；
+// 关键字以 * 结尾时最后一个词按前缀匹配，用于 AFTMM 一类的型号代码
+
+type classRule struct {
+	class    types.DeviceClass
+	keywords []string
+}
+
+// 分词后的关键字
+var keywordTokens = make(map[string][]string)
+
+func init() {
+	for _, rules := range [][]classRule{specificRules, pcRules} {
+		for _, rule := range rules {
+			for _, keyword := range rule.keywords {
+				keywordTokens[keyword] = tokenize(keyword)
+			}
+		}
+	}
+}
+
+// 具体类别规则，按顺序匹配
+var specificRules = []classRule{
+	{types.ClassConsole, []string{"playstation", "xbox", "nintendo", "steamdeck", "steam deck", "游戏机"}},
+	{types.ClassTV, []string{"smart-tv", "smarttv", "smart tv", "hbbtv", "tizen", "webos", "web0s", "appletv", "apple tv", "android tv", "google tv", "googletv", "_googlecast", "chromecast", "bravia", "roku", "mibox", "mitv", "aftb*", "aftm*", "aftt*", "afts*", "kodi", "xbmc", "电视", "机顶盒", "盒子"}},
+	{types.ClassPrinter, []string{"printer", "_ipp", "_pdl-datastream", "epson", "brother", "canon", "kyocera", "ricoh", "xerox", "lexmark", "pantum", "打印机"}},
+	{types.ClassNetwork, []string{"routeros", "mikrotik", "openwrt", "ubiquiti", "ubnt", "ruijie", "h3c", "cisco", "juniper", "aruba", "ruckus", "netgear", "路由", "交换机"}},
+	{types.ClassIoT, []string{"espressif", "esp8266", "esp32", "tuya", "shelly", "sonoff", "itead", "hikvision", "dahua", "ezviz", "signify", "philips hue", "yeelight", "homekit", "_hap.", "miio", "google nest", "ecovacs", "roborock", "freertos", "hyperion", "摄像", "智能家居", "音箱"}},
+	{types.ClassTablet, []string{"ipad", "tablet", "kindle", "galaxy tab", "matepad", "xiaomi pad", "sm-t", "平板"}},
+	{types.ClassPhone, []string{"iphone", "windows phone", "mobile", "手机"}},
+}
+
+// 电脑类别规则，在移动系统判断之后匹配
+var pcRules = []classRule{
+	{types.ClassLaptop, []string{"macbook", "thinkpad", "matebook", "notebook", "laptop", "chromebook", "cros", "笔记本"}},
+	{types.ClassPC, []string{"windows", "macintosh", "mac os", "macos", "msft", "linux", "x11", "ubuntu", "电脑"}},
+}
+
+// Classify 推断设备类别
+func Classify(device types.DeviceRecord) types.DeviceClass {
+	if device.Class != types.ClassUnknown {
+		return device.Class
+	}
+	// TTL 指纹仅识别 windows
+	if device.OriginChanel == types.TTL {
+		return types.ClassPC
+	}
+	values := []string{device.Device, device.Model, device.Os, device.Brand, device.Description}
+	// 仅 UA 的原始值可用于判断，域名等原始值容易误判
+	if device.OriginChanel == types.UserAgent {
+		values = append(values, device.OriginValue)
+	}
+	tokens := tokenize(strings.Join(values, " "))
+
+	if class := matchClass(tokens, specificRules); class != types.ClassUnknown {
+		return class
+	}
+	if hasToken(tokens, "android") {
+		// 安卓 UA 不含 mobile 时通常为平板
+		if device.OriginChanel == types.UserAgent && !hasToken(tokens, "mobile") {
+			return types.ClassTablet
+		}
+		return types.ClassPhone
+	}
+	if strings.ToLower(device.Os) == "ios" {
+		return types.ClassPhone
+	}
+	if class := matchClass(tokens, pcRules); class != types.ClassUnknown {
+		return class
+	}
+	return classOfIdentities(device.IP)
+}
+
+// ClassifyText 根据 mDNS 服务、DHCP 主机名与厂商标识等文本推断设备类别
+func ClassifyText(values ...string) types.DeviceClass {
+	tokens := tokenize(strings.Join(values, " "))
+	if class := matchClass(tokens, specificRules); class != types.ClassUnknown {
+		return class
+	}
+	if hasToken(tokens, "android") {
+		return types.ClassPhone
+	}
+	return matchClass(tokens, pcRules)
+}
+
+// IsMobile 判断客户端是否为移动设备
+func IsMobile(device types.DeviceRecord) bool {
+	return Classify(device).IsMobile()
+}
+
+func matchClass(tokens []string, rules []classRule) types.DeviceClass {
+	if len(tokens) == 0 {
+		return types.ClassUnknown
+	}
+	for _, rule := range rules {
+		for _, keyword := range rule.keywords {
+			if matchTokens(tokens, keywordTokens[keyword]) {
+				return rule.class
+			}
+		}
+	}
+	return types.ClassUnknown
+}
+
+// matchTokens 关键字的词在文本中连续出现
+func matchTokens(tokens, pattern []string) bool {
+	if len(pattern) == 0 {
+		return false
+	}
+	for i := 0; i+len(pattern) <= len(tokens); i++ {
+		ok := true
+		for j, p := range pattern {
+			t := tokens[i+j]
+			if j == len(pattern)-1 && strings.HasSuffix(p, "*") {
+				ok = strings.HasPrefix(t, p[:len(p)-1])
+			} else {
+				ok = t == p
+			}
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasToken(tokens []string, token string) bool {
+	for _, t := range tokens {
+		if t == token {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenize 转小写后按非字母数字切分，字母与数字之间断开，如 iPhone14,2 -> iphone 14 2；
+// 中文没有词边界，每个汉字单独成词，关键字按连续汉字匹配
+func tokenize(text string) []string {
+	var tokens []string
+	var cur []rune
+	var kind int // 0 无 1 字母 2 数字
+	flush := func() {
+		if len(cur) > 0 {
+			tokens = append(tokens, string(cur))
+			cur = cur[:0]
+		}
+		kind = 0
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flush()
+			tokens = append(tokens, string(r))
+		case r == '*':
+			// 仅用于关键字的前缀标记
+			cur = append(cur, r)
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+			k := 1
+			if unicode.IsDigit(r) {
+				k = 2
+			}
+			if kind != 0 && kind != k {
+				flush()
+			}
+			cur = append(cur, r)
+			kind = k
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+// 同IP设备实体的类别一致时沿用该类别
+func classOfIdentities(ip string) types.DeviceClass {
+	class := types.ClassUnknown
+	for _, d := range GetIdentities(ip) {
+		c := types.DeviceClass(d.Attr(types.AttrClass))
+		if c == types.ClassUnknown {
+			continue
+		}
+		if class != types.ClassUnknown && class != c {
+			return types.ClassUnknown
+		}
+		class = c
+	}
+	return class
+}
@@ -0,0 +1,45 @@
+package resolve
+
+import (
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"testing"
+)
+
+func TestClassifyText(t *testing.T) {
+	cases := []struct {
+		text string
+		want types.DeviceClass
+	}{
+		{"Microsoft Windows", types.ClassPC},
+		{"Canonical Ubuntu", types.ClassPC},
+		{"Canon MF643C", types.ClassPrinter},
+		{"Mozilla/5.0 (X11; CrOS x86_64 14541.0.0)", types.ClassLaptop},
+		{"Mozilla/5.0 (iPhone14,2; CPU iPhone OS 16_0 like Mac OS X)", types.ClassPhone},
+		{"SAMSUNG SM-T510", types.ClassTablet},
+		{"AFTMM Fire TV", types.ClassTV},
+		{"_googlecast._tcp.local", types.ClassTV},
+		{"SMART-TV Tizen", types.ClassTV},
+		{"esp32-cam", types.ClassIoT},
+		{"小米电视", types.ClassTV},
+		{"crossover", types.ClassUnknown},
+		{"", types.ClassUnknown},
+	}
+	for _, c := range cases {
+		if got := ClassifyText(c.text); got != c.want {
+			t.Errorf("ClassifyText(%q) = %q, want %q", c.text, got, c.want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("iPhone14,2 SM-T510 游戏机")
+	want := []string{"iphone", "14", "2", "sm", "t", "510", "游", "戏", "机"}
+	if len(got) != len(want) {
+		t.Fatalf("tokenize = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("tokenize = %q, want %q", got, want)
+		}
+	}
+}
@@ -3,9 +3,9 @@ package resolve
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/bus"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/state"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/redis"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
 	v9 "github.com/redis/go-redis/v9"
@@ -54,30 +54,18 @@ func (d *Device) unSerialize(jsonData string) types.DeviceRecord {
 
 // 保存设备记录到mongodb
 func (d *Device) storeMongo() {
-	collection, err := createDynamicCollectionWithUniqueIndex(mongo.GetMongoClient(), types.MongoDatabaseDevices)
-	if err != nil {
-		zap.L().Error("Failed to create dynamic collection by devices", zap.Error(err))
-		return
-	}
-	_, _ = collection.InsertOne(d.ctx, d.Record)
+	storeMongo(d.Record)
+	bus.DeviceDiscovered.Publish(d.Record)
 }
 
-// 保存设备信息到redis
+// 保存设备信息到状态，并刷新设备最后出现时间，由状态写回 redis
 func (d *Device) storeRedis(update bool) {
-	key := fmt.Sprintf(types.SetIPDevices, d.IP)
-
-	if !update {
-		storeDeviceIncr(d.rdb, d.Record)
-	}
 	// 序列化
 	jsonData := d.serialize()
 	if len(jsonData) == 0 {
 		return
 	}
-	// 追加到集合中
-	d.rdb.SAdd(d.ctx, key, jsonData).Val()
-	// 设置过期时间
-	d.rdb.Expire(d.ctx, key, 24*time.Hour).Val()
+	state.TouchDevice(d.IP, jsonData)
 	d.checkCount()
 }
 
@@ -92,13 +80,10 @@ func (d *Device) deleteRedis() {
 // 检查设备信息
 func (d *Device) checkDevice() {
 	update := false
-	key := fmt.Sprintf(types.SetIPDevices, d.IP)
-	jsonData, err := d.rdb.SMembers(d.ctx, key).Result()
-	if err != nil {
-		zap.L().Error("check device failed", zap.Error(err))
-		return
-	}
-	for _, device := range jsonData {
+	// 命中的已有设备，刷新其最后出现时间
+	matched := ""
+	for _, item := range state.Devices(d.IP) {
+		device := item.Member
 		oldRecord := d.unSerialize(device)
 		if oldRecord.IP != d.IP {
 			continue
@@ -107,6 +92,7 @@ func (d *Device) checkDevice() {
 		// 操作系统一致，且版本不存在跳过
 		if len(d.Record.Os) > 0 && d.Record.Os == oldRecord.Os && d.Record.Version == oldRecord.Version {
 			update = true
+			matched = device
 			break
 		}
 		// 操作系统一致，但是品牌宽泛地跳过
@@ -114,6 +100,7 @@ func (d *Device) checkDevice() {
 			d.Record.Version == oldRecord.Version &&
 			(d.Record.Device == "Other" || d.Record.Brand == "android" || d.Record.Brand == "generic_android") {
 			update = true
+			matched = device
 			break
 		}
 		// window 跳过联想
@@ -125,7 +112,7 @@ func (d *Device) checkDevice() {
 			// 更新操作系统和版本
 			d.Record = updateDeviceRecord(d.Record, oldRecord)
 			// 删除旧的设备信息
-			d.rdb.SRem(d.ctx, key, device).Val()
+			state.RemoveDevices(d.IP, device)
 			// 更新设备信息
 			update = true
 			d.storeRedis(update)
@@ -138,11 +125,13 @@ func (d *Device) checkDevice() {
 			// 因为这里是更新品牌具体信息，如果操作系统和版本为空那么也跳过，仅当ua分析出来具体的系统和版本再进行设备的更新
 			if len(d.Record.Os) == 0 || len(d.Record.Version) == 0 {
 				update = true
+				matched = device
 				break
 			}
 			// 版本一致代表重复数据，也跳过
 			if d.Record.Version == oldRecord.Version {
 				update = true
+				matched = device
 				break
 			}
 			// TODO 其他条件 start
@@ -158,7 +147,7 @@ func (d *Device) checkDevice() {
 				oldRecord.Model = d.Record.Model
 			}
 			// 删除旧的设备信息
-			d.rdb.SRem(d.ctx, key, device).Val()
+			state.RemoveDevices(d.IP, device)
 			// 更新设备信息
 			update = true
 			d.storeRedis(update)
@@ -172,63 +161,38 @@ func (d *Device) checkDevice() {
 		d.storeRedis(update)
 		d.Record.Remark = "saved device"
 		d.storeMongo()
+		return
+	}
+	if matched != "" {
+		state.TouchDevice(d.IP, matched)
 	}
 }
 
 // 检查设备数量
 func (d *Device) checkCount() {
-	key := fmt.Sprintf(types.SetIPDevices, d.IP)
-
-	// 获取该 IP 下的设备数量
-	deviceCount, err := d.rdb.SCard(d.ctx, key).Result()
-	if err != nil {
-		zap.L().Error("Error getting device count for IP %s: %v", zap.String("key", key), zap.Error(err))
-		return
-	}
+	// 由活跃设备重新计算数量
+	deviceCount, _, _ := types.Policy{}.Count(CountDevices(d.IP))
 
-	// 如果设备数量超过 1，则触发事件
+	// 如果活跃设备数量超过 1，则触发事件
 	if deviceCount > 1 {
 		triggerEvent(d.IP)
 	}
 }
 
-var (
-	expiration = 2 * time.Second
-	retryCount = 5
-	retryDelay = 100 * time.Millisecond
-)
-
 // Handle 设备处理
 // 渠道 sni匹配 useragent匹配 ttl匹配
 func Handle(device types.DeviceRecord) {
-	rdb := redis.GetRedisClient()
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second) // 增加上下文超时时间
-	defer cancel()
+	device.Class = Classify(device)
+	// 归并到设备实体
+	ObserveRecord(device)
 
-	lockKey := fmt.Sprintf(types.LockIPBrand, device.IP, device.OriginChanel)
+	// 同一 IP 的设备串行处理
+	unlock := state.Lock(device.IP)
+	defer unlock()
 
-	// 获取锁
-	lockValue := fmt.Sprintf("%d", time.Now().UnixNano())
-	locked, err := acquireLock(ctx, rdb, lockKey, lockValue, expiration)
-	if err != nil {
-		zap.L().Error("Error acquiring lock", zap.String("key", lockKey), zap.Error(err), zap.String("IP", device.IP))
-		return
-	}
-	if !locked {
-		// zap.L().Warn("Failed to acquire lock", zap.String("key", lockKey), zap.String("IP", device.IP))
-		return
-	}
-
-	// 确保锁在任务完成或上下文超时时释放
-	defer func() {
-		if err = releaseLock(context.Background(), rdb, lockKey, lockValue); err != nil {
-			zap.L().Error("Error releasing lock", zap.String("key", lockKey), zap.Error(err), zap.String("IP", device.IP))
-		}
-	}()
-
-	// 启动锁续约机制
-	stopRenewal := startLockRenewal(ctx, rdb, lockKey, lockValue, expiration)
-	defer stopRenewal()
+	rdb := redis.GetRedisClient()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
 	d := Device{
 		IP:     device.IP,
@@ -241,108 +205,6 @@ func Handle(device types.DeviceRecord) {
 	d.checkDevice()
 }
 
-func acquireLock(ctx context.Context, rdb *v9.Client, key, value string, expiration time.Duration) (bool, error) {
-	locked, err := trySetLock(ctx, rdb, key, value, expiration)
-	if err != nil {
-		return false, err
-	}
-	if !locked {
-		for i := 0; i < retryCount; i++ {
-			time.Sleep(retryDelay)
-			locked, err = trySetLock(ctx, rdb, key, value, expiration)
-			if err != nil {
-				return false, err
-			}
-			if locked {
-				break
-			}
-		}
-	}
-	return locked, nil
-}
-
-func startLockRenewal(ctx context.Context, rdb *v9.Client, key, value string, expiration time.Duration) func() {
-	stop := make(chan struct{})
-	go func() {
-		ticker := time.NewTicker(expiration / 2) // 每半个过期时间续约一次
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				err := renewLock(ctx, rdb, key, value, expiration)
-				if err != nil {
-					zap.L().Error("Failed to renew lock", zap.String("key", key), zap.Error(err))
-					return
-				}
-			case <-stop:
-				return
-			}
-		}
-	}()
-	return func() { close(stop) }
-}
-
-func renewLock(ctx context.Context, rdb *v9.Client, key, value string, expiration time.Duration) error {
-	// 使用 Watch 监听 key，确保操作原子性
-	err := rdb.Watch(ctx, func(tx *v9.Tx) error {
-		// 获取当前锁的值
-		currentValue, err := tx.Get(ctx, key).Result()
-		if err != nil {
-			if errors.Is(err, v9.Nil) {
-				return fmt.Errorf("lock does not exist or expired")
-			}
-			return err
-		}
-
-		// 判断锁的所有权
-		if currentValue != value {
-			return fmt.Errorf("lock ownership mismatch")
-		}
-
-		// 续约
-		_, err = tx.TxPipelined(ctx, func(pipe v9.Pipeliner) error {
-			pipe.Expire(ctx, key, expiration)
-			return nil
-		})
-		return err
-	}, key)
-
-	return err
-}
-
-// 尝试设置锁
-func trySetLock(ctx context.Context, rdb *v9.Client, key, value string, expiration time.Duration) (bool, error) {
-	return rdb.SetNX(ctx, key, value, expiration).Result()
-}
-
-// 释放锁
-func releaseLock(ctx context.Context, rdb *v9.Client, key, value string) error {
-	// 使用 Watch 和事务确保安全性
-	err := rdb.Watch(ctx, func(tx *v9.Tx) error {
-		currentValue, err := tx.Get(ctx, key).Result()
-		if err != nil {
-			if errors.Is(err, v9.Nil) {
-				return nil // 锁已经不存在
-			}
-			return err
-		}
-
-		// 确认值匹配
-		if currentValue != value {
-			return nil // 不释放其他客户端的锁
-		}
-
-		// 删除锁
-		_, err = tx.TxPipelined(ctx, func(pipe v9.Pipeliner) error {
-			pipe.Del(ctx, key)
-			return nil
-		})
-		return err
-	}, key)
-
-	return err
-}
-
 // updateDeviceRecord 比较 d.Record 和 oldRecord，更新 d.Record 并返回
 func updateDeviceRecord(d, oldRecord types.DeviceRecord) types.DeviceRecord {
 	// 比较并更新字段：优先使用 d.Record 的值
@@ -370,6 +232,9 @@ func updateDeviceRecord(d, oldRecord types.DeviceRecord) types.DeviceRecord {
 	if len(d.Type) == 0 {
 		d.Type = oldRecord.Type
 	}
+	if len(d.Class) == 0 {
+		d.Class = oldRecord.Class
+	}
 	if len(d.Os) == 0 {
 		d.Os = oldRecord.Os
 	}
@@ -0,0 +1,492 @@
+package resolve
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/member"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/clock"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/spill"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/users"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 设备实体
+// 各渠道观测按 强关联键 -> 同IP下属性兼容的设备 -> MAC 的顺序归并到设备，未命中则新建
+// 设备属性记录置信度与来源，高置信度来源覆盖低置信度来源
+// 设备库保存在 devices.inventory，定期经写入队列批量落库
+// 内存中只保留活跃设备，超过 device.idle 未出现的设备落库后释放，再次出现时按关联键从设备库恢复
+
+const (
+	maxBindings       = 100
+	maxChanges        = 200
+	identityFlushTick = 30 * time.Second
+	identityIdleIP    = 10 * time.Minute
+)
+
+// 各渠道的基础置信度
+var sourceConfidence = map[types.Property]float64{
+	types.UserAgent:    0.9,
+	types.MDNSProperty: 0.8,
+	types.DHCPProperty: 0.7,
+	types.DNSProperty:  0.6,
+	types.Mac:          0.5,
+	types.TTL:          0.3,
+}
+
+// 用于判断两个观测是否冲突的属性
+var identifyingAttrs = []string{types.AttrOs, types.AttrBrand, types.AttrModel}
+
+var identityQueue = spill.NewFixed("identity", types.MongoDatabaseDevices, types.MongoCollectionDeviceInventory, 10000, 500,
+	func(ctx context.Context, _ string, docs []bson.Raw) error {
+		return storage.Devices().SaveIdentities(ctx, docs)
+	})
+
+var identity = &registry{
+	devices: make(map[string]*types.DeviceIdentity),
+	keys:    make(map[string]string),
+	ips:     make(map[string][]string),
+	dirty:   make(map[string]struct{}),
+}
+
+type registry struct {
+	mu      sync.Mutex
+	devices map[string]*types.DeviceIdentity // 设备ID -> 设备
+	keys    map[string]string                // 关联键 -> 设备ID
+	ips     map[string][]string              // IP -> 当前设备ID
+	dirty   map[string]struct{}              // 待落库设备
+}
+
+// SetupIdentity 加载活跃设备并启动落库
+func SetupIdentity() error {
+	devices, err := findIdentities(storage.IdentityQuery{SeenSince: time.Now().Add(-getDeviceIdle())})
+	if err != nil {
+		zap.L().Error("加载设备库失败", zap.Error(err))
+		return err
+	}
+
+	identity.mu.Lock()
+	for i := range devices {
+		d := &devices[i]
+		identity.restore(d)
+		if d.IP != "" && users.ExitsUser(d.IP) {
+			identity.ips[d.IP] = append(identity.ips[d.IP], d.ID)
+		}
+	}
+	identity.mu.Unlock()
+
+	zap.L().Info("加载设备库完成", zap.Int("count", len(devices)))
+	identityQueue.Start(1)
+	go startIdentityFlush(identityFlushTick)
+	return nil
+}
+
+// ObserveDevice 归并一次设备观测，返回设备ID
+func ObserveDevice(obs types.DeviceObservation) string {
+	if obs.IP == "" {
+		return ""
+	}
+	if obs.Time.IsZero() {
+		obs.Time = clock.Now()
+	}
+	if obs.Mac == "" {
+		obs.Mac = member.GetMac(obs.IP)
+	}
+	obs.Mac = strings.ToLower(obs.Mac)
+	obs.Attributes = normalizeAttributes(obs.Attributes)
+
+	identity.mu.Lock()
+	defer identity.mu.Unlock()
+
+	d := identity.match(obs)
+	if d == nil {
+		// 已释放的设备从设备库恢复，查询期间不持有锁
+		if keys := identity.missingKeys(obs); len(keys) > 0 {
+			identity.mu.Unlock()
+			devices, err := findIdentities(storage.IdentityQuery{Keys: keys})
+			identity.mu.Lock()
+			if err != nil {
+				zap.L().Error("恢复设备失败", zap.Strings("keys", keys), zap.Error(err))
+			}
+			for i := range devices {
+				identity.restore(&devices[i])
+			}
+			d = identity.match(obs)
+		}
+	}
+	if d == nil {
+		d = &types.DeviceIdentity{
+			ID:         primitive.NewObjectID().Hex(),
+			Attributes: make(map[string]types.DeviceAttribute),
+			FirstSeen:  obs.Time,
+		}
+		identity.devices[d.ID] = d
+	}
+	identity.merge(d, obs)
+	identity.dirty[d.ID] = struct{}{}
+	return d.ID
+}
+
+// ObserveRecord 将设备记录转为观测
+func ObserveRecord(record types.DeviceRecord) string {
+	obs := types.DeviceObservation{
+		IP:          record.IP,
+		Source:      record.OriginChanel,
+		OriginValue: record.OriginValue,
+		Time:        record.LastSeen,
+		Attributes: map[string]string{
+			types.AttrOs:      record.Os,
+			types.AttrVersion: record.Version,
+			types.AttrDevice:  record.Device,
+			types.AttrBrand:   record.Brand,
+			types.AttrModel:   record.Model,
+			types.AttrType:    record.Type,
+			types.AttrIcon:    record.Icon,
+			types.AttrClass:   string(record.Class),
+		},
+	}
+	if record.OriginChanel == types.UserAgent && record.OriginValue != "" {
+		obs.Keys = append(obs.Keys, Fingerprint(record.OriginValue))
+	}
+	return ObserveDevice(obs)
+}
+
+// Fingerprint 生成指纹关联键
+func Fingerprint(value string) string {
+	sum := sha1.Sum([]byte(value))
+	return types.KeyFingerprint + hex.EncodeToString(sum[:8])
+}
+
+// GetIdentities 获取IP当前的设备实体
+func GetIdentities(ip string) []types.DeviceIdentity {
+	identity.mu.Lock()
+	defer identity.mu.Unlock()
+
+	var result []types.DeviceIdentity
+	for _, id := range identity.ips[ip] {
+		if d, ok := identity.devices[id]; ok {
+			result = append(result, copyIdentity(d))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastSeen.After(result[j].LastSeen)
+	})
+	return result
+}
+
+// missingKeys 观测中内存里不存在的关联键，用于从设备库恢复
+func (r *registry) missingKeys(obs types.DeviceObservation) []string {
+	var keys []string
+	for _, k := range obs.Keys {
+		if _, ok := r.keys[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	if obs.Mac != "" && len(r.ips[obs.IP]) == 0 {
+		if _, ok := r.keys[types.KeyMac+obs.Mac]; !ok {
+			keys = append(keys, types.KeyMac+obs.Mac)
+		}
+	}
+	return keys
+}
+
+// restore 将设备库中的设备放回内存，已在内存中的设备以内存为准
+func (r *registry) restore(d *types.DeviceIdentity) {
+	if _, ok := r.devices[d.ID]; ok {
+		return
+	}
+	if d.Attributes == nil {
+		d.Attributes = make(map[string]types.DeviceAttribute)
+	}
+	r.devices[d.ID] = d
+	for _, k := range d.Keys {
+		if _, ok := r.keys[k]; !ok {
+			r.keys[k] = d.ID
+		}
+	}
+}
+
+// evict 释放设备及其关联键与IP映射
+func (r *registry) evict(d *types.DeviceIdentity) {
+	for _, k := range d.Keys {
+		if r.keys[k] == d.ID {
+			delete(r.keys, k)
+		}
+	}
+	if contains(r.ips[d.IP], d.ID) {
+		r.unlinkIP(d.IP, d.ID)
+	}
+	delete(r.devices, d.ID)
+}
+
+// match 查找观测对应的设备
+func (r *registry) match(obs types.DeviceObservation) *types.DeviceIdentity {
+	// 1.强关联键，指纹仅在同一接入MAC下生效
+	for _, k := range obs.Keys {
+		id, ok := r.keys[k]
+		if !ok {
+			continue
+		}
+		d := r.devices[id]
+		if strings.HasPrefix(k, types.KeyFingerprint) && d.IP != obs.IP && (obs.Mac == "" || d.Mac != obs.Mac) {
+			continue
+		}
+		return d
+	}
+	// 2.同IP下属性兼容的设备，匹配属性最多者优先
+	var best *types.DeviceIdentity
+	bestScore := -1
+	for _, id := range r.ips[obs.IP] {
+		d := r.devices[id]
+		score, ok := compatible(d, obs)
+		if !ok {
+			continue
+		}
+		if score > bestScore || (score == bestScore && d.LastSeen.After(best.LastSeen)) {
+			best, bestScore = d, score
+		}
+	}
+	if best != nil {
+		return best
+	}
+	// 3.IP变化后通过MAC关联
+	if obs.Mac != "" && len(r.ips[obs.IP]) == 0 {
+		if id, ok := r.keys[types.KeyMac+obs.Mac]; ok {
+			return r.devices[id]
+		}
+	}
+	return nil
+}
+
+// compatible 判断观测与设备是否冲突，返回一致的属性数量
+func compatible(d *types.DeviceIdentity, obs types.DeviceObservation) (int, bool) {
+	conf := sourceConfidence[obs.Source]
+	score := 0
+	for _, name := range identifyingAttrs {
+		value := obs.Attributes[name]
+		attr, ok := d.Attributes[name]
+		if value == "" || !ok || attr.Value == "" {
+			continue
+		}
+		if strings.EqualFold(value, attr.Value) {
+			score++
+			continue
+		}
+		// 低置信度的属性不参与冲突判断，如TTL推断的windows与DNS识别的品牌
+		if conf < 0.5 || attr.Confidence < 0.5 {
+			continue
+		}
+		return 0, false
+	}
+	return score, true
+}
+
+// merge 合并观测到设备
+func (r *registry) merge(d *types.DeviceIdentity, obs types.DeviceObservation) {
+	conf := sourceConfidence[obs.Source]
+	if conf == 0 {
+		conf = 0.5
+	}
+	for name, value := range obs.Attributes {
+		attr, ok := d.Attributes[name]
+		switch {
+		case ok && strings.EqualFold(attr.Value, value):
+			// 多次观测一致，提升置信度
+			attr.Confidence = max(attr.Confidence, conf)
+			attr.Confidence += (1 - attr.Confidence) * 0.1
+			attr.LastSeen = obs.Time
+		case !ok || conf >= attr.Confidence:
+			attr = types.DeviceAttribute{
+				Value:       value,
+				Confidence:  conf,
+				Source:      obs.Source,
+				OriginValue: obs.OriginValue,
+				LastSeen:    obs.Time,
+			}
+			d.Changes = append(d.Changes, types.DeviceChange{
+				Time:       obs.Time,
+				Attribute:  name,
+				Value:      value,
+				Source:     obs.Source,
+				Confidence: conf,
+				IP:         obs.IP,
+			})
+		default:
+			continue
+		}
+		d.Attributes[name] = attr
+	}
+	if len(d.Changes) > maxChanges {
+		d.Changes = d.Changes[len(d.Changes)-maxChanges:]
+	}
+
+	for _, k := range obs.Keys {
+		r.addKey(d, k)
+	}
+	r.bind(d, obs)
+	// 仅当IP下只有一个设备时，MAC才能代表该设备
+	if obs.Mac != "" && len(r.ips[obs.IP]) == 1 {
+		d.Mac = obs.Mac
+		r.addKey(d, types.KeyMac+obs.Mac)
+	}
+	d.LastSeen = obs.Time
+}
+
+// addKey 添加关联键，已被其他设备占用的键不抢占
+func (r *registry) addKey(d *types.DeviceIdentity, key string) {
+	if id, ok := r.keys[key]; ok && id != d.ID {
+		if _, exists := r.devices[id]; exists {
+			return
+		}
+	}
+	r.keys[key] = d.ID
+	for _, k := range d.Keys {
+		if k == key {
+			return
+		}
+	}
+	d.Keys = append(d.Keys, key)
+}
+
+// bind 更新设备与IP、用户的绑定
+func (r *registry) bind(d *types.DeviceIdentity, obs types.DeviceObservation) {
+	username := users.FindUserName(obs.IP)
+	if d.IP != obs.IP {
+		r.unlinkIP(d.IP, d.ID)
+		r.ips[obs.IP] = append(r.ips[obs.IP], d.ID)
+	} else if !contains(r.ips[obs.IP], d.ID) {
+		r.ips[obs.IP] = append(r.ips[obs.IP], d.ID)
+	}
+	d.IP, d.UserName = obs.IP, username
+
+	n := len(d.Bindings)
+	if n > 0 && d.Bindings[n-1].IP == obs.IP && d.Bindings[n-1].UserName == username {
+		d.Bindings[n-1].LastSeen = obs.Time
+		return
+	}
+	d.Bindings = append(d.Bindings, types.DeviceBinding{
+		IP:        obs.IP,
+		UserName:  username,
+		FirstSeen: obs.Time,
+		LastSeen:  obs.Time,
+	})
+	if len(d.Bindings) > maxBindings {
+		d.Bindings = d.Bindings[len(d.Bindings)-maxBindings:]
+	}
+}
+
+func (r *registry) unlinkIP(ip, id string) {
+	ids := r.ips[ip]
+	for i, v := range ids {
+		if v == id {
+			ids = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(r.ips, ip)
+		return
+	}
+	r.ips[ip] = ids
+}
+
+// 定期落库并释放下线IP的设备映射与空闲设备
+func startIdentityFlush(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := clock.Now()
+		identity.mu.Lock()
+		devices := make([]types.DeviceIdentity, 0, len(identity.dirty))
+		for id := range identity.dirty {
+			if d, ok := identity.devices[id]; ok {
+				devices = append(devices, copyIdentity(d))
+			}
+		}
+		identity.dirty = make(map[string]struct{})
+
+		// 待落库的设备已在本次快照中，可以直接释放
+		border := now.Add(-getDeviceIdle())
+		evicted := 0
+		for _, d := range identity.devices {
+			if d.LastSeen.Before(border) {
+				identity.evict(d)
+				evicted++
+			}
+		}
+
+		for ip, ids := range identity.ips {
+			if users.ExitsUser(ip) {
+				continue
+			}
+			idle := true
+			for _, id := range ids {
+				if now.Sub(identity.devices[id].LastSeen) < identityIdleIP {
+					idle = false
+					break
+				}
+			}
+			if idle {
+				delete(identity.ips, ip)
+			}
+		}
+		identity.mu.Unlock()
+
+		if evicted > 0 {
+			zap.L().Debug("释放空闲设备", zap.Int("count", evicted))
+		}
+		flushIdentities(devices)
+	}
+}
+
+// 设备按 _id 覆盖写入，写入失败或队列满时落盘暂存
+func flushIdentities(devices []types.DeviceIdentity) {
+	for _, d := range devices {
+		identityQueue.Push(d)
+	}
+}
+
+func findIdentities(q storage.IdentityQuery) ([]types.DeviceIdentity, error) {
+	devices, _, err := storage.Devices().FindIdentities(context.TODO(), q)
+	return devices, err
+}
+
+func normalizeAttributes(attrs map[string]string) map[string]string {
+	result := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		if v = strings.TrimSpace(v); v != "" && v != "Other" {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func copyIdentity(d *types.DeviceIdentity) types.DeviceIdentity {
+	c := *d
+	c.Keys = append([]string(nil), d.Keys...)
+	c.Bindings = append([]types.DeviceBinding(nil), d.Bindings...)
+	c.Changes = append([]types.DeviceChange(nil), d.Changes...)
+	c.Attributes = make(map[string]types.DeviceAttribute, len(d.Attributes))
+	for k, v := range d.Attributes {
+		c.Attributes[k] = v
+	}
+	return c
+}
+
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
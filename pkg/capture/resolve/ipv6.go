@@ -0,0 +1,227 @@
+package resolve
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/users"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IPv6 临时地址关联
+// 通过 EUI-64 接口标识、DHCPv6 DUID、NDP 链路层地址选项与源MAC 将地址关联到设备锚点，
+// 同一锚点下的地址共用首个地址作为状态键，隐私地址轮换后特征、设备与观察者状态保持在同一键下。
+// 锚点下所有地址超过保留时长未出现后锚点失效
+
+const (
+	defaultLinkTTL   = 48 * time.Hour
+	linkPruneTick    = 10 * time.Minute
+	linkRefreshDelay = time.Minute // 同一来源的重复观测在该间隔内只更新一次
+)
+
+// 关联来源可信度，低可信度来源不覆盖高可信度来源
+var linkPriority = map[string]int{
+	types.LinkEUI64:  4,
+	types.LinkDHCPv6: 3,
+	types.LinkNDP:    2,
+	types.LinkSrcMac: 1,
+}
+
+type anchorState struct {
+	canonical string
+	addrs     map[netip.Addr]struct{}
+}
+
+type linker struct {
+	mu      sync.RWMutex
+	links   map[netip.Addr]*types.IPv6Link
+	anchors map[string]*anchorState
+	once    sync.Once
+}
+
+var ipv6Links = &linker{
+	links:   make(map[netip.Addr]*types.IPv6Link),
+	anchors: make(map[string]*anchorState),
+}
+
+// LinkIPv6 记录一次地址观测，mac 为观测到的链路层地址，duid 为 DHCPv6 客户端标识
+func LinkIPv6(ip, mac string, duid []byte, source string) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.Is6() || addr.Is4In6() || addr.IsUnspecified() || addr.IsMulticast() || addr.IsLoopback() {
+		return
+	}
+	if source == types.LinkSrcMac && config.Cfg.UserSource.IPv6.DisableSourceMac {
+		return
+	}
+	mac = strings.ToLower(mac)
+	link := types.IPv6Link{Address: addr.String(), Mac: mac, Source: source}
+	if len(duid) > 0 {
+		link.DUID = hex.EncodeToString(duid)
+		if m := duidMac(duid); m != "" {
+			link.Mac = m
+		}
+	}
+	// 接口标识由MAC生成时，地址本身即可确定设备
+	if m := eui64Mac(addr); m != "" {
+		link.Mac, link.Source = m, types.LinkEUI64
+	}
+	switch {
+	case link.Mac != "":
+		link.Anchor = types.KeyMac + link.Mac
+	case link.DUID != "":
+		link.Anchor = types.KeyDUID + link.DUID
+	default:
+		return
+	}
+	ipv6Links.once.Do(func() { go ipv6Links.startPrune(linkPruneTick) })
+	ipv6Links.observe(addr, link, time.Now())
+}
+
+func (l *linker) observe(addr netip.Addr, link types.IPv6Link, now time.Time) {
+	// 重复观测只刷新时间，避免热路径频繁加写锁
+	l.mu.RLock()
+	current, ok := l.links[addr]
+	fresh := ok && current.Anchor == link.Anchor && now.Sub(current.LastSeen) < linkRefreshDelay
+	l.mu.RUnlock()
+	if fresh {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	current, ok = l.links[addr]
+	if ok && current.Anchor != link.Anchor && linkPriority[link.Source] < linkPriority[current.Source] {
+		current.LastSeen = now
+		return
+	}
+	if ok && current.Anchor == link.Anchor {
+		current.LastSeen = now
+		if linkPriority[link.Source] > linkPriority[current.Source] {
+			current.Source = link.Source
+		}
+		if link.DUID != "" {
+			current.DUID = link.DUID
+		}
+		return
+	}
+	if ok {
+		l.detach(addr, current.Anchor)
+	}
+	anchor, exists := l.anchors[link.Anchor]
+	if !exists {
+		anchor = &anchorState{canonical: link.Address, addrs: make(map[netip.Addr]struct{})}
+		l.anchors[link.Anchor] = anchor
+	}
+	anchor.addrs[addr] = struct{}{}
+	link.Canonical = anchor.canonical
+	link.FirstSeen, link.LastSeen = now, now
+	l.links[addr] = &link
+}
+
+// 地址离开锚点，锚点下无地址时删除
+func (l *linker) detach(addr netip.Addr, key string) {
+	anchor, ok := l.anchors[key]
+	if !ok {
+		return
+	}
+	delete(anchor.addrs, addr)
+	if len(anchor.addrs) == 0 {
+		delete(l.anchors, key)
+	}
+}
+
+// CanonicalIPv6 地址所属设备的状态键，未关联或非IPv6地址原样返回
+func CanonicalIPv6(ip string) string {
+	if !strings.Contains(ip, ":") {
+		return ip
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	ipv6Links.mu.RLock()
+	defer ipv6Links.mu.RUnlock()
+	if link, ok := ipv6Links.links[addr]; ok {
+		return link.Canonical
+	}
+	return ip
+}
+
+// GetIPv6Links 状态键下关联的IPv6地址，key 为用户标识或设备状态键
+func GetIPv6Links(key string) []types.IPv6Link {
+	ipv6Links.mu.RLock()
+	var result []types.IPv6Link
+	for _, link := range ipv6Links.links {
+		if link.Canonical == key || link.Address == key {
+			result = append(result, *link)
+			continue
+		}
+		// 用户的地址按用户标识归属
+		if owner, ok := users.ResolveUser(link.Address); ok && owner == key {
+			result = append(result, *link)
+		}
+	}
+	ipv6Links.mu.RUnlock()
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastSeen.After(result[j].LastSeen)
+	})
+	return result
+}
+
+// 清理超过保留时长的地址关联
+func (l *linker) startPrune(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		ttl := defaultLinkTTL
+		if hours := config.Cfg.UserSource.IPv6.LinkTTL; hours > 0 {
+			ttl = time.Duration(hours) * time.Hour
+		}
+		l.mu.Lock()
+		for addr, link := range l.links {
+			if now.Sub(link.LastSeen) > ttl {
+				delete(l.links, addr)
+				l.detach(addr, link.Anchor)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// EUI-64 接口标识: MAC 前三字节 + fffe + 后三字节，首字节翻转 U/L 位
+func eui64Mac(addr netip.Addr) string {
+	b := addr.As16()
+	if b[11] != 0xff || b[12] != 0xfe {
+		return ""
+	}
+	mac := net.HardwareAddr{b[8] ^ 0x02, b[9], b[10], b[13], b[14], b[15]}
+	return mac.String()
+}
+
+// DUID-LLT(1) 与 DUID-LL(3) 中的以太网地址
+func duidMac(duid []byte) string {
+	if len(duid) < 4 || binary.BigEndian.Uint16(duid[2:4]) != 1 {
+		return ""
+	}
+	var mac []byte
+	switch binary.BigEndian.Uint16(duid[0:2]) {
+	case 1:
+		if len(duid) == 14 {
+			mac = duid[8:14]
+		}
+	case 3:
+		if len(duid) == 10 {
+			mac = duid[4:10]
+		}
+	}
+	if mac == nil {
+		return ""
+	}
+	return net.HardwareAddr(mac).String()
+}
@@ -0,0 +1,83 @@
+package resolve
+
+import (
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/clock"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/components/features/oui"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MAC 厂商识别
+// 同一IP的MAC未变化时不重复处理，超过设备空闲时长未出现的记录定期清理
+
+const macExpireTick = time.Minute
+
+var (
+	macAnalyzed  sync.Map // ip -> *macEntry
+	macLastSweep atomic.Int64
+)
+
+type macEntry struct {
+	mac  string
+	seen atomic.Int64
+}
+
+func AnalyzeByMac(ip, mac string) {
+	if ip == "" || mac == "" {
+		return
+	}
+	now := clock.Now()
+	expireMac(now)
+	mac = strings.ToLower(mac)
+	if prev, ok := macAnalyzed.Load(ip); ok && prev.(*macEntry).mac == mac {
+		prev.(*macEntry).seen.Store(now.Unix())
+		return
+	}
+	entry := &macEntry{mac: mac}
+	entry.seen.Store(now.Unix())
+	macAnalyzed.Store(ip, entry)
+
+	// 随机MAC无厂商信息，仅用于设备关联
+	if oui.IsRandomized(mac) {
+		ObserveDevice(types.DeviceObservation{
+			IP:          ip,
+			Mac:         mac,
+			Source:      types.Mac,
+			OriginValue: mac,
+		})
+		return
+	}
+	vendor, ok := oui.Lookup(mac)
+	if !ok {
+		return
+	}
+	brand := vendor.Brand()
+	Handle(types.DeviceRecord{
+		IP:           ip,
+		OriginChanel: types.Mac,
+		OriginValue:  mac,
+		Brand:        brand,
+		Icon:         fmt.Sprintf("icon-%s", brand),
+		Description:  fmt.Sprintf("MAC 厂商识别 %s", vendor.Organization),
+		LastSeen:     clock.Now(),
+	})
+}
+
+// 清理超过设备空闲时长未出现的记录，间隔内仅执行一次
+func expireMac(now time.Time) {
+	last := macLastSweep.Load()
+	if now.Unix()-last < int64(macExpireTick/time.Second) || !macLastSweep.CompareAndSwap(last, now.Unix()) {
+		return
+	}
+	cutoff := now.Add(-getDeviceIdle()).Unix()
+	macAnalyzed.Range(func(key, value any) bool {
+		if value.(*macEntry).seen.Load() < cutoff {
+			macAnalyzed.CompareAndDelete(key, value)
+		}
+		return true
+	})
+}
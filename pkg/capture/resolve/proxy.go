@@ -2,13 +2,14 @@ package resolve
 
 import (
 	"context"
-	"fmt"
-	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
-	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/redis"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/bus"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/state"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/clock"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/exemption"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/policy"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/users"
-	v9 "github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"strconv"
 	"time"
@@ -16,49 +17,65 @@ import (
 
 // 代理handle
 
+// 同一 IP 两次判定的最小间隔
+const discoverCooldown = 5 * time.Minute
+
+// ProxyRecorder 设置后代理记录交由其处理而不写入mongo，用于模拟回放
+var ProxyRecorder func(record types.ProxyRecord)
+
 func NewRecord(ip, username string, devices []types.DeviceRecord) *types.ProxyRecord {
 	pr := &types.ProxyRecord{
 		IP:       ip,
 		Username: username,
 		Devices:  devices,
-		LastSeen: time.Now(),
+		LastSeen: clock.Now(),
 	}
 	return pr
 }
 
 func HandleProxy(record *types.ProxyRecord) {
-	_, _ = mongo.GetMongoClient().Database(types.MongoDatabaseProxy).
-		Collection(time.Now().Format("06_01")).
-		InsertOne(context.TODO(), record)
+	if ProxyRecorder != nil {
+		ProxyRecorder(*record)
+		return
+	}
+	err := storage.Judgements().InsertProxy(context.TODO(), time.Now().Format(types.MongoCollectionMonthlyLayout), *record)
+	if err != nil {
+		zap.L().Error("failed to insert proxy record", zap.String("ip", record.IP), zap.Error(err))
+		return
+	}
+	bus.ProxyDetected.Publish(*record)
 }
 
 // Discover 检测到当前设备数异常后处理
 func Discover(ip string) {
 	// 时间间隔，如果短时间内处理过
-	rdb := redis.GetRedisClient()
-	ctx := context.Background()
-	key := fmt.Sprintf(types.KeyDiscoverIP, ip)
-
-	ttl := rdb.TTL(ctx, key).Val()
-	if ttl > 0 {
+	if state.Cooling(ip) {
 		return
 	}
 	// 获取用户详情
 	user := users.FindUser(ip)
 	if user.UserName == "" {
-		afterDiscover(key, rdb)
+		afterDiscover(ip)
 		zap.L().Warn("用户不存在", zap.String("ip", ip))
 		return
 	}
+	if exemption.MatchUser(user) {
+		exemption.Skip(exemption.PointDiscover)
+		zap.L().Debug("豁免用户，跳过判定", zap.String("ip", ip), zap.String("user", user.UserName))
+		afterDiscover(ip)
+		return
+	}
 	// 记录到实时共享终端判定记录中
 	NewRealtime(ip)
 	// TODO 获取控制策略,检测是否开启防代理
 
 	// 获取产品对应条件
-	conditionAll, conditionMobile, conditionPc, disable := getStrategyByProduct(user.ProductsID)
+	condition, controls := getStrategyByProduct(user.ProductsID)
 	// 获取设备信息
-	all, mobile, pc := GetDeviceIncr(ip, rdb)
-	if all < conditionAll && mobile < conditionMobile && pc < conditionPc {
+	classes := CountDevices(ip)
+	all, mobile, pc := condition.Count(classes)
+	exceeded := condition.Exceeded(classes)
+	if all < condition.ALL && mobile < condition.Mobile && pc < condition.Pc && len(exceeded) == 0 {
 		zap.L().Warn("设备数量不满足判定条件", zap.String("ip", ip), zap.Int("mobile", mobile), zap.Int("pc", pc), zap.Int("all", all))
 		return
 	}
@@ -66,26 +83,25 @@ func Discover(ip string) {
 	devices, err := GetDevicesByIP(ip)
 	if err != nil {
 		zap.L().Error("获取用户设备信息失败")
-		afterDiscover(key, rdb)
+		afterDiscover(ip)
 		return
 	}
 	pr := NewRecord(ip, user.UserName, devices)
 	pr.AllCount, pr.MobileCount, pr.PcCount = all, mobile, pc
-	if disable == 1 {
-		_ = users.HookDropUser(user, pr)
-	}
+	pr.ClassCount = classes
+	// 按处置阶梯处理
+	pr.Action = users.Enforce(user, pr, controls)
 	HandleProxy(pr)
-	DelDeviceIncr(ip, rdb)
-	afterDiscover(key, rdb)
+	afterDiscover(ip)
 }
 
 // 根据产品获取对应的策略
-func getStrategyByProduct(productID int) (all, mobile, pc, disable int) {
+func getStrategyByProduct(productID int) (types.Policy, types.Controls) {
 	product := policy.Get(strconv.Itoa(productID))
-	all, mobile, pc, disable = product.ALL, product.Mobile, product.Pc, product.DisableProxy
-	return
+	return product.Policy, product.Controls
 }
 
-func afterDiscover(key string, rdb *v9.Client) {
-	rdb.Set(context.Background(), key, time.Now(), time.Minute*5).Val()
+// 判定后进入冷却期，由 IP 状态写回 redis
+func afterDiscover(ip string) {
+	state.Cooldown(ip, discoverCooldown)
 }
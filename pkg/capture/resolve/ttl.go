@@ -1,9 +1,9 @@
 package resolve
 
 import (
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/clock"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
 	"strconv"
-	"time"
 )
 
 func AnalyzeByTTL(ip string, ttl uint8) {
@@ -18,7 +18,7 @@ func AnalyzeByTTL(ip string, ttl uint8) {
 		Model:        "",
 		Icon:         "icon-windows",
 		Description:  "TTL 识别",
-		LastSeen:     time.Now(),
+		LastSeen:     clock.Now(),
 	}
 
 	Handle(dr)
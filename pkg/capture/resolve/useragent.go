@@ -1,20 +1,25 @@
 package resolve
 
 import (
+	"context"
 	"fmt"
-	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/clock"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/uaparser"
-	"go.uber.org/zap"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/spill"
+	"go.mongodb.org/mongo-driver/bson"
 	"net/url"
 	"strings"
 	"sync"
-	"time"
 )
 
 var (
 	useragentLock sync.Mutex
-	logQueue      = make(chan types.UserAgentRecord, 10000)
+	logQueue      = spill.New("useragent", types.MongoDatabaseUserAgent, types.MongoCollectionUserAgentLayout, 10000, 100,
+		func(ctx context.Context, collection string, docs []bson.Raw) error {
+			return storage.Sessions().InsertUserAgents(ctx, collection, docs)
+		})
 )
 
 func AnalyzeByUserAgent(ip, ua, host string) string {
@@ -39,9 +44,9 @@ func AnalyzeByUserAgent(ip, ua, host string) string {
 		Device:    client.Device.ToString(),
 		Brand:     strings.ToLower(client.Device.Brand),
 		Model:     client.Device.Model,
-		LastSeen:  time.Now(),
+		LastSeen:  clock.Now(),
 	}
-	logQueue <- record
+	logQueue.Push(record)
 	//useragentLock.Lock()
 	//
 	//_, _ = mongo.GetMongoClient().Database(types.MongoDatabaseUserAgent).
@@ -77,7 +82,7 @@ func AnalyzeByUserAgent(ip, ua, host string) string {
 		Model:        client.Device.Model,
 		Icon:         icon,
 		Description:  "UserAgent 解析",
-		LastSeen:     time.Now(),
+		LastSeen:     clock.Now(),
 	}
 
 	Handle(dr)
@@ -85,34 +90,5 @@ func AnalyzeByUserAgent(ip, ua, host string) string {
 }
 
 func StartUserAgentConsumer() {
-	go func() {
-		buffer := make([]any, 0, 100)
-		ticker := time.NewTicker(time.Second) // 每秒批量写入
-		defer ticker.Stop()
-
-		for {
-			select {
-			case log := <-logQueue:
-				buffer = append(buffer, log)
-				if len(buffer) >= 100 {
-					insertManyStream(buffer)
-					buffer = buffer[:0]
-				}
-			case <-ticker.C: // 定时写入
-				if len(buffer) > 0 {
-					insertManyStream(buffer)
-					buffer = buffer[:0]
-				}
-			}
-		}
-	}()
-}
-
-func insertManyStream(buffer []interface{}) {
-	_, err := mongo.GetMongoClient().Database(types.MongoDatabaseUserAgent).Collection(time.Now().Format("06_01_02_useragent")).
-		InsertMany(mongo.Context, buffer)
-	if err != nil {
-		zap.L().Error("insert [useragent] record failed", zap.Error(err))
-		return
-	}
+	logQueue.Start(1)
 }
@@ -0,0 +1,314 @@
+package state
+
+import (
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/clock"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IP 状态
+// 每个 IP 的属性、设备集合与判定冷却保存在抓包进程内，作为抓包路径上的权威数据；
+// 首次访问 IP 时从 redis 恢复上次运行写回的数据，此后读写不访问 redis。
+// 变更标记为待写回，由后台按批次经 pipeline 只写回变化的属性与设备，redis 只作为 web 进程的共享读模型。
+// 写回失败时保留标记等待下次写回，redis 恢复或数据丢失(写回标记不存在)后全量重同步；
+// IP 数量超过上限时淘汰最久未活跃的 IP，并删除其 redis 数据
+
+const (
+	defaultMaxIPs   = 100000
+	defaultInterval = time.Second
+	defaultBatch    = 500
+)
+
+var (
+	entries = make(map[string]*entry)
+	mu      sync.RWMutex
+	active  atomic.Bool
+	evicts  []func(ip string)
+	// 将 redis 中的字段还原为属性值，返回 false 的字段不属于 IP 状态
+	decode func(property types.Property, value string) (any, bool)
+)
+
+// Device 设备集合成员与最后出现时间
+type Device struct {
+	Member   string
+	LastSeen int64
+}
+
+type entry struct {
+	ip       string
+	lock     sync.Mutex // 设备处理锁
+	mu       sync.Mutex
+	props    map[types.Property]any
+	devices  map[string]int64
+	counts   [3]int // 全部、移动端、PC 设备数
+	counted  bool
+	lastSeen int64
+	cooldown int64 // 判定冷却截止时间
+	removed  bool
+
+	// 待写回
+	dirtyProps    map[types.Property]struct{}
+	dirtyDevices  map[string]struct{} // 添加、刷新或移除的设备
+	dirtyCounts   bool
+	dirtyCooldown bool
+}
+
+// Active 状态写回是否已启动，仅抓包进程启动
+func Active() bool {
+	return active.Load()
+}
+
+// OnEvict 注册 IP 淘汰时的回调，用于清理其他进程内缓存
+func OnEvict(fn func(ip string)) {
+	mu.Lock()
+	evicts = append(evicts, fn)
+	mu.Unlock()
+}
+
+func get(ip string) *entry {
+	mu.RLock()
+	e, ok := entries[ip]
+	mu.RUnlock()
+	if ok {
+		return e
+	}
+	mu.Lock()
+	if e, ok = entries[ip]; ok {
+		mu.Unlock()
+		return e
+	}
+	e = &entry{ip: ip, props: make(map[types.Property]any), devices: make(map[string]int64)}
+	entries[ip] = e
+	// 恢复完成前其他协程等待 e.mu
+	e.mu.Lock()
+	mu.Unlock()
+	hydrate(e)
+	e.mu.Unlock()
+	return e
+}
+
+func lookup(ip string) (*entry, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	e, ok := entries[ip]
+	return e, ok
+}
+
+// Lock 获取 IP 的设备处理锁，返回解锁函数
+func Lock(ip string) func() {
+	e := get(ip)
+	e.lock.Lock()
+	return e.lock.Unlock
+}
+
+// SetProperty 更新 IP 属性
+func SetProperty(ip string, property types.Property, value any) {
+	e := get(ip)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.props[property] = value
+	e.lastSeen = clock.Now().Unix()
+	if e.dirtyProps == nil {
+		e.dirtyProps = make(map[types.Property]struct{})
+	}
+	e.dirtyProps[property] = struct{}{}
+	markDirty(e)
+}
+
+// GetProperty 获取 IP 属性，包括上次运行写回 redis 的属性
+func GetProperty(ip string, property types.Property) (any, bool) {
+	e := get(ip)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	v, ok := e.props[property]
+	return v, ok
+}
+
+// Devices IP 的设备集合
+func Devices(ip string) []Device {
+	e, ok := lookup(ip)
+	if !ok {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	devices := make([]Device, 0, len(e.devices))
+	for member, seen := range e.devices {
+		devices = append(devices, Device{Member: member, LastSeen: seen})
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Member < devices[j].Member })
+	return devices
+}
+
+// TouchDevice 添加设备或刷新其最后出现时间
+func TouchDevice(ip, member string) {
+	e := get(ip)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := clock.Now().Unix()
+	e.devices[member] = now
+	e.lastSeen = now
+	e.markDevice(member)
+	markDirty(e)
+}
+
+// RemoveDevices 移除设备
+func RemoveDevices(ip string, members ...string) {
+	e, ok := lookup(ip)
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	removed := false
+	for _, member := range members {
+		if _, ok = e.devices[member]; ok {
+			delete(e.devices, member)
+			e.markDevice(member)
+			removed = true
+		}
+	}
+	if removed {
+		markDirty(e)
+	}
+}
+
+// PruneDevices 移除最后出现时间早于 cutoff 的设备，返回仍活跃的设备
+func PruneDevices(ip string, cutoff int64) (active []string, pruned int) {
+	e, ok := lookup(ip)
+	if !ok {
+		return nil, 0
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for member, seen := range e.devices {
+		if seen < cutoff {
+			delete(e.devices, member)
+			e.markDevice(member)
+			pruned++
+			continue
+		}
+		active = append(active, member)
+	}
+	if pruned > 0 {
+		markDirty(e)
+	}
+	sort.Strings(active)
+	return active, pruned
+}
+
+// SetDeviceCounts 更新设备数量，供 IP 列表展示
+func SetDeviceCounts(ip string, all, mobile, pc int) {
+	e := get(ip)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	counts := [3]int{all, mobile, pc}
+	if e.counted && e.counts == counts {
+		return
+	}
+	e.counts, e.counted, e.dirtyCounts = counts, true, true
+	markDirty(e)
+}
+
+// Cooling IP 是否处于判定冷却期
+func Cooling(ip string) bool {
+	e := get(ip)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return clock.Now().Unix() < e.cooldown
+}
+
+// Cooldown 设置 IP 的判定冷却期
+func Cooldown(ip string, d time.Duration) {
+	e := get(ip)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cooldown = clock.Now().Add(d).Unix()
+	e.dirtyCooldown = true
+	markDirty(e)
+}
+
+// 标记设备待写回，写回时按是否仍在集合中添加或移除，调用时需持有 e.mu
+func (e *entry) markDevice(member string) {
+	if e.dirtyDevices == nil {
+		e.dirtyDevices = make(map[string]struct{})
+	}
+	e.dirtyDevices[member] = struct{}{}
+}
+
+// Delete 删除 IP 状态，redis 中的数据在下次写回时删除
+func Delete(ip string) {
+	mu.Lock()
+	e, ok := entries[ip]
+	if ok {
+		delete(entries, ip)
+	}
+	mu.Unlock()
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	e.removed = true
+	markDirty(e)
+	e.mu.Unlock()
+}
+
+// 淘汰最久未活跃的 IP 至上限的 90%
+func evict() int {
+	limit := maxIPs()
+	mu.RLock()
+	n := len(entries)
+	mu.RUnlock()
+	if n <= limit {
+		return 0
+	}
+
+	type candidate struct {
+		ip       string
+		lastSeen int64
+	}
+	mu.RLock()
+	list := make([]candidate, 0, len(entries))
+	for ip, e := range entries {
+		e.mu.Lock()
+		list = append(list, candidate{ip: ip, lastSeen: e.lastSeen})
+		e.mu.Unlock()
+	}
+	hooks := evicts
+	mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].lastSeen < list[j].lastSeen })
+
+	count := len(list) - limit*9/10
+	for _, c := range list[:count] {
+		Delete(c.ip)
+		for _, fn := range hooks {
+			fn(c.ip)
+		}
+	}
+	return count
+}
+
+func maxIPs() int {
+	if config.Cfg.State.MaxIPs > 0 {
+		return config.Cfg.State.MaxIPs
+	}
+	return defaultMaxIPs
+}
+
+func interval() time.Duration {
+	if config.Cfg.State.Interval > 0 {
+		return time.Duration(config.Cfg.State.Interval) * time.Millisecond
+	}
+	return defaultInterval
+}
+
+func batch() int {
+	if config.Cfg.State.Batch > 0 {
+		return config.Cfg.State.Batch
+	}
+	return defaultBatch
+}
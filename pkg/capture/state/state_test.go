@@ -0,0 +1,142 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/redis"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	v9 "github.com/redis/go-redis/v9"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testDecode(property types.Property, value string) (any, bool) {
+	switch property {
+	case types.TTL:
+		ttl, err := strconv.ParseUint(value, 10, 8)
+		return uint8(ttl), err == nil
+	case types.Mac:
+		return value, true
+	}
+	return nil, false
+}
+
+var memoryOnce sync.Once
+
+func setup(t *testing.T) *v9.Client {
+	t.Helper()
+	if config.Cfg == nil {
+		config.Cfg = &config.Yaml{}
+	}
+	memoryOnce.Do(func() {
+		if err := redis.SetupMemory(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	Setup(testDecode)
+	return redis.GetRedisClient()
+}
+
+func flushAll() {
+	for flush() > 0 {
+	}
+}
+
+// 重启后首次访问从 redis 恢复，只写回变化的属性与设备
+func TestHydrateAndDelta(t *testing.T) {
+	rdb := setup(t)
+	ctx := context.TODO()
+	ip := "10.0.0.1"
+	hash := fmt.Sprintf(types.HashAnalyzeIP, ip)
+	set := fmt.Sprintf(types.SetIPDevices, ip)
+	zset := fmt.Sprintf(types.ZSetIPDevices, ip)
+	discover := fmt.Sprintf(types.KeyDiscoverIP, ip)
+
+	rdb.HSet(ctx, hash, "ttl", 64, "mac", "aa", "user_name", "alice")
+	rdb.SAdd(ctx, set, "old", "gone")
+	rdb.ZAdd(ctx, zset, v9.Z{Score: 100, Member: "old"}, v9.Z{Score: 90, Member: "gone"})
+	rdb.Set(ctx, discover, 1, time.Minute)
+
+	if v, ok := GetProperty(ip, types.TTL); !ok || v != uint8(64) {
+		t.Fatalf("restored ttl = %v %v", v, ok)
+	}
+	if _, ok := GetProperty(ip, "user_name"); ok {
+		t.Fatal("user_name is not an IP state property")
+	}
+	if !Cooling(ip) {
+		t.Fatal("discover cooldown not restored")
+	}
+	if devices := Devices(ip); len(devices) != 2 {
+		t.Fatalf("restored devices = %v", devices)
+	}
+
+	TouchDevice(ip, "new")
+	RemoveDevices(ip, "gone")
+	SetProperty(ip, types.Mac, "bb")
+	flushAll()
+
+	members := rdb.SMembers(ctx, set).Val()
+	sort.Strings(members)
+	if fmt.Sprint(members) != "[new old]" {
+		t.Errorf("device set = %v", members)
+	}
+	if score := rdb.ZScore(ctx, zset, "old").Val(); score != 100 {
+		t.Errorf("old device score = %v", score)
+	}
+	if n := rdb.ZCard(ctx, zset).Val(); n != 2 {
+		t.Errorf("device zset size = %d", n)
+	}
+	got := rdb.HGetAll(ctx, hash).Val()
+	if got["mac"] != "bb" || got["ttl"] != "64" || got["user_name"] != "alice" {
+		t.Errorf("hash = %v", got)
+	}
+
+	Delete(ip)
+	flushAll()
+	got = rdb.HGetAll(ctx, hash).Val()
+	if len(got) != 1 || got["user_name"] != "alice" {
+		t.Errorf("hash after delete = %v", got)
+	}
+	if n := rdb.Exists(ctx, set, zset, discover).Val(); n != 0 {
+		t.Errorf("%d keys left after delete", n)
+	}
+}
+
+// redis 不可用期间新 IP 以空状态开始，不在数据包路径上等待
+func TestHydrateSkippedWhileDown(t *testing.T) {
+	rdb := setup(t)
+	ip := "10.0.0.3"
+	hash := fmt.Sprintf(types.HashAnalyzeIP, ip)
+	rdb.HSet(context.TODO(), hash, "ttl", 64)
+	defer rdb.Del(context.TODO(), hash)
+
+	down.Store(true)
+	defer down.Store(false)
+	if v, ok := GetProperty(ip, types.TTL); ok {
+		t.Fatalf("hydrated while down: %v", v)
+	}
+	Delete(ip)
+}
+
+func TestCooldown(t *testing.T) {
+	rdb := setup(t)
+	ip := "10.0.0.2"
+	defer flushAll()
+	defer Delete(ip)
+	if Cooling(ip) {
+		t.Fatal("new IP should not be cooling")
+	}
+	Cooldown(ip, time.Minute)
+	if !Cooling(ip) {
+		t.Fatal("cooldown not applied")
+	}
+	flushAll()
+	ttl := rdb.TTL(context.TODO(), fmt.Sprintf(types.KeyDiscoverIP, ip)).Val()
+	if ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("discover key ttl = %v", ttl)
+	}
+}
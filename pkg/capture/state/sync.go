@@ -0,0 +1,454 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/clock"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/redis"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	v9 "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 写回 redis
+
+const (
+	deviceTTL     = 24 * time.Hour
+	writeTimeout  = 5 * time.Second
+	loadTimeout   = time.Second
+	epochInterval = 10 * time.Second
+)
+
+var (
+	dirtyMu  sync.Mutex
+	dirty    = make(map[*entry]struct{})
+	removals = make(map[*entry]struct{}) // 已删除的 IP，先于其他变更写回
+
+	setupOnce sync.Once
+	closeOnce sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+	down      atomic.Bool // 写回失败，恢复后全量重同步
+	syncing   sync.Mutex
+
+	loaded    atomic.Int64
+	written   atomic.Int64
+	failed    atomic.Int64
+	resynced  atomic.Int64
+	evicted   atomic.Int64
+	errMu     sync.Mutex
+	lastErr   string
+	lastWrite atomic.Int64
+)
+
+// Stats IP 状态统计
+type Stats struct {
+	IPs       int    `json:"ips"`
+	Dirty     int    `json:"dirty"`    // 待写回
+	Loaded    int64  `json:"loaded"`   // 从 redis 恢复的 IP
+	Written   int64  `json:"written"`  // 已写回的 IP 次数
+	Failed    int64  `json:"failed"`   // 写回失败次数
+	Resynced  int64  `json:"resynced"` // 全量重同步次数
+	Evicted   int64  `json:"evicted"`  // 超过上限淘汰的 IP
+	Down      bool   `json:"down"`
+	LastWrite int64  `json:"last_write,omitempty"` // 最后一次写回成功时间
+	LastError string `json:"last_error,omitempty"`
+}
+
+// 待写回的变更快照
+type change struct {
+	e        *entry
+	removed  bool
+	props    map[types.Property]any
+	devices  map[string]int64 // 添加或刷新的设备
+	gone     []string         // 移除的设备
+	counts   [3]int
+	counted  bool
+	cooldown int64
+	cooled   bool
+	seen     int64
+}
+
+// 调用时需持有 e.mu
+func markDirty(e *entry) {
+	dirtyMu.Lock()
+	if e.removed {
+		delete(dirty, e)
+		removals[e] = struct{}{}
+	} else {
+		dirty[e] = struct{}{}
+	}
+	dirtyMu.Unlock()
+}
+
+// Setup 启动写回，仅抓包进程调用
+// fn 将 redis 中的字段还原为属性值，用于首次访问 IP 时恢复上次运行的状态
+func Setup(fn func(property types.Property, value string) (any, bool)) {
+	setupOnce.Do(func() {
+		decode = fn
+		stop, done = make(chan struct{}), make(chan struct{})
+		active.Store(true)
+		go loop()
+	})
+}
+
+// Close 停止写回，退出前写回全部变更
+func Close() {
+	if !active.Load() {
+		return
+	}
+	closeOnce.Do(func() {
+		close(stop)
+		<-done
+		for flush() > 0 {
+		}
+	})
+}
+
+func loop() {
+	defer close(done)
+	ticker := time.NewTicker(interval())
+	defer ticker.Stop()
+	epoch := time.Now()
+	checkEpoch()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if n := evict(); n > 0 {
+			evicted.Add(int64(n))
+			zap.L().Info("IP 状态超过上限，淘汰最久未活跃的 IP", zap.Int("count", n), zap.Int("max", maxIPs()))
+		}
+		if time.Since(epoch) >= epochInterval {
+			epoch = time.Now()
+			checkEpoch()
+		}
+		// 积压较多时连续写回，失败时等待下一周期
+		for flush() >= batch() {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// redis 被清空或重启后写回标记丢失，全量重同步
+func checkEpoch() {
+	rdb := redis.GetRedisClient()
+	if rdb == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+	n, err := rdb.Exists(ctx, types.KeyStateEpoch).Result()
+	if err != nil {
+		return
+	}
+	if n == 0 {
+		resync("写回标记不存在")
+		rdb.Set(ctx, types.KeyStateEpoch, time.Now().Unix(), 0).Val()
+	}
+}
+
+// 从 redis 恢复属性、设备与判定冷却，调用时需持有 e.mu，失败时以空状态继续
+// redis 不可用期间不再恢复，避免每个新 IP 在数据包路径上等待超时，恢复后由全量重同步写回
+func hydrate(e *entry) {
+	if !active.Load() || decode == nil || down.Load() {
+		return
+	}
+	rdb := redis.GetRedisClient()
+	if rdb == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+	defer cancel()
+	pipe := rdb.Pipeline()
+	hash := pipe.HGetAll(ctx, fmt.Sprintf(types.HashAnalyzeIP, e.ip))
+	devices := pipe.ZRangeWithScores(ctx, fmt.Sprintf(types.ZSetIPDevices, e.ip), 0, -1)
+	cooldown := pipe.TTL(ctx, fmt.Sprintf(types.KeyDiscoverIP, e.ip))
+	if _, err := pipe.Exec(ctx); err != nil {
+		errMu.Lock()
+		lastErr = err.Error()
+		errMu.Unlock()
+		if !down.Swap(true) {
+			zap.L().Error("恢复 IP 状态失败，等待 redis 恢复", zap.String("ip", e.ip), zap.Error(err))
+		}
+		return
+	}
+	for field, value := range hash.Val() {
+		if v, ok := decode(types.Property(field), value); ok {
+			e.props[types.Property(field)] = v
+		}
+	}
+	for _, z := range devices.Val() {
+		if member, ok := z.Member.(string); ok {
+			e.devices[member] = int64(z.Score)
+		}
+	}
+	now := clock.Now()
+	if ttl := cooldown.Val(); ttl > 0 {
+		e.cooldown = now.Add(ttl).Unix()
+	}
+	e.lastSeen = now.Unix()
+	if len(e.props) > 0 || len(e.devices) > 0 {
+		loaded.Add(1)
+	}
+}
+
+// 将全部 IP 标记为待写回
+func resync(reason string) {
+	mu.RLock()
+	list := make([]*entry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	mu.RUnlock()
+	for _, e := range list {
+		e.mu.Lock()
+		if e.removed {
+			e.mu.Unlock()
+			continue
+		}
+		if e.dirtyProps == nil {
+			e.dirtyProps = make(map[types.Property]struct{})
+		}
+		for property := range e.props {
+			e.dirtyProps[property] = struct{}{}
+		}
+		for member := range e.devices {
+			e.markDevice(member)
+		}
+		e.dirtyCounts = e.counted
+		e.dirtyCooldown = e.cooldown > 0
+		markDirty(e)
+		e.mu.Unlock()
+	}
+	resynced.Add(1)
+	zap.L().Info("IP 状态全量重同步", zap.String("reason", reason), zap.Int("ips", len(list)))
+}
+
+// 取出一批变更写回，返回本批数量
+func flush() int {
+	syncing.Lock()
+	defer syncing.Unlock()
+
+	changes := take(batch())
+	if len(changes) == 0 {
+		return 0
+	}
+	rdb := redis.GetRedisClient()
+	if rdb == nil {
+		fail(changes, errors.New("redis unavailable"))
+		return 0
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+	pipe := rdb.Pipeline()
+	for _, c := range changes {
+		c.apply(ctx, pipe)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		fail(changes, err)
+		return 0
+	}
+	written.Add(int64(len(changes)))
+	lastWrite.Store(time.Now().Unix())
+	if down.Swap(false) {
+		zap.L().Info("IP 状态写回恢复")
+		resync("写回恢复")
+	}
+	return len(changes)
+}
+
+// 删除优先，本批只包含删除时其余变更留待下一批，保证删除先于同一 IP 的新状态写回
+func take(n int) []change {
+	dirtyMu.Lock()
+	var list []*entry
+	if len(removals) > 0 {
+		for e := range removals {
+			if len(list) >= n {
+				break
+			}
+			list = append(list, e)
+			delete(removals, e)
+		}
+	} else {
+		for e := range dirty {
+			if len(list) >= n {
+				break
+			}
+			list = append(list, e)
+			delete(dirty, e)
+		}
+	}
+	dirtyMu.Unlock()
+
+	changes := make([]change, 0, len(list))
+	for _, e := range list {
+		e.mu.Lock()
+		c := change{e: e, removed: e.removed, seen: e.lastSeen}
+		if e.removed {
+			c.props = make(map[types.Property]any, len(e.props))
+			for property := range e.props {
+				c.props[property] = nil
+			}
+		} else {
+			if len(e.dirtyProps) > 0 {
+				c.props = make(map[types.Property]any, len(e.dirtyProps))
+				for property := range e.dirtyProps {
+					c.props[property] = e.props[property]
+				}
+				e.dirtyProps = nil
+			}
+			if len(e.dirtyDevices) > 0 {
+				c.devices = make(map[string]int64, len(e.dirtyDevices))
+				for member := range e.dirtyDevices {
+					if seen, ok := e.devices[member]; ok {
+						c.devices[member] = seen
+					} else {
+						c.gone = append(c.gone, member)
+					}
+				}
+				e.dirtyDevices = nil
+			}
+			if e.dirtyCounts {
+				c.counts, c.counted = e.counts, true
+				e.dirtyCounts = false
+			}
+			if e.dirtyCooldown {
+				c.cooldown, c.cooled = e.cooldown, true
+				e.dirtyCooldown = false
+			}
+		}
+		e.mu.Unlock()
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+func (c change) apply(ctx context.Context, pipe v9.Pipeliner) {
+	ip := c.e.ip
+	hash := fmt.Sprintf(types.HashAnalyzeIP, ip)
+	set := fmt.Sprintf(types.SetIPDevices, ip)
+	zset := fmt.Sprintf(types.ZSetIPDevices, ip)
+	if c.removed {
+		// 仅删除状态写入的字段，用户名等由用户模块维护
+		if len(c.props) > 0 {
+			fields := make([]string, 0, len(c.props))
+			for property := range c.props {
+				fields = append(fields, string(property))
+			}
+			pipe.HDel(ctx, hash, fields...)
+		}
+		pipe.Del(ctx, set, zset,
+			fmt.Sprintf(types.KeyDiscoverIP, ip),
+			fmt.Sprintf(types.KeyDevicesAllIP, ip),
+			fmt.Sprintf(types.KeyDevicesMobileIP, ip),
+			fmt.Sprintf(types.KeyDevicesPcIP, ip))
+		pipe.ZRem(ctx, types.ZSetIP, ip)
+		return
+	}
+	if len(c.props) > 0 {
+		values := make([]any, 0, len(c.props)*2)
+		for property, value := range c.props {
+			values = append(values, string(property), value)
+		}
+		pipe.HSet(ctx, hash, values...)
+		pipe.ZAdd(ctx, types.ZSetIP, v9.Z{Score: float64(c.seen), Member: ip})
+	}
+	if len(c.gone) > 0 {
+		members := make([]any, 0, len(c.gone))
+		for _, member := range c.gone {
+			members = append(members, member)
+		}
+		pipe.SRem(ctx, set, members...)
+		pipe.ZRem(ctx, zset, members...)
+	}
+	if len(c.devices) > 0 {
+		members := make([]any, 0, len(c.devices))
+		scores := make([]v9.Z, 0, len(c.devices))
+		for member, seen := range c.devices {
+			members = append(members, member)
+			scores = append(scores, v9.Z{Score: float64(seen), Member: member})
+		}
+		pipe.SAdd(ctx, set, members...)
+		pipe.ZAdd(ctx, zset, scores...)
+		pipe.Expire(ctx, set, deviceTTL)
+		pipe.Expire(ctx, zset, deviceTTL)
+	}
+	// 冷却期写回供重启后恢复
+	if ttl := time.Duration(c.cooldown-clock.Now().Unix()) * time.Second; c.cooled && ttl > 0 {
+		pipe.Set(ctx, fmt.Sprintf(types.KeyDiscoverIP, ip), c.cooldown, ttl)
+	}
+	if c.counted {
+		pipe.Set(ctx, fmt.Sprintf(types.KeyDevicesAllIP, ip), c.counts[0], deviceTTL)
+		pipe.Set(ctx, fmt.Sprintf(types.KeyDevicesMobileIP, ip), c.counts[1], deviceTTL)
+		pipe.Set(ctx, fmt.Sprintf(types.KeyDevicesPcIP, ip), c.counts[2], deviceTTL)
+	}
+}
+
+// 写回失败，变更重新标记为待写回
+func fail(changes []change, err error) {
+	failed.Add(1)
+	errMu.Lock()
+	lastErr = err.Error()
+	errMu.Unlock()
+	if !down.Swap(true) {
+		zap.L().Error("IP 状态写回失败，等待 redis 恢复", zap.Error(err))
+	}
+	for _, c := range changes {
+		e := c.e
+		e.mu.Lock()
+		if !c.removed && !e.removed {
+			if len(c.props) > 0 && e.dirtyProps == nil {
+				e.dirtyProps = make(map[types.Property]struct{})
+			}
+			for property := range c.props {
+				e.dirtyProps[property] = struct{}{}
+			}
+			for member := range c.devices {
+				e.markDevice(member)
+			}
+			for _, member := range c.gone {
+				e.markDevice(member)
+			}
+			e.dirtyCounts = e.dirtyCounts || c.counted
+			e.dirtyCooldown = e.dirtyCooldown || c.cooled
+		}
+		markDirty(e)
+		e.mu.Unlock()
+	}
+}
+
+// GetStats IP 状态统计
+func GetStats() Stats {
+	mu.RLock()
+	n := len(entries)
+	mu.RUnlock()
+	dirtyMu.Lock()
+	pending := len(dirty) + len(removals)
+	dirtyMu.Unlock()
+	s := Stats{
+		IPs:       n,
+		Dirty:     pending,
+		Loaded:    loaded.Load(),
+		Written:   written.Load(),
+		Failed:    failed.Load(),
+		Resynced:  resynced.Load(),
+		Evicted:   evicted.Load(),
+		Down:      down.Load(),
+		LastWrite: lastWrite.Load(),
+	}
+	errMu.Lock()
+	s.LastError = lastErr
+	errMu.Unlock()
+	return s
+}
@@ -0,0 +1,40 @@
+package clock
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 统一时钟
+// 实时抓包使用系统时间；回放离线文件时使用数据包时间，设备老化、速率窗口与处置窗口与抓包当时一致
+
+var (
+	replay  atomic.Bool
+	current atomic.Int64 // 最近一个数据包的时间(纳秒)
+)
+
+// SetReplay 切换为数据包时间
+func SetReplay() {
+	replay.Store(true)
+}
+
+// Advance 推进回放时钟，乱序到达的较早数据包不回拨
+func Advance(t time.Time) {
+	n := t.UnixNano()
+	for {
+		old := current.Load()
+		if n <= old || current.CompareAndSwap(old, n) {
+			return
+		}
+	}
+}
+
+// Now 当前时间，回放时为已处理数据包的最大时间，尚未处理数据包时为系统时间
+func Now() time.Time {
+	if replay.Load() {
+		if n := current.Load(); n > 0 {
+			return time.Unix(0, n)
+		}
+	}
+	return time.Now()
+}
@@ -0,0 +1,96 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	v9 "github.com/redis/go-redis/v9"
+	"net"
+	"time"
+)
+
+// 内存 redis
+// 由 miniredis 提供，客户端连接通过 net.Pipe 直接交给 miniredis 处理，不经过网络；
+// miniredis 启动时会在回环地址监听随机端口，程序不使用该端口
+// 用于模拟回放等不能访问生产 redis 的场景
+
+// 内存存储名称，与 redis 客户端对应
+const (
+	memoryDPI    = "dpi"
+	memoryOnline = "online"
+	memoryCache  = "cache"
+	memoryUsers  = "users"
+)
+
+// miniredis 的过期时间不随时钟递减，按此间隔推进
+const memoryTick = time.Second
+
+// SetupMemory 使用内存存储初始化全部 redis 客户端
+func SetupMemory() error {
+	var setErr error
+	ok := false
+	Redis.once.Do(func() {
+		ok = true
+		stores := make(map[string]*memoryStore)
+		for _, name := range []string{memoryDPI, memoryOnline, memoryCache, memoryUsers} {
+			store, err := newMemoryStore()
+			if err != nil {
+				setErr = err
+				return
+			}
+			stores[name] = store
+		}
+		Redis.memory = stores
+		Redis.Client = memoryClient(stores[memoryDPI])
+		Redis.Online = memoryClient(stores[memoryOnline])
+		Redis.Cache = memoryClient(stores[memoryCache])
+		Redis.Users = memoryClient(stores[memoryUsers])
+		Redis.initialized = true
+	})
+	if !ok {
+		return fmt.Errorf("redis already initialized")
+	}
+	return setErr
+}
+
+type memoryStore struct {
+	mr *miniredis.Miniredis
+}
+
+func newMemoryStore() (*memoryStore, error) {
+	mr := miniredis.NewMiniRedis()
+	if err := mr.StartAddr("127.0.0.1:0"); err != nil {
+		return nil, fmt.Errorf("start memory redis: %w", err)
+	}
+	s := &memoryStore{mr: mr}
+	go s.expire()
+	return s, nil
+}
+
+// 按实际流逝时间推进过期时间
+func (s *memoryStore) expire() {
+	ticker := time.NewTicker(memoryTick)
+	defer ticker.Stop()
+	last := time.Now()
+	for now := range ticker.C {
+		s.mr.FastForward(now.Sub(last))
+		last = now
+	}
+}
+
+func (s *memoryStore) serve(conn net.Conn) {
+	s.mr.Server().ServeConn(conn)
+}
+
+func memoryClient(store *memoryStore) *v9.Client {
+	return v9.NewClient(&v9.Options{
+		Addr:             "memory",
+		Protocol:         2,
+		DisableIndentity: true,
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			client, server := net.Pipe()
+			store.serve(server)
+			return client, nil
+		},
+	})
+}
@@ -0,0 +1,142 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	v9 "github.com/redis/go-redis/v9"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) (*memoryStore, *v9.Client) {
+	t.Helper()
+	store, err := newMemoryStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := memoryClient(store)
+	t.Cleanup(func() {
+		_ = c.Close()
+		store.mr.Close()
+	})
+	return store, c
+}
+
+func TestMemoryPipeline(t *testing.T) {
+	_, c := newTestStore(t)
+	ctx := context.Background()
+
+	for _, tx := range []bool{false, true} {
+		pipe := c.Pipeline()
+		if tx {
+			pipe = c.TxPipeline()
+		}
+		hset := pipe.HSet(ctx, "h", "a", 1)
+		pipe.ZAdd(ctx, "z", v9.Z{Score: 1, Member: "a"}, v9.Z{Score: 2, Member: "b"})
+		get := pipe.Get(ctx, "missing")
+		zrange := pipe.ZRangeWithScores(ctx, "z", 0, -1)
+		_, _ = pipe.Exec(ctx)
+		if hset.Val() != 1 || get.Err() != v9.Nil || len(zrange.Val()) != 2 || zrange.Val()[1].Member != "b" {
+			t.Errorf("tx=%v: hset %v get %v zrange %v", tx, hset, get, zrange)
+		}
+		c.FlushDB(ctx)
+	}
+}
+
+// 过期时间随时间推进
+func TestMemoryExpire(t *testing.T) {
+	store, c := newTestStore(t)
+	ctx := context.Background()
+
+	c.Set(ctx, "k", "v", 2*time.Second)
+	c.HSet(ctx, "h", "a", 1)
+	c.Expire(ctx, "h", time.Minute)
+	store.mr.FastForward(3 * time.Second)
+	if n := c.Exists(ctx, "k", "h").Val(); n != 1 {
+		t.Fatalf("Exists after fast forward = %d", n)
+	}
+
+	c.Set(ctx, "tick", "v", memoryTick)
+	deadline := time.Now().Add(5 * memoryTick)
+	for c.Exists(ctx, "tick").Val() == 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("key not expired by ticker")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	src, c := newTestStore(t)
+	ctx := context.Background()
+
+	c.Set(ctx, "s", "v", 0)
+	c.Set(ctx, "ttl", "v", time.Hour)
+	c.HSet(ctx, "h", "a", 1, "b", 2)
+	c.SAdd(ctx, "set", "a", "b")
+	c.ZAdd(ctx, "z", v9.Z{Score: 1.5, Member: "a"}, v9.Z{Score: 2, Member: "b"})
+	c.RPush(ctx, "l", "a", "b", "c")
+	data, err := src.snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst, d := newTestStore(t)
+	d.Set(ctx, "s", "old", 0)
+	if err = dst.restore(data); err != nil {
+		t.Fatal(err)
+	}
+	keys := d.Keys(ctx, "*").Val()
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "h,l,s,set,ttl,z" {
+		t.Fatalf("keys %v", keys)
+	}
+	members := d.SMembers(ctx, "set").Val()
+	sort.Strings(members)
+	checks := map[string]string{
+		"s":   d.Get(ctx, "s").Val(),
+		"h":   fmt.Sprint(d.HGet(ctx, "h", "a").Val(), d.HGet(ctx, "h", "b").Val()),
+		"set": strings.Join(members, ","),
+		"z":   fmt.Sprint(d.ZRangeWithScores(ctx, "z", 0, -1).Val()),
+		"l":   strings.Join(d.LRange(ctx, "l", 0, -1).Val(), ","),
+	}
+	want := map[string]string{"s": "v", "h": "12", "set": "a,b", "z": "[{1.5 a} {2 b}]", "l": "a,b,c"}
+	for key, got := range checks {
+		if got != want[key] {
+			t.Errorf("%s = %s, want %s", key, got, want[key])
+		}
+	}
+	if ttl := d.TTL(ctx, "ttl").Val(); ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("restored ttl %v", ttl)
+	}
+	if ttl := d.TTL(ctx, "s").Val(); ttl != -1 {
+		t.Errorf("persistent key ttl %v", ttl)
+	}
+}
+
+// capture 进程通过 unix socket 提供内存 redis
+func TestServeMemory(t *testing.T) {
+	store, c := newTestStore(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	saved := Redis.memory
+	Redis.memory = map[string]*memoryStore{memoryDPI: store}
+	defer func() { Redis.memory = saved }()
+	closer, err := ServeMemory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer()
+
+	remote := socketClient(dir, memoryDPI)
+	defer remote.Close()
+	if err = remote.Set(ctx, "k", "v", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if v := c.Get(ctx, "k").Val(); v != "v" {
+		t.Fatalf("value written over socket = %q", v)
+	}
+}
@@ -22,6 +22,7 @@ type redis struct {
 	Online      *v9.Client
 	Cache       *v9.Client
 	Users       *v9.Client
+	memory      map[string]*memoryStore // 内存存储，按名称保存用于快照与 socket 服务
 }
 
 func (r *redis) Setup() error {
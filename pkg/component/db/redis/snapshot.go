@@ -0,0 +1,218 @@
+package redis
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	v9 "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 内存 redis 快照与 socket 服务
+// 嵌入式存储定期保存快照，重启后恢复；capture 进程通过 unix socket 将内存 redis 提供给 web 等进程，
+// socket 上的连接同样交给 miniredis 处理
+
+// 快照条目
+type snapshotEntry struct {
+	Kind   int
+	Str    string
+	Hash   map[string]string
+	Set    []string
+	ZSet   map[string]float64
+	List   []string
+	Expire time.Time
+}
+
+// Snapshot 导出全部内存存储，按名称返回
+func Snapshot() (map[string][]byte, error) {
+	snapshot := make(map[string][]byte, len(Redis.memory))
+	for name, store := range Redis.memory {
+		data, err := store.snapshot()
+		if err != nil {
+			return nil, err
+		}
+		snapshot[name] = data
+	}
+	return snapshot, nil
+}
+
+// Restore 从快照恢复内存存储，过期的键忽略
+func Restore(snapshot map[string][]byte) error {
+	for name, data := range snapshot {
+		store, ok := Redis.memory[name]
+		if !ok {
+			continue
+		}
+		if err := store.restore(data); err != nil {
+			return fmt.Errorf("restore %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// 快照条目类型，与已保存的快照兼容
+const (
+	kindString = iota
+	kindHash
+	kindSet
+	kindZSet
+	kindList
+)
+
+// 逐个键导出，导出期间被删除的键忽略
+func (s *memoryStore) snapshot() ([]byte, error) {
+	now := time.Now()
+	entries := make(map[string]snapshotEntry)
+	for _, key := range s.mr.Keys() {
+		var entry snapshotEntry
+		var err error
+		switch s.mr.Type(key) {
+		case "string":
+			entry.Kind = kindString
+			entry.Str, err = s.mr.Get(key)
+		case "hash":
+			entry.Kind = kindHash
+			var fields []string
+			if fields, err = s.mr.HKeys(key); err == nil {
+				entry.Hash = make(map[string]string, len(fields))
+				for _, field := range fields {
+					entry.Hash[field] = s.mr.HGet(key, field)
+				}
+			}
+		case "set":
+			entry.Kind = kindSet
+			entry.Set, err = s.mr.Members(key)
+		case "zset":
+			entry.Kind = kindZSet
+			entry.ZSet, err = s.mr.SortedSet(key)
+		case "list":
+			entry.Kind = kindList
+			entry.List, err = s.mr.List(key)
+		default:
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if ttl := s.mr.TTL(key); ttl > 0 {
+			entry.Expire = now.Add(ttl)
+		}
+		entries[key] = entry
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(entries)
+	return buf.Bytes(), err
+}
+
+func (s *memoryStore) restore(data []byte) error {
+	var entries map[string]snapshotEntry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entries); err != nil {
+		return err
+	}
+	now := time.Now()
+	for key, entry := range entries {
+		if !entry.Expire.IsZero() && now.After(entry.Expire) {
+			continue
+		}
+		s.mr.Del(key)
+		var err error
+		switch entry.Kind {
+		case kindString:
+			err = s.mr.Set(key, entry.Str)
+		case kindHash:
+			for field, value := range entry.Hash {
+				s.mr.HSet(key, field, value)
+			}
+		case kindSet:
+			if len(entry.Set) > 0 {
+				_, err = s.mr.SetAdd(key, entry.Set...)
+			}
+		case kindZSet:
+			for member, score := range entry.ZSet {
+				if _, err = s.mr.ZAdd(key, score, member); err != nil {
+					break
+				}
+			}
+		case kindList:
+			if len(entry.List) > 0 {
+				_, err = s.mr.Push(key, entry.List...)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("restore key %s: %w", key, err)
+		}
+		if !entry.Expire.IsZero() {
+			s.mr.SetTTL(key, entry.Expire.Sub(now))
+		}
+	}
+	return nil
+}
+
+func socketPath(dir, name string) string {
+	return filepath.Join(dir, fmt.Sprintf("redis-%s.sock", name))
+}
+
+// ServeMemory 在 dir 下为每个内存存储监听 unix socket，返回关闭函数
+func ServeMemory(dir string) (func() error, error) {
+	if len(Redis.memory) == 0 {
+		return nil, fmt.Errorf("memory redis not initialized")
+	}
+	listeners := make([]net.Listener, 0, len(Redis.memory))
+	closeAll := func() error {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+		return nil
+	}
+	for name, store := range Redis.memory {
+		sock := socketPath(dir, name)
+		_ = os.Remove(sock) // 清理旧的 socket 文件
+		l, err := net.Listen("unix", sock)
+		if err != nil {
+			_ = closeAll()
+			return nil, err
+		}
+		listeners = append(listeners, l)
+		go func(l net.Listener, store *memoryStore) {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				store.serve(conn)
+			}
+		}(l, store)
+		zap.L().Info("Memory redis listening", zap.String("sock", sock))
+	}
+	return closeAll, nil
+}
+
+// SetupSocket 连接 capture 进程提供的内存 redis
+func SetupSocket(dir string) error {
+	ok := false
+	Redis.once.Do(func() {
+		Redis.Client = socketClient(dir, memoryDPI)
+		Redis.Online = socketClient(dir, memoryOnline)
+		Redis.Cache = socketClient(dir, memoryCache)
+		Redis.Users = socketClient(dir, memoryUsers)
+		Redis.initialized = true
+		ok = true
+	})
+	if !ok {
+		return fmt.Errorf("redis already initialized")
+	}
+	return nil
+}
+
+func socketClient(dir, name string) *v9.Client {
+	return v9.NewClient(&v9.Options{
+		Network:          "unix",
+		Addr:             socketPath(dir, name),
+		Protocol:         2,
+		DisableIndentity: true,
+	})
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// AlertStore 告警静默规则
+type AlertStore interface {
+	Silences(ctx context.Context) ([]types.AlertSilence, error)
+	SaveSilence(ctx context.Context, s types.AlertSilence) error
+	DeleteSilence(ctx context.Context, id string) error
+}
+
+func (m *mongoStore) Silences(ctx context.Context) ([]types.AlertSilence, error) {
+	return findAll[types.AlertSilence](ctx, m.collection(types.MongoDatabaseConfigs, types.MongoCollectionAlertSilence), bson.M{})
+}
+
+func (m *mongoStore) SaveSilence(ctx context.Context, s types.AlertSilence) error {
+	return replaceByID(ctx, m.collection(types.MongoDatabaseConfigs, types.MongoCollectionAlertSilence), s.ID, s)
+}
+
+func (m *mongoStore) DeleteSilence(ctx context.Context, id string) error {
+	_, err := m.collection(types.MongoDatabaseConfigs, types.MongoCollectionAlertSilence).DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (s *kvStore) Silences(ctx context.Context) ([]types.AlertSilence, error) {
+	return findDocs[types.AlertSilence](ctx, s, types.MongoDatabaseConfigs, types.MongoCollectionAlertSilence, nil)
+}
+
+func (s *kvStore) SaveSilence(_ context.Context, silence types.AlertSilence) error {
+	return s.putDoc(types.MongoDatabaseConfigs, types.MongoCollectionAlertSilence, silence)
+}
+
+func (s *kvStore) DeleteSilence(_ context.Context, id string) error {
+	return s.kv.del(types.MongoDatabaseConfigs, types.MongoCollectionAlertSilence, [][]byte{stringKey(id)})
+}
@@ -0,0 +1,239 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// 嵌入式后端，数据保存在单个 bbolt 文件
+// 布局: 数据库 bucket -> 集合 bucket -> 键值
+// 根 bucket __redis 保存内存 redis 快照
+
+var bucketRedis = []byte("__redis")
+
+type boltKV struct {
+	db *bolt.DB
+}
+
+func openBolt(path string) (*boltKV, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		if errors.Is(err, bolt.ErrTimeout) {
+			return nil, fmt.Errorf("storage file %s is locked by another process", path)
+		}
+		return nil, err
+	}
+	return &boltKV{db: db}, nil
+}
+
+// 只读打开，持有共享锁，不阻塞其他只读进程
+func openBoltReadOnly(path string) (*boltKV, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		if errors.Is(err, bolt.ErrTimeout) {
+			return nil, fmt.Errorf("storage file %s is locked by another process", path)
+		}
+		return nil, err
+	}
+	return &boltKV{db: db}, nil
+}
+
+// 集合 bucket，不存在时为空
+func table(tx *bolt.Tx, db, name string) *bolt.Bucket {
+	if b := tx.Bucket([]byte(db)); b != nil {
+		return b.Bucket([]byte(name))
+	}
+	return nil
+}
+
+// bbolt 返回的数据只在事务内有效，读取时复制
+func (b *boltKV) get(db, name string, key []byte) ([]byte, error) {
+	var value []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if bucket := table(tx, db, name); bucket != nil {
+			value = bytes.Clone(bucket.Get(key))
+		}
+		return nil
+	})
+	return value, err
+}
+
+func (b *boltKV) put(db, name string, pairs []pair) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+	return b.db.Batch(func(tx *bolt.Tx) error {
+		parent, err := tx.CreateBucketIfNotExists([]byte(db))
+		if err != nil {
+			return err
+		}
+		bucket, err := parent.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return err
+		}
+		for _, p := range pairs {
+			if err = bucket.Put(p.Key, p.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltKV) del(db, name string, keys [][]byte) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return b.db.Batch(func(tx *bolt.Tx) error {
+		bucket := table(tx, db, name)
+		if bucket == nil {
+			return nil
+		}
+		for _, key := range keys {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltKV) scan(db, name string, after []byte, reverse bool, fn func(key, value []byte) bool) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		bucket := table(tx, db, name)
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		var k, v []byte
+		switch {
+		case after == nil && !reverse:
+			k, v = c.First()
+		case after == nil:
+			k, v = c.Last()
+		case !reverse:
+			k, v = c.Seek(after)
+			if k != nil && bytes.Equal(k, after) {
+				k, v = c.Next()
+			}
+		default:
+			// Seek 定位到不小于 after 的键，倒序时从其前一个开始
+			k, _ = c.Seek(after)
+			if k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		}
+		for k != nil {
+			if v != nil && !fn(bytes.Clone(k), bytes.Clone(v)) {
+				return nil
+			}
+			if reverse {
+				k, v = c.Prev()
+			} else {
+				k, v = c.Next()
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltKV) stats(db, name string) (CollectionStats, error) {
+	var stats CollectionStats
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := table(tx, db, name)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			stats.Count++
+			stats.Size += int64(len(v))
+			return nil
+		})
+	})
+	return stats, err
+}
+
+func (b *boltKV) tables(db string) ([]string, error) {
+	names := make([]string, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		parent := tx.Bucket([]byte(db))
+		if parent == nil {
+			return nil
+		}
+		return parent.ForEach(func(name, value []byte) error {
+			if value == nil {
+				names = append(names, string(name))
+			}
+			return nil
+		})
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+func (b *boltKV) drop(db, name string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		parent := tx.Bucket([]byte(db))
+		if parent == nil || parent.Bucket([]byte(name)) == nil {
+			return nil
+		}
+		return parent.DeleteBucket([]byte(name))
+	})
+}
+
+func (b *boltKV) dropDatabase(db string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket([]byte(db))
+		if errors.Is(err, bolt.ErrBucketNotFound) {
+			return nil
+		}
+		return err
+	})
+}
+
+func (b *boltKV) close() error {
+	return b.db.Close()
+}
+
+// saveSnapshot 保存内存 redis 快照
+func (b *boltKV) saveSnapshot(snapshot map[string][]byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(bucketRedis)
+		if err != nil {
+			return err
+		}
+		for name, data := range snapshot {
+			if err = bucket.Put([]byte(name), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// loadSnapshot 读取内存 redis 快照
+func (b *boltKV) loadSnapshot() (map[string][]byte, error) {
+	snapshot := make(map[string][]byte)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketRedis)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(name, data []byte) error {
+			snapshot[string(name)] = bytes.Clone(data)
+			return nil
+		})
+	})
+	return snapshot, err
+}
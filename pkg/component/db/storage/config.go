@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+	"go.uber.org/zap"
+	"reflect"
+)
+
+// 运行配置文档的 _id
+const runtimeConfigID = "runtime_config"
+
+// ConfigStore 运行配置
+type ConfigStore interface {
+	// RuntimeConfig 不存在时返回 ErrNotFound
+	RuntimeConfig(ctx context.Context) (*config.Yaml, error)
+	SaveRuntimeConfig(ctx context.Context, cfg *config.Yaml) error
+}
+
+func (m *mongoStore) RuntimeConfig(ctx context.Context) (*config.Yaml, error) {
+	cfg, err := findOne[config.Yaml](ctx, m.collection(types.MongoDatabaseConfigs, types.MongoCollectionConfig), bson.M{"_id": runtimeConfigID})
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (m *mongoStore) SaveRuntimeConfig(ctx context.Context, cfg *config.Yaml) error {
+	_, err := m.collection(types.MongoDatabaseConfigs, types.MongoCollectionConfig).UpdateOne(ctx,
+		bson.M{"_id": runtimeConfigID},
+		bson.M{"$set": cfg},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *kvStore) RuntimeConfig(_ context.Context) (*config.Yaml, error) {
+	cfg, err := getDoc[config.Yaml](s, types.MongoDatabaseConfigs, types.MongoCollectionConfig, stringKey(runtimeConfigID))
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (s *kvStore) SaveRuntimeConfig(_ context.Context, cfg *config.Yaml) error {
+	data, err := bson.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	idx, doc := bsoncore.AppendDocumentStart(nil)
+	doc = bsoncore.AppendStringElement(doc, "_id", runtimeConfigID)
+	doc = append(doc, data[4:len(data)-1]...)
+	if doc, err = bsoncore.AppendDocumentEnd(doc, idx); err != nil {
+		return err
+	}
+	return s.kv.put(types.MongoDatabaseConfigs, types.MongoCollectionConfig, []pair{{Key: stringKey(runtimeConfigID), Value: doc}})
+}
+
+// LoadConfig 加载存储中的运行配置，不存在时将 yaml 配置写入存储
+func LoadConfig() error {
+	cfg, err := Configs().RuntimeConfig(context.TODO())
+	if errors.Is(err, ErrNotFound) {
+		// 配置不存在，将yaml加载到存储中
+		return StoreConfig()
+	}
+	if err != nil {
+		zap.L().Error("Failed to find runtime config", zap.Error(err))
+		return err
+	}
+
+	// 将存储中的配置加载到 config.Cfg
+	config.Cfg = cfg
+	return nil
+}
+
+// StoreConfig 将配置保存到存储中
+func StoreConfig() error {
+	if err := Configs().SaveRuntimeConfig(context.TODO(), config.Cfg); err != nil {
+		zap.L().Error("Failed to store runtime config", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// UpdateNestedConfig 更新配置
+func UpdateNestedConfig(cfg interface{}, updates map[string]interface{}) error {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		fieldType := t.Field(i)
+		jsonTag := fieldType.Tag.Get("json")
+
+		if newValue, ok := updates[jsonTag]; ok {
+			if field.Kind() == reflect.Struct {
+				// 递归更新嵌套结构
+				if err := UpdateNestedConfig(field.Addr().Interface(), newValue.(map[string]interface{})); err != nil {
+					return err
+				}
+			} else if field.CanSet() {
+				newValueReflect := reflect.ValueOf(newValue)
+				if newValueReflect.Type().ConvertibleTo(field.Type()) {
+					field.Set(newValueReflect.Convert(field.Type()))
+				} else {
+					return fmt.Errorf("type mismatch for field %s", jsonTag)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// DatasetStore 按时段分集合的数据集，供保留策略清理与归档导出使用
+type DatasetStore interface {
+	Collections(ctx context.Context, db string) ([]string, error)
+	CollectionStats(ctx context.Context, db, collection string) (CollectionStats, error)
+	DropCollection(ctx context.Context, db, collection string) error
+	DropDatabase(ctx context.Context, db string) error
+	// CountRange 时间范围内的文档数量
+	CountRange(ctx context.Context, db, collection string, r TimeRange) (int64, error)
+	// ScanRange 遍历时间范围内的文档，fn 中不能写入存储
+	ScanRange(ctx context.Context, db, collection string, r TimeRange, fn func(doc bson.Raw) error) error
+}
+
+// TimeRange 文档时间字段的范围 [From, To)，Field 为空时不过滤
+type TimeRange struct {
+	Field    string
+	From, To time.Time
+}
+
+func (r TimeRange) filter() bson.D {
+	if r.Field == "" {
+		return bson.D{}
+	}
+	return bson.D{{Key: r.Field, Value: bson.D{
+		{Key: "$gte", Value: primitive.NewDateTimeFromTime(r.From)},
+		{Key: "$lt", Value: primitive.NewDateTimeFromTime(r.To)},
+	}}}
+}
+
+func (r TimeRange) match(doc bson.Raw) bool {
+	if r.Field == "" {
+		return true
+	}
+	t, ok := timeField(doc, r.Field)
+	return ok && !t.Before(r.From) && t.Before(r.To)
+}
+
+func (m *mongoStore) Collections(ctx context.Context, db string) ([]string, error) {
+	return m.client.Database(db).ListCollectionNames(ctx, bson.M{})
+}
+
+func (m *mongoStore) CollectionStats(ctx context.Context, db, collection string) (CollectionStats, error) {
+	var result struct {
+		Count int64 `bson:"count"`
+		Size  int64 `bson:"size"`
+	}
+	err := m.client.Database(db).RunCommand(ctx, bson.D{{Key: "collStats", Value: collection}}).Decode(&result)
+	return CollectionStats{Count: result.Count, Size: result.Size}, err
+}
+
+func (m *mongoStore) DropCollection(ctx context.Context, db, collection string) error {
+	return m.collection(db, collection).Drop(ctx)
+}
+
+func (m *mongoStore) DropDatabase(ctx context.Context, db string) error {
+	return m.client.Database(db).Drop(ctx)
+}
+
+func (m *mongoStore) CountRange(ctx context.Context, db, collection string, r TimeRange) (int64, error) {
+	return m.collection(db, collection).CountDocuments(ctx, r.filter())
+}
+
+func (m *mongoStore) ScanRange(ctx context.Context, db, collection string, r TimeRange, fn func(bson.Raw) error) error {
+	cursor, err := m.collection(db, collection).Find(ctx, r.filter())
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		if err = fn(cursor.Current); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (s *kvStore) Collections(_ context.Context, db string) ([]string, error) {
+	return s.kv.tables(db)
+}
+
+func (s *kvStore) CollectionStats(_ context.Context, db, collection string) (CollectionStats, error) {
+	return s.kv.stats(db, collection)
+}
+
+func (s *kvStore) DropCollection(_ context.Context, db, collection string) error {
+	return s.kv.drop(db, collection)
+}
+
+func (s *kvStore) DropDatabase(_ context.Context, db string) error {
+	return s.kv.dropDatabase(db)
+}
+
+func (s *kvStore) CountRange(ctx context.Context, db, collection string, r TimeRange) (int64, error) {
+	var total int64
+	err := s.ScanRange(ctx, db, collection, r, func(bson.Raw) error {
+		total++
+		return nil
+	})
+	return total, err
+}
+
+func (s *kvStore) ScanRange(ctx context.Context, db, collection string, r TimeRange, fn func(bson.Raw) error) error {
+	var fnErr error
+	err := s.kv.scan(db, collection, nil, false, func(_, value []byte) bool {
+		if fnErr = ctx.Err(); fnErr != nil {
+			return false
+		}
+		if doc := bson.Raw(value); r.match(doc) {
+			fnErr = fn(doc)
+		}
+		return fnErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"slices"
+	"sort"
+	"time"
+)
+
+// DeviceStore 设备录入记录(按天分集合)与设备库
+type DeviceStore interface {
+	// InsertDeviceRecord 同一 IP 同一时刻的重复记录忽略
+	InsertDeviceRecord(ctx context.Context, collection string, rec types.DeviceRecord) error
+	// FindDeviceRecords IP 的设备记录，按最后出现时间倒序
+	FindDeviceRecords(ctx context.Context, collection, ip string) ([]types.DeviceRecordByFront, error)
+	// SaveIdentities 按 _id 整体替换，同一 _id 后写入的生效
+	SaveIdentities(ctx context.Context, docs []bson.Raw) error
+	// FindIdentities 按最后出现时间倒序
+	FindIdentities(ctx context.Context, q IdentityQuery) ([]types.DeviceIdentity, int64, error)
+	GetIdentity(ctx context.Context, id string) (types.DeviceIdentity, error)
+}
+
+// IdentityQuery 设备库查询条件，字段为空时不过滤
+type IdentityQuery struct {
+	IP        string    // 曾绑定的 IP
+	UserName  string    // 曾绑定的用户
+	Keys      []string  // 包含任一关联键
+	SeenSince time.Time // 最后出现时间不早于
+	NoChanges bool      // 不返回属性变化历史
+	Page
+}
+
+func (q IdentityQuery) filter() bson.M {
+	filter := bson.M{}
+	if q.IP != "" {
+		filter["bindings.ip"] = q.IP
+	}
+	if q.UserName != "" {
+		filter["bindings.user_name"] = q.UserName
+	}
+	if len(q.Keys) > 0 {
+		filter["keys"] = bson.M{"$in": q.Keys}
+	}
+	if !q.SeenSince.IsZero() {
+		filter["last_seen"] = bson.M{"$gte": q.SeenSince}
+	}
+	return filter
+}
+
+func (q IdentityQuery) match(d *types.DeviceIdentity) bool {
+	if !q.SeenSince.IsZero() && d.LastSeen.Before(q.SeenSince) {
+		return false
+	}
+	if len(q.Keys) > 0 && !slices.ContainsFunc(d.Keys, func(k string) bool { return slices.Contains(q.Keys, k) }) {
+		return false
+	}
+	// 与 mongo 对数组字段的匹配一致: IP 与用户可以出现在不同的绑定中
+	return (q.IP == "" || slices.ContainsFunc(d.Bindings, func(b types.DeviceBinding) bool { return b.IP == q.IP })) &&
+		(q.UserName == "" || slices.ContainsFunc(d.Bindings, func(b types.DeviceBinding) bool { return b.UserName == q.UserName }))
+}
+
+var inventoryIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "keys", Value: 1}}},
+	{Keys: bson.D{{Key: "ip", Value: 1}}},
+	{Keys: bson.D{{Key: "user_name", Value: 1}}},
+	{Keys: bson.D{{Key: "mac", Value: 1}}},
+	{Keys: bson.D{{Key: "last_seen", Value: -1}}},
+}
+
+func (m *mongoStore) inventory(ctx context.Context) (*mongo.Collection, error) {
+	c := m.collection(types.MongoDatabaseDevices, types.MongoCollectionDeviceInventory)
+	return c, m.indexOnce(ctx, c, inventoryIndexes...)
+}
+
+func (m *mongoStore) InsertDeviceRecord(ctx context.Context, collection string, rec types.DeviceRecord) error {
+	c := m.collection(types.MongoDatabaseDevices, collection)
+	err := m.indexOnce(ctx, c, mongo.IndexModel{
+		Keys:    bson.D{{Key: "ip", Value: 1}, {Key: "last_seen", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("unique_ip_last_seen_index"),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.InsertOne(ctx, rec)
+	return ignoreDuplicates(err)
+}
+
+func (m *mongoStore) FindDeviceRecords(ctx context.Context, collection, ip string) ([]types.DeviceRecordByFront, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen", Value: -1}})
+	return findAll[types.DeviceRecordByFront](ctx, m.collection(types.MongoDatabaseDevices, collection), bson.M{"ip": ip}, opts)
+}
+
+func (m *mongoStore) SaveIdentities(ctx context.Context, docs []bson.Raw) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	c, err := m.inventory(ctx)
+	if err != nil {
+		return err
+	}
+	models := make([]mongo.WriteModel, 0, len(docs))
+	for _, doc := range docs {
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: doc.Lookup("_id")}}).
+			SetReplacement(doc).
+			SetUpsert(true))
+	}
+	_, err = c.BulkWrite(ctx, models)
+	return err
+}
+
+func (m *mongoStore) FindIdentities(ctx context.Context, q IdentityQuery) ([]types.DeviceIdentity, int64, error) {
+	c, err := m.inventory(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen", Value: -1}})
+	if q.NoChanges {
+		opts.SetProjection(bson.M{"changes": 0})
+	}
+	return findPage[types.DeviceIdentity](ctx, c, q.filter(), q.Page, opts)
+}
+
+func (m *mongoStore) GetIdentity(ctx context.Context, id string) (types.DeviceIdentity, error) {
+	c := m.collection(types.MongoDatabaseDevices, types.MongoCollectionDeviceInventory)
+	return findOne[types.DeviceIdentity](ctx, c, bson.M{"_id": id})
+}
+
+// 设备记录键: IP + 0x00 + 最后出现时间(毫秒，与 bson 时间精度一致)，同一 IP 的记录按时间排列
+func deviceRecordKey(ip string, t time.Time) []byte {
+	key := append([]byte(ip), 0)
+	return binary.BigEndian.AppendUint64(key, uint64(t.UnixMilli()))
+}
+
+func (s *kvStore) InsertDeviceRecord(_ context.Context, collection string, rec types.DeviceRecord) error {
+	_, raw, err := encode(rec)
+	if err != nil {
+		return err
+	}
+	key := deviceRecordKey(rec.IP, rec.LastSeen)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, err := s.kv.get(types.MongoDatabaseDevices, collection, key); err != nil || existing != nil {
+		return err
+	}
+	return s.kv.put(types.MongoDatabaseDevices, collection, []pair{{Key: key, Value: raw}})
+}
+
+func (s *kvStore) FindDeviceRecords(_ context.Context, collection, ip string) ([]types.DeviceRecordByFront, error) {
+	prefix := append([]byte(ip), 0)
+	result := make([]types.DeviceRecordByFront, 0)
+	var decodeErr error
+	err := s.kv.scan(types.MongoDatabaseDevices, collection, prefix, false, func(key, value []byte) bool {
+		if !bytes.HasPrefix(key, prefix) {
+			return false
+		}
+		var rec types.DeviceRecordByFront
+		if decodeErr = bson.Unmarshal(value, &rec); decodeErr != nil {
+			return false
+		}
+		result = append(result, rec)
+		return true
+	})
+	if err == nil {
+		err = decodeErr
+	}
+	slices.Reverse(result)
+	return result, err
+}
+
+func (s *kvStore) SaveIdentities(_ context.Context, docs []bson.Raw) error {
+	return s.putRaw(types.MongoDatabaseDevices, types.MongoCollectionDeviceInventory, docs)
+}
+
+func (s *kvStore) FindIdentities(ctx context.Context, q IdentityQuery) ([]types.DeviceIdentity, int64, error) {
+	list, err := findDocs(ctx, s, types.MongoDatabaseDevices, types.MongoCollectionDeviceInventory, q.match)
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].LastSeen.After(list[j].LastSeen)
+	})
+	total := int64(len(list))
+	list = pageOf(list, q.Page)
+	if q.NoChanges {
+		for i := range list {
+			list[i].Changes = nil
+		}
+	}
+	return list, total, nil
+}
+
+func (s *kvStore) GetIdentity(_ context.Context, id string) (types.DeviceIdentity, error) {
+	return getDoc[types.DeviceIdentity](s, types.MongoDatabaseDevices, types.MongoCollectionDeviceInventory, stringKey(id))
+}
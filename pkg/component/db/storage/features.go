@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"time"
+)
+
+// FeatureStore 在线用户特征快照与用户行为基线
+type FeatureStore interface {
+	// SetFeatureExpire 特征快照按最后出现时间过期
+	SetFeatureExpire(ctx context.Context, ttl time.Duration) error
+	InsertFeatures(ctx context.Context, docs []bson.Raw) error
+	FindFeatures(ctx context.Context, ip string) ([]types.FeatureSet, error)
+	// ScanFeatures 按写入顺序遍历 after 之后的快照，无法解析的快照跳过
+	ScanFeatures(ctx context.Context, after primitive.ObjectID, fn func(id primitive.ObjectID, fs types.FeatureSet) error) error
+	Baselines(ctx context.Context) ([]types.UserBaseline, error)
+	SaveBaseline(ctx context.Context, b types.UserBaseline) error
+}
+
+// 特征快照，_id 为写入时生成的 ObjectID
+type featureSnapshot struct {
+	ID               primitive.ObjectID `bson:"_id"`
+	types.FeatureSet `bson:",inline"`
+}
+
+func (m *mongoStore) features() *mongo.Collection {
+	return m.collection(types.MongoDatabaseFeatures, types.OnlineUsersFeature)
+}
+
+func (m *mongoStore) SetFeatureExpire(ctx context.Context, ttl time.Duration) error {
+	return ensureIndexes(ctx, m.features(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "ip", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "last_seen", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(ttl / time.Second)),
+		},
+	})
+}
+
+func (m *mongoStore) InsertFeatures(ctx context.Context, docs []bson.Raw) error {
+	return insertMany(ctx, m.features(), docs)
+}
+
+func (m *mongoStore) FindFeatures(ctx context.Context, ip string) ([]types.FeatureSet, error) {
+	return findAll[types.FeatureSet](ctx, m.features(), bson.M{"ip": ip})
+}
+
+func (m *mongoStore) ScanFeatures(ctx context.Context, after primitive.ObjectID, fn func(primitive.ObjectID, types.FeatureSet) error) error {
+	cursor, err := m.features().Find(ctx, bson.M{"_id": bson.M{"$gt": after}}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc featureSnapshot
+		if err = cursor.Decode(&doc); err != nil {
+			zap.L().Warn("解析特征快照失败", zap.Error(err))
+			continue
+		}
+		if err = fn(doc.ID, doc.FeatureSet); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (m *mongoStore) Baselines(ctx context.Context) ([]types.UserBaseline, error) {
+	return findAll[types.UserBaseline](ctx, m.collection(types.MongoDatabaseFeatures, types.MongoCollectionBaseline), bson.M{})
+}
+
+func (m *mongoStore) SaveBaseline(ctx context.Context, b types.UserBaseline) error {
+	return replaceByID(ctx, m.collection(types.MongoDatabaseFeatures, types.MongoCollectionBaseline), b.UserName, b)
+}
+
+func (s *kvStore) SetFeatureExpire(_ context.Context, ttl time.Duration) error {
+	s.setExpire(types.MongoDatabaseFeatures, types.OnlineUsersFeature, "last_seen", ttl)
+	return nil
+}
+
+func (s *kvStore) InsertFeatures(_ context.Context, docs []bson.Raw) error {
+	return s.putRaw(types.MongoDatabaseFeatures, types.OnlineUsersFeature, docs)
+}
+
+func (s *kvStore) FindFeatures(ctx context.Context, ip string) ([]types.FeatureSet, error) {
+	return findDocs(ctx, s, types.MongoDatabaseFeatures, types.OnlineUsersFeature, func(fs *types.FeatureSet) bool {
+		return fs.IP == ip
+	})
+}
+
+func (s *kvStore) ScanFeatures(ctx context.Context, after primitive.ObjectID, fn func(primitive.ObjectID, types.FeatureSet) error) error {
+	// 回调可能读写存储，先读出再处理
+	var list []featureSnapshot
+	err := s.kv.scan(types.MongoDatabaseFeatures, types.OnlineUsersFeature, objectKey(after), false, func(_, value []byte) bool {
+		var doc featureSnapshot
+		if err := bson.Unmarshal(value, &doc); err != nil {
+			zap.L().Warn("解析特征快照失败", zap.Error(err))
+			return true
+		}
+		list = append(list, doc)
+		return ctx.Err() == nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, doc := range list {
+		if err = fn(doc.ID, doc.FeatureSet); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (s *kvStore) Baselines(ctx context.Context) ([]types.UserBaseline, error) {
+	return findDocs[types.UserBaseline](ctx, s, types.MongoDatabaseFeatures, types.MongoCollectionBaseline, nil)
+}
+
+func (s *kvStore) SaveBaseline(_ context.Context, b types.UserBaseline) error {
+	return s.putDoc(types.MongoDatabaseFeatures, types.MongoCollectionBaseline, b)
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// JudgeStore 代理与可疑判定记录，按月分集合
+type JudgeStore interface {
+	InsertProxy(ctx context.Context, collection string, rec types.ProxyRecord) error
+	// FindProxies 按写入顺序倒序
+	FindProxies(ctx context.Context, collection string, q JudgeQuery) ([]types.ProxyRecord, int64, error)
+	InsertSuspected(ctx context.Context, collection string, rec types.SuspectedRecord) error
+	// FindSuspected 按写入顺序倒序
+	FindSuspected(ctx context.Context, collection string, q JudgeQuery) ([]types.SuspectedRecord, int64, error)
+}
+
+// JudgeQuery 判定记录查询条件，字段为空时不过滤
+type JudgeQuery struct {
+	IP       string
+	Username string
+	Page
+}
+
+func (q JudgeQuery) filter() bson.M {
+	filter := bson.M{}
+	if q.IP != "" {
+		filter["ip"] = q.IP
+	}
+	if q.Username != "" {
+		filter["username"] = q.Username
+	}
+	return filter
+}
+
+func (q JudgeQuery) match(ip, username string) bool {
+	return (q.IP == "" || ip == q.IP) && (q.Username == "" || username == q.Username)
+}
+
+func (m *mongoStore) InsertProxy(ctx context.Context, collection string, rec types.ProxyRecord) error {
+	_, err := m.collection(types.MongoDatabaseProxy, collection).InsertOne(ctx, rec)
+	return err
+}
+
+func (m *mongoStore) FindProxies(ctx context.Context, collection string, q JudgeQuery) ([]types.ProxyRecord, int64, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}})
+	return findPage[types.ProxyRecord](ctx, m.collection(types.MongoDatabaseProxy, collection), q.filter(), q.Page, opts)
+}
+
+func (m *mongoStore) InsertSuspected(ctx context.Context, collection string, rec types.SuspectedRecord) error {
+	_, err := m.collection(types.MongoDatabaseSuspected, collection).InsertOne(ctx, rec)
+	return err
+}
+
+func (m *mongoStore) FindSuspected(ctx context.Context, collection string, q JudgeQuery) ([]types.SuspectedRecord, int64, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}})
+	return findPage[types.SuspectedRecord](ctx, m.collection(types.MongoDatabaseSuspected, collection), q.filter(), q.Page, opts)
+}
+
+func (s *kvStore) InsertProxy(_ context.Context, collection string, rec types.ProxyRecord) error {
+	return s.putDoc(types.MongoDatabaseProxy, collection, rec)
+}
+
+func (s *kvStore) FindProxies(ctx context.Context, collection string, q JudgeQuery) ([]types.ProxyRecord, int64, error) {
+	return pageDocs(ctx, s, types.MongoDatabaseProxy, collection, func(r *types.ProxyRecord) bool {
+		return q.match(r.IP, r.Username)
+	}, q.Page)
+}
+
+func (s *kvStore) InsertSuspected(_ context.Context, collection string, rec types.SuspectedRecord) error {
+	return s.putDoc(types.MongoDatabaseSuspected, collection, rec)
+}
+
+func (s *kvStore) FindSuspected(ctx context.Context, collection string, q JudgeQuery) ([]types.SuspectedRecord, int64, error) {
+	return pageDocs(ctx, s, types.MongoDatabaseSuspected, collection, func(r *types.SuspectedRecord) bool {
+		return q.match(r.IP, r.Username)
+	}, q.Page)
+}
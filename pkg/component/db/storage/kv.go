@@ -0,0 +1,273 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// 嵌入式与内存后端
+// 底层为按 数据库/集合 两级分桶的有序键值存储(bbolt 文件或内存)，各类数据的存储在其上按类型读写：
+// 文档以 bson 保存，键为文档 _id 或业务唯一键，条件在读取时按类型字段比较，不解析查询语句。
+// 特征快照与观察者历史按时间字段过期，由持有存储的进程定期清理
+
+const expireInterval = time.Minute
+
+// kv 有序键值存储
+type kv interface {
+	// get 读取键，不存在时返回 nil
+	get(db, table string, key []byte) ([]byte, error)
+	put(db, table string, pairs []pair) error
+	del(db, table string, keys [][]byte) error
+	// scan 按键顺序遍历，after 非空时从该键之后开始，fn 返回 false 停止
+	scan(db, table string, after []byte, reverse bool, fn func(key, value []byte) bool) error
+	stats(db, table string) (CollectionStats, error)
+	tables(db string) ([]string, error)
+	drop(db, table string) error
+	dropDatabase(db string) error
+	close() error
+}
+
+type pair struct {
+	Key   []byte `json:"k"`
+	Value []byte `json:"v"`
+}
+
+// 过期设置，field 为文档中的时间字段
+type expiry struct {
+	db    string
+	table string
+	field string
+	ttl   time.Duration
+}
+
+type kvStore struct {
+	kv      kv
+	mu      sync.Mutex // 读改写操作串行
+	expires map[string]expiry
+	stop    chan struct{}
+	once    sync.Once
+}
+
+func newKVStore(k kv) *kvStore {
+	return &kvStore{kv: k, expires: make(map[string]expiry), stop: make(chan struct{})}
+}
+
+func (s *kvStore) close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.stop)
+		err = s.kv.close()
+	})
+	return err
+}
+
+// 设置集合按时间字段过期，ttl 不大于 0 时不过期
+func (s *kvStore) setExpire(db, table, field string, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ttl <= 0 {
+		delete(s.expires, db+"."+table)
+		return
+	}
+	s.expires[db+"."+table] = expiry{db: db, table: table, field: field, ttl: ttl}
+}
+
+// 定期删除过期文档，持有存储的进程调用
+func (s *kvStore) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.expire(now)
+		}
+	}
+}
+
+func (s *kvStore) expire(now time.Time) {
+	s.mu.Lock()
+	list := make([]expiry, 0, len(s.expires))
+	for _, e := range s.expires {
+		list = append(list, e)
+	}
+	s.mu.Unlock()
+
+	for _, e := range list {
+		before := now.Add(-e.ttl)
+		var keys [][]byte
+		err := s.kv.scan(e.db, e.table, nil, false, func(key, value []byte) bool {
+			if t, ok := timeField(value, e.field); ok && t.Before(before) {
+				keys = append(keys, key)
+			}
+			return true
+		})
+		if err == nil && len(keys) > 0 {
+			err = s.kv.del(e.db, e.table, keys)
+		}
+		if err != nil {
+			zap.L().Warn("Failed expiring documents", zap.String("collection", e.db+"."+e.table), zap.Error(err))
+		}
+	}
+}
+
+// 文档中的时间字段
+func timeField(doc bson.Raw, field string) (time.Time, bool) {
+	v, err := doc.LookupErr(field)
+	if err != nil || v.Type != bsontype.DateTime {
+		return time.Time{}, false
+	}
+	return v.Time(), true
+}
+
+// 键编码: 类型字节 + 值，同类型的键保持原有顺序，ObjectID 键按生成时间排列
+
+func objectKey(id primitive.ObjectID) []byte {
+	return append([]byte{byte(bsontype.ObjectID)}, id[:]...)
+}
+
+func stringKey(s string) []byte {
+	return append([]byte{byte(bsontype.String)}, s...)
+}
+
+func idKey(v bson.RawValue) ([]byte, error) {
+	switch v.Type {
+	case bsontype.ObjectID:
+		return objectKey(v.ObjectID()), nil
+	case bsontype.String:
+		return stringKey(v.StringValue()), nil
+	}
+	return nil, fmt.Errorf("unsupported _id type %s", v.Type)
+}
+
+// EnsureID 文档没有 _id 时在首位补齐 ObjectID
+func EnsureID(raw bson.Raw) (bson.Raw, error) {
+	if _, err := raw.LookupErr("_id"); err == nil {
+		return raw, nil
+	}
+	idx, doc := bsoncore.AppendDocumentStart(nil)
+	doc = bsoncore.AppendObjectIDElement(doc, "_id", primitive.NewObjectID())
+	doc = append(doc, raw[4:len(raw)-1]...)
+	return bsoncore.AppendDocumentEnd(doc, idx)
+}
+
+// 编码文档，返回 _id 键
+func encode(doc any) ([]byte, bson.Raw, error) {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := EnsureID(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := idKey(raw.Lookup("_id"))
+	return key, raw, err
+}
+
+// 按 _id 写入已编码的文档
+func (s *kvStore) putRaw(db, table string, docs []bson.Raw) error {
+	pairs := make([]pair, 0, len(docs))
+	for _, doc := range docs {
+		raw, err := EnsureID(doc)
+		if err != nil {
+			return err
+		}
+		key, err := idKey(raw.Lookup("_id"))
+		if err != nil {
+			return err
+		}
+		pairs = append(pairs, pair{Key: key, Value: raw})
+	}
+	return s.kv.put(db, table, pairs)
+}
+
+// 按 _id 写入文档
+func (s *kvStore) putDoc(db, table string, doc any) error {
+	key, raw, err := encode(doc)
+	if err != nil {
+		return err
+	}
+	return s.kv.put(db, table, []pair{{Key: key, Value: raw}})
+}
+
+// 读取并解码单个文档，不存在时返回 ErrNotFound
+func getDoc[T any](s *kvStore, db, table string, key []byte) (T, error) {
+	var doc T
+	value, err := s.kv.get(db, table, key)
+	if err != nil {
+		return doc, err
+	}
+	if value == nil {
+		return doc, ErrNotFound
+	}
+	return doc, bson.Unmarshal(value, &doc)
+}
+
+// 按键顺序解码文档，fn 返回 false 停止
+func eachDoc[T any](ctx context.Context, s *kvStore, db, table string, reverse bool, fn func(doc *T) bool) error {
+	var decodeErr error
+	err := s.kv.scan(db, table, nil, reverse, func(_, value []byte) bool {
+		if decodeErr = ctx.Err(); decodeErr != nil {
+			return false
+		}
+		var doc T
+		if decodeErr = bson.Unmarshal(value, &doc); decodeErr != nil {
+			return false
+		}
+		return fn(&doc)
+	})
+	if err != nil {
+		return err
+	}
+	return decodeErr
+}
+
+// 满足条件的全部文档，按键顺序
+func findDocs[T any](ctx context.Context, s *kvStore, db, table string, match func(*T) bool) ([]T, error) {
+	result := make([]T, 0)
+	err := eachDoc(ctx, s, db, table, false, func(doc *T) bool {
+		if match == nil || match(doc) {
+			result = append(result, *doc)
+		}
+		return true
+	})
+	return result, err
+}
+
+// 按 _id 倒序分页，返回当页文档与满足条件的总数
+func pageDocs[T any](ctx context.Context, s *kvStore, db, table string, match func(*T) bool, page Page) ([]T, int64, error) {
+	result := make([]T, 0)
+	var total int64
+	err := eachDoc(ctx, s, db, table, true, func(doc *T) bool {
+		if match != nil && !match(doc) {
+			return true
+		}
+		if total >= page.Skip && (page.Limit <= 0 || int64(len(result)) < page.Limit) {
+			result = append(result, *doc)
+		}
+		total++
+		return true
+	})
+	return result, total, err
+}
+
+// 对排序后的文档分页
+func pageOf[T any](docs []T, page Page) []T {
+	if page.Skip >= int64(len(docs)) {
+		return make([]T, 0)
+	}
+	docs = docs[page.Skip:]
+	if page.Limit > 0 && int64(len(docs)) > page.Limit {
+		docs = docs[:page.Limit]
+	}
+	return docs
+}
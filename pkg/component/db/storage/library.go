@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sort"
+	"time"
+)
+
+// LibraryStore 特征库版本，元信息集合记录当前版本，历史集合保存各版本数据
+type LibraryStore interface {
+	LibraryExists(ctx context.Context, lib Library) (bool, error)
+	// LibraryVersion 当前版本，特征库不存在时返回 ErrNotFound
+	LibraryVersion(ctx context.Context, lib Library) (string, error)
+	// LoadLibrary 当前版本的数据
+	LoadLibrary(ctx context.Context, lib Library) ([]byte, error)
+	// LibraryHistory 按时间倒序
+	LibraryHistory(ctx context.Context, lib Library) ([]LibraryVersion, error)
+	// SaveLibrary 写入新版本并设为当前版本
+	SaveLibrary(ctx context.Context, lib Library, version string, data []byte, changeNumber int) error
+}
+
+// Library 特征库所在的库与集合
+type Library struct {
+	Database string
+	Metadata string
+	History  string
+}
+
+// LibraryVersion 特征库历史版本
+type LibraryVersion struct {
+	DocId        primitive.ObjectID `bson:"doc_id" json:"doc_id"`
+	Version      string             `bson:"version" json:"version"`
+	Type         string             `bson:"type" json:"type"`
+	Timestamp    primitive.DateTime `bson:"timestamp" json:"timestamp"`
+	ChangeNumber int                `bson:"change_number" json:"change_number"`
+}
+
+type libraryMetadata struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	CurrentVersion string             `bson:"current_version"`
+	CreatedAt      time.Time          `bson:"created_at"`
+	UpdatedAt      time.Time          `bson:"updated_at"`
+}
+
+type libraryData struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	LibraryVersion `bson:",inline"`
+	Data           []byte `bson:"data"`
+}
+
+// 新版本的历史记录，首个版本为 insert，其余为 update
+func newLibraryData(docID primitive.ObjectID, version string, data []byte, changeNumber int, first bool) libraryData {
+	kind := "update"
+	if first {
+		kind, changeNumber = "insert", 0
+	}
+	return libraryData{
+		LibraryVersion: LibraryVersion{
+			DocId:        docID,
+			Version:      version,
+			Type:         kind,
+			Timestamp:    primitive.NewDateTimeFromTime(time.Now()),
+			ChangeNumber: changeNumber,
+		},
+		Data: data,
+	}
+}
+
+func (m *mongoStore) LibraryExists(ctx context.Context, lib Library) (bool, error) {
+	names, err := m.client.Database(lib.Database).ListCollectionNames(ctx, bson.M{"name": lib.Metadata})
+	return len(names) > 0, err
+}
+
+func (m *mongoStore) LibraryVersion(ctx context.Context, lib Library) (string, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	meta, err := findOne[libraryMetadata](ctx, m.collection(lib.Database, lib.Metadata), bson.M{}, opts)
+	return meta.CurrentVersion, err
+}
+
+func (m *mongoStore) LoadLibrary(ctx context.Context, lib Library) ([]byte, error) {
+	version, err := m.LibraryVersion(ctx, lib)
+	if err != nil {
+		return nil, err
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}})
+	doc, err := findOne[libraryData](ctx, m.collection(lib.Database, lib.History), bson.M{"version": version}, opts)
+	return doc.Data, err
+}
+
+func (m *mongoStore) LibraryHistory(ctx context.Context, lib Library) ([]LibraryVersion, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+		SetProjection(bson.M{"data": 0})
+	return findAll[LibraryVersion](ctx, m.collection(lib.Database, lib.History), bson.M{}, opts)
+}
+
+func (m *mongoStore) SaveLibrary(ctx context.Context, lib Library, version string, data []byte, changeNumber int) error {
+	metadata := m.collection(lib.Database, lib.Metadata)
+	meta, err := findOne[libraryMetadata](ctx, metadata, bson.M{})
+	first := errors.Is(err, ErrNotFound)
+	if err != nil && !first {
+		return err
+	}
+	now := time.Now()
+	if first {
+		meta = libraryMetadata{ID: primitive.NewObjectID(), CurrentVersion: version, CreatedAt: now, UpdatedAt: now}
+		_, err = metadata.InsertOne(ctx, meta)
+	} else {
+		_, err = metadata.UpdateOne(ctx, bson.M{"_id": meta.ID}, bson.M{
+			"$set": bson.M{"current_version": version, "updated_at": now},
+		})
+	}
+	if err != nil {
+		return err
+	}
+	_, err = m.collection(lib.Database, lib.History).InsertOne(ctx, newLibraryData(meta.ID, version, data, changeNumber, first))
+	return err
+}
+
+// 元信息集合只有一个文档
+func (s *kvStore) libraryMetadata(ctx context.Context, lib Library) (libraryMetadata, error) {
+	var meta libraryMetadata
+	found := false
+	err := eachDoc(ctx, s, lib.Database, lib.Metadata, false, func(doc *libraryMetadata) bool {
+		meta, found = *doc, true
+		return false
+	})
+	if err == nil && !found {
+		err = ErrNotFound
+	}
+	return meta, err
+}
+
+func (s *kvStore) LibraryExists(ctx context.Context, lib Library) (bool, error) {
+	_, err := s.libraryMetadata(ctx, lib)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *kvStore) LibraryVersion(ctx context.Context, lib Library) (string, error) {
+	meta, err := s.libraryMetadata(ctx, lib)
+	return meta.CurrentVersion, err
+}
+
+func (s *kvStore) LoadLibrary(ctx context.Context, lib Library) ([]byte, error) {
+	version, err := s.LibraryVersion(ctx, lib)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	found := false
+	// 倒序遍历，取该版本最后写入的数据
+	err = eachDoc(ctx, s, lib.Database, lib.History, true, func(doc *libraryData) bool {
+		if doc.Version != version {
+			return true
+		}
+		data, found = doc.Data, true
+		return false
+	})
+	if err == nil && !found {
+		err = ErrNotFound
+	}
+	return data, err
+}
+
+func (s *kvStore) LibraryHistory(ctx context.Context, lib Library) ([]LibraryVersion, error) {
+	result := make([]LibraryVersion, 0)
+	err := eachDoc(ctx, s, lib.Database, lib.History, true, func(doc *libraryData) bool {
+		result = append(result, doc.LibraryVersion)
+		return true
+	})
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Timestamp > result[j].Timestamp
+	})
+	return result, err
+}
+
+func (s *kvStore) SaveLibrary(ctx context.Context, lib Library, version string, data []byte, changeNumber int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	meta, err := s.libraryMetadata(ctx, lib)
+	first := errors.Is(err, ErrNotFound)
+	if err != nil && !first {
+		return err
+	}
+	now := time.Now()
+	if first {
+		meta = libraryMetadata{ID: primitive.NewObjectID(), CreatedAt: now}
+	}
+	meta.CurrentVersion, meta.UpdatedAt = version, now
+	if err = s.putDoc(lib.Database, lib.Metadata, meta); err != nil {
+		return err
+	}
+	return s.putDoc(lib.Database, lib.History, newLibraryData(meta.ID, version, data, changeNumber, first))
+}
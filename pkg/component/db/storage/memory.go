@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// 内存后端，进程退出后数据丢失
+
+type memoryTable struct {
+	keys   []string // 有序键
+	values map[string][]byte
+}
+
+type memoryKV struct {
+	mu   sync.RWMutex
+	data map[string]map[string]*memoryTable
+}
+
+func newMemoryKV() *memoryKV {
+	return &memoryKV{data: make(map[string]map[string]*memoryTable)}
+}
+
+func (m *memoryKV) get(db, table string, key []byte) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if t, ok := m.data[db][table]; ok {
+		return bytes.Clone(t.values[string(key)]), nil
+	}
+	return nil, nil
+}
+
+func (m *memoryKV) put(db, table string, pairs []pair) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data[db] == nil {
+		m.data[db] = make(map[string]*memoryTable)
+	}
+	t, ok := m.data[db][table]
+	if !ok {
+		t = &memoryTable{values: make(map[string][]byte)}
+		m.data[db][table] = t
+	}
+	for _, p := range pairs {
+		key := string(p.Key)
+		if _, exists := t.values[key]; !exists {
+			i := sort.SearchStrings(t.keys, key)
+			t.keys = append(t.keys, "")
+			copy(t.keys[i+1:], t.keys[i:])
+			t.keys[i] = key
+		}
+		t.values[key] = bytes.Clone(p.Value)
+	}
+	return nil
+}
+
+func (m *memoryKV) del(db, table string, keys [][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.data[db][table]
+	if !ok {
+		return nil
+	}
+	for _, k := range keys {
+		key := string(k)
+		if _, exists := t.values[key]; !exists {
+			continue
+		}
+		delete(t.values, key)
+		i := sort.SearchStrings(t.keys, key)
+		t.keys = append(t.keys[:i], t.keys[i+1:]...)
+	}
+	return nil
+}
+
+// 遍历时不持有锁，按调用时的键列表读取，回调中可以写入
+func (m *memoryKV) scan(db, table string, after []byte, reverse bool, fn func(key, value []byte) bool) error {
+	m.mu.RLock()
+	t, ok := m.data[db][table]
+	if !ok {
+		m.mu.RUnlock()
+		return nil
+	}
+	keys := t.keys
+	start, end := 0, len(keys)
+	if after != nil {
+		i := sort.SearchStrings(keys, string(after))
+		if reverse {
+			end = i
+		} else {
+			if i < len(keys) && keys[i] == string(after) {
+				i++
+			}
+			start = i
+		}
+	}
+	keys = append([]string(nil), keys[start:end]...)
+	m.mu.RUnlock()
+
+	for n := range keys {
+		key := keys[n]
+		if reverse {
+			key = keys[len(keys)-1-n]
+		}
+		m.mu.RLock()
+		value, exists := t.values[key]
+		m.mu.RUnlock()
+		if exists && !fn([]byte(key), bytes.Clone(value)) {
+			break
+		}
+	}
+	return nil
+}
+
+func (m *memoryKV) stats(db, table string) (CollectionStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var stats CollectionStats
+	if t, ok := m.data[db][table]; ok {
+		for _, v := range t.values {
+			stats.Count++
+			stats.Size += int64(len(v))
+		}
+	}
+	return stats, nil
+}
+
+func (m *memoryKV) tables(db string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.data[db]))
+	for name := range m.data[db] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *memoryKV) drop(db, table string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data[db], table)
+	if len(m.data[db]) == 0 {
+		delete(m.data, db)
+	}
+	return nil
+}
+
+func (m *memoryKV) dropDatabase(db string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, db)
+	return nil
+}
+
+func (m *memoryKV) close() error {
+	return nil
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sync"
+)
+
+// mongodb 后端，各存储接口直接使用驱动实现
+
+type mongoStore struct {
+	client  *mongo.Client
+	indexed sync.Map // 已创建索引的集合
+}
+
+func newMongoStore(client *mongo.Client) *mongoStore {
+	return &mongoStore{client: client}
+}
+
+func (m *mongoStore) collection(database, name string) *mongo.Collection {
+	return m.client.Database(database).Collection(name)
+}
+
+func (m *mongoStore) close() error {
+	return m.client.Disconnect(context.TODO())
+}
+
+// 每个集合只创建一次索引
+func (m *mongoStore) indexOnce(ctx context.Context, c *mongo.Collection, models ...mongo.IndexModel) error {
+	key := c.Database().Name() + "." + c.Name()
+	if _, ok := m.indexed.Load(key); ok {
+		return nil
+	}
+	if err := ensureIndexes(ctx, c, models); err != nil {
+		return err
+	}
+	m.indexed.Store(key, struct{}{})
+	return nil
+}
+
+// 创建索引，同名 TTL 索引已存在时更新过期时间
+func ensureIndexes(ctx context.Context, c *mongo.Collection, models []mongo.IndexModel) error {
+	for _, model := range models {
+		_, err := c.Indexes().CreateOne(ctx, model)
+		if err == nil {
+			continue
+		}
+		opts := options.MergeIndexOptions(model.Options)
+		if opts.ExpireAfterSeconds == nil {
+			return err
+		}
+		// 过期时间变更，使用 collMod 更新
+		index := bson.D{{Key: "keyPattern", Value: model.Keys}}
+		if opts.Name != nil {
+			index = bson.D{{Key: "name", Value: *opts.Name}}
+		}
+		index = append(index, bson.E{Key: "expireAfterSeconds", Value: *opts.ExpireAfterSeconds})
+		err = c.Database().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: c.Name()},
+			{Key: "index", Value: index},
+		}).Err()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 批量写入，已写入的记录(重复键)视为成功
+func insertMany(ctx context.Context, c *mongo.Collection, docs []bson.Raw) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	list := make([]any, len(docs))
+	for i, doc := range docs {
+		list[i] = doc
+	}
+	_, err := c.InsertMany(ctx, list, options.InsertMany().SetOrdered(false))
+	return ignoreDuplicates(err)
+}
+
+// 写入错误仅包含重复键时忽略，即记录已写入
+func ignoreDuplicates(err error) error {
+	var codes []int
+	var bwe mongo.BulkWriteException
+	var we mongo.WriteException
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &bwe) && bwe.WriteConcernError == nil:
+		for _, e := range bwe.WriteErrors {
+			codes = append(codes, e.Code)
+		}
+	case errors.As(err, &we) && we.WriteConcernError == nil:
+		for _, e := range we.WriteErrors {
+			codes = append(codes, e.Code)
+		}
+	}
+	if len(codes) == 0 {
+		return err
+	}
+	for _, code := range codes {
+		if code != 11000 {
+			return err
+		}
+	}
+	return nil
+}
+
+// 按 _id 整体替换，不存在时写入
+func replaceByID(ctx context.Context, c *mongo.Collection, id, doc any) error {
+	_, err := c.ReplaceOne(ctx, bson.M{"_id": id}, doc, options.Replace().SetUpsert(true))
+	return err
+}
+
+func findOne[T any](ctx context.Context, c *mongo.Collection, filter any, opts ...*options.FindOneOptions) (T, error) {
+	var doc T
+	err := c.FindOne(ctx, filter, opts...).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = ErrNotFound
+	}
+	return doc, err
+}
+
+func findAll[T any](ctx context.Context, c *mongo.Collection, filter any, opts ...*options.FindOptions) ([]T, error) {
+	cursor, err := c.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]T, 0)
+	err = cursor.All(ctx, &result)
+	return result, err
+}
+
+// 分页查询，opts 指定排序与投影，返回当页文档与满足条件的总数
+func findPage[T any](ctx context.Context, c *mongo.Collection, filter any, page Page, opts *options.FindOptions) ([]T, int64, error) {
+	total, err := c.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	opts.SetSkip(page.Skip)
+	if page.Limit > 0 {
+		opts.SetLimit(page.Limit)
+	}
+	list, err := findAll[T](ctx, c, filter, opts)
+	return list, total, err
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sort"
+	"time"
+)
+
+// ObserverStore 观察者变化历史，每个观察者一个集合，文档包含 ip、mac、time 字段
+type ObserverStore interface {
+	// SetObserverRetention 历史按 time 字段保留 retention 后过期
+	SetObserverRetention(ctx context.Context, name string, retention time.Duration) error
+	InsertObserverHistory(ctx context.Context, name string, doc any) error
+	// FindObserverHistory 按时间排序
+	FindObserverHistory(ctx context.Context, name string, q ObserverQuery) ([]bson.Raw, error)
+	// ObserverLastSeen since 之后各 IP 最后一次变化的时间
+	ObserverLastSeen(ctx context.Context, name string, since time.Time) (map[string]time.Time, error)
+}
+
+// ObserverQuery 观察者历史查询条件，字段为空时不过滤
+type ObserverQuery struct {
+	IP    string
+	Mac   string
+	Start time.Time // 不早于
+	End   time.Time // 不晚于
+	Desc  bool
+	Limit int64
+}
+
+// 历史记录中用于过滤的字段
+type observerRecord struct {
+	IP   string    `bson:"ip"`
+	Mac  string    `bson:"mac"`
+	Time time.Time `bson:"time"`
+}
+
+func (q ObserverQuery) filter() bson.M {
+	filter := bson.M{}
+	if q.IP != "" {
+		filter["ip"] = q.IP
+	}
+	if q.Mac != "" {
+		filter["mac"] = q.Mac
+	}
+	timeRange := bson.M{}
+	if !q.Start.IsZero() {
+		timeRange["$gte"] = q.Start
+	}
+	if !q.End.IsZero() {
+		timeRange["$lte"] = q.End
+	}
+	if len(timeRange) > 0 {
+		filter["time"] = timeRange
+	}
+	return filter
+}
+
+func (q ObserverQuery) match(r *observerRecord) bool {
+	return (q.IP == "" || r.IP == q.IP) &&
+		(q.Mac == "" || r.Mac == q.Mac) &&
+		(q.Start.IsZero() || !r.Time.Before(q.Start)) &&
+		(q.End.IsZero() || !r.Time.After(q.End))
+}
+
+func (m *mongoStore) observer(name string) *mongo.Collection {
+	return m.collection(types.MongoDatabaseObserver, name)
+}
+
+func (m *mongoStore) SetObserverRetention(ctx context.Context, name string, retention time.Duration) error {
+	return ensureIndexes(ctx, m.observer(name), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "ip", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "mac", Value: 1}, {Key: "time", Value: -1}}},
+		{
+			Keys:    bson.D{{Key: "time", Value: 1}},
+			Options: options.Index().SetName("time_expire").SetExpireAfterSeconds(int32(retention / time.Second)),
+		},
+	})
+}
+
+func (m *mongoStore) InsertObserverHistory(ctx context.Context, name string, doc any) error {
+	_, err := m.observer(name).InsertOne(ctx, doc)
+	return err
+}
+
+func (m *mongoStore) FindObserverHistory(ctx context.Context, name string, q ObserverQuery) ([]bson.Raw, error) {
+	order := 1
+	if q.Desc {
+		order = -1
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "time", Value: order}})
+	if q.Limit > 0 {
+		opts.SetLimit(q.Limit)
+	}
+	return findAll[bson.Raw](ctx, m.observer(name), q.filter(), opts)
+}
+
+func (m *mongoStore) ObserverLastSeen(ctx context.Context, name string, since time.Time) (map[string]time.Time, error) {
+	cursor, err := m.observer(name).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"time": bson.M{"$gte": since}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$ip", "last": bson.M{"$max": "$time"}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		IP   string    `bson:"_id"`
+		Last time.Time `bson:"last"`
+	}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	result := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		result[row.IP] = row.Last
+	}
+	return result, nil
+}
+
+func (s *kvStore) SetObserverRetention(_ context.Context, name string, retention time.Duration) error {
+	s.setExpire(types.MongoDatabaseObserver, name, "time", retention)
+	return nil
+}
+
+func (s *kvStore) InsertObserverHistory(_ context.Context, name string, doc any) error {
+	return s.putDoc(types.MongoDatabaseObserver, name, doc)
+}
+
+func (s *kvStore) FindObserverHistory(ctx context.Context, name string, q ObserverQuery) ([]bson.Raw, error) {
+	type entry struct {
+		time time.Time
+		doc  bson.Raw
+	}
+	var list []entry
+	err := eachDoc(ctx, s, types.MongoDatabaseObserver, name, false, func(doc *bson.Raw) bool {
+		var r observerRecord
+		if err := bson.Unmarshal(*doc, &r); err == nil && q.match(&r) {
+			list = append(list, entry{time: r.Time, doc: *doc})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if q.Desc {
+			return list[i].time.After(list[j].time)
+		}
+		return list[i].time.Before(list[j].time)
+	})
+	if q.Limit > 0 && int64(len(list)) > q.Limit {
+		list = list[:q.Limit]
+	}
+	result := make([]bson.Raw, len(list))
+	for i, e := range list {
+		result[i] = e.doc
+	}
+	return result, nil
+}
+
+func (s *kvStore) ObserverLastSeen(ctx context.Context, name string, since time.Time) (map[string]time.Time, error) {
+	result := make(map[string]time.Time)
+	err := eachDoc(ctx, s, types.MongoDatabaseObserver, name, false, func(r *observerRecord) bool {
+		if !r.Time.Before(since) && r.Time.After(result[r.IP]) {
+			result[r.IP] = r.Time
+		}
+		return true
+	})
+	return result, err
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+	"time"
+)
+
+// PolicyStore 产品策略与豁免名单
+type PolicyStore interface {
+	Products(ctx context.Context) ([]types.Products, error)
+	// SaveProduct 按产品ID写入，保留首次写入的 created_at
+	SaveProduct(ctx context.Context, p types.Products) error
+	Exemptions(ctx context.Context) ([]types.Exemption, error)
+	SaveExemption(ctx context.Context, e types.Exemption) error
+	DeleteExemption(ctx context.Context, id string) error
+}
+
+func (m *mongoStore) Products(ctx context.Context) ([]types.Products, error) {
+	return findAll[types.Products](ctx, m.collection(types.MongoDatabaseConfigs, types.MongoCollectionPolicy), bson.M{})
+}
+
+func (m *mongoStore) SaveProduct(ctx context.Context, p types.Products) error {
+	update := bson.M{
+		"$set":         p,
+		"$setOnInsert": bson.M{"created_at": time.Now()},
+	}
+	_, err := m.collection(types.MongoDatabaseConfigs, types.MongoCollectionPolicy).
+		UpdateOne(ctx, bson.M{"_id": p.ProductsID}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (m *mongoStore) Exemptions(ctx context.Context) ([]types.Exemption, error) {
+	return findAll[types.Exemption](ctx, m.collection(types.MongoDatabaseConfigs, types.MongoCollectionExemption), bson.M{})
+}
+
+func (m *mongoStore) SaveExemption(ctx context.Context, e types.Exemption) error {
+	return replaceByID(ctx, m.collection(types.MongoDatabaseConfigs, types.MongoCollectionExemption), e.ID, e)
+}
+
+func (m *mongoStore) DeleteExemption(ctx context.Context, id string) error {
+	_, err := m.collection(types.MongoDatabaseConfigs, types.MongoCollectionExemption).DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (s *kvStore) Products(ctx context.Context) ([]types.Products, error) {
+	return findDocs[types.Products](ctx, s, types.MongoDatabaseConfigs, types.MongoCollectionPolicy, nil)
+}
+
+func (s *kvStore) SaveProduct(_ context.Context, p types.Products) error {
+	key, raw, err := encode(p)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, err := s.kv.get(types.MongoDatabaseConfigs, types.MongoCollectionPolicy, key)
+	if err != nil {
+		return err
+	}
+	createdAt, ok := timeField(existing, "created_at")
+	if !ok {
+		createdAt = time.Now()
+	}
+	idx, doc := bsoncore.AppendDocumentStart(nil)
+	doc = append(doc, raw[4:len(raw)-1]...)
+	doc = bsoncore.AppendDateTimeElement(doc, "created_at", createdAt.UnixMilli())
+	if doc, err = bsoncore.AppendDocumentEnd(doc, idx); err != nil {
+		return err
+	}
+	return s.kv.put(types.MongoDatabaseConfigs, types.MongoCollectionPolicy, []pair{{Key: key, Value: doc}})
+}
+
+func (s *kvStore) Exemptions(ctx context.Context) ([]types.Exemption, error) {
+	return findDocs[types.Exemption](ctx, s, types.MongoDatabaseConfigs, types.MongoCollectionExemption, nil)
+}
+
+func (s *kvStore) SaveExemption(_ context.Context, e types.Exemption) error {
+	return s.putDoc(types.MongoDatabaseConfigs, types.MongoCollectionExemption, e)
+}
+
+func (s *kvStore) DeleteExemption(_ context.Context, id string) error {
+	return s.kv.del(types.MongoDatabaseConfigs, types.MongoCollectionExemption, [][]byte{stringKey(id)})
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"slices"
+)
+
+// RecordingStore 定向录制审计记录
+type RecordingStore interface {
+	InsertRecording(ctx context.Context, rec types.Recording) error
+	// GetRecording 不存在时返回 ErrNotFound
+	GetRecording(ctx context.Context, id string) (types.Recording, error)
+	// FindRecordings 按开始时间倒序，status 为空时不过滤，limit 为0时不限制
+	FindRecordings(ctx context.Context, status string, limit int64) ([]types.Recording, error)
+	// UpdateRecording 更新录制状态、统计与文件列表，审计事件不变
+	UpdateRecording(ctx context.Context, rec types.Recording) error
+	// AddRecordEvent 追加审计事件
+	AddRecordEvent(ctx context.Context, id string, event types.RecordEvent) error
+}
+
+func (m *mongoStore) recordings() *mongo.Collection {
+	return m.collection(types.MongoDatabaseAudit, types.MongoCollectionRecording)
+}
+
+func (m *mongoStore) InsertRecording(ctx context.Context, rec types.Recording) error {
+	_, err := m.recordings().InsertOne(ctx, rec)
+	return err
+}
+
+func (m *mongoStore) GetRecording(ctx context.Context, id string) (types.Recording, error) {
+	return findOne[types.Recording](ctx, m.recordings(), bson.M{"_id": id})
+}
+
+func (m *mongoStore) FindRecordings(ctx context.Context, status string, limit int64) ([]types.Recording, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "start_time", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	return findAll[types.Recording](ctx, m.recordings(), filter, opts)
+}
+
+func (m *mongoStore) UpdateRecording(ctx context.Context, rec types.Recording) error {
+	return m.updateRecording(ctx, rec.ID, bson.M{"$set": bson.M{
+		"status":   rec.Status,
+		"reason":   rec.Reason,
+		"error":    rec.Error,
+		"packets":  rec.Packets,
+		"bytes":    rec.Bytes,
+		"dropped":  rec.Dropped,
+		"files":    rec.Files,
+		"end_time": rec.EndTime,
+	}})
+}
+
+func (m *mongoStore) AddRecordEvent(ctx context.Context, id string, event types.RecordEvent) error {
+	return m.updateRecording(ctx, id, bson.M{"$push": bson.M{"events": event}})
+}
+
+func (m *mongoStore) updateRecording(ctx context.Context, id string, update bson.M) error {
+	result, err := m.recordings().UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err == nil && result.MatchedCount == 0 {
+		err = ErrNotFound
+	}
+	return err
+}
+
+func (s *kvStore) InsertRecording(_ context.Context, rec types.Recording) error {
+	return s.putDoc(types.MongoDatabaseAudit, types.MongoCollectionRecording, rec)
+}
+
+func (s *kvStore) GetRecording(_ context.Context, id string) (types.Recording, error) {
+	return getDoc[types.Recording](s, types.MongoDatabaseAudit, types.MongoCollectionRecording, stringKey(id))
+}
+
+func (s *kvStore) FindRecordings(ctx context.Context, status string, limit int64) ([]types.Recording, error) {
+	list, err := findDocs(ctx, s, types.MongoDatabaseAudit, types.MongoCollectionRecording, func(rec *types.Recording) bool {
+		return status == "" || rec.Status == status
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(list, func(a, b types.Recording) int {
+		return b.StartTime.Compare(a.StartTime)
+	})
+	if limit > 0 && int64(len(list)) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (s *kvStore) UpdateRecording(_ context.Context, rec types.Recording) error {
+	return s.updateRecording(rec.ID, func(saved *types.Recording) {
+		saved.Status, saved.Reason, saved.Error = rec.Status, rec.Reason, rec.Error
+		saved.Packets, saved.Bytes, saved.Dropped = rec.Packets, rec.Bytes, rec.Dropped
+		saved.Files, saved.EndTime = rec.Files, rec.EndTime
+	})
+}
+
+func (s *kvStore) AddRecordEvent(_ context.Context, id string, event types.RecordEvent) error {
+	return s.updateRecording(id, func(saved *types.Recording) {
+		saved.Events = append(saved.Events, event)
+	})
+}
+
+func (s *kvStore) updateRecording(id string, fn func(*types.Recording)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, err := getDoc[types.Recording](s, types.MongoDatabaseAudit, types.MongoCollectionRecording, stringKey(id))
+	if err != nil {
+		return err
+	}
+	fn(&rec)
+	return s.putDoc(types.MongoDatabaseAudit, types.MongoCollectionRecording, rec)
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/socket"
+)
+
+// 远程后端
+// 嵌入式与内存存储由 capture 进程持有，其他进程通过 unix socket 转发键值操作，
+// 遍历按批次分页读取
+
+const remoteBatch = 500
+
+type remoteRequest struct {
+	Op      string   `json:"op"`
+	DB      string   `json:"db"`
+	Table   string   `json:"table,omitempty"`
+	Key     []byte   `json:"key,omitempty"` // get 的键，scan 的起始键
+	Keys    [][]byte `json:"keys,omitempty"`
+	Pairs   []pair   `json:"pairs,omitempty"`
+	Reverse bool     `json:"reverse,omitempty"`
+	Limit   int      `json:"limit,omitempty"`
+}
+
+type remoteReply struct {
+	Value []byte          `json:"value,omitempty"`
+	Pairs []pair          `json:"pairs,omitempty"`
+	Names []string        `json:"names,omitempty"`
+	Stats CollectionStats `json:"stats"`
+	Error string          `json:"error,omitempty"`
+}
+
+type remoteKV struct{}
+
+func call(req remoteRequest) (*remoteReply, error) {
+	data, err := socket.SendUnixMessage(socket.Storage, req)
+	if err != nil {
+		return nil, err
+	}
+	var reply remoteReply
+	if err = json.Unmarshal(data, &reply); err != nil {
+		return nil, fmt.Errorf("invalid storage reply: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+	return &reply, nil
+}
+
+func (remoteKV) get(db, table string, key []byte) ([]byte, error) {
+	reply, err := call(remoteRequest{Op: "get", DB: db, Table: table, Key: key})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Value, nil
+}
+
+func (remoteKV) put(db, table string, pairs []pair) error {
+	_, err := call(remoteRequest{Op: "put", DB: db, Table: table, Pairs: pairs})
+	return err
+}
+
+func (remoteKV) del(db, table string, keys [][]byte) error {
+	_, err := call(remoteRequest{Op: "del", DB: db, Table: table, Keys: keys})
+	return err
+}
+
+func (remoteKV) scan(db, table string, after []byte, reverse bool, fn func(key, value []byte) bool) error {
+	for {
+		reply, err := call(remoteRequest{Op: "scan", DB: db, Table: table, Key: after, Reverse: reverse, Limit: remoteBatch})
+		if err != nil {
+			return err
+		}
+		for _, p := range reply.Pairs {
+			if !fn(p.Key, p.Value) {
+				return nil
+			}
+		}
+		if len(reply.Pairs) < remoteBatch {
+			return nil
+		}
+		after = reply.Pairs[len(reply.Pairs)-1].Key
+	}
+}
+
+func (remoteKV) stats(db, table string) (CollectionStats, error) {
+	reply, err := call(remoteRequest{Op: "stats", DB: db, Table: table})
+	if err != nil {
+		return CollectionStats{}, err
+	}
+	return reply.Stats, nil
+}
+
+func (remoteKV) tables(db string) ([]string, error) {
+	reply, err := call(remoteRequest{Op: "tables", DB: db})
+	if err != nil {
+		return nil, err
+	}
+	if reply.Names == nil {
+		return make([]string, 0), nil
+	}
+	return reply.Names, nil
+}
+
+func (remoteKV) drop(db, table string) error {
+	_, err := call(remoteRequest{Op: "drop", DB: db, Table: table})
+	return err
+}
+
+func (remoteKV) dropDatabase(db string) error {
+	_, err := call(remoteRequest{Op: "dropDatabase", DB: db})
+	return err
+}
+
+func (remoteKV) close() error {
+	return nil
+}
+
+// HandleRemote 执行其他进程转发的键值操作，capture 进程注册为 socket 处理函数
+func HandleRemote(raw json.RawMessage) any {
+	var req remoteRequest
+	reply := &remoteReply{}
+	err := json.Unmarshal(raw, &req)
+	if err == nil {
+		err = execute(req, reply)
+	}
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	return reply
+}
+
+func execute(req remoteRequest, reply *remoteReply) (err error) {
+	local := Storage.local
+	if local == nil {
+		return fmt.Errorf("storage is not served by this process")
+	}
+	k := local.kv
+	switch req.Op {
+	case "get":
+		reply.Value, err = k.get(req.DB, req.Table, req.Key)
+	case "put":
+		err = k.put(req.DB, req.Table, req.Pairs)
+	case "del":
+		err = k.del(req.DB, req.Table, req.Keys)
+	case "scan":
+		reply.Pairs = make([]pair, 0)
+		err = k.scan(req.DB, req.Table, req.Key, req.Reverse, func(key, value []byte) bool {
+			reply.Pairs = append(reply.Pairs, pair{Key: key, Value: value})
+			return req.Limit <= 0 || len(reply.Pairs) < req.Limit
+		})
+	case "stats":
+		reply.Stats, err = k.stats(req.DB, req.Table)
+	case "tables":
+		reply.Names, err = k.tables(req.DB)
+	case "drop":
+		err = k.drop(req.DB, req.Table)
+	case "dropDatabase":
+		err = k.dropDatabase(req.DB)
+	default:
+		err = fmt.Errorf("unknown storage op %q", req.Op)
+	}
+	return err
+}
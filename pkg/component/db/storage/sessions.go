@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SessionStore 会话流与 UserAgent 记录，按时间分集合
+type SessionStore interface {
+	InsertSessions(ctx context.Context, collection string, docs []bson.Raw) error
+	FindSessions(ctx context.Context, collection string, q SessionQuery) ([]types.Sessions, int64, error)
+	InsertUserAgents(ctx context.Context, collection string, docs []bson.Raw) error
+	// FindUserAgents 按最后出现时间倒序
+	FindUserAgents(ctx context.Context, collection string, q UserAgentQuery) ([]types.UserAgentRecord, int64, error)
+}
+
+// SessionQuery 会话查询条件，字段为空时不过滤
+type SessionQuery struct {
+	SrcIP   string
+	DstIP   string
+	SrcPort string
+	DstPort string
+	SNI     bool   // 仅包含 TLS SNI 的会话
+	Host    bool   // 仅包含 HTTP Host 的会话
+	Sort    string // 排序字段，见 sessionSorts，为空时按 _id
+	Desc    bool
+	Page
+}
+
+// UserAgentQuery UserAgent 查询条件，Host 不区分大小写包含匹配
+type UserAgentQuery struct {
+	IP   string
+	Host string
+	Page
+}
+
+// 会话可排序字段
+var sessionSorts = map[string]func(a, b *types.Sessions) int{
+	"_id":          func(a, b *types.Sessions) int { return bytes.Compare(a.ID[:], b.ID[:]) },
+	"start_time":   func(a, b *types.Sessions) int { return a.StartTime.Compare(b.StartTime) },
+	"end_time":     func(a, b *types.Sessions) int { return a.EndTime.Compare(b.EndTime) },
+	"packet_count": func(a, b *types.Sessions) int { return a.PacketCount - b.PacketCount },
+	"byte_count":   func(a, b *types.Sessions) int { return a.ByteCount - b.ByteCount },
+}
+
+func (q SessionQuery) sort() (string, error) {
+	field := q.Sort
+	if field == "" {
+		field = "_id"
+	}
+	if _, ok := sessionSorts[field]; !ok {
+		return "", fmt.Errorf("unsupported sort field %q", q.Sort)
+	}
+	return field, nil
+}
+
+func (q SessionQuery) filter() bson.M {
+	filter := bson.M{}
+	for field, value := range map[string]string{"src_ip": q.SrcIP, "dst_ip": q.DstIP, "src_port": q.SrcPort, "dst_port": q.DstPort} {
+		if value != "" {
+			filter[field] = value
+		}
+	}
+	if q.SNI {
+		filter["metadata.tls_info.sni"] = bson.M{"$nin": bson.A{nil, ""}}
+	}
+	if q.Host {
+		filter["metadata.http_info.host"] = bson.M{"$nin": bson.A{nil, ""}}
+	}
+	return filter
+}
+
+func (q SessionQuery) match(s *types.Sessions) bool {
+	return (q.SrcIP == "" || s.SrcIp == q.SrcIP) &&
+		(q.DstIP == "" || s.DstIp == q.DstIP) &&
+		(q.SrcPort == "" || s.SrcPort == q.SrcPort) &&
+		(q.DstPort == "" || s.DstPort == q.DstPort) &&
+		(!q.SNI || s.Metadata.TlsInfo.Sni != "") &&
+		(!q.Host || s.Metadata.HttpInfo.Host != "")
+}
+
+func (q UserAgentQuery) filter() bson.M {
+	filter := bson.M{}
+	if q.IP != "" {
+		filter["ip"] = q.IP
+	}
+	if q.Host != "" {
+		filter["host"] = primitive.Regex{Pattern: regexp.QuoteMeta(q.Host), Options: "i"}
+	}
+	return filter
+}
+
+func (q UserAgentQuery) match(r *types.UserAgentRecord) bool {
+	return (q.IP == "" || r.IP == q.IP) &&
+		(q.Host == "" || strings.Contains(strings.ToLower(r.Host), strings.ToLower(q.Host)))
+}
+
+func (m *mongoStore) InsertSessions(ctx context.Context, collection string, docs []bson.Raw) error {
+	return insertMany(ctx, m.collection(types.MongoDatabaseStream, collection), docs)
+}
+
+func (m *mongoStore) FindSessions(ctx context.Context, collection string, q SessionQuery) ([]types.Sessions, int64, error) {
+	field, err := q.sort()
+	if err != nil {
+		return nil, 0, err
+	}
+	order := 1
+	if q.Desc {
+		order = -1
+	}
+	opts := options.Find().SetSort(bson.D{{Key: field, Value: order}})
+	return findPage[types.Sessions](ctx, m.collection(types.MongoDatabaseStream, collection), q.filter(), q.Page, opts)
+}
+
+func (m *mongoStore) InsertUserAgents(ctx context.Context, collection string, docs []bson.Raw) error {
+	return insertMany(ctx, m.collection(types.MongoDatabaseUserAgent, collection), docs)
+}
+
+func (m *mongoStore) FindUserAgents(ctx context.Context, collection string, q UserAgentQuery) ([]types.UserAgentRecord, int64, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen", Value: -1}})
+	return findPage[types.UserAgentRecord](ctx, m.collection(types.MongoDatabaseUserAgent, collection), q.filter(), q.Page, opts)
+}
+
+func (s *kvStore) InsertSessions(_ context.Context, collection string, docs []bson.Raw) error {
+	return s.putRaw(types.MongoDatabaseStream, collection, docs)
+}
+
+func (s *kvStore) FindSessions(ctx context.Context, collection string, q SessionQuery) ([]types.Sessions, int64, error) {
+	field, err := q.sort()
+	if err != nil {
+		return nil, 0, err
+	}
+	list, err := findDocs(ctx, s, types.MongoDatabaseStream, collection, q.match)
+	if err != nil {
+		return nil, 0, err
+	}
+	compare := sessionSorts[field]
+	sort.SliceStable(list, func(i, j int) bool {
+		if q.Desc {
+			return compare(&list[i], &list[j]) > 0
+		}
+		return compare(&list[i], &list[j]) < 0
+	})
+	return pageOf(list, q.Page), int64(len(list)), nil
+}
+
+func (s *kvStore) InsertUserAgents(_ context.Context, collection string, docs []bson.Raw) error {
+	return s.putRaw(types.MongoDatabaseUserAgent, collection, docs)
+}
+
+func (s *kvStore) FindUserAgents(ctx context.Context, collection string, q UserAgentQuery) ([]types.UserAgentRecord, int64, error) {
+	list, err := findDocs(ctx, s, types.MongoDatabaseUserAgent, collection, q.match)
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].LastSeen.After(list[j].LastSeen)
+	})
+	return pageOf(list, q.Page), int64(len(list)), nil
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"errors"
+)
+
+// web 进程使用的存储
+// capture 运行时经 unix socket 读写；未运行时嵌入式后端只读打开存储文件，操作结束即关闭，
+// 不影响 capture 之后加锁启动。写操作与 memory 后端在 capture 未运行时返回 ErrCaptureStopped
+
+var ErrCaptureStopped = errors.New("capture is not running")
+
+type standbyKV struct {
+	remote kv
+	path   string // 嵌入式存储文件，memory 后端为空
+	online func() bool
+}
+
+// 选择本次操作使用的存储，done 释放只读打开的文件
+func (s *standbyKV) pick(write bool) (kv, func(), error) {
+	if s.online() {
+		return s.remote, func() {}, nil
+	}
+	if write || s.path == "" {
+		return nil, nil, ErrCaptureStopped
+	}
+	b, err := openBoltReadOnly(s.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, func() { _ = b.close() }, nil
+}
+
+func (s *standbyKV) get(db, table string, key []byte) ([]byte, error) {
+	k, done, err := s.pick(false)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return k.get(db, table, key)
+}
+
+func (s *standbyKV) put(db, table string, pairs []pair) error {
+	k, done, err := s.pick(true)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return k.put(db, table, pairs)
+}
+
+func (s *standbyKV) del(db, table string, keys [][]byte) error {
+	k, done, err := s.pick(true)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return k.del(db, table, keys)
+}
+
+func (s *standbyKV) scan(db, table string, after []byte, reverse bool, fn func(key, value []byte) bool) error {
+	k, done, err := s.pick(false)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return k.scan(db, table, after, reverse, fn)
+}
+
+func (s *standbyKV) stats(db, table string) (CollectionStats, error) {
+	k, done, err := s.pick(false)
+	if err != nil {
+		return CollectionStats{}, err
+	}
+	defer done()
+	return k.stats(db, table)
+}
+
+func (s *standbyKV) tables(db string) ([]string, error) {
+	k, done, err := s.pick(false)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return k.tables(db)
+}
+
+func (s *standbyKV) drop(db, table string) error {
+	k, done, err := s.pick(true)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return k.drop(db, table)
+}
+
+func (s *standbyKV) dropDatabase(db string) error {
+	k, done, err := s.pick(true)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return k.dropDatabase(db)
+}
+
+func (s *standbyKV) close() error {
+	return nil
+}
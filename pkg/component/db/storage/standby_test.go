@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"path/filepath"
+	"testing"
+)
+
+func TestStandbyOffline(t *testing.T) {
+	ctx := context.TODO()
+	path := filepath.Join(t.TempDir(), "dpi.db")
+	b, err := openBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := newKVStore(b)
+	if err = owner.InsertRecording(ctx, types.Recording{ID: "r1", Status: types.RecordDone}); err != nil {
+		t.Fatal(err)
+	}
+	_ = owner.close()
+
+	s := newKVStore(&standbyKV{remote: remoteKV{}, path: path, online: func() bool { return false }})
+	if rec, err := s.GetRecording(ctx, "r1"); err != nil || rec.Status != types.RecordDone {
+		t.Errorf("offline get = %+v %v", rec, err)
+	}
+	if list, err := s.FindRecordings(ctx, "", 0); err != nil || len(list) != 1 {
+		t.Errorf("offline find = %d %v", len(list), err)
+	}
+	if err = s.InsertRecording(ctx, types.Recording{ID: "r2"}); !errors.Is(err, ErrCaptureStopped) {
+		t.Errorf("offline insert = %v, want ErrCaptureStopped", err)
+	}
+
+	// 只读打开在操作结束后释放，capture 可重新持有存储文件
+	b, err = openBolt(path)
+	if err != nil {
+		t.Fatalf("storage file still locked: %v", err)
+	}
+	_ = b.close()
+
+	memory := newKVStore(&standbyKV{remote: remoteKV{}, online: func() bool { return false }})
+	if _, err = memory.GetRecording(ctx, "r1"); !errors.Is(err, ErrCaptureStopped) {
+		t.Errorf("memory backend offline = %v, want ErrCaptureStopped", err)
+	}
+}
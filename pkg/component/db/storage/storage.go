@@ -0,0 +1,352 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/redis"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"go.uber.org/zap"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 存储后端
+// 各类数据通过对应的存储接口读写(Sessions、Devices、Features 等)，后端由 storage.backend 选择:
+// mongo 使用 mongodb 与 redis；embedded 文档与 redis 快照保存在单个 bbolt 文件；memory 全部保存在内存。
+// 非 mongo 后端时存储由 capture 进程持有，redis 与文档通过 run 目录下的 unix socket 提供给 web 等进程
+
+const (
+	BackendMongo    = "mongo"
+	BackendEmbedded = "embedded"
+	BackendMemory   = "memory"
+)
+
+// ErrNotFound 记录不存在
+var ErrNotFound = errors.New("document not found")
+
+// Page 分页，Limit 为 0 时不限制
+type Page struct {
+	Skip  int64
+	Limit int64
+}
+
+// CollectionStats 集合占用
+type CollectionStats struct {
+	Count int64 `json:"count" bson:"count"` // 文档数量
+	Size  int64 `json:"size" bson:"size"`   // 文档数据字节数
+}
+
+// store 各后端实现全部存储接口
+type store interface {
+	SessionStore
+	DeviceStore
+	FeatureStore
+	ObserverStore
+	UserStore
+	JudgeStore
+	PolicyStore
+	AlertStore
+	ConfigStore
+	LibraryStore
+	RecordingStore
+	DatasetStore
+	close() error
+}
+
+var Storage storage
+
+type storage struct {
+	once        sync.Once
+	initialized bool
+	backend     string
+	offline     bool
+	store       store
+	local       *kvStore // 本进程持有的嵌入式或内存存储
+	closers     []func() error
+	mu          sync.Mutex
+}
+
+type setupMode int
+
+const (
+	modeOwner  setupMode = iota // 持有存储并对外提供
+	modeRemote                  // 连接 capture 进程
+	modeClient                  // capture 运行时连接，否则直接打开存储
+)
+
+// Setup 初始化存储，capture 进程调用
+func Setup() error {
+	return Storage.setup(modeOwner)
+}
+
+// SetupRemote 初始化存储客户端，web 进程调用
+// 非 mongo 后端时通过 capture 进程读写，capture 未运行时嵌入式存储只读可用
+func SetupRemote() error {
+	return Storage.setup(modeRemote)
+}
+
+// SetupClient 初始化存储客户端，非 mongo 后端时 capture 运行则连接 capture，否则直接打开存储
+func SetupClient() error {
+	return Storage.setup(modeClient)
+}
+
+// SetupOffline 模拟回放使用，文档读写均失败，redis 使用独立内存存储
+func SetupOffline() error {
+	ok := false
+	Storage.once.Do(func() {
+		if err := redis.SetupMemory(); err != nil {
+			zap.L().Warn("Failed setup memory redis", zap.Error(err))
+		}
+		if err := mongo.SetupOffline(); err != nil {
+			zap.L().Error("Failed setup offline storage", zap.Error(err))
+			return
+		}
+		Storage.backend, Storage.offline = BackendMongo, true
+		Storage.store = newMongoStore(mongo.GetMongoClient())
+		Storage.initialized = true
+		ok = true
+	})
+	if !ok {
+		return fmt.Errorf("storage already initialized")
+	}
+	return nil
+}
+
+func (s *storage) setup(mode setupMode) error {
+	var setupErr error
+	s.once.Do(func() {
+		s.backend = backend()
+		if s.backend != BackendMongo && mode == modeClient {
+			mode = modeOwner
+			if running() {
+				mode = modeRemote
+			}
+		}
+		switch {
+		case s.backend == BackendMongo:
+			setupErr = s.setupMongo(mode)
+		case mode == modeRemote:
+			setupErr = s.setupRemote()
+		default:
+			setupErr = s.setupLocal(mode)
+		}
+		if setupErr != nil {
+			return
+		}
+		s.initialized = true
+		zap.L().Info("Storage initialized", zap.String("backend", s.backend))
+		// 加载配置
+		if setupErr = LoadConfig(); setupErr != nil {
+			zap.L().Error("Failed loading runtime config", zap.Error(setupErr))
+		}
+	})
+	if setupErr == nil && !s.initialized {
+		setupErr = fmt.Errorf("storage not initialized")
+	}
+	return setupErr
+}
+
+func (s *storage) setupMongo(mode setupMode) error {
+	if mode == modeOwner {
+		if err := redis.Setup(); err != nil {
+			return err
+		}
+	}
+	if err := mongo.Setup(); err != nil {
+		return err
+	}
+	s.store = newMongoStore(mongo.GetMongoClient())
+	return nil
+}
+
+func (s *storage) setupRemote() error {
+	if err := redis.SetupSocket(config.RunDir); err != nil {
+		return err
+	}
+	standby := &standbyKV{remote: remoteKV{}, online: running}
+	if s.backend == BackendEmbedded {
+		standby.path = storagePath()
+	}
+	s.store = newKVStore(standby)
+	zap.L().Info("Storage served by capture", zap.String("dir", config.RunDir), zap.Bool("running", running()))
+	return nil
+}
+
+func (s *storage) setupLocal(mode setupMode) error {
+	if err := redis.SetupMemory(); err != nil {
+		return err
+	}
+	if s.backend == BackendEmbedded {
+		path := storagePath()
+		b, err := openBolt(path)
+		if err != nil {
+			return err
+		}
+		s.local = newKVStore(b)
+		// 恢复 redis 快照
+		if snapshot, err := b.loadSnapshot(); err != nil {
+			zap.L().Warn("Failed loading redis snapshot", zap.Error(err))
+		} else if err = redis.Restore(snapshot); err != nil {
+			zap.L().Warn("Failed restoring redis snapshot", zap.Error(err))
+		}
+		interval := time.Duration(config.Cfg.Storage.Snapshot) * time.Second
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		stop := make(chan struct{})
+		go s.snapshotLoop(b, interval, stop)
+		s.closers = append(s.closers, func() error {
+			close(stop)
+			return s.saveSnapshot(b)
+		})
+		zap.L().Info("Embedded storage opened", zap.String("path", path))
+	} else {
+		s.local = newKVStore(newMemoryKV())
+	}
+	go s.local.sweep(expireInterval)
+	s.store = s.local
+	if mode == modeOwner {
+		closer, err := redis.ServeMemory(config.RunDir)
+		if err != nil {
+			return err
+		}
+		s.closers = append(s.closers, closer)
+	}
+	return nil
+}
+
+// 定期保存 redis 快照
+func (s *storage) snapshotLoop(b *boltKV, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.saveSnapshot(b); err != nil {
+				zap.L().Warn("Failed saving redis snapshot", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *storage) saveSnapshot(b *boltKV) error {
+	snapshot, err := redis.Snapshot()
+	if err != nil {
+		return err
+	}
+	return b.saveSnapshot(snapshot)
+}
+
+// Close 关闭存储，保存 redis 快照并释放嵌入式存储文件
+func Close() error {
+	s := &Storage
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var firstErr error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if err := s.closers[i](); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.closers = nil
+	if s.store != nil {
+		if err := s.store.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// 当前存储，未初始化时按 capture 方式初始化
+func current() store {
+	if Storage.store == nil {
+		if err := Setup(); err != nil {
+			zap.L().Error("Failed setup storage", zap.Error(err))
+			return newKVStore(unavailable{err: err})
+		}
+	}
+	return Storage.store
+}
+
+// Sessions 会话流与 UserAgent 记录
+func Sessions() SessionStore { return current() }
+
+// Devices 设备记录与设备库
+func Devices() DeviceStore { return current() }
+
+// Features 特征快照与用户基线
+func Features() FeatureStore { return current() }
+
+// Observers 观察者历史
+func Observers() ObserverStore { return current() }
+
+// Users 用户事件与处置状态
+func Users() UserStore { return current() }
+
+// Judgements 代理与可疑判定记录
+func Judgements() JudgeStore { return current() }
+
+// Policies 产品策略与豁免
+func Policies() PolicyStore { return current() }
+
+// Alerts 告警静默
+func Alerts() AlertStore { return current() }
+
+// Configs 运行配置
+func Configs() ConfigStore { return current() }
+
+// Libraries 特征库版本
+func Libraries() LibraryStore { return current() }
+
+// Recordings 定向录制审计记录
+func Recordings() RecordingStore { return current() }
+
+// Datasets 按时间分集合的数据集
+func Datasets() DatasetStore { return current() }
+
+// Backend 当前存储后端
+func Backend() string {
+	if Storage.backend == "" {
+		return backend()
+	}
+	return Storage.backend
+}
+
+// Offline 是否为离线模式
+func Offline() bool {
+	return Storage.offline
+}
+
+func backend() string {
+	switch config.Cfg.Storage.Backend {
+	case BackendEmbedded, BackendMemory:
+		return config.Cfg.Storage.Backend
+	case "", BackendMongo:
+	default:
+		zap.L().Warn("Unknown storage backend, fallback to mongo", zap.String("backend", config.Cfg.Storage.Backend))
+	}
+	return BackendMongo
+}
+
+// 嵌入式存储文件路径
+func storagePath() string {
+	if config.Cfg.Storage.Path != "" {
+		return config.Cfg.Storage.Path
+	}
+	return filepath.Join(config.Home, "data", "dpi.db")
+}
+
+// capture 进程是否运行
+func running() bool {
+	conn, err := net.DialTimeout("unix", filepath.Join(config.RunDir, "unix.sock"), time.Second)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"context"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 同一组用例分别在内存与嵌入式后端执行
+
+var day = time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+func eachBackend(t *testing.T, fn func(t *testing.T, s *kvStore)) {
+	for _, name := range []string{BackendMemory, BackendEmbedded} {
+		t.Run(name, func(t *testing.T) {
+			s := newKVStore(newMemoryKV())
+			if name == BackendEmbedded {
+				b, err := openBolt(filepath.Join(t.TempDir(), "dpi.db"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				s = newKVStore(b)
+			}
+			t.Cleanup(func() { _ = s.close() })
+			fn(t, s)
+		})
+	}
+}
+
+func raws(t *testing.T, docs ...any) []bson.Raw {
+	t.Helper()
+	list := make([]bson.Raw, len(docs))
+	for i, doc := range docs {
+		data, err := bson.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list[i] = data
+	}
+	return list
+}
+
+func TestFindSessions(t *testing.T) {
+	eachBackend(t, func(t *testing.T, s *kvStore) {
+		ctx := context.TODO()
+		sessions := []types.Sessions{
+			{SrcIp: "10.0.0.1", DstPort: "443", ByteCount: 300, Metadata: types.Metadata{TlsInfo: types.TlsInfo{Sni: "a.com"}}},
+			{SrcIp: "10.0.0.1", DstPort: "80", ByteCount: 100, Metadata: types.Metadata{HttpInfo: types.HttpInfo{Host: "b.com"}}},
+			{SrcIp: "10.0.0.2", DstPort: "443", ByteCount: 200},
+		}
+		docs := make([]any, len(sessions))
+		for i := range sessions {
+			sessions[i].ID = primitive.NewObjectID()
+			docs[i] = sessions[i]
+		}
+		if err := s.InsertSessions(ctx, "c", raws(t, docs...)); err != nil {
+			t.Fatal(err)
+		}
+
+		ports := func(q SessionQuery) string {
+			t.Helper()
+			list, _, err := s.FindSessions(ctx, "c", q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, doc := range list {
+				got = append(got, doc.DstPort)
+			}
+			return strings.Join(got, ",")
+		}
+		if got := ports(SessionQuery{SrcIP: "10.0.0.1"}); got != "443,80" {
+			t.Errorf("src_ip = %s", got)
+		}
+		if got := ports(SessionQuery{SNI: true}); got != "443" {
+			t.Errorf("sni = %s", got)
+		}
+		if got := ports(SessionQuery{Host: true}); got != "80" {
+			t.Errorf("host = %s", got)
+		}
+		if got := ports(SessionQuery{Sort: "byte_count", Desc: true, Page: Page{Skip: 1, Limit: 1}}); got != "443" {
+			t.Errorf("sorted page = %s", got)
+		}
+		if _, total, _ := s.FindSessions(ctx, "c", SessionQuery{Page: Page{Limit: 1}}); total != 3 {
+			t.Errorf("total = %d", total)
+		}
+		if _, _, err := s.FindSessions(ctx, "c", SessionQuery{Sort: "$where"}); err == nil {
+			t.Error("unknown sort field accepted")
+		}
+	})
+}
+
+func TestIdentities(t *testing.T) {
+	eachBackend(t, func(t *testing.T, s *kvStore) {
+		ctx := context.TODO()
+		docs := raws(t,
+			types.DeviceIdentity{ID: "d1", Keys: []string{"mac:aa"}, LastSeen: day, Bindings: []types.DeviceBinding{{IP: "10.0.0.1", UserName: "alice"}}},
+			types.DeviceIdentity{ID: "d2", Keys: []string{"mac:bb"}, LastSeen: day.Add(time.Hour), Bindings: []types.DeviceBinding{{IP: "10.0.0.2", UserName: "bob"}}},
+		)
+		if err := s.SaveIdentities(ctx, docs); err != nil {
+			t.Fatal(err)
+		}
+		// 同一 _id 再次写入时替换
+		if err := s.SaveIdentities(ctx, raws(t, types.DeviceIdentity{ID: "d1", Keys: []string{"mac:aa"}, LastSeen: day.Add(2 * time.Hour)})); err != nil {
+			t.Fatal(err)
+		}
+		list, total, err := s.FindIdentities(ctx, IdentityQuery{})
+		if err != nil || total != 2 || list[0].ID != "d1" {
+			t.Errorf("identities = %+v %d %v", list, total, err)
+		}
+		if list, _, _ = s.FindIdentities(ctx, IdentityQuery{Keys: []string{"mac:bb"}}); len(list) != 1 || list[0].ID != "d2" {
+			t.Errorf("keys = %+v", list)
+		}
+		if list, _, _ = s.FindIdentities(ctx, IdentityQuery{UserName: "bob", SeenSince: day}); len(list) != 1 {
+			t.Errorf("user = %+v", list)
+		}
+		if _, err = s.GetIdentity(ctx, "d3"); err != ErrNotFound {
+			t.Errorf("missing identity = %v", err)
+		}
+	})
+}
+
+func TestObserverExpire(t *testing.T) {
+	eachBackend(t, func(t *testing.T, s *kvStore) {
+		ctx := context.TODO()
+		now := time.Now()
+		for i, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.1"} {
+			doc := bson.M{"ip": ip, "time": now.Add(time.Duration(i-2) * time.Hour)}
+			if err := s.InsertObserverHistory(ctx, "ttl", doc); err != nil {
+				t.Fatal(err)
+			}
+		}
+		list, err := s.FindObserverHistory(ctx, "ttl", ObserverQuery{IP: "10.0.0.1", Desc: true, Limit: 1})
+		if err != nil || len(list) != 1 {
+			t.Fatalf("history = %d %v", len(list), err)
+		}
+		if last, _ := timeField(list[0], "time"); last.Unix() != now.Unix() {
+			t.Errorf("latest = %v", last)
+		}
+
+		_ = s.SetObserverRetention(ctx, "ttl", 90*time.Minute)
+		s.expire(now)
+		seen, err := s.ObserverLastSeen(ctx, "ttl", time.Time{})
+		if err != nil || len(seen) != 2 {
+			t.Errorf("after expire = %v %v", seen, err)
+		}
+		if list, _ = s.FindObserverHistory(ctx, "ttl", ObserverQuery{IP: "10.0.0.1"}); len(list) != 1 {
+			t.Errorf("10.0.0.1 history = %d", len(list))
+		}
+	})
+}
+
+func TestScanRange(t *testing.T) {
+	eachBackend(t, func(t *testing.T, s *kvStore) {
+		ctx := context.TODO()
+		var docs []bson.Raw
+		for i := 0; i < 4; i++ {
+			docs = append(docs, raws(t, bson.M{"n": i, "start_time": day.Add(time.Duration(i) * 30 * time.Minute)})...)
+		}
+		if err := s.InsertSessions(ctx, "hour", docs); err != nil {
+			t.Fatal(err)
+		}
+		r := TimeRange{Field: "start_time", From: day, To: day.Add(time.Hour)}
+		if n, err := s.CountRange(ctx, types.MongoDatabaseStream, "hour", r); err != nil || n != 2 {
+			t.Errorf("count = %d %v", n, err)
+		}
+		if n, _ := s.CountRange(ctx, types.MongoDatabaseStream, "hour", TimeRange{}); n != 4 {
+			t.Errorf("count all = %d", n)
+		}
+		stats, err := s.CollectionStats(ctx, types.MongoDatabaseStream, "hour")
+		if err != nil || stats.Count != 4 || stats.Size == 0 {
+			t.Errorf("stats = %+v %v", stats, err)
+		}
+		if err = s.DropCollection(ctx, types.MongoDatabaseStream, "hour"); err != nil {
+			t.Fatal(err)
+		}
+		if names, _ := s.Collections(ctx, types.MongoDatabaseStream); len(names) != 0 {
+			t.Errorf("collections after drop = %v", names)
+		}
+	})
+}
+
+func TestSaveProduct(t *testing.T) {
+	eachBackend(t, func(t *testing.T, s *kvStore) {
+		ctx := context.TODO()
+		if err := s.SaveProduct(ctx, types.Products{ProductsID: "1", Policy: types.Policy{ALL: 4}}); err != nil {
+			t.Fatal(err)
+		}
+		created := func() time.Time {
+			raw, _ := s.kv.get(types.MongoDatabaseConfigs, types.MongoCollectionPolicy, stringKey("1"))
+			at, _ := timeField(raw, "created_at")
+			return at
+		}
+		first := created()
+		if first.IsZero() {
+			t.Fatal("created_at not set")
+		}
+		time.Sleep(2 * time.Millisecond)
+		if err := s.SaveProduct(ctx, types.Products{ProductsID: "1", Policy: types.Policy{ALL: 6}}); err != nil {
+			t.Fatal(err)
+		}
+		if !created().Equal(first) {
+			t.Errorf("created_at changed on update")
+		}
+		if products, _ := s.Products(ctx); len(products) != 1 || products[0].ALL != 6 {
+			t.Errorf("products = %+v", products)
+		}
+	})
+}
+
+func TestUpdateRecording(t *testing.T) {
+	eachBackend(t, func(t *testing.T, s *kvStore) {
+		ctx := context.TODO()
+		rec := types.Recording{ID: "r1", Status: types.RecordRunning, StartTime: day, Remark: "keep"}
+		if err := s.InsertRecording(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+		rec.Status, rec.Packets, rec.Remark = types.RecordDone, 10, "ignored"
+		if err := s.UpdateRecording(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddRecordEvent(ctx, "r1", types.RecordEvent{Action: "finish"}); err != nil {
+			t.Fatal(err)
+		}
+		saved, err := s.GetRecording(ctx, "r1")
+		if err != nil || saved.Status != types.RecordDone || saved.Packets != 10 || saved.Remark != "keep" || len(saved.Events) != 1 {
+			t.Errorf("recording = %+v %v", saved, err)
+		}
+		if err = s.AddRecordEvent(ctx, "r2", types.RecordEvent{}); err != ErrNotFound {
+			t.Errorf("missing recording = %v", err)
+		}
+		if list, _ := s.FindRecordings(ctx, types.RecordRunning, 0); len(list) != 0 {
+			t.Errorf("running = %+v", list)
+		}
+	})
+}
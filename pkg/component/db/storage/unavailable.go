@@ -0,0 +1,43 @@
+package storage
+
+// 存储初始化失败时使用，所有操作返回初始化错误
+
+type unavailable struct {
+	err error
+}
+
+func (u unavailable) get(string, string, []byte) ([]byte, error) {
+	return nil, u.err
+}
+
+func (u unavailable) put(string, string, []pair) error {
+	return u.err
+}
+
+func (u unavailable) del(string, string, [][]byte) error {
+	return u.err
+}
+
+func (u unavailable) scan(string, string, []byte, bool, func(key, value []byte) bool) error {
+	return u.err
+}
+
+func (u unavailable) stats(string, string) (CollectionStats, error) {
+	return CollectionStats{}, u.err
+}
+
+func (u unavailable) tables(string) ([]string, error) {
+	return nil, u.err
+}
+
+func (u unavailable) drop(string, string) error {
+	return u.err
+}
+
+func (u unavailable) dropDatabase(string) error {
+	return u.err
+}
+
+func (u unavailable) close() error {
+	return nil
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UserStore 用户上下线事件(按月分集合)与处置状态
+type UserStore interface {
+	InsertUserEvent(ctx context.Context, collection string, event types.UserEvent) error
+	// FindUserEvents 按写入顺序倒序
+	FindUserEvents(ctx context.Context, collection string, q UserEventQuery) ([]types.UserEvent, int64, error)
+	EnforcementStates(ctx context.Context) ([]types.EnforcementState, error)
+	SaveEnforcementState(ctx context.Context, state types.EnforcementState) error
+}
+
+// UserEventQuery 用户事件查询条件，字段为空时不过滤
+type UserEventQuery struct {
+	IP       string
+	UserName string
+	UserMac  string
+	Action   int
+	Page
+}
+
+func (q UserEventQuery) filter() bson.M {
+	filter := bson.M{}
+	if q.IP != "" {
+		filter["ip"] = q.IP
+	}
+	if q.UserName != "" {
+		filter["user_name"] = q.UserName
+	}
+	if q.UserMac != "" {
+		filter["user_mac"] = q.UserMac
+	}
+	if q.Action != 0 {
+		filter["action"] = q.Action
+	}
+	return filter
+}
+
+func (q UserEventQuery) match(e *types.UserEvent) bool {
+	return (q.IP == "" || e.Ip == q.IP) &&
+		(q.UserName == "" || e.UserName == q.UserName) &&
+		(q.UserMac == "" || e.UserMac == q.UserMac) &&
+		(q.Action == 0 || e.Action == q.Action)
+}
+
+func (m *mongoStore) InsertUserEvent(ctx context.Context, collection string, event types.UserEvent) error {
+	_, err := m.collection(types.MongoDatabaseUserEvents, collection).InsertOne(ctx, event)
+	return err
+}
+
+func (m *mongoStore) FindUserEvents(ctx context.Context, collection string, q UserEventQuery) ([]types.UserEvent, int64, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}})
+	return findPage[types.UserEvent](ctx, m.collection(types.MongoDatabaseUserEvents, collection), q.filter(), q.Page, opts)
+}
+
+func (m *mongoStore) EnforcementStates(ctx context.Context) ([]types.EnforcementState, error) {
+	return findAll[types.EnforcementState](ctx, m.collection(types.MongoDatabaseEnforce, types.MongoCollectionEnforcementState), bson.M{})
+}
+
+func (m *mongoStore) SaveEnforcementState(ctx context.Context, state types.EnforcementState) error {
+	return replaceByID(ctx, m.collection(types.MongoDatabaseEnforce, types.MongoCollectionEnforcementState), state.UserName, state)
+}
+
+func (s *kvStore) InsertUserEvent(_ context.Context, collection string, event types.UserEvent) error {
+	return s.putDoc(types.MongoDatabaseUserEvents, collection, event)
+}
+
+func (s *kvStore) FindUserEvents(ctx context.Context, collection string, q UserEventQuery) ([]types.UserEvent, int64, error) {
+	return pageDocs(ctx, s, types.MongoDatabaseUserEvents, collection, q.match, q.Page)
+}
+
+func (s *kvStore) EnforcementStates(ctx context.Context) ([]types.EnforcementState, error) {
+	return findDocs[types.EnforcementState](ctx, s, types.MongoDatabaseEnforce, types.MongoCollectionEnforcementState, nil)
+}
+
+func (s *kvStore) SaveEnforcementState(_ context.Context, state types.EnforcementState) error {
+	return s.putDoc(types.MongoDatabaseEnforce, types.MongoCollectionEnforcementState, state)
+}
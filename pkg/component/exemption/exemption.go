@@ -0,0 +1,353 @@
+package exemption
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 豁免名单
+// 条目保存在 config.exemption 集合，启动时加载至内存，过期条目定期清理
+// 检测链路上每次因豁免跳过的动作按检查点计数
+
+// 检查点
+const (
+	PointPacket   = "packet"   // Analyze.HandlePacket
+	PointFeature  = "feature"  // member.Increment
+	PointDiscover = "discover" // resolve.Discover
+	PointHook     = "hook"     // users.dispatch
+)
+
+var (
+	ErrInvalidKind  = errors.New("invalid exemption kind")
+	ErrInvalidValue = errors.New("invalid exemption value")
+	ErrNotFound     = errors.New("exemption not found")
+
+	list    = &allowList{}
+	skipped sync.Map // 检查点 -> *int64
+)
+
+type subnet struct {
+	ipNet *net.IPNet
+	entry types.Exemption
+}
+
+type allowList struct {
+	mu       sync.RWMutex
+	writeMu  sync.Mutex // 串行化增删
+	entries  map[string]types.Exemption
+	users    map[string]types.Exemption
+	products map[string]types.Exemption
+	macs     map[string]types.Exemption
+	domains  map[string]types.Exemption
+	subnets  []subnet // 用户IP网段
+	dstNets  []subnet // 目的IP网段
+}
+
+// Setup 从mongo加载豁免名单
+func Setup() error {
+	entries, err := storage.Policies().Exemptions(context.TODO())
+	if err != nil {
+		zap.L().Error("加载豁免名单失败", zap.Error(err))
+		return err
+	}
+	list.rebuild(entries)
+	zap.L().Info("加载豁免名单完成", zap.Int("count", len(entries)))
+
+	go startExpire(time.Minute)
+	return nil
+}
+
+// List 豁免条目列表
+func List() []types.Exemption {
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+
+	result := make([]types.Exemption, 0, len(list.entries))
+	for _, e := range list.entries {
+		result = append(result, e)
+	}
+	return result
+}
+
+// Add 新增或更新豁免条目
+func Add(e types.Exemption) (types.Exemption, error) {
+	value, err := normalize(e.Kind, e.Value)
+	if err != nil {
+		return e, err
+	}
+	e.Value = value
+	list.writeMu.Lock()
+	defer list.writeMu.Unlock()
+
+	if e.ID == "" {
+		e.ID = primitive.NewObjectID().Hex()
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	if err = storage.Policies().SaveExemption(context.TODO(), e); err != nil {
+		zap.L().Error("保存豁免条目失败", zap.Error(err))
+		return e, err
+	}
+
+	entries := list.snapshot()
+	entries[e.ID] = e
+	list.rebuildMap(entries)
+
+	zap.L().Info("新增豁免条目", zap.String("kind", string(e.Kind)), zap.String("value", e.Value), zap.String("reason", e.Reason))
+	return e, nil
+}
+
+// Delete 删除豁免条目
+func Delete(id string) error {
+	list.writeMu.Lock()
+	defer list.writeMu.Unlock()
+
+	entries := list.snapshot()
+	if _, ok := entries[id]; !ok {
+		return ErrNotFound
+	}
+	if err := storage.Policies().DeleteExemption(context.TODO(), id); err != nil {
+		zap.L().Error("删除豁免条目失败", zap.Error(err))
+		return err
+	}
+	delete(entries, id)
+	list.rebuildMap(entries)
+	return nil
+}
+
+// MatchUser 用户是否豁免，依次匹配用户名、产品、IP、MAC
+func MatchUser(user types.User) bool {
+	return MatchUserName(user.UserName) ||
+		MatchProduct(fmt.Sprintf("%d", user.ProductsID)) ||
+		MatchIP(user.IP) ||
+		MatchMac(user.UserMac)
+}
+
+// MatchUserName 用户名是否豁免
+func MatchUserName(username string) bool {
+	if username == "" {
+		return false
+	}
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+	return active(list.users, strings.ToLower(username))
+}
+
+// MatchProduct 产品是否豁免
+func MatchProduct(productID string) bool {
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+	return active(list.products, productID)
+}
+
+// MatchIP 用户IP是否在豁免网段
+func MatchIP(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+	return contains(list.subnets, addr)
+}
+
+// MatchMac MAC是否豁免
+func MatchMac(mac string) bool {
+	// 与存储时一致归一化，兼容 AA-BB-CC-DD-EE-FF 等写法
+	mac, err := normalize(types.ExemptMac, mac)
+	if err != nil {
+		return false
+	}
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+	return active(list.macs, mac)
+}
+
+// MatchDestination 目的域名或IP是否豁免，域名按后缀匹配
+func MatchDestination(dst string) bool {
+	if dst == "" {
+		return false
+	}
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+
+	if addr := net.ParseIP(dst); addr != nil {
+		return contains(list.dstNets, addr)
+	}
+	domain := strings.TrimSuffix(strings.ToLower(dst), ".")
+	for {
+		if active(list.domains, domain) {
+			return true
+		}
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			return false
+		}
+		domain = domain[i+1:]
+	}
+}
+
+// Skip 记录一次跳过
+func Skip(point string) {
+	v, _ := skipped.LoadOrStore(point, new(int64))
+	atomic.AddInt64(v.(*int64), 1)
+}
+
+// Skipped 各检查点跳过次数
+func Skipped() map[string]int64 {
+	result := make(map[string]int64)
+	skipped.Range(func(key, value any) bool {
+		result[key.(string)] = atomic.LoadInt64(value.(*int64))
+		return true
+	})
+	return result
+}
+
+func active(m map[string]types.Exemption, key string) bool {
+	e, ok := m[key]
+	return ok && !expired(e, time.Now())
+}
+
+func contains(nets []subnet, addr net.IP) bool {
+	now := time.Now()
+	for _, n := range nets {
+		if n.ipNet.Contains(addr) && !expired(n.entry, now) {
+			return true
+		}
+	}
+	return false
+}
+
+func expired(e types.Exemption, now time.Time) bool {
+	return !e.ExpireAt.IsZero() && now.After(e.ExpireAt)
+}
+
+// 校验并规范化条目值
+func normalize(kind types.ExemptionKind, value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return "", ErrInvalidValue
+	}
+	switch kind {
+	case types.ExemptUser, types.ExemptProduct:
+		return value, nil
+	case types.ExemptSubnet:
+		if parseNet(value) == nil {
+			return "", ErrInvalidValue
+		}
+		return value, nil
+	case types.ExemptMac:
+		hw, err := net.ParseMAC(value)
+		if err != nil {
+			return "", ErrInvalidValue
+		}
+		return hw.String(), nil
+	case types.ExemptDestination:
+		return strings.TrimSuffix(value, "."), nil
+	default:
+		return "", ErrInvalidKind
+	}
+}
+
+// 解析IP或CIDR
+func parseNet(value string) *net.IPNet {
+	if _, ipNet, err := net.ParseCIDR(value); err == nil {
+		return ipNet
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil
+	}
+	bits := 128
+	if ip.To4() != nil {
+		ip, bits = ip.To4(), 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+}
+
+func (l *allowList) snapshot() map[string]types.Exemption {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	entries := make(map[string]types.Exemption, len(l.entries))
+	for id, e := range l.entries {
+		entries[id] = e
+	}
+	return entries
+}
+
+func (l *allowList) rebuild(entries []types.Exemption) {
+	m := make(map[string]types.Exemption, len(entries))
+	for _, e := range entries {
+		m[e.ID] = e
+	}
+	l.rebuildMap(m)
+}
+
+// 重建索引
+func (l *allowList) rebuildMap(entries map[string]types.Exemption) {
+	users := make(map[string]types.Exemption)
+	products := make(map[string]types.Exemption)
+	macs := make(map[string]types.Exemption)
+	domains := make(map[string]types.Exemption)
+	var subnets, dstNets []subnet
+
+	for _, e := range entries {
+		switch e.Kind {
+		case types.ExemptUser:
+			users[e.Value] = e
+		case types.ExemptProduct:
+			products[e.Value] = e
+		case types.ExemptMac:
+			macs[e.Value] = e
+		case types.ExemptSubnet:
+			if ipNet := parseNet(e.Value); ipNet != nil {
+				subnets = append(subnets, subnet{ipNet: ipNet, entry: e})
+			}
+		case types.ExemptDestination:
+			if ipNet := parseNet(e.Value); ipNet != nil {
+				dstNets = append(dstNets, subnet{ipNet: ipNet, entry: e})
+			} else {
+				domains[e.Value] = e
+			}
+		}
+	}
+
+	l.mu.Lock()
+	l.entries, l.users, l.products, l.macs, l.domains = entries, users, products, macs, domains
+	l.subnets, l.dstNets = subnets, dstNets
+	l.mu.Unlock()
+}
+
+// 定期清理过期条目
+func startExpire(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		list.mu.RLock()
+		var ids []string
+		for id, e := range list.entries {
+			if expired(e, now) {
+				ids = append(ids, id)
+			}
+		}
+		list.mu.RUnlock()
+
+		for _, id := range ids {
+			zap.L().Info("豁免条目已过期", zap.String("id", id))
+			_ = Delete(id)
+		}
+	}
+}
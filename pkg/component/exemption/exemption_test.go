@@ -0,0 +1,26 @@
+package exemption
+
+import (
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"testing"
+)
+
+func TestMatchMac(t *testing.T) {
+	value, err := normalize(types.ExemptMac, "AA-BB-CC-00-11-22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list.rebuild([]types.Exemption{{ID: "mac", Kind: types.ExemptMac, Value: value}})
+	defer list.rebuild(nil)
+
+	for _, mac := range []string{"aa:bb:cc:00:11:22", "AA:BB:CC:00:11:22", "aa-bb-cc-00-11-22", "aabb.cc00.1122", " AA:bb:cc:00:11:22 "} {
+		if !MatchMac(mac) {
+			t.Errorf("%q not matched", mac)
+		}
+	}
+	for _, mac := range []string{"", "aa:bb:cc:00:11:23", "invalid"} {
+		if MatchMac(mac) {
+			t.Errorf("%q matched", mac)
+		}
+	}
+}
@@ -4,14 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/redis"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 	"sync"
-	"time"
 )
 
 var (
@@ -36,6 +33,23 @@ func GetList() []types.Products {
 	return productsList
 }
 
+// Load 使用给定的产品策略初始化，不读写 redis 与 mongo，用于模拟回放
+func Load(products []types.Products) {
+	Policy = &policy{
+		initialized: true,
+		products:    make(map[string]types.Products, len(products)),
+		controls:    make(map[string]types.Controls),
+	}
+	for _, product := range products {
+		Policy.products[product.ProductsID] = product
+	}
+}
+
+// Fetch 只读获取mongo中当前生效的产品策略
+func Fetch() ([]types.Products, error) {
+	return storage.Policies().Products(context.TODO())
+}
+
 func Get(product string) types.Products {
 	return Policy.products[product]
 }
@@ -122,36 +136,16 @@ func (p *policy) load() error {
 }
 
 func (p *policy) searchMongo() error {
-	// 检查集合是否有数据
-	count, err := mongo.GetMongoClient().
-		Database(types.MongoDatabaseConfigs).
-		Collection(types.MongoCollectionPolicy).
-		CountDocuments(mongo.Context, bson.M{})
-	if err != nil {
-		zap.L().Error("Failed to count documents in MongoDB", zap.Error(err))
-		return err
-	}
-
-	if count == 0 {
-		zap.L().Info("MongoDB is empty, storing configurations from Redis")
-		return p.storeMongo() // 持久化 Redis 数据
-	}
-
 	// 获取已有的配置
-	cursor, err := mongo.GetMongoClient().
-		Database(types.MongoDatabaseConfigs).
-		Collection(types.MongoCollectionPolicy).
-		Find(mongo.Context, bson.M{})
+	configs, err := storage.Policies().Products(context.TODO())
 	if err != nil {
 		zap.L().Error("Failed to find documents in MongoDB", zap.Error(err))
 		return err
 	}
 
-	var configs []types.Products
-	err = cursor.All(mongo.Context, &configs)
-	if err != nil {
-		zap.L().Error("Failed to decode MongoDB documents", zap.Error(err))
-		return err
+	if len(configs) == 0 {
+		zap.L().Info("MongoDB is empty, storing configurations from Redis")
+		return p.storeMongo() // 持久化 Redis 数据
 	}
 
 	// 将 MongoDB 的配置更新到内存
@@ -174,9 +168,6 @@ func (p *policy) searchMongo() error {
 }
 
 func (p *policy) storeMongo() error {
-	client := mongo.GetMongoClient()
-	collection := client.Database(types.MongoDatabaseConfigs).Collection(types.MongoCollectionPolicy)
-
 	for _, product := range p.products {
 		if product.ALL == 0 {
 			product.Policy.ALL = 4
@@ -188,16 +179,8 @@ func (p *policy) storeMongo() error {
 			product.Policy.Pc = 2
 		}
 		p.products[product.ProductsID] = product
-		config := product
 
-		filter := bson.M{"_id": product.ProductsID}
-		update := bson.M{
-			"$set":         config,
-			"$setOnInsert": bson.M{"created_at": time.Now()},
-		}
-
-		_, err := collection.UpdateOne(mongo.Context, filter, update, options.Update().SetUpsert(true))
-		if err != nil {
+		if err := storage.Policies().SaveProduct(context.TODO(), product); err != nil {
 			zap.L().Error("Failed to upsert product",
 				zap.String("product_id", product.ProductsID),
 				zap.Error(err))
@@ -216,6 +199,8 @@ func (p *policy) Update(params types.Products) error {
 	product.Pc = params.Pc
 	product.Mobile = params.Mobile
 	product.ALL = params.Pc + params.Mobile
+	product.Classes = params.Classes
+	product.Exclude = params.Exclude
 	p.products[params.ProductsID] = product
 	zap.L().Debug("product updated", zap.Any("product", p.products[params.ProductsID]))
 	return p.storeMongo()
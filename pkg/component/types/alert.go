@@ -0,0 +1,78 @@
+package types
+
+import "time"
+
+// 告警
+
+type AlertType string
+
+const (
+	AlertProxy     AlertType = "proxy"     // 代理判定
+	AlertSuspected AlertType = "suspected" // 疑似代理
+	AlertLicense   AlertType = "license"   // 授权到期
+	AlertCapture   AlertType = "capture"   // 抓包健康
+	AlertTest      AlertType = "test"      // 通道测试
+)
+
+type AlertSeverity string
+
+const (
+	SeverityInfo     AlertSeverity = "info"
+	SeverityWarning  AlertSeverity = "warning"
+	SeverityCritical AlertSeverity = "critical"
+)
+
+// Level 严重程度等级，未知为0
+func (s AlertSeverity) Level() int {
+	switch s {
+	case SeverityInfo:
+		return 1
+	case SeverityWarning:
+		return 2
+	case SeverityCritical:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Alert 告警事件
+type Alert struct {
+	Type        AlertType         `json:"type" bson:"type"`
+	Severity    AlertSeverity     `json:"severity" bson:"severity"`
+	Title       string            `json:"title" bson:"title"`
+	Message     string            `json:"message" bson:"message"`
+	IP          string            `json:"ip,omitempty" bson:"ip,omitempty"`
+	Username    string            `json:"username,omitempty" bson:"username,omitempty"`
+	ProductsID  int               `json:"products_id,omitempty" bson:"products_id,omitempty"`
+	Reason      string            `json:"reason,omitempty" bson:"reason,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty" bson:"labels,omitempty"`
+	Fingerprint string            `json:"fingerprint" bson:"fingerprint"` // 去重标识
+	Channels    []string          `json:"channels,omitempty" bson:"channels,omitempty"`
+	Silenced    bool              `json:"silenced" bson:"silenced"`
+	Time        time.Time         `json:"time" bson:"time"`
+}
+
+// AlertSilence 告警静默，非空条件全部匹配时静默
+type AlertSilence struct {
+	ID        string    `json:"id" bson:"_id"`
+	Type      AlertType `json:"type" bson:"type"`
+	Username  string    `json:"username" bson:"username"`
+	IP        string    `json:"ip" bson:"ip"`
+	Reason    string    `json:"reason" bson:"reason"`
+	Comment   string    `json:"comment" bson:"comment"`
+	StartsAt  time.Time `json:"starts_at" bson:"starts_at"`
+	EndsAt    time.Time `json:"ends_at" bson:"ends_at"` // 零值表示永久
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// Match 是否匹配告警
+func (s AlertSilence) Match(a Alert, now time.Time) bool {
+	if now.Before(s.StartsAt) || (!s.EndsAt.IsZero() && now.After(s.EndsAt)) {
+		return false
+	}
+	return (s.Type == "" || s.Type == a.Type) &&
+		(s.Username == "" || s.Username == a.Username) &&
+		(s.IP == "" || s.IP == a.IP) &&
+		(s.Reason == "" || s.Reason == a.Reason)
+}
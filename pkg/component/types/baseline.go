@@ -0,0 +1,61 @@
+package types
+
+import (
+	"math"
+	"time"
+)
+
+const ReasonBehaviourAnomaly = "behaviour_anomaly"
+
+// Stat 指数加权滑动均值与方差
+type Stat struct {
+	Mean     float64 `json:"mean" bson:"mean"`
+	Variance float64 `json:"variance" bson:"variance"`
+	Samples  int     `json:"samples" bson:"samples"`
+}
+
+// Add 加入样本，首个样本直接作为均值
+func (s *Stat) Add(x, alpha float64) {
+	if s.Samples == 0 {
+		s.Mean, s.Variance, s.Samples = x, 0, 1
+		return
+	}
+	diff := x - s.Mean
+	incr := alpha * diff
+	s.Mean += incr
+	s.Variance = (1 - alpha) * (s.Variance + diff*incr)
+	s.Samples++
+}
+
+// ZScore 样本偏离均值的标准差倍数，标准差过小时以均值的10%且不小于1兜底，避免低频用户误判
+func (s Stat) ZScore(x float64) float64 {
+	std := math.Max(math.Sqrt(s.Variance), math.Max(s.Mean*0.1, 1))
+	return (x - s.Mean) / std
+}
+
+// FeatureBaseline 单个特征类型的基线
+type FeatureBaseline struct {
+	Count    Stat `json:"count" bson:"count"`       // 访问次数
+	Distinct Stat `json:"distinct" bson:"distinct"` // 不同数值数量
+}
+
+// UserBaseline 用户行为基线
+type UserBaseline struct {
+	UserName  string                          `json:"user_name" bson:"_id"`
+	Features  map[FeatureType]FeatureBaseline `json:"features" bson:"features"`
+	Hours     [24]Stat                        `json:"hours" bson:"hours"`     // 各时段总访问次数
+	Devices   map[string]int                  `json:"devices" bson:"devices"` // 设备实体ID与出现次数
+	Samples   int                             `json:"samples" bson:"samples"`
+	UpdatedAt time.Time                       `json:"updated_at" bson:"updated_at"`
+}
+
+// TypicalDevices 常用设备，出现次数不少于样本数的十分之一
+func (b *UserBaseline) TypicalDevices() []string {
+	var ids []string
+	for id, count := range b.Devices {
+		if count*10 >= b.Samples {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -9,8 +9,22 @@ const (
 	MongoDatabaseConfigs    = "config"
 	MongoDatabaseProxy      = "proxy"
 	MongoDatabaseSuspected  = "suspected"
+	MongoDatabaseEnforce    = "enforcement"
+	MongoDatabaseObserver   = "observer"
+	MongoDatabaseAudit      = "audit"
+
+	// 按时间分集合的集合名格式
+	MongoCollectionStreamLayout    = "stream-06-01-02-15" // 按小时
+	MongoCollectionDailyLayout     = "06_01_02"           // 按天
+	MongoCollectionUserAgentLayout = "06_01_02_useragent" // 按天
+	MongoCollectionMonthlyLayout   = "06_01"              // 按月
 
 	MongoCollectionPolicy                      = "policy"
+	MongoCollectionExemption                   = "exemption"
+	MongoCollectionEnforcementState            = "state"
+	MongoCollectionDeviceInventory             = "inventory"
+	MongoCollectionBaseline                    = "baseline"
+	MongoCollectionAlertSilence                = "alert_silence"
 	MongoCollectionConfig                      = "config"
 	MongoCollectionFeatureApplication          = "feature_application"
 	MongoCollectionFeatureApplicationHistory   = "feature_application_history"
@@ -20,4 +34,7 @@ const (
 	MongoCollectionFeatureBrandsKeywordHistory = "feature_brands_keyword_history"
 	MongoCollectionFeatureBrandsRoot           = "feature_brands_root"
 	MongoCollectionFeatureBrandsRootHistory    = "feature_brands_root_history"
+	MongoCollectionFeatureOui                  = "feature_oui"
+	MongoCollectionFeatureOuiHistory           = "feature_oui_history"
+	MongoCollectionRecording                   = "recording"
 )
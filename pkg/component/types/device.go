@@ -3,32 +3,63 @@ package types
 import "time"
 
 type DeviceRecord struct {
-	IP           string    `json:"ip" bson:"ip"`
-	OriginChanel Property  `json:"-" bson:"origin_chanel"`
-	OriginValue  string    `json:"-" bson:"origin_value"`
-	Type         string    `json:"type" bson:"type"`
-	Os           string    `json:"os" bson:"os,omitempty"`
-	Version      string    `json:"version" bson:"version,omitempty"`
-	Device       string    `json:"device" bson:"device,omitempty"`
-	Brand        string    `json:"brand" bson:"brand,omitempty"`
-	Model        string    `json:"model" bson:"model,omitempty"`
-	Icon         string    `json:"icon" bson:"icon,omitempty"`
-	Description  string    `json:"description" bson:"description,omitempty"`
-	Remark       string    `json:"remark" bson:"remark,omitempty"`
-	LastSeen     time.Time `json:"-" bson:"last_seen,omitempty"`
+	IP           string      `json:"ip" bson:"ip"`
+	OriginChanel Property    `json:"-" bson:"origin_chanel"`
+	OriginValue  string      `json:"-" bson:"origin_value"`
+	Type         string      `json:"type" bson:"type"`
+	Class        DeviceClass `json:"class" bson:"class,omitempty"`
+	Os           string      `json:"os" bson:"os,omitempty"`
+	Version      string      `json:"version" bson:"version,omitempty"`
+	Device       string      `json:"device" bson:"device,omitempty"`
+	Brand        string      `json:"brand" bson:"brand,omitempty"`
+	Model        string      `json:"model" bson:"model,omitempty"`
+	Icon         string      `json:"icon" bson:"icon,omitempty"`
+	Description  string      `json:"description" bson:"description,omitempty"`
+	Remark       string      `json:"remark" bson:"remark,omitempty"`
+	LastSeen     time.Time   `json:"-" bson:"last_seen,omitempty"`
 }
 
 type DeviceRecordByFront struct {
-	IP           string    `json:"ip" bson:"ip"`
-	OriginChanel Property  `json:"origin_chanel" bson:"origin_chanel"`
-	OriginValue  string    `json:"origin_value" bson:"origin_value"`
-	Os           string    `json:"os" bson:"os,omitempty"`
-	Version      string    `json:"version" bson:"version,omitempty"`
-	Device       string    `json:"device" bson:"device,omitempty"`
-	Brand        string    `json:"brand" bson:"brand,omitempty"`
-	Model        string    `json:"model" bson:"model,omitempty"`
-	Icon         string    `json:"icon" bson:"icon,omitempty"`
-	Description  string    `json:"description" bson:"description,omitempty"`
-	Remark       string    `json:"remark" bson:"remark,omitempty"`
-	LastSeen     time.Time `json:"last_seen" bson:"last_seen,omitempty"`
+	IP           string      `json:"ip" bson:"ip"`
+	OriginChanel Property    `json:"origin_chanel" bson:"origin_chanel"`
+	OriginValue  string      `json:"origin_value" bson:"origin_value"`
+	Class        DeviceClass `json:"class" bson:"class,omitempty"`
+	Os           string      `json:"os" bson:"os,omitempty"`
+	Version      string      `json:"version" bson:"version,omitempty"`
+	Device       string      `json:"device" bson:"device,omitempty"`
+	Brand        string      `json:"brand" bson:"brand,omitempty"`
+	Model        string      `json:"model" bson:"model,omitempty"`
+	Icon         string      `json:"icon" bson:"icon,omitempty"`
+	Description  string      `json:"description" bson:"description,omitempty"`
+	Remark       string      `json:"remark" bson:"remark,omitempty"`
+	LastSeen     time.Time   `json:"last_seen" bson:"last_seen,omitempty"`
+}
+
+// DeviceClass 设备类别
+type DeviceClass string
+
+const (
+	ClassUnknown DeviceClass = ""
+	ClassPhone   DeviceClass = "phone"   // 手机
+	ClassTablet  DeviceClass = "tablet"  // 平板
+	ClassPC      DeviceClass = "pc"      // 台式机
+	ClassLaptop  DeviceClass = "laptop"  // 笔记本
+	ClassTV      DeviceClass = "tv"      // 智能电视/机顶盒
+	ClassConsole DeviceClass = "console" // 游戏主机
+	ClassIoT     DeviceClass = "iot"     // 物联网设备
+	ClassPrinter DeviceClass = "printer" // 打印机
+	ClassNetwork DeviceClass = "network" // 网络设备
+)
+
+// DeviceClasses 全部设备类别
+var DeviceClasses = []DeviceClass{ClassPhone, ClassTablet, ClassPC, ClassLaptop, ClassTV, ClassConsole, ClassIoT, ClassPrinter, ClassNetwork}
+
+// IsMobile 是否为移动设备
+func (c DeviceClass) IsMobile() bool {
+	return c == ClassPhone || c == ClassTablet
+}
+
+// IsPc 是否为电脑
+func (c DeviceClass) IsPc() bool {
+	return c == ClassPC || c == ClassLaptop
 }
@@ -0,0 +1,57 @@
+package types
+
+import "time"
+
+// 处置阶梯
+
+type EnforcementLevel int
+
+const (
+	LevelNone     EnforcementLevel = iota // 无处置
+	LevelWarn                             // 警告
+	LevelDisable                          // 临时禁用
+	LevelEscalate                         // 升级处置，需人工解除
+)
+
+const (
+	ActionWarn     = "warn"
+	ActionDisable  = "disable"
+	ActionEscalate = "escalate"
+	ActionRelease  = "release"
+	ActionReset    = "reset"
+	ActionReapply  = "reapply"
+)
+
+// EnforcementState 用户处置状态
+type EnforcementState struct {
+	UserName      string             `json:"user_name" bson:"_id"`
+	Level         EnforcementLevel   `json:"level" bson:"level"`
+	Offences      []time.Time        `json:"offences" bson:"offences"`             // 窗口内违规时间
+	TotalOffences int                `json:"total_offences" bson:"total_offences"` // 累计违规次数
+	Disables      int                `json:"disables" bson:"disables"`             // 禁用次数，人工重置时清零
+	DisabledUntil time.Time          `json:"disabled_until" bson:"disabled_until"` // 禁用截止时间
+	LastAction    string             `json:"last_action" bson:"last_action"`
+	LastSeen      time.Time          `json:"last_seen" bson:"last_seen"`
+	Events        []EnforcementEvent `json:"events" bson:"events"`
+}
+
+// EnforcementEvent 处置记录
+type EnforcementEvent struct {
+	Time     time.Time `json:"time" bson:"time"`
+	Action   string    `json:"action" bson:"action"`
+	IP       string    `json:"ip" bson:"ip"`
+	Offences int       `json:"offences" bson:"offences"`
+	Remark   string    `json:"remark" bson:"remark"`
+	// 下发结果
+	Results []EnforcementResult `json:"results,omitempty" bson:"results,omitempty"`
+}
+
+// EnforcementResult 处置动作执行结果
+type EnforcementResult struct {
+	Time    time.Time `json:"time" bson:"time"`
+	Action  string    `json:"action" bson:"action"` // 动作名称
+	Type    string    `json:"type" bson:"type"`
+	Success bool      `json:"success" bson:"success"`
+	Detail  string    `json:"detail,omitempty" bson:"detail,omitempty"`
+	Error   string    `json:"error,omitempty" bson:"error,omitempty"`
+}
@@ -0,0 +1,25 @@
+package types
+
+import "time"
+
+// 豁免名单
+
+type ExemptionKind string
+
+const (
+	ExemptUser        ExemptionKind = "user"        // 用户名
+	ExemptProduct     ExemptionKind = "product"     // 产品ID
+	ExemptSubnet      ExemptionKind = "subnet"      // IP或网段
+	ExemptMac         ExemptionKind = "mac"         // MAC地址
+	ExemptDestination ExemptionKind = "destination" // 目的域名、IP或网段
+)
+
+// Exemption 豁免条目
+type Exemption struct {
+	ID        string        `json:"id" bson:"_id"`
+	Kind      ExemptionKind `json:"kind" bson:"kind"`
+	Value     string        `json:"value" bson:"value"`
+	Reason    string        `json:"reason" bson:"reason"`
+	ExpireAt  time.Time     `json:"expire_at" bson:"expire_at"` // 零值表示永久
+	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+}
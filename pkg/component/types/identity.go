@@ -0,0 +1,110 @@
+package types
+
+import "time"
+
+// 设备实体模型
+// 多渠道观测(UA、DNS品牌、TTL、mDNS、DHCP、MAC)合并为具有稳定ID的设备
+
+const (
+	DHCPProperty Property = "dhcp"
+	MDNSProperty Property = "mdns"
+)
+
+// 设备属性名
+const (
+	AttrOs      = "os"
+	AttrVersion = "version"
+	AttrDevice  = "device"
+	AttrBrand   = "brand"
+	AttrModel   = "model"
+	AttrName    = "name"
+	AttrType    = "type"
+	AttrVendor  = "vendor"
+	AttrIcon    = "icon"
+	AttrClass   = "class"
+)
+
+// 设备关联键前缀
+const (
+	KeyMac         = "mac:"  // MAC地址
+	KeyDHCPClient  = "dhcp:" // DHCP client identifier
+	KeyFingerprint = "fp:"   // 指纹
+	KeyDUID        = "duid:" // DHCPv6 DUID
+)
+
+// IPv6 地址关联来源，按可信度从高到低
+const (
+	LinkEUI64  = "eui64"   // 接口标识由MAC生成
+	LinkDHCPv6 = "dhcpv6"  // DHCPv6 分配地址与 DUID
+	LinkNDP    = "ndp"     // NS/NA/RS 链路层地址选项
+	LinkSrcMac = "src_mac" // 报文源MAC
+)
+
+// IPv6Link IPv6 地址与设备的关联
+type IPv6Link struct {
+	Address   string    `json:"address"`
+	Anchor    string    `json:"anchor"`    // 设备锚点 mac:<mac> 或 duid:<hex>
+	Canonical string    `json:"canonical"` // 同一设备各地址共用的状态键
+	Mac       string    `json:"mac,omitempty"`
+	DUID      string    `json:"duid,omitempty"`
+	Source    string    `json:"source"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// DeviceObservation 单次设备观测
+type DeviceObservation struct {
+	IP          string            `json:"ip"`
+	Mac         string            `json:"mac"`
+	Source      Property          `json:"source"`
+	OriginValue string            `json:"origin_value"`
+	Keys        []string          `json:"keys"`       // 强关联键，如 DHCP client id
+	Attributes  map[string]string `json:"attributes"` // 属性名 -> 值
+	Time        time.Time         `json:"time"`
+}
+
+// DeviceAttribute 设备属性，记录置信度与来源
+type DeviceAttribute struct {
+	Value       string    `json:"value" bson:"value"`
+	Confidence  float64   `json:"confidence" bson:"confidence"`
+	Source      Property  `json:"source" bson:"source"`
+	OriginValue string    `json:"origin_value" bson:"origin_value"`
+	LastSeen    time.Time `json:"last_seen" bson:"last_seen"`
+}
+
+// DeviceBinding 设备与IP/用户的绑定历史
+type DeviceBinding struct {
+	IP        string    `json:"ip" bson:"ip"`
+	UserName  string    `json:"user_name" bson:"user_name"`
+	FirstSeen time.Time `json:"first_seen" bson:"first_seen"`
+	LastSeen  time.Time `json:"last_seen" bson:"last_seen"`
+}
+
+// DeviceChange 设备属性变化记录
+type DeviceChange struct {
+	Time       time.Time `json:"time" bson:"time"`
+	Attribute  string    `json:"attribute" bson:"attribute"`
+	Value      string    `json:"value" bson:"value"`
+	Source     Property  `json:"source" bson:"source"`
+	Confidence float64   `json:"confidence" bson:"confidence"`
+	IP         string    `json:"ip" bson:"ip"`
+}
+
+// DeviceIdentity 设备实体
+type DeviceIdentity struct {
+	ID         string                     `json:"id" bson:"_id"`
+	Keys       []string                   `json:"keys" bson:"keys"`
+	Attributes map[string]DeviceAttribute `json:"attributes" bson:"attributes"`
+	IP         string                     `json:"ip" bson:"ip"`
+	UserName   string                     `json:"user_name" bson:"user_name"`
+	Mac        string                     `json:"mac" bson:"mac"`
+	FirstSeen  time.Time                  `json:"first_seen" bson:"first_seen"`
+	LastSeen   time.Time                  `json:"last_seen" bson:"last_seen"`
+	Bindings   []DeviceBinding            `json:"bindings" bson:"bindings"`
+	Changes    []DeviceChange             `json:"changes" bson:"changes"`
+}
+
+// Attr 获取属性值
+func (d *DeviceIdentity) Attr(name string) string {
+	return d.Attributes[name].Value
+}
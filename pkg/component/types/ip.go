@@ -7,6 +7,7 @@ type Property string
 const (
 	TTL         Property = "ttl"
 	Mac         Property = "mac"
+	RandomMac   Property = "random_mac"
 	UserAgent   Property = "user_agent"
 	Device      Property = "device"
 	DNSProperty Property = "dns"
@@ -48,3 +49,12 @@ type TrafficRecord struct {
 	FeatureData map[string]int `bson:"feature_data" json:"feature_data"`
 	CreateAt    time.Time      `bson:"create_at" json:"create_at"`
 }
+
+// PropertyChange IP属性变化
+type PropertyChange struct {
+	IP       string
+	Mac      string // 变化时IP对应的MAC
+	Property Property
+	OldValue any
+	NewValue any
+}
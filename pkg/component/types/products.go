@@ -16,7 +16,53 @@ type Controls struct {
 }
 
 type Policy struct {
-	ALL    int `json:"all" bson:"all"`
-	Mobile int `json:"mobile" bson:"mobile"`
-	Pc     int `json:"pc" bson:"pc"`
+	ALL     int                 `json:"all" bson:"all"`
+	Mobile  int                 `json:"mobile" bson:"mobile"`
+	Pc      int                 `json:"pc" bson:"pc"`
+	Classes map[DeviceClass]int `json:"classes" bson:"classes,omitempty"` // 各类别设备数量上限，0为不限制
+	Exclude []DeviceClass       `json:"exclude" bson:"exclude"`           // 不计入数量的类别，为空时使用默认
+}
+
+// DefaultExcludeClasses 默认不计入数量的设备类别
+var DefaultExcludeClasses = []DeviceClass{ClassIoT, ClassPrinter}
+
+// Excluded 类别是否不计入数量
+func (p Policy) Excluded(class DeviceClass) bool {
+	exclude := p.Exclude
+	if exclude == nil {
+		exclude = DefaultExcludeClasses
+	}
+	for _, c := range exclude {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Count 按类别数量计算总数、移动设备数与电脑数，排除的类别不计入
+func (p Policy) Count(classes map[DeviceClass]int) (all, mobile, pc int) {
+	for class, n := range classes {
+		if p.Excluded(class) {
+			continue
+		}
+		all += n
+		if class.IsMobile() {
+			mobile += n
+		} else if class.IsPc() {
+			pc += n
+		}
+	}
+	return
+}
+
+// Exceeded 返回达到上限的类别
+func (p Policy) Exceeded(classes map[DeviceClass]int) []DeviceClass {
+	var result []DeviceClass
+	for _, class := range DeviceClasses {
+		if limit := p.Classes[class]; limit > 0 && classes[class] >= limit {
+			result = append(result, class)
+		}
+	}
+	return result
 }
@@ -6,14 +6,16 @@ import (
 )
 
 type ProxyRecord struct {
-	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	IP          string             `json:"ip" bson:"ip"`
-	Username    string             `json:"username" bson:"username"`
-	Devices     []DeviceRecord     `json:"devices" bson:"devices"`
-	AllCount    int                `json:"all_count" bson:"all_count"`
-	MobileCount int                `json:"mobile_count" bson:"mobile_count"`
-	PcCount     int                `json:"pc_count" bson:"pc_count"`
-	LastSeen    time.Time          `json:"last_seen" bson:"last_seen"`
+	ID          primitive.ObjectID  `json:"_id,omitempty" bson:"_id,omitempty"`
+	IP          string              `json:"ip" bson:"ip"`
+	Username    string              `json:"username" bson:"username"`
+	Devices     []DeviceRecord      `json:"devices" bson:"devices"`
+	AllCount    int                 `json:"all_count" bson:"all_count"`
+	MobileCount int                 `json:"mobile_count" bson:"mobile_count"`
+	PcCount     int                 `json:"pc_count" bson:"pc_count"`
+	ClassCount  map[DeviceClass]int `json:"class_count" bson:"class_count,omitempty"` // 各类别活跃设备数
+	Action      string              `json:"action" bson:"action,omitempty"`           // 处置动作
+	LastSeen    time.Time           `json:"last_seen" bson:"last_seen"`
 }
 
 type SuspectedRecord struct {
@@ -25,6 +27,7 @@ type SuspectedRecord struct {
 	Tags           []string           `json:"tags" bson:"tags"`
 	Context        Context            `json:"context" bson:"context"`
 	Remark         string             `json:"remark" bson:"remark"`
+	Baseline       *UserBaseline      `json:"baseline,omitempty" bson:"baseline,omitempty"` // 行为偏离时的用户基线
 	LastSeen       time.Time          `json:"last_seen" bson:"last_seen"`
 }
 
@@ -0,0 +1,77 @@
+package types
+
+import "time"
+
+// RecordTarget 定向录制目标类型
+type RecordTarget string
+
+const (
+	RecordUser RecordTarget = "user" // 用户名，按用户当前的 IPv4、IPv6 地址匹配
+	RecordIP   RecordTarget = "ip"   // 源或目的 IP
+	RecordMac  RecordTarget = "mac"  // 源或目的 MAC
+)
+
+// 录制状态
+const (
+	RecordRunning     = "running"
+	RecordDone        = "done"
+	RecordFailed      = "failed"
+	RecordInterrupted = "interrupted" // 进程异常退出，文件可能不完整
+	RecordDeleted     = "deleted"     // 文件已删除
+)
+
+// 录制结束原因
+const (
+	RecordReasonDuration = "duration" // 达到时长
+	RecordReasonBytes    = "bytes"    // 达到字节上限
+	RecordReasonQuota    = "quota"    // 磁盘配额已满
+	RecordReasonStopped  = "stopped"  // 手动停止
+	RecordReasonShutdown = "shutdown" // 抓包进程退出
+	RecordReasonError    = "error"    // 写入失败
+)
+
+// RecordRequest 发起录制
+type RecordRequest struct {
+	Target   RecordTarget `json:"target" binding:"required"`
+	Value    string       `json:"value" binding:"required"`
+	Duration int          `json:"duration"`  // 录制时长(秒)，为0时使用默认值
+	MaxBytes int64        `json:"max_bytes"` // 字节上限，为0时不限制
+	Remark   string       `json:"remark"`
+	Operator string       `json:"operator"`
+}
+
+// RecordFile 录制文件
+type RecordFile struct {
+	Name    string `json:"name" bson:"name"`
+	Size    int64  `json:"size" bson:"size"`
+	Packets int64  `json:"packets" bson:"packets"`
+}
+
+// RecordEvent 录制审计事件
+type RecordEvent struct {
+	Action   string    `json:"action" bson:"action"` // start stop download delete
+	Operator string    `json:"operator" bson:"operator"`
+	Detail   string    `json:"detail,omitempty" bson:"detail,omitempty"`
+	Time     time.Time `json:"time" bson:"time"`
+}
+
+// Recording 定向录制，同时作为审计记录保存在 audit.recording 集合
+type Recording struct {
+	ID        string        `json:"id" bson:"_id"`
+	Target    RecordTarget  `json:"target" bson:"target"`
+	Value     string        `json:"value" bson:"value"`
+	Duration  int           `json:"duration" bson:"duration"`
+	MaxBytes  int64         `json:"max_bytes" bson:"max_bytes"`
+	Remark    string        `json:"remark" bson:"remark"`
+	Operator  string        `json:"operator" bson:"operator"`
+	Status    string        `json:"status" bson:"status"`
+	Reason    string        `json:"reason,omitempty" bson:"reason,omitempty"`
+	Error     string        `json:"error,omitempty" bson:"error,omitempty"`
+	Packets   int64         `json:"packets" bson:"packets"`
+	Bytes     int64         `json:"bytes" bson:"bytes"`
+	Dropped   int64         `json:"dropped" bson:"dropped"` // 写入队列已满丢弃的包数
+	Files     []RecordFile  `json:"files" bson:"files"`
+	Events    []RecordEvent `json:"events" bson:"events"`
+	StartTime time.Time     `json:"start_time" bson:"start_time"`
+	EndTime   time.Time     `json:"end_time" bson:"end_time"`
+}
@@ -21,15 +21,17 @@ const (
 	ZSetObserverMac    = "z_set:observer:mac"
 	ZSetObserverUa     = "z_set:observer:ua"
 	ZSetObserverDevice = "z_set:observer:device"
+	ZSetObserverRandom = "z_set:observer:random_mac"
 	ZSetOnlineUsers    = "z_set:online:users"
 	ZSetRealtimeShored = "z_set:realtime:shored"
 	HashAnalyzeIP      = "hash:analyze:ip:%s"
 	SetIPDevices       = "set:ip:devices:%s"
+	ZSetIPDevices      = "z_set:ip:devices:%s"
 	KeyDiscoverIP      = "key:discover:ip:%s"
 	KeyDevicesAllIP    = "key:devices:all:ip:%s"
 	KeyDevicesMobileIP = "key:devices:mobile:ip:%s"
 	KeyDevicesPcIP     = "key:devices:pc:ip:%s"
-	LockIPBrand        = "lock:%s:%s"
+	KeyStateEpoch      = "key:state:epoch" // IP 状态写回标记，丢失时全量重同步
 
 	ListProducts        = "list:products"
 	ListControl         = "list:control"
@@ -10,20 +10,25 @@ const (
 )
 
 type User struct {
-	RadOnlineID int    `redis:"rad_online_id" json:"rad_online_id"`
-	UserName    string `redis:"user_name" json:"user_name"`
-	IP          string `redis:"ip" json:"ip"`
-	UserMac     string `redis:"user_mac" json:"user_mac"`
-	LineType    int    `redis:"line_type" json:"line_type"`
-	AddTime     int    `redis:"add_time" json:"add_time"`
-	ProductsID  int    `redis:"products_id" json:"products_id"`
-	BillingID   int    `redis:"billing_id" json:"billing_id"`
-	ContractID  int    `redis:"contract_id" json:"contract_id"`
+	RadOnlineID int      `redis:"rad_online_id" json:"rad_online_id"`
+	UserName    string   `redis:"user_name" json:"user_name"`
+	IP          string   `redis:"ip" json:"ip"`
+	UserMac     string   `redis:"user_mac" json:"user_mac"`
+	LineType    int      `redis:"line_type" json:"line_type"`
+	AddTime     int      `redis:"add_time" json:"add_time"`
+	ProductsID  int      `redis:"products_id" json:"products_id"`
+	BillingID   int      `redis:"billing_id" json:"billing_id"`
+	ContractID  int      `redis:"contract_id" json:"contract_id"`
+	Source      string   `redis:"-" json:"source,omitempty"`     // 用户来源名称
+	SessionID   string   `redis:"-" json:"session_id,omitempty"` // 计费会话ID，RADIUS 处置使用
+	NasIP       string   `redis:"-" json:"nas_ip,omitempty"`
+	IP6         []string `redis:"-" json:"ip6,omitempty"` // IPv6 地址或委派前缀
 }
 
 type UserEvent struct {
 	ID              primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
 	Action          int                `json:"action" bson:"action,omitempty"`
+	Origin          string             `json:"origin,omitempty" bson:"origin,omitempty"` // 事件来源，对账补记为 reconcile，其余为用户来源名称
 	SessionId       string             `json:"session_id" bson:"session_id,omitempty"`
 	NasIp           string             `json:"nas_ip" bson:"nas_ip,omitempty"`
 	NasIp1          string             `json:"nas_ip1" bson:"nas_ip1,omitempty"`
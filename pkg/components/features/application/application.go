@@ -2,7 +2,6 @@ package application
 
 import (
 	"embed"
-	mongodb "github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/loader"
@@ -31,7 +30,6 @@ func Setup() error {
 		Filename: "feature2.0_cn_24.10.14-plus.cfg",
 	}
 	LoaderManger.Mongo = &loader.MongoLoader{
-		Client:             mongodb.GetMongoClient(),
 		MetadataCollection: types.MongoCollectionFeatureApplication,
 		HistoryCollection:  types.MongoCollectionFeatureApplicationHistory,
 		Database:           types.MongoDatabaseConfigs,
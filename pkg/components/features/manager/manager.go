@@ -1,7 +1,6 @@
 package manager
 
 import (
-	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/loader"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/matcher"
 	"go.uber.org/zap"
@@ -31,7 +30,6 @@ func NewManager(config Config) *Manager {
 	return &Manager{
 		Loader: &loader.Manager{
 			Mongo: &loader.MongoLoader{
-				Client:             mongo.GetMongoClient(),
 				MetadataCollection: config.CollectionName,
 				HistoryCollection:  config.HistoryCollectionName,
 				Database:           config.DatabaseName,
@@ -68,6 +66,10 @@ func (m *Manager) Setup() error {
 
 // Match 匹配输入字符串
 func (m *Manager) Match(input string) (ok bool, result interface{}) {
+	// 未加载成功时不匹配
+	if m.MatcherInstance == nil {
+		return false, nil
+	}
 	hits := m.MatcherInstance.Match(input)
 	if len(hits) == 0 {
 		return false, nil
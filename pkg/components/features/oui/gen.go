@@ -0,0 +1,135 @@
+//go:build ignore
+
+// 生成内置 MAC 厂商库 oui.csv
+// 默认从 IEEE 下载 MA-L、MA-M、MA-S 三个注册表合并；无法访问 IEEE 时使用 -gopacket 以
+// gopacket/macs 中内置的 MA-L 注册表为基础，-in 指定的本地 IEEE 格式文件按顺序覆盖前面的来源
+//
+//	go run gen.go
+//	go run gen.go -ieee=false -gopacket -in oui.csv
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"github.com/google/gopacket/macs"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ieee = []string{
+	"https://standards-oui.ieee.org/oui/oui.csv",
+	"https://standards-oui.ieee.org/oui28/mam.csv",
+	"https://standards-oui.ieee.org/oui36/oui36.csv",
+}
+
+var sizes = map[string]int{"MA-L": 6, "MA-M": 7, "MA-S": 9}
+
+type row struct {
+	registry, assignment, organization string
+}
+
+func main() {
+	var inputs []string
+	useIEEE := flag.Bool("ieee", true, "download registries from IEEE")
+	useGopacket := flag.Bool("gopacket", false, "use MA-L registry bundled in gopacket/macs as base")
+	out := flag.String("out", "oui.csv", "output file")
+	flag.Func("in", "local IEEE csv file, may be repeated", func(s string) error {
+		inputs = append(inputs, s)
+		return nil
+	})
+	flag.Parse()
+
+	rows := make(map[string]row)
+	var sources []string
+	if *useGopacket {
+		for prefix, org := range macs.ValidMACPrefixMap {
+			a := fmt.Sprintf("%02X%02X%02X", prefix[0], prefix[1], prefix[2])
+			rows[a] = row{"MA-L", a, strings.TrimSpace(org)}
+		}
+		sources = append(sources, "gopacket/macs")
+	}
+	if *useIEEE {
+		client := &http.Client{Timeout: time.Minute}
+		for _, url := range ieee {
+			resp, err := client.Get(url)
+			if err != nil {
+				log.Fatalf("download %s: %v", url, err)
+			}
+			data, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil || resp.StatusCode != http.StatusOK {
+				log.Fatalf("download %s: status %d %v", url, resp.StatusCode, err)
+			}
+			merge(rows, data, url)
+			sources = append(sources, url)
+		}
+	}
+	// 先读取全部输入，输出文件可以同时作为输入
+	var local [][]byte
+	for _, in := range inputs {
+		data, err := os.ReadFile(in)
+		if err != nil {
+			log.Fatal(err)
+		}
+		local = append(local, data)
+		sources = append(sources, in)
+	}
+	for i, data := range local {
+		merge(rows, data, inputs[i])
+	}
+	if len(rows) == 0 {
+		log.Fatal("no oui record, use -ieee, -gopacket or -in")
+	}
+
+	list := make([]row, 0, len(rows))
+	for _, r := range rows {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].assignment < list[j].assignment })
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# version %s 由 gen.go 生成，来源: %s\n", time.Now().Format("v06.01.02"), strings.Join(sources, ", "))
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"Registry", "Assignment", "Organization Name", "Organization Address"})
+	for _, r := range list {
+		_ = w.Write([]string{r.registry, r.assignment, r.organization, ""})
+	}
+	w.Flush()
+	if err := os.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d records to %s", len(list), *out)
+}
+
+func merge(rows map[string]row, data []byte, name string) {
+	var lines [][]byte
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 && !bytes.HasPrefix(line, []byte("#")) {
+			lines = append(lines, line)
+		}
+	}
+	reader := csv.NewReader(bytes.NewReader(bytes.Join(lines, []byte("\n"))))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		log.Fatalf("parse %s: %v", name, err)
+	}
+	for _, record := range records {
+		if len(record) < 3 {
+			continue
+		}
+		registry := strings.TrimSpace(record[0])
+		a := strings.ToUpper(strings.TrimSpace(record[1]))
+		if size, ok := sizes[registry]; ok && len(a) == size {
+			rows[a] = row{registry, a, strings.TrimSpace(record[2])}
+		}
+	}
+}
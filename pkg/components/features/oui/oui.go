@@ -0,0 +1,200 @@
+package oui
+
+import (
+	"bytes"
+	"embed"
+	"encoding/csv"
+	"errors"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/loader"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// MAC 厂商库
+// 数据格式与 IEEE 发布的 oui.csv/mam.csv/mas.csv 一致，按 MA-S -> MA-M -> MA-L 最长前缀匹配。
+// 内置的 oui.csv 由 gen.go 生成，当前仅含 gopacket/macs 中的 MA-L 注册表；
+// 可访问 IEEE 时执行 go generate 合并 MA-M、MA-S，或通过 Update 导入 IEEE 发布的 csv
+
+//go:generate go run gen.go
+
+var (
+	//go:embed oui.csv
+	feature      embed.FS
+	LoaderManger = loader.Manager{}
+	Vendors      = make(map[string]Vendor) // 前缀 -> 厂商
+	mutex        sync.RWMutex
+)
+
+// 各注册类型的前缀长度(十六进制位数)
+var registries = map[string]int{
+	"MA-L": 6,
+	"MA-M": 7,
+	"MA-S": 9,
+}
+
+// Vendor 厂商
+type Vendor struct {
+	Registry     string `json:"registry"`
+	Assignment   string `json:"assignment"`
+	Organization string `json:"organization"`
+}
+
+func Setup() error {
+	LoaderManger.Embed = &loader.EmbedLoader{
+		Fs:       feature,
+		Filename: "oui.csv",
+	}
+	LoaderManger.Mongo = &loader.MongoLoader{
+		MetadataCollection: types.MongoCollectionFeatureOui,
+		HistoryCollection:  types.MongoCollectionFeatureOuiHistory,
+		Database:           types.MongoDatabaseConfigs,
+	}
+	data, err := LoaderManger.Load()
+	if err != nil {
+		return err
+	}
+	vendors, err := Parse(data)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	Vendors = vendors
+	mutex.Unlock()
+	zap.L().Info("Initialized oui vendors", zap.Int("count", len(vendors)))
+	return nil
+}
+
+// Parse 解析 IEEE csv，忽略注释行与重复的表头
+func Parse(data []byte) (map[string]Vendor, error) {
+	var lines [][]byte
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 || bytes.HasPrefix(line, []byte("#")) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	reader := csv.NewReader(bytes.NewReader(bytes.Join(lines, []byte("\n"))))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	vendors := make(map[string]Vendor)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			continue
+		}
+		registry := strings.TrimSpace(record[0])
+		size, ok := registries[registry]
+		assignment := strings.ToUpper(strings.TrimSpace(record[1]))
+		if !ok || len(assignment) != size {
+			continue
+		}
+		vendors[assignment] = Vendor{
+			Registry:     registry,
+			Assignment:   assignment,
+			Organization: strings.TrimSpace(record[2]),
+		}
+	}
+	if len(vendors) == 0 {
+		return nil, errors.New("no oui record found")
+	}
+	return vendors, nil
+}
+
+// Update 更新
+func Update(filepath string) error {
+	file, err := os.ReadFile(filepath)
+	if err != nil {
+		zap.L().Error("Failed to open oui file", zap.String("file", filepath), zap.Error(err))
+		return err
+	}
+	vendors, err := Parse(file)
+	if err != nil {
+		zap.L().Error("Failed to parse oui file", zap.String("file", filepath), zap.Error(err))
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	err = LoaderManger.Mongo.Save(file, len(Vendors)-len(vendors))
+	if err != nil {
+		zap.L().Error("Failed to save oui file", zap.String("file", filepath), zap.Error(err))
+		return err
+	}
+	Vendors = vendors
+	return nil
+}
+
+// Lookup 查找MAC所属厂商
+func Lookup(mac string) (Vendor, bool) {
+	hex := normalize(mac)
+	if len(hex) != 12 {
+		return Vendor{}, false
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	for _, size := range []int{9, 7, 6} {
+		if v, ok := Vendors[hex[:size]]; ok {
+			return v, true
+		}
+	}
+	return Vendor{}, false
+}
+
+// IsRandomized 是否为本地管理地址(随机MAC)
+// 第一个字节的 bit1 为本地管理位，bit0 为组播位
+func IsRandomized(mac string) bool {
+	hex := normalize(mac)
+	if len(hex) != 12 {
+		return false
+	}
+	var b byte
+	for _, c := range hex[:2] {
+		b <<= 4
+		switch {
+		case c >= '0' && c <= '9':
+			b |= byte(c - '0')
+		case c >= 'A' && c <= 'F':
+			b |= byte(c-'A') + 10
+		}
+	}
+	return b&0x02 != 0 && b&0x01 == 0
+}
+
+// Brand 厂商名转换为品牌标识，如 "Apple, Inc." -> "apple"
+func (v Vendor) Brand() string {
+	name := strings.ToLower(v.Organization)
+	if i := strings.IndexAny(name, " ,."); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// 去除分隔符并转为大写
+func normalize(mac string) string {
+	var sb strings.Builder
+	for _, c := range mac {
+		switch {
+		case c >= '0' && c <= '9', c >= 'A' && c <= 'F':
+			sb.WriteRune(c)
+		case c >= 'a' && c <= 'f':
+			sb.WriteRune(c - 'a' + 'A')
+		case c == ':' || c == '-' || c == '.':
+		default:
+			return ""
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,49 @@
+package oui
+
+import "testing"
+
+// IEEE 三个注册表合并后按最长前缀匹配
+const registry = `Registry,Assignment,Organization Name,Organization Address
+MA-L,70B3D5,IEEE Registration Authority,"445 Hoes Lane Piscataway NJ US 08554 "
+MA-M,70B3D51,"Large Block, Inc.",Somewhere
+MA-S,70B3D5123,Small Block Ltd,Somewhere
+MA-L,001122,CIMSYS Inc,Somewhere
+Registry,Assignment,Organization Name,Organization Address
+MA-M,0011223,CIMSYS Block,Somewhere
+MA-S,70B3D512,wrong size,Somewhere
+`
+
+func TestLookupLongestPrefix(t *testing.T) {
+	vendors, err := Parse([]byte("# header comment\n" + registry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vendors) != 5 {
+		t.Fatalf("parsed %d vendors", len(vendors))
+	}
+	saved := Vendors
+	Vendors = vendors
+	defer func() { Vendors = saved }()
+
+	cases := []struct {
+		mac, registry, organization string
+	}{
+		{"70:b3:d5:12:34:56", "MA-S", "Small Block Ltd"},
+		{"70-B3-D5-1F-00-00", "MA-M", "Large Block, Inc."},
+		{"70b3.d520.0000", "MA-L", "IEEE Registration Authority"},
+		{"00:11:22:33:44:55", "MA-M", "CIMSYS Block"},
+		{"00:11:22:43:44:55", "MA-L", "CIMSYS Inc"},
+	}
+	for _, c := range cases {
+		v, ok := Lookup(c.mac)
+		if !ok || v.Registry != c.registry || v.Organization != c.organization {
+			t.Errorf("%s = %+v %v, want %s %s", c.mac, v, ok, c.registry, c.organization)
+		}
+	}
+	if _, ok := Lookup("00:00:00:00:00:01"); ok {
+		t.Error("unknown prefix matched")
+	}
+	if _, ok := Lookup("70:b3:d5"); ok {
+		t.Error("short mac matched")
+	}
+}
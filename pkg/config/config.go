@@ -70,6 +70,20 @@ type Yaml struct {
 	Username              string     `mapstructure:"username" bson:"username" json:"username"`
 	Password              string     `mapstructure:"password" bson:"password" json:"password"`
 	License               License    `mapstructure:"license" bson:"license" json:"license"`
+	Enforcement           Enforce    `mapstructure:"enforcement" bson:"enforcement" json:"enforcement"`
+	Observer              Observer   `mapstructure:"observer" bson:"observer" json:"observer"`
+	Device                Device     `mapstructure:"device" bson:"device" json:"device"`
+	Baseline              Baseline   `mapstructure:"baseline" bson:"baseline" json:"baseline"`
+	Alert                 Alert      `mapstructure:"alert" bson:"alert" json:"alert"`
+	Export                Export     `mapstructure:"export" bson:"export" json:"export"`
+	EventBus              EventBus   `mapstructure:"event_bus" bson:"event_bus" json:"event_bus"`
+	UserSource            UserSource `mapstructure:"user_source" bson:"user_source" json:"user_source"`
+	Storage               Storage    `mapstructure:"storage" bson:"storage" json:"storage"`
+	Retention             Retention  `mapstructure:"retention" bson:"retention" json:"retention"`
+	Spill                 Spill      `mapstructure:"spill" bson:"spill" json:"spill"`
+	State                 State      `mapstructure:"state" bson:"state" json:"state"`
+	Archive               Archive    `mapstructure:"archive" bson:"archive" json:"archive"`
+	Record                Record     `mapstructure:"record" bson:"record" json:"record"`
 }
 
 type Capture struct {
@@ -94,9 +108,254 @@ type Thresholds struct {
 }
 
 type ProtocolFeature struct {
-	Threshold int    `mapstructure:"threshold" bson:"threshold" json:"threshold"`
-	Normal    string `mapstructure:"normal" bson:"normal" json:"normal"`
-	Remark    string `mapstructure:"remark" bson:"remark" json:"remark"`
+	Threshold         int    `mapstructure:"threshold" bson:"threshold" json:"threshold"`                            // 窗口内相同数值次数阈值
+	DistinctThreshold int    `mapstructure:"distinct_threshold" bson:"distinct_threshold" json:"distinct_threshold"` // 窗口内不同数值数量阈值
+	Window            int    `mapstructure:"window" bson:"window" json:"window"`                                     // 窗口长度(秒)
+	Normal            string `mapstructure:"normal" bson:"normal" json:"normal"`
+	Remark            string `mapstructure:"remark" bson:"remark" json:"remark"`
+}
+
+// Enforce 处置阶梯配置
+type Enforce struct {
+	Window   int `mapstructure:"window" bson:"window" json:"window"`          // 违规计数窗口(分钟)
+	MaxLevel int `mapstructure:"max_level" bson:"max_level" json:"max_level"` // 最大处置等级 1 警告 2 临时禁用 3 升级
+	History  int `mapstructure:"history" bson:"history" json:"history"`       // 保留处置记录条数
+	// 处置动作，按控制策略名称 > 产品ID > 默认 选择，未配置时使用计费系统 redis 回调
+	Actions  []EnforceAction     `mapstructure:"actions" bson:"actions" json:"actions"`
+	Default  []string            `mapstructure:"default" bson:"default" json:"default"`
+	Products map[string][]string `mapstructure:"products" bson:"products" json:"products"`
+	Controls map[string][]string `mapstructure:"controls" bson:"controls" json:"controls"`
+}
+
+// EnforceAction 处置动作
+type EnforceAction struct {
+	Name       string            `mapstructure:"name" bson:"name" json:"name"`
+	Type       string            `mapstructure:"type" bson:"type" json:"type"`                   // redis radius http script
+	Address    string            `mapstructure:"address" bson:"address" json:"address"`          // radius NAS 地址 host:port，默认端口3799
+	Secret     string            `mapstructure:"secret" bson:"secret" json:"secret"`             // radius 共享密钥
+	Mode       string            `mapstructure:"mode" bson:"mode" json:"mode"`                   // radius disconnect coa
+	Attributes map[string]string `mapstructure:"attributes" bson:"attributes" json:"attributes"` // radius CoA 附加属性，属性号 -> 字符串值
+	Retries    int               `mapstructure:"retries" bson:"retries" json:"retries"`          // radius 重试次数
+	URL        string            `mapstructure:"url" bson:"url" json:"url"`                      // http 回调地址
+	Method     string            `mapstructure:"method" bson:"method" json:"method"`
+	Headers    map[string]string `mapstructure:"headers" bson:"headers" json:"headers"`
+	Command    string            `mapstructure:"command" bson:"command" json:"command"` // script 脚本路径
+	Args       []string          `mapstructure:"args" bson:"args" json:"args"`
+	Timeout    int               `mapstructure:"timeout" bson:"timeout" json:"timeout"` // 超时(秒)
+}
+
+// Observer 观察者历史配置
+type Observer struct {
+	Retention int `mapstructure:"retention" bson:"retention" json:"retention"` // 历史保留时长(小时)
+	Capacity  int `mapstructure:"capacity" bson:"capacity" json:"capacity"`    // 每个观察者内存中缓存的IP数量
+}
+
+// Device 设备活跃配置
+type Device struct {
+	Idle int `mapstructure:"idle" bson:"idle" json:"idle"` // 设备空闲多久后不再计入活跃设备(分钟)
+}
+
+// Baseline 用户行为基线配置
+type Baseline struct {
+	Interval   int     `mapstructure:"interval" bson:"interval" json:"interval"`          // 基线更新间隔(分钟)
+	Alpha      float64 `mapstructure:"alpha" bson:"alpha" json:"alpha"`                   // 滑动均值与方差的衰减系数
+	ZScore     float64 `mapstructure:"zscore" bson:"zscore" json:"zscore"`                // 偏离判定阈值(标准差倍数)
+	MinSamples int     `mapstructure:"min_samples" bson:"min_samples" json:"min_samples"` // 基线生效所需最少样本数
+	NewDevices int     `mapstructure:"new_devices" bson:"new_devices" json:"new_devices"` // 单次出现的陌生设备数阈值
+}
+
+// Alert 告警配置
+type Alert struct {
+	Enable      bool                `mapstructure:"enable" bson:"enable" json:"enable"`
+	Dedup       int                 `mapstructure:"dedup" bson:"dedup" json:"dedup"`                      // 相同告警去重时长(分钟)
+	RateLimit   int                 `mapstructure:"rate_limit" bson:"rate_limit" json:"rate_limit"`       // 每个通道每分钟最多发送条数
+	LicenseDays int                 `mapstructure:"license_days" bson:"license_days" json:"license_days"` // 授权到期提前提醒天数
+	DropRate    float64             `mapstructure:"drop_rate" bson:"drop_rate" json:"drop_rate"`          // 抓包丢包率告警阈值
+	Stall       int                 `mapstructure:"stall" bson:"stall" json:"stall"`                      // 网卡无数据包告警时长(分钟)
+	Groups      map[string][]string `mapstructure:"groups" bson:"groups" json:"groups"`                   // 用户组，值为用户名通配
+	Routes      []AlertRoute        `mapstructure:"routes" bson:"routes" json:"routes"`
+	Webhooks    []AlertWebhook      `mapstructure:"webhooks" bson:"webhooks" json:"webhooks"`
+	Syslogs     []AlertSyslog       `mapstructure:"syslogs" bson:"syslogs" json:"syslogs"`
+	SMTPs       []AlertSMTP         `mapstructure:"smtps" bson:"smtps" json:"smtps"`
+}
+
+// AlertRoute 告警路由，条件为空表示不限，按顺序匹配
+type AlertRoute struct {
+	Severity string   `mapstructure:"severity" bson:"severity" json:"severity"` // 最低严重程度
+	Types    []string `mapstructure:"types" bson:"types" json:"types"`
+	Products []int    `mapstructure:"products" bson:"products" json:"products"`
+	Groups   []string `mapstructure:"groups" bson:"groups" json:"groups"`
+	Channels []string `mapstructure:"channels" bson:"channels" json:"channels"`
+	Continue bool     `mapstructure:"continue" bson:"continue" json:"continue"` // 匹配后是否继续匹配后续路由
+}
+
+// AlertWebhook HTTP 回调通道
+type AlertWebhook struct {
+	Name     string            `mapstructure:"name" bson:"name" json:"name"`
+	URL      string            `mapstructure:"url" bson:"url" json:"url"`
+	Method   string            `mapstructure:"method" bson:"method" json:"method"`
+	Headers  map[string]string `mapstructure:"headers" bson:"headers" json:"headers"`
+	Template string            `mapstructure:"template" bson:"template" json:"template"` // 请求体模板，为空时发送告警json
+	Timeout  int               `mapstructure:"timeout" bson:"timeout" json:"timeout"`    // 超时(秒)
+}
+
+// AlertSyslog RFC5424 syslog 通道
+type AlertSyslog struct {
+	Name     string `mapstructure:"name" bson:"name" json:"name"`
+	Network  string `mapstructure:"network" bson:"network" json:"network"` // udp tcp tls
+	Address  string `mapstructure:"address" bson:"address" json:"address"`
+	Facility int    `mapstructure:"facility" bson:"facility" json:"facility"`
+	AppName  string `mapstructure:"app_name" bson:"app_name" json:"app_name"`
+	Insecure bool   `mapstructure:"insecure" bson:"insecure" json:"insecure"` // tls 不校验证书
+}
+
+// AlertSMTP 邮件通道
+type AlertSMTP struct {
+	Name     string   `mapstructure:"name" bson:"name" json:"name"`
+	Host     string   `mapstructure:"host" bson:"host" json:"host"`
+	Port     int      `mapstructure:"port" bson:"port" json:"port"`
+	Username string   `mapstructure:"username" bson:"username" json:"username"`
+	Password string   `mapstructure:"password" bson:"password" json:"password"`
+	From     string   `mapstructure:"from" bson:"from" json:"from"`
+	To       []string `mapstructure:"to" bson:"to" json:"to"`
+	TLS      bool     `mapstructure:"tls" bson:"tls" json:"tls"`             // 直接使用 TLS 连接(465)，否则服务端支持时使用 STARTTLS
+	Timeout  int      `mapstructure:"timeout" bson:"timeout" json:"timeout"` // 超时(秒)
+}
+
+// Export SIEM 导出配置
+type Export struct {
+	Enable  bool           `mapstructure:"enable" bson:"enable" json:"enable"`
+	Vendor  string         `mapstructure:"vendor" bson:"vendor" json:"vendor"`
+	Product string         `mapstructure:"product" bson:"product" json:"product"`
+	Targets []ExportTarget `mapstructure:"targets" bson:"targets" json:"targets"`
+}
+
+// ExportTarget 导出目标
+type ExportTarget struct {
+	Name       string            `mapstructure:"name" bson:"name" json:"name"`
+	Format     string            `mapstructure:"format" bson:"format" json:"format"`                // cef leef ecs
+	Output     string            `mapstructure:"output" bson:"output" json:"output"`                // syslog file
+	Network    string            `mapstructure:"network" bson:"network" json:"network"`             // syslog 协议 udp tcp tls
+	Address    string            `mapstructure:"address" bson:"address" json:"address"`             // syslog 地址
+	Insecure   bool              `mapstructure:"insecure" bson:"insecure" json:"insecure"`          // tls 不校验证书
+	Facility   int               `mapstructure:"facility" bson:"facility" json:"facility"`          // syslog facility
+	Path       string            `mapstructure:"path" bson:"path" json:"path"`                      // 文件路径
+	MaxSize    int               `mapstructure:"max_size" bson:"max_size" json:"max_size"`          // 单个文件大小(MB)
+	MaxBackups int               `mapstructure:"max_backups" bson:"max_backups" json:"max_backups"` // 保留历史文件数
+	Events     ExportEvents      `mapstructure:"events" bson:"events" json:"events"`
+	Mapping    map[string]string `mapstructure:"mapping" bson:"mapping" json:"mapping"` // 标准字段 -> 目标字段，目标为空时不输出
+}
+
+// ExportEvents 按事件类型开关
+type ExportEvents struct {
+	Proxy     bool `mapstructure:"proxy" bson:"proxy" json:"proxy"`
+	Suspected bool `mapstructure:"suspected" bson:"suspected" json:"suspected"`
+	Session   bool `mapstructure:"session" bson:"session" json:"session"`
+	UserEvent bool `mapstructure:"user_event" bson:"user_event" json:"user_event"`
+}
+
+// EventBus 内部事件总线配置
+type EventBus struct {
+	Buffer      int                           `mapstructure:"buffer" bson:"buffer" json:"buffer"` // 订阅者默认缓冲
+	Policy      string                        `mapstructure:"policy" bson:"policy" json:"policy"` // 默认丢弃策略 block drop_newest drop_oldest
+	Subscribers map[string]EventBusSubscriber `mapstructure:"subscribers" bson:"subscribers" json:"subscribers"`
+}
+
+// EventBusSubscriber 按订阅者名称覆盖缓冲与丢弃策略
+type EventBusSubscriber struct {
+	Buffer int    `mapstructure:"buffer" bson:"buffer" json:"buffer"`
+	Policy string `mapstructure:"policy" bson:"policy" json:"policy"`
+}
+
+// UserSource 在线用户来源，多个来源按顺序合并，同一IP以靠前的来源为准
+type UserSource struct {
+	Interval    int               `mapstructure:"interval" bson:"interval" json:"interval"`             // 全量对账间隔(分钟)
+	HealthCheck int               `mapstructure:"health_check" bson:"health_check" json:"health_check"` // redis 检测间隔(秒)，恢复连接后立即对账
+	Sources     []UserSourceEntry `mapstructure:"sources" bson:"sources" json:"sources"`
+	IPv6        UserIPv6          `mapstructure:"ipv6" bson:"ipv6" json:"ipv6"`
+}
+
+// UserIPv6 IPv6 地址归属
+type UserIPv6 struct {
+	PrivacyPrefix  int  `mapstructure:"privacy_prefix" bson:"privacy_prefix" json:"privacy_prefix"`    // 终端地址所在前缀长度，默认64
+	DisablePrivacy bool `mapstructure:"disable_privacy" bson:"disable_privacy" json:"disable_privacy"` // 关闭后仅精确匹配终端地址
+	// 临时地址关联设备时不使用报文源MAC，镜像口位于三层设备之后时开启
+	DisableSourceMac bool `mapstructure:"disable_source_mac" bson:"disable_source_mac" json:"disable_source_mac"`
+	LinkTTL          int  `mapstructure:"link_ttl" bson:"link_ttl" json:"link_ttl"` // 地址关联保留时长(小时)，默认48
+}
+
+// UserSourceEntry 用户来源
+type UserSourceEntry struct {
+	Name       string            `mapstructure:"name" bson:"name" json:"name"`
+	Type       string            `mapstructure:"type" bson:"type" json:"type"`                      // srun static dhcp http radius
+	Path       string            `mapstructure:"path" bson:"path" json:"path"`                      // static dhcp 文件路径
+	Format     string            `mapstructure:"format" bson:"format" json:"format"`                // static: csv yaml; dhcp: isc dnsmasq kea
+	Username   string            `mapstructure:"username" bson:"username" json:"username"`          // dhcp 用户名取值 hostname mac
+	ProductsID int               `mapstructure:"products_id" bson:"products_id" json:"products_id"` // 来源未提供产品时的默认产品
+	URL        string            `mapstructure:"url" bson:"url" json:"url"`                         // http 接口地址
+	Headers    map[string]string `mapstructure:"headers" bson:"headers" json:"headers"`
+	Timeout    int               `mapstructure:"timeout" bson:"timeout" json:"timeout"` // http 超时(秒)
+	Root       string            `mapstructure:"root" bson:"root" json:"root"`          // http 响应中用户列表的路径，点分
+	Fields     map[string]string `mapstructure:"fields" bson:"fields" json:"fields"`    // 标准字段 -> 响应字段
+	Secret     string            `mapstructure:"secret" bson:"secret" json:"secret"`    // radius 共享密钥，为空时不校验认证字
+	Ports      []int             `mapstructure:"ports" bson:"ports" json:"ports"`       // radius 计费端口
+}
+
+// Storage 存储后端
+type Storage struct {
+	Backend  string `mapstructure:"backend" bson:"backend" json:"backend"`    // mongo、embedded、memory，默认 mongo
+	Path     string `mapstructure:"path" bson:"path" json:"path"`             // 嵌入式存储文件，默认 <home>/data/dpi.db
+	Snapshot int    `mapstructure:"snapshot" bson:"snapshot" json:"snapshot"` // 内存 redis 落盘间隔(秒)，默认60
+}
+
+// Retention 数据保留策略，按时间分集合的数据集超过保留天数后删除集合
+// 保留天数为0时使用默认值，小于0永久保留
+type Retention struct {
+	Disable    bool `mapstructure:"disable" bson:"disable" json:"disable"`             // 关闭自动清理
+	Interval   int  `mapstructure:"interval" bson:"interval" json:"interval"`          // 清理间隔(分钟)，默认60
+	Streams    int  `mapstructure:"streams" bson:"streams" json:"streams"`             // 会话流，默认7天
+	Devices    int  `mapstructure:"devices" bson:"devices" json:"devices"`             // 设备记录，默认30天
+	UserAgent  int  `mapstructure:"useragent" bson:"useragent" json:"useragent"`       // UserAgent 记录，默认30天
+	Proxy      int  `mapstructure:"proxy" bson:"proxy" json:"proxy"`                   // 代理判定记录，默认180天
+	Suspected  int  `mapstructure:"suspected" bson:"suspected" json:"suspected"`       // 疑似代理记录，默认180天
+	UserEvents int  `mapstructure:"user_events" bson:"user_events" json:"user_events"` // 用户上下线记录，默认180天
+}
+
+// Spill 会话、UserAgent 等批量写入的磁盘暂存，写入失败或队列满时落盘，恢复后重放
+type Spill struct {
+	Disable  bool   `mapstructure:"disable" bson:"disable" json:"disable"`    // 关闭磁盘暂存，写入失败直接丢弃
+	Path     string `mapstructure:"path" bson:"path" json:"path"`             // 暂存目录，默认 <home>/data/spill
+	MaxSize  int    `mapstructure:"max_size" bson:"max_size" json:"max_size"` // 每个数据集最大占用(MB)，默认1024
+	Interval int    `mapstructure:"interval" bson:"interval" json:"interval"` // 重放间隔(秒)，默认10
+}
+
+// State IP 属性与设备的进程内状态，批量写回 redis 供 web 查询
+type State struct {
+	MaxIPs   int `mapstructure:"max_ips" bson:"max_ips" json:"max_ips"`    // 最多保留的 IP 数，超出后淘汰最久未活跃的，默认100000
+	Interval int `mapstructure:"interval" bson:"interval" json:"interval"` // 写回间隔(毫秒)，默认1000
+	Batch    int `mapstructure:"batch" bson:"batch" json:"batch"`          // 单个 pipeline 最多写回的 IP 数，默认500
+}
+
+// Archive 会话等按时间分集合的数据按小时分区归档为文件，供离线分析
+type Archive struct {
+	Enable      bool     `mapstructure:"enable" bson:"enable" json:"enable"`                // 抓包进程内定时归档
+	Path        string   `mapstructure:"path" bson:"path" json:"path"`                      // 归档目录，默认 <home>/data/archive
+	Format      string   `mapstructure:"format" bson:"format" json:"format"`                // parquet csv jsonl，默认 parquet
+	Compression string   `mapstructure:"compression" bson:"compression" json:"compression"` // parquet: snappy zstd gzip none，默认 snappy；csv/jsonl: gzip none，默认 gzip
+	Datasets    []string `mapstructure:"datasets" bson:"datasets" json:"datasets"`          // streams devices proxy suspected，默认 streams
+	Interval    int      `mapstructure:"interval" bson:"interval" json:"interval"`          // 检查间隔(分钟)，默认10
+	Delay       int      `mapstructure:"delay" bson:"delay" json:"delay"`                   // 小时结束后等待的时长(分钟)，默认10
+}
+
+// Record 按用户、IP 或 MAC 定向录制数据包为 pcapng 文件，供取证分析下载
+type Record struct {
+	Disable       bool   `mapstructure:"disable" bson:"disable" json:"disable"`                      // 关闭定向录制
+	Path          string `mapstructure:"path" bson:"path" json:"path"`                               // 录制目录，默认 <home>/data/record
+	MaxConcurrent int    `mapstructure:"max_concurrent" bson:"max_concurrent" json:"max_concurrent"` // 同时进行的录制数，默认2
+	Quota         int    `mapstructure:"quota" bson:"quota" json:"quota"`                            // 录制文件总占用上限(MB)，默认2048
+	FileSize      int    `mapstructure:"file_size" bson:"file_size" json:"file_size"`                // 单个文件大小(MB)，超出后滚动到新文件，默认64
+	Duration      int    `mapstructure:"duration" bson:"duration" json:"duration"`                   // 未指定时的录制时长(秒)，默认300
+	MaxDuration   int    `mapstructure:"max_duration" bson:"max_duration" json:"max_duration"`       // 最长录制时长(秒)，默认3600
 }
 
 type Mongodb struct {
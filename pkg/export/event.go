@@ -0,0 +1,174 @@
+package export
+
+import (
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"time"
+)
+
+// 事件标准化
+// 各类记录先转换为标准字段，再由格式化器按目标的字段映射输出
+
+type Kind string
+
+const (
+	KindProxy     Kind = "proxy"
+	KindSuspected Kind = "suspected"
+	KindSession   Kind = "session"
+	KindUserEvent Kind = "user_event"
+)
+
+// 标准字段
+const (
+	FieldIP             = "ip"
+	FieldUserName       = "user_name"
+	FieldMac            = "mac"
+	FieldAction         = "action"
+	FieldReason         = "reason"
+	FieldMessage        = "message"
+	FieldDeviceCount    = "device_count"
+	FieldMobileCount    = "mobile_count"
+	FieldPcCount        = "pc_count"
+	FieldReasonCategory = "reason_category"
+	FieldFeature        = "feature"
+	FieldValue          = "value"
+	FieldThreshold      = "threshold"
+	FieldRemark         = "remark"
+	FieldSessionID      = "session_id"
+	FieldDstIP          = "dst_ip"
+	FieldSrcPort        = "src_port"
+	FieldDstPort        = "dst_port"
+	FieldProtocol       = "protocol"
+	FieldAppProtocol    = "app_protocol"
+	FieldAppName        = "app_name"
+	FieldBytes          = "bytes"
+	FieldPackets        = "packets"
+	FieldHost           = "host"
+	FieldSNI            = "sni"
+	FieldStart          = "start"
+	FieldEnd            = "end"
+	FieldNasIP          = "nas_ip"
+	FieldProductsID     = "products_id"
+)
+
+// Event 标准化事件
+type Event struct {
+	Kind     Kind
+	ID       string // 事件标识，CEF SignatureID 与 LEEF EventID
+	Name     string
+	Severity int // 0-10
+	Time     time.Time
+	Fields   map[string]any
+}
+
+func proxyEvent(r types.ProxyRecord) Event {
+	severity := 7
+	if r.Action == types.ActionEscalate || r.Action == types.ActionReapply {
+		severity = 9
+	}
+	return Event{
+		Kind:     KindProxy,
+		ID:       "proxy:" + r.Action,
+		Name:     "Proxy sharing detected",
+		Severity: severity,
+		Time:     r.LastSeen,
+		Fields: compact(map[string]any{
+			FieldIP:          r.IP,
+			FieldUserName:    r.Username,
+			FieldAction:      r.Action,
+			FieldDeviceCount: r.AllCount,
+			FieldMobileCount: r.MobileCount,
+			FieldPcCount:     r.PcCount,
+			FieldMessage:     fmt.Sprintf("%d devices, %d mobile, %d pc", r.AllCount, r.MobileCount, r.PcCount),
+		}),
+	}
+}
+
+func suspectedEvent(r types.SuspectedRecord) Event {
+	return Event{
+		Kind:     KindSuspected,
+		ID:       "suspected:" + r.ReasonCategory,
+		Name:     "Suspected proxy",
+		Severity: 5,
+		Time:     r.LastSeen,
+		Fields: compact(map[string]any{
+			FieldIP:             r.IP,
+			FieldUserName:       r.Username,
+			FieldReasonCategory: r.ReasonCategory,
+			FieldFeature:        fmt.Sprint(r.ReasonDetail.Name),
+			FieldValue:          r.ReasonDetail.Value,
+			FieldThreshold:      r.ReasonDetail.Threshold,
+			FieldReason:         r.ReasonDetail.Description,
+			FieldRemark:         r.Remark,
+		}),
+	}
+}
+
+func sessionEvent(s types.Sessions, username string) Event {
+	return Event{
+		Kind:     KindSession,
+		ID:       "session:" + string(s.ApplicationProtocol),
+		Name:     "Session",
+		Severity: 1,
+		Time:     s.EndTime,
+		Fields: compact(map[string]any{
+			FieldIP:          s.SrcIp,
+			FieldUserName:    username,
+			FieldSessionID:   s.SessionId,
+			FieldDstIP:       s.DstIp,
+			FieldSrcPort:     s.SrcPort,
+			FieldDstPort:     s.DstPort,
+			FieldProtocol:    s.Protocol,
+			FieldAppProtocol: string(s.ApplicationProtocol),
+			FieldAppName:     s.Metadata.ApplicationInfo.AppName,
+			FieldBytes:       s.ByteCount,
+			FieldPackets:     s.PacketCount,
+			FieldHost:        s.Metadata.HttpInfo.Host,
+			FieldSNI:         s.Metadata.TlsInfo.Sni,
+			FieldStart:       s.StartTime,
+			FieldEnd:         s.EndTime,
+		}),
+	}
+}
+
+func userEvent(e types.UserEvent) Event {
+	action, name := "online", "User online"
+	if e.Action == 2 {
+		action, name = "offline", "User offline"
+	}
+	return Event{
+		Kind:     KindUserEvent,
+		ID:       "user:" + action,
+		Name:     name,
+		Severity: 2,
+		Time:     time.Now(),
+		Fields: compact(map[string]any{
+			FieldIP:         e.Ip,
+			FieldUserName:   e.UserName,
+			FieldMac:        e.UserMac,
+			FieldAction:     action,
+			FieldSessionID:  e.SessionId,
+			FieldNasIP:      e.NasIp,
+			FieldProductsID: e.ProductsId,
+		}),
+	}
+}
+
+// 去除空字符串与零时间
+func compact(fields map[string]any) map[string]any {
+	for k, v := range fields {
+		switch value := v.(type) {
+		case string:
+			if value == "" {
+				delete(fields, k)
+			}
+		case time.Time:
+			if value.IsZero() {
+				delete(fields, k)
+			}
+		case nil:
+			delete(fields, k)
+		}
+	}
+	return fields
+}
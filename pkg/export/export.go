@@ -0,0 +1,188 @@
+package export
+
+import (
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/bus"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+)
+
+// SIEM 导出
+// 代理判定、疑似代理、会话与用户上下线事件按目标配置格式化为 CEF、LEEF 或 ECS，
+// 经 syslog 或本地滚动文件输出；每个目标独立队列，队列满时丢弃并计数
+
+const queueSize = 10000
+
+var (
+	// LookupUserName 根据IP查询用户名，用于补充会话的用户，由抓包服务注入
+	LookupUserName func(ip string) string
+
+	targets []*target
+	mu      sync.RWMutex
+)
+
+type target struct {
+	cfg       config.ExportTarget
+	formatter formatter
+	output    output
+	queue     chan Event
+	sent      atomic.Int64
+	dropped   atomic.Int64
+	failed    atomic.Int64
+}
+
+// Stats 导出统计
+type Stats struct {
+	Name    string `json:"name"`
+	Format  string `json:"format"`
+	Output  string `json:"output"`
+	Sent    int64  `json:"sent"`
+	Dropped int64  `json:"dropped"`
+	Failed  int64  `json:"failed"`
+}
+
+// Setup 按配置创建导出目标
+func Setup() error {
+	c := config.Cfg.Export
+	if !c.Enable {
+		zap.L().Info("SIEM 导出未启用")
+		return nil
+	}
+	vendor, product := c.Vendor, c.Product
+	if vendor == "" {
+		vendor = "srun"
+	}
+	if product == "" {
+		product = "dpi-analyze"
+	}
+
+	var list []*target
+	for _, t := range c.Targets {
+		f, err := newFormatter(t.Format, vendor, product, config.Version, t.Mapping)
+		if err != nil {
+			return fmt.Errorf("export target %s: %w", t.Name, err)
+		}
+		out, err := newOutput(t)
+		if err != nil {
+			return fmt.Errorf("export target %s: %w", t.Name, err)
+		}
+		list = append(list, &target{cfg: t, formatter: f, output: out, queue: make(chan Event, queueSize)})
+	}
+
+	mu.Lock()
+	targets = list
+	mu.Unlock()
+	for _, t := range list {
+		go t.run()
+	}
+	subscribe()
+	zap.L().Info("SIEM 导出加载完成", zap.Int("targets", len(list)))
+	return nil
+}
+
+// 按目标启用的事件类型订阅总线
+func subscribe() {
+	if enabled(KindProxy) {
+		bus.ProxyDetected.Subscribe("export_proxy", bus.Options{}, func(r types.ProxyRecord) {
+			publish(proxyEvent(r))
+		})
+	}
+	if enabled(KindSuspected) {
+		bus.SuspectedDetected.Subscribe("export_suspected", bus.Options{}, func(r types.SuspectedRecord) {
+			publish(suspectedEvent(r))
+		})
+	}
+	if enabled(KindSession) {
+		bus.SessionClosed.Subscribe("export_session", bus.Options{}, func(s types.Sessions) {
+			var username string
+			if LookupUserName != nil {
+				username = LookupUserName(s.SrcIp)
+			}
+			publish(sessionEvent(s, username))
+		})
+	}
+	if enabled(KindUserEvent) {
+		bus.UserEvents.Subscribe("export_user_event", bus.Options{}, func(e types.UserEvent) {
+			publish(userEvent(e))
+		})
+	}
+}
+
+// GetStats 各目标导出统计
+func GetStats() []Stats {
+	mu.RLock()
+	defer mu.RUnlock()
+	result := make([]Stats, 0, len(targets))
+	for _, t := range targets {
+		result = append(result, Stats{
+			Name:    t.cfg.Name,
+			Format:  t.cfg.Format,
+			Output:  t.cfg.Output,
+			Sent:    t.sent.Load(),
+			Dropped: t.dropped.Load(),
+			Failed:  t.failed.Load(),
+		})
+	}
+	return result
+}
+
+func enabled(kind Kind) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, t := range targets {
+		if t.accept(kind) {
+			return true
+		}
+	}
+	return false
+}
+
+func publish(e Event) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, t := range targets {
+		if !t.accept(e.Kind) {
+			continue
+		}
+		select {
+		case t.queue <- e:
+		default:
+			t.dropped.Add(1)
+		}
+	}
+}
+
+func (t *target) accept(kind Kind) bool {
+	switch kind {
+	case KindProxy:
+		return t.cfg.Events.Proxy
+	case KindSuspected:
+		return t.cfg.Events.Suspected
+	case KindSession:
+		return t.cfg.Events.Session
+	case KindUserEvent:
+		return t.cfg.Events.UserEvent
+	default:
+		return false
+	}
+}
+
+func (t *target) run() {
+	for e := range t.queue {
+		line, err := t.formatter.Format(e)
+		if err == nil {
+			err = t.output.Write(line)
+		}
+		if err != nil {
+			// 仅在首次及每千次失败时记录，避免日志刷屏
+			if n := t.failed.Add(1); n == 1 || n%1000 == 0 {
+				zap.L().Error("SIEM 导出失败", zap.String("target", t.cfg.Name), zap.Int64("failed", n), zap.Error(err))
+			}
+			continue
+		}
+		t.sent.Add(1)
+	}
+}
@@ -0,0 +1,312 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 输出格式
+// CEF 与 LEEF 为单行文本，ECS 为单行json；字段映射在默认映射基础上按目标配置覆盖
+
+const (
+	FormatCEF  = "cef"
+	FormatLEEF = "leef"
+	FormatECS  = "ecs"
+
+	ecsVersion = "8.11.0"
+)
+
+type formatter interface {
+	Format(e Event) ([]byte, error)
+}
+
+// 默认字段映射，CEF 未映射的字段不输出，LEEF 未映射时使用标准字段名，ECS 未映射时置于 dpi 命名空间
+var defaultMappings = map[string]map[string]string{
+	FormatCEF: {
+		FieldIP:             "src",
+		FieldUserName:       "suser",
+		FieldMac:            "smac",
+		FieldAction:         "act",
+		FieldReason:         "reason",
+		FieldMessage:        "msg",
+		FieldDeviceCount:    "cnt",
+		FieldMobileCount:    "cn1",
+		FieldPcCount:        "cn2",
+		FieldReasonCategory: "cat",
+		FieldFeature:        "cs1",
+		FieldValue:          "cs2",
+		FieldThreshold:      "cs3",
+		FieldRemark:         "cs4",
+		FieldSessionID:      "externalId",
+		FieldDstIP:          "dst",
+		FieldSrcPort:        "spt",
+		FieldDstPort:        "dpt",
+		FieldProtocol:       "proto",
+		FieldAppProtocol:    "app",
+		FieldAppName:        "cs5",
+		FieldBytes:          "in",
+		FieldPackets:        "cnt",
+		FieldHost:           "dhost",
+		FieldSNI:            "cs6",
+		FieldStart:          "start",
+		FieldEnd:            "end",
+		FieldNasIP:          "dvc",
+		FieldProductsID:     "cn3",
+	},
+	FormatLEEF: {
+		FieldIP:             "src",
+		FieldUserName:       "usrName",
+		FieldMac:            "srcMAC",
+		FieldDstIP:          "dst",
+		FieldSrcPort:        "srcPort",
+		FieldDstPort:        "dstPort",
+		FieldProtocol:       "proto",
+		FieldBytes:          "totalBytes",
+		FieldPackets:        "totalPackets",
+		FieldReasonCategory: "cat",
+	},
+	FormatECS: {
+		FieldIP:             "source.ip",
+		FieldUserName:       "user.name",
+		FieldMac:            "source.mac",
+		FieldAction:         "event.action",
+		FieldReason:         "event.reason",
+		FieldMessage:        "message",
+		FieldReasonCategory: "rule.category",
+		FieldFeature:        "rule.name",
+		FieldDstIP:          "destination.ip",
+		FieldSrcPort:        "source.port",
+		FieldDstPort:        "destination.port",
+		FieldProtocol:       "network.transport",
+		FieldAppProtocol:    "network.protocol",
+		FieldBytes:          "network.bytes",
+		FieldPackets:        "network.packets",
+		FieldHost:           "url.domain",
+		FieldSNI:            "tls.client.server_name",
+		FieldStart:          "event.start",
+		FieldEnd:            "event.end",
+		FieldNasIP:          "observer.ip",
+	},
+}
+
+var customLabel = regexp.MustCompile(`^c[sn]\d$`)
+
+func newFormatter(format, vendor, product, version string, mapping map[string]string) (formatter, error) {
+	merged := make(map[string]string)
+	for k, v := range defaultMappings[format] {
+		merged[k] = v
+	}
+	for k, v := range mapping {
+		merged[k] = v
+	}
+	switch format {
+	case FormatCEF:
+		return &cef{vendor: vendor, product: product, version: version, mapping: merged}, nil
+	case FormatLEEF:
+		return &leef{vendor: vendor, product: product, version: version, mapping: merged}, nil
+	case FormatECS:
+		return &ecs{vendor: vendor, product: product, mapping: merged}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+// 按映射转换字段，fallback 为未映射字段的目标名，返回空时不输出
+func mapFields(e Event, mapping map[string]string, fallback func(string) string) map[string]any {
+	result := make(map[string]any, len(e.Fields))
+	for k, v := range e.Fields {
+		target, ok := mapping[k]
+		if !ok {
+			target = fallback(k)
+		}
+		if target == "" {
+			continue
+		}
+		result[target] = v
+	}
+	return result
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CEF:Version|Device Vendor|Device Product|Device Version|Signature ID|Name|Severity|Extension
+
+type cef struct {
+	vendor, product, version string
+	mapping                  map[string]string
+}
+
+var (
+	cefHeader    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtension = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+func (f *cef) Format(e Event) ([]byte, error) {
+	fields := mapFields(e, f.mapping, func(string) string { return "" })
+	// 自定义字段补充标签
+	labels := make(map[string]string)
+	for k, target := range f.mapping {
+		if _, ok := e.Fields[k]; ok && customLabel.MatchString(target) {
+			labels[target+"Label"] = k
+		}
+	}
+	for k, v := range labels {
+		fields[k] = v
+	}
+	fields["rt"] = e.Time
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%s|%s|%d|",
+		cefHeader.Replace(f.vendor), cefHeader.Replace(f.product), cefHeader.Replace(f.version),
+		cefHeader.Replace(e.ID), cefHeader.Replace(e.Name), e.Severity)
+	for i, k := range sortedKeys(fields) {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(cefExtension.Replace(textValue(fields[k], epochMillis)))
+	}
+	return []byte(b.String()), nil
+}
+
+// LEEF:1.0|Vendor|Product|Version|EventID|Extension，扩展字段以制表符分隔
+
+type leef struct {
+	vendor, product, version string
+	mapping                  map[string]string
+}
+
+var (
+	leefHeader    = strings.NewReplacer("|", " ", "\r", " ", "\n", " ")
+	leefExtension = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+)
+
+const leefTimeLayout = "Jan 02 2006 15:04:05.000 MST"
+
+func (f *leef) Format(e Event) ([]byte, error) {
+	fields := mapFields(e, f.mapping, func(k string) string { return k })
+	fields["devTime"] = e.Time
+	fields["devTimeFormat"] = "MMM dd yyyy HH:mm:ss.SSS z"
+	fields["sev"] = e.Severity
+	fields["kind"] = string(e.Kind)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "LEEF:1.0|%s|%s|%s|%s|",
+		leefHeader.Replace(f.vendor), leefHeader.Replace(f.product), leefHeader.Replace(f.version), leefHeader.Replace(e.ID))
+	for i, k := range sortedKeys(fields) {
+		if i > 0 {
+			b.WriteByte('\t')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(leefExtension.Replace(textValue(fields[k], func(t time.Time) string {
+			return t.Format(leefTimeLayout)
+		})))
+	}
+	return []byte(b.String()), nil
+}
+
+// Elastic Common Schema，点分字段展开为嵌套对象
+
+type ecs struct {
+	vendor, product string
+	mapping         map[string]string
+}
+
+func (f *ecs) Format(e Event) ([]byte, error) {
+	fields := mapFields(e, f.mapping, func(k string) string { return "dpi." + k })
+	kind := "event"
+	if e.Kind == KindProxy || e.Kind == KindSuspected {
+		kind = "alert"
+	}
+	fields["@timestamp"] = e.Time.Format(time.RFC3339Nano)
+	fields["ecs.version"] = ecsVersion
+	fields["event.kind"] = kind
+	fields["event.category"] = ecsCategory(e.Kind)
+	fields["event.dataset"] = "dpi." + string(e.Kind)
+	fields["event.module"] = "dpi"
+	fields["event.code"] = e.ID
+	fields["event.severity"] = e.Severity
+	fields["observer.vendor"] = f.vendor
+	fields["observer.product"] = f.product
+
+	doc := make(map[string]any)
+	for _, k := range sortedKeys(fields) {
+		v := fields[k]
+		switch value := v.(type) {
+		case time.Time:
+			v = value.Format(time.RFC3339Nano)
+		case string:
+			// 端口转为数值
+			if strings.HasSuffix(k, ".port") {
+				if port, err := strconv.Atoi(value); err == nil {
+					v = port
+				}
+			}
+		}
+		setPath(doc, strings.Split(k, "."), v)
+	}
+	return json.Marshal(doc)
+}
+
+func ecsCategory(kind Kind) []string {
+	switch kind {
+	case KindSession:
+		return []string{"network"}
+	case KindUserEvent:
+		return []string{"authentication", "session"}
+	default:
+		return []string{"network", "intrusion_detection"}
+	}
+}
+
+// 设置嵌套字段，与已有非对象值冲突时以点分键保留
+func setPath(doc map[string]any, path []string, v any) {
+	node := doc
+	for i, p := range path[:len(path)-1] {
+		next, ok := node[p]
+		if !ok {
+			child := make(map[string]any)
+			node[p] = child
+			node = child
+			continue
+		}
+		child, ok := next.(map[string]any)
+		if !ok {
+			node[strings.Join(path[i:], ".")] = v
+			return
+		}
+		node = child
+	}
+	node[path[len(path)-1]] = v
+}
+
+func epochMillis(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+func textValue(v any, formatTime func(time.Time) string) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case time.Time:
+		return formatTime(value)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,136 @@
+package export
+
+import (
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/syslog"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"os"
+	"path/filepath"
+)
+
+// 输出目标
+
+const (
+	OutputSyslog = "syslog"
+	OutputFile   = "file"
+
+	defaultMaxSize    = 100
+	defaultMaxBackups = 5
+)
+
+type output interface {
+	Write(line []byte) error
+	Close() error
+}
+
+func newOutput(t config.ExportTarget) (output, error) {
+	switch t.Output {
+	case OutputSyslog, "":
+		writer, err := syslog.NewWriter(t.Network, t.Address, t.Insecure)
+		if err != nil {
+			return nil, err
+		}
+		facility := t.Facility
+		if facility == 0 {
+			facility = syslog.FacilityLocal0
+		}
+		return &syslogOutput{writer: writer, facility: facility}, nil
+	case OutputFile:
+		return newRotateFile(t.Path, t.MaxSize, t.MaxBackups)
+	default:
+		return nil, fmt.Errorf("unsupported export output: %s", t.Output)
+	}
+}
+
+// syslog 输出，消息体为格式化后的事件
+
+type syslogOutput struct {
+	writer   *syslog.Writer
+	facility int
+}
+
+func (s *syslogOutput) Write(line []byte) error {
+	return s.writer.Send(syslog.Message{
+		Facility: s.facility,
+		Severity: syslog.SeverityInfo,
+		AppName:  "dpi-analyze",
+		Content:  string(line),
+	})
+}
+
+func (s *syslogOutput) Close() error {
+	return s.writer.Close()
+}
+
+// 按大小滚动的本地文件，历史文件依次命名为 path.1 path.2 ...
+
+type rotateFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func newRotateFile(path string, maxSize, maxBackups int) (*rotateFile, error) {
+	if path == "" {
+		return nil, fmt.Errorf("export file path is empty")
+	}
+	if maxSize <= 0 {
+		maxSize = defaultMaxSize
+	}
+	if maxBackups <= 0 {
+		maxBackups = defaultMaxBackups
+	}
+	r := &rotateFile{path: path, maxSize: int64(maxSize) << 20, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotateFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	r.file, r.size = file, info.Size()
+	return nil
+}
+
+func (r *rotateFile) Write(line []byte) error {
+	if r.size+int64(len(line))+1 > r.maxSize && r.size > 0 {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := r.file.Write(append(line, '\n'))
+	r.size += int64(n)
+	return err
+}
+
+func (r *rotateFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	_ = os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxBackups))
+	for i := r.maxBackups - 1; i > 0; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *rotateFile) Close() error {
+	return r.file.Close()
+}
@@ -3,6 +3,7 @@ package loader
 import (
 	"errors"
 	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
 )
 
 type Manager struct {
@@ -23,8 +24,8 @@ func (m *Manager) Load() ([]byte, error) {
 			return nil, fmt.Errorf("failed to load from yaml file: %w", err)
 		}
 
-		// 将加载的数据存储到 MongoDB
-		if m.Mongo != nil {
+		// 将加载的数据存储到 MongoDB，离线模式不保存
+		if m.Mongo != nil && !storage.Offline() {
 			err = m.Mongo.Save(data, 0)
 			if err != nil {
 				return nil, fmt.Errorf("failed to store data into MongoDB: %w", err)
@@ -39,8 +40,8 @@ func (m *Manager) Load() ([]byte, error) {
 			return nil, fmt.Errorf("failed to load from embedded file: %w", err)
 		}
 
-		// 将加载的数据存储到 MongoDB
-		if m.Mongo != nil {
+		// 将加载的数据存储到 MongoDB，离线模式不保存
+		if m.Mongo != nil && !storage.Offline() {
 			err = m.Mongo.Save(data, 0)
 			if err != nil {
 				return nil, fmt.Errorf("failed to store data into MongoDB: %w", err)
@@ -0,0 +1,193 @@
+package protocols
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"net"
+	"strings"
+)
+
+// RADIUS
+// 解析镜像的 Accounting-Request，提取用户名、分配地址、终端MAC与计费会话；
+// 构造 RFC5176 Disconnect/CoA 请求并校验应答
+
+const (
+	AcctStart   = 1
+	AcctStop    = 2
+	AcctInterim = 3
+
+	radiusAttributeFramedIPv6Prefix layers.RADIUSAttributeType = 97 // RFC3162 2.3. Framed-IPv6-Prefix
+
+	// RFC5176 3. Packet Format
+	RadiusDisconnectRequest layers.RADIUSCode = 40
+	RadiusDisconnectACK     layers.RADIUSCode = 41
+	RadiusDisconnectNAK     layers.RADIUSCode = 42
+	RadiusCoARequest        layers.RADIUSCode = 43
+	RadiusCoAACK            layers.RADIUSCode = 44
+	RadiusCoANAK            layers.RADIUSCode = 45
+
+	RadiusAttributeErrorCause layers.RADIUSAttributeType = 101 // RFC5176 3.5. Error-Cause
+)
+
+var (
+	ErrNotAccounting = errors.New("not a radius accounting request")
+	ErrAuthenticator = errors.New("radius authenticator mismatch")
+	ErrResponse      = errors.New("invalid radius response")
+)
+
+// RadiusAccounting 计费请求
+type RadiusAccounting struct {
+	StatusType       int
+	UserName         string
+	FramedIP         string
+	FramedIPv6Prefix string
+	CallingStationID string // 终端MAC，已统一为小写冒号格式
+	AcctSessionID    string
+	NasIP            string
+}
+
+// ParseRadiusAccounting 解析计费请求，secret 不为空时校验请求认证字
+func ParseRadiusAccounting(data []byte, secret string) (RadiusAccounting, error) {
+	radius := &layers.RADIUS{}
+	if err := radius.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err != nil {
+		return RadiusAccounting{}, err
+	}
+	if radius.Code != layers.RADIUSCodeAccountingRequest {
+		return RadiusAccounting{}, ErrNotAccounting
+	}
+	if secret != "" && !verifyAccountingAuthenticator(data[:radius.Length], secret) {
+		return RadiusAccounting{}, ErrAuthenticator
+	}
+
+	var acct RadiusAccounting
+	for _, attr := range radius.Attributes {
+		value := []byte(attr.Value)
+		switch attr.Type {
+		case layers.RADIUSAttributeTypeAcctStatusType:
+			if len(value) == 4 {
+				acct.StatusType = int(binary.BigEndian.Uint32(value))
+			}
+		case layers.RADIUSAttributeTypeUserName:
+			acct.UserName = string(value)
+		case layers.RADIUSAttributeTypeFramedIPAddress:
+			if len(value) == 4 {
+				acct.FramedIP = net.IP(value).String()
+			}
+		case radiusAttributeFramedIPv6Prefix:
+			acct.FramedIPv6Prefix = parseIPv6Prefix(value)
+		case layers.RADIUSAttributeTypeCallingStationId:
+			acct.CallingStationID = normalizeStationID(string(value))
+		case layers.RADIUSAttributeTypeAcctSessionId:
+			acct.AcctSessionID = string(value)
+		case layers.RADIUSAttributeTypeNASIPAddress:
+			if len(value) == 4 {
+				acct.NasIP = net.IP(value).String()
+			}
+		}
+	}
+	return acct, nil
+}
+
+// RadiusAttribute 请求属性
+type RadiusAttribute struct {
+	Type  layers.RADIUSAttributeType
+	Value []byte
+}
+
+// BuildRadiusRequest 构造 Disconnect/CoA 请求，认证字算法与计费请求相同(RFC5176 3.)
+func BuildRadiusRequest(code layers.RADIUSCode, identifier uint8, attrs []RadiusAttribute, secret string) ([]byte, error) {
+	packet := []byte{byte(code), identifier, 0, 0}
+	packet = append(packet, make([]byte, 16)...)
+	for _, attr := range attrs {
+		if len(attr.Value) > 253 {
+			return nil, fmt.Errorf("radius attribute %d too long", attr.Type)
+		}
+		packet = append(packet, byte(attr.Type), byte(len(attr.Value)+2))
+		packet = append(packet, attr.Value...)
+	}
+	if len(packet) > 4096 {
+		return nil, fmt.Errorf("radius packet too long: %d", len(packet))
+	}
+	binary.BigEndian.PutUint16(packet[2:4], uint16(len(packet)))
+	h := md5.New()
+	h.Write(packet)
+	h.Write([]byte(secret))
+	copy(packet[4:20], h.Sum(nil))
+	return packet, nil
+}
+
+// ParseRadiusResponse 校验应答与请求匹配及应答认证字，返回应答码与 Error-Cause
+// Response Authenticator = MD5(Code+Identifier+Length+Request Authenticator+属性+共享密钥)
+func ParseRadiusResponse(response, request []byte, secret string) (layers.RADIUSCode, int, error) {
+	radius := &layers.RADIUS{}
+	if err := radius.DecodeFromBytes(response, gopacket.NilDecodeFeedback); err != nil {
+		return 0, 0, err
+	}
+	if len(request) < 20 || response[1] != request[1] {
+		return 0, 0, ErrResponse
+	}
+	packet := response[:radius.Length]
+	h := md5.New()
+	h.Write(packet[:4])
+	h.Write(request[4:20])
+	h.Write(packet[20:])
+	h.Write([]byte(secret))
+	if !bytes.Equal(h.Sum(nil), packet[4:20]) {
+		return 0, 0, ErrAuthenticator
+	}
+	var cause int
+	for _, attr := range radius.Attributes {
+		if attr.Type == RadiusAttributeErrorCause && len(attr.Value) == 4 {
+			cause = int(binary.BigEndian.Uint32(attr.Value))
+		}
+	}
+	return radius.Code, cause, nil
+}
+
+// RFC2866 3. Request Authenticator = MD5(Code+Identifier+Length+16个0+属性+共享密钥)
+func verifyAccountingAuthenticator(packet []byte, secret string) bool {
+	if len(packet) < 20 {
+		return false
+	}
+	h := md5.New()
+	h.Write(packet[:4])
+	h.Write(make([]byte, 16))
+	h.Write(packet[20:])
+	h.Write([]byte(secret))
+	return bytes.Equal(h.Sum(nil), packet[4:20])
+}
+
+// Framed-IPv6-Prefix: 保留字节、前缀长度、前缀(最多16字节)
+func parseIPv6Prefix(value []byte) string {
+	if len(value) < 2 || len(value) > 18 || value[1] > 128 {
+		return ""
+	}
+	prefix := make(net.IP, net.IPv6len)
+	copy(prefix, value[2:])
+	ipNet := net.IPNet{IP: prefix, Mask: net.CIDRMask(int(value[1]), 128)}
+	return ipNet.String()
+}
+
+// Calling-Station-Id 常见格式 AA-BB-CC-DD-EE-FF、aabb.ccdd.eeff，非MAC原样返回
+func normalizeStationID(id string) string {
+	if mac, err := net.ParseMAC(strings.TrimSpace(id)); err == nil {
+		return mac.String()
+	}
+	hex := strings.Map(func(r rune) rune {
+		if strings.ContainsRune("-:. ", r) {
+			return -1
+		}
+		return r
+	}, id)
+	if len(hex) == 12 {
+		if mac, err := net.ParseMAC(hex[0:2] + ":" + hex[2:4] + ":" + hex[4:6] + ":" + hex[6:8] + ":" + hex[8:10] + ":" + hex[10:12]); err == nil {
+			return mac.String()
+		}
+	}
+	return id
+}
@@ -0,0 +1,221 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"go.uber.org/zap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 数据保留
+// 会话流、设备、UserAgent、代理判定等数据按时间分集合写入，集合名由时间格式生成。
+// 定期按数据集的保留天数计算截止时间，集合覆盖的时段全部早于截止时间时删除整个集合，
+// 集合名不符合时间格式的(如 devices.inventory)不处理
+
+const defaultInterval = time.Hour
+
+// 集合时段
+const (
+	PeriodHour  = "hour"
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+)
+
+// Dataset 按时间分集合的数据集
+type Dataset struct {
+	Name     string `json:"name"`
+	Database string `json:"database"`
+	Layout   string `json:"layout"` // 集合名时间格式
+	Period   string `json:"period"` // 单个集合覆盖的时段
+	def      int
+	days     func() int
+}
+
+var Datasets = []Dataset{
+	{Name: "streams", Database: types.MongoDatabaseStream, Layout: types.MongoCollectionStreamLayout, Period: PeriodHour, def: 7,
+		days: func() int { return config.Cfg.Retention.Streams }},
+	{Name: "devices", Database: types.MongoDatabaseDevices, Layout: types.MongoCollectionDailyLayout, Period: PeriodDay, def: 30,
+		days: func() int { return config.Cfg.Retention.Devices }},
+	{Name: "useragent", Database: types.MongoDatabaseUserAgent, Layout: types.MongoCollectionUserAgentLayout, Period: PeriodDay, def: 30,
+		days: func() int { return config.Cfg.Retention.UserAgent }},
+	{Name: "proxy", Database: types.MongoDatabaseProxy, Layout: types.MongoCollectionMonthlyLayout, Period: PeriodMonth, def: 180,
+		days: func() int { return config.Cfg.Retention.Proxy }},
+	{Name: "suspected", Database: types.MongoDatabaseSuspected, Layout: types.MongoCollectionMonthlyLayout, Period: PeriodMonth, def: 180,
+		days: func() int { return config.Cfg.Retention.Suspected }},
+	{Name: "user_events", Database: types.MongoDatabaseUserEvents, Layout: types.MongoCollectionMonthlyLayout, Period: PeriodMonth, def: 180,
+		days: func() int { return config.Cfg.Retention.UserEvents }},
+}
+
+var running sync.Mutex
+
+// Usage 数据集占用
+type Usage struct {
+	Dataset
+	Days        int        `json:"days"` // 保留天数，小于0永久保留
+	Collections int        `json:"collections"`
+	Count       int64      `json:"count"`            // 文档数量
+	Size        int64      `json:"size"`             // 数据字节数
+	Oldest      *time.Time `json:"oldest,omitempty"` // 最早集合的起始时间
+	Newest      *time.Time `json:"newest,omitempty"` // 最新集合的起始时间
+}
+
+// Find 按名称查找数据集
+func Find(name string) (Dataset, bool) {
+	for _, d := range Datasets {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return Dataset{}, false
+}
+
+// Days 保留天数，小于0永久保留
+func (d Dataset) Days() int {
+	if days := d.days(); days != 0 {
+		return days
+	}
+	return d.def
+}
+
+// Span 解析集合名，返回集合覆盖的时段
+func (d Dataset) Span(collection string) (start, end time.Time, ok bool) {
+	start, err := time.ParseInLocation(d.Layout, collection, time.Local)
+	if err != nil || start.Format(d.Layout) != collection {
+		return time.Time{}, time.Time{}, false
+	}
+	switch d.Period {
+	case PeriodHour:
+		end = start.Add(time.Hour)
+	case PeriodDay:
+		end = start.AddDate(0, 0, 1)
+	default:
+		end = start.AddDate(0, 1, 0)
+	}
+	return start, end, true
+}
+
+// Collections 数据集的集合，按时间升序
+func (d Dataset) Collections() ([]string, error) {
+	names, err := storage.Datasets().Collections(context.TODO(), d.Database)
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	starts := make(map[string]time.Time)
+	for _, name := range names {
+		if start, _, ok := d.Span(name); ok {
+			list = append(list, name)
+			starts[name] = start
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return starts[list[i]].Before(starts[list[j]])
+	})
+	return list, nil
+}
+
+// Expired 时段全部早于 before 的集合
+func (d Dataset) Expired(before time.Time) ([]string, error) {
+	names, err := d.Collections()
+	if err != nil {
+		return nil, err
+	}
+	var expired []string
+	for _, name := range names {
+		if _, end, _ := d.Span(name); !end.After(before) {
+			expired = append(expired, name)
+		}
+	}
+	return expired, nil
+}
+
+// Drop 删除时段全部早于 before 的集合，返回已删除的集合
+func (d Dataset) Drop(before time.Time) ([]string, error) {
+	expired, err := d.Expired(before)
+	if err != nil {
+		return nil, err
+	}
+	var dropped []string
+	for _, name := range expired {
+		if err = storage.Datasets().DropCollection(context.TODO(), d.Database, name); err != nil {
+			return dropped, fmt.Errorf("drop %s.%s: %w", d.Database, name, err)
+		}
+		dropped = append(dropped, name)
+	}
+	return dropped, nil
+}
+
+// Interval 清理间隔
+func Interval() time.Duration {
+	if config.Cfg.Retention.Interval > 0 {
+		return time.Duration(config.Cfg.Retention.Interval) * time.Minute
+	}
+	return defaultInterval
+}
+
+// Prune 按保留策略删除过期集合
+func Prune() {
+	if config.Cfg.Retention.Disable {
+		return
+	}
+	if !running.TryLock() {
+		zap.L().Warn("上次数据清理尚未完成，跳过本次")
+		return
+	}
+	defer running.Unlock()
+
+	now := time.Now()
+	total := 0
+	for _, d := range Datasets {
+		days := d.Days()
+		if days < 0 {
+			continue
+		}
+		before := now.AddDate(0, 0, -days)
+		dropped, err := d.Drop(before)
+		for _, name := range dropped {
+			zap.L().Info("删除过期集合", zap.String("dataset", d.Name), zap.String("database", d.Database),
+				zap.String("collection", name), zap.Int("days", days))
+		}
+		if err != nil {
+			zap.L().Error("清理过期数据失败", zap.String("dataset", d.Name), zap.Error(err))
+		}
+		total += len(dropped)
+	}
+	if total > 0 {
+		zap.L().Info("过期数据清理完成", zap.Int("collections", total), zap.Duration("cost", time.Since(now)))
+	}
+}
+
+// GetUsage 各数据集的存储占用
+func GetUsage() ([]Usage, error) {
+	list := make([]Usage, 0, len(Datasets))
+	for _, d := range Datasets {
+		usage := Usage{Dataset: d, Days: d.Days()}
+		names, err := d.Collections()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			stats, err := storage.Datasets().CollectionStats(context.TODO(), d.Database, name)
+			if err != nil {
+				return nil, fmt.Errorf("stats %s.%s: %w", d.Database, name, err)
+			}
+			usage.Count += stats.Count
+			usage.Size += stats.Size
+		}
+		usage.Collections = len(names)
+		if len(names) > 0 {
+			oldest, _, _ := d.Span(names[0])
+			newest, _, _ := d.Span(names[len(names)-1])
+			usage.Oldest, usage.Newest = &oldest, &newest
+		}
+		list = append(list, usage)
+	}
+	return list, nil
+}
@@ -1,54 +1,19 @@
 package sessions
 
 import (
-	mongodb "github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
+	"context"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
-	"go.uber.org/zap"
-	"time"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/spill"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
-var SessionQueue = make(chan types.Sessions, 500000)
+// SessionQueue 会话记录写入队列，按小时分集合，写入失败或队列满时落盘暂存
+var SessionQueue = spill.New("streams", types.MongoDatabaseStream, types.MongoCollectionStreamLayout, 500000, 1000,
+	func(ctx context.Context, collection string, docs []bson.Raw) error {
+		return storage.Sessions().InsertSessions(ctx, collection, docs)
+	})
 
 func StartLogConsumer() {
-	consumerCount := 4 // 启动 4 个消费者，你可以根据机器的资源来调整这个值
-	for i := 0; i < consumerCount; i++ {
-		go consumeLogQueue()
-	}
-}
-
-func consumeLogQueue() {
-	buffer := make([]interface{}, 0, 100)
-	ticker := time.NewTicker(time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case log := <-SessionQueue:
-			buffer = append(buffer, log)
-			if len(buffer) >= 1000 {
-				insertManyStream(buffer)
-				buffer = buffer[:0]
-			}
-		case <-ticker.C:
-			if len(buffer) > 0 {
-				insertManyStream(buffer)
-				buffer = buffer[:0]
-			}
-		}
-	}
-}
-
-func insertManyStream(buffer []interface{}) {
-	retries := 3
-	var err error
-	for i := 0; i < retries; i++ {
-		_, err = mongodb.GetMongoClient().Database(types.MongoDatabaseStream).Collection(time.Now().Format("stream-06-01-02-15")).
-			InsertMany(mongodb.Context, buffer)
-		if err == nil {
-			return // 成功插入
-		}
-		time.Sleep(time.Duration(1<<i) * time.Second) // 指数退避
-	}
-	// 记录失败
-	zap.L().Error("insert stream failed after retries", zap.Error(err))
+	SessionQueue.Start(4) // 启动 4 个消费者，你可以根据机器的资源来调整这个值
 }
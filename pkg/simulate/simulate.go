@@ -0,0 +1,190 @@
+package simulate
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/policy"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/users"
+	"os"
+	"sort"
+	"time"
+)
+
+// 策略模拟
+// 以当前策略和候选策略分别回放历史抓包，对比两者产生的代理与疑似记录
+
+// Candidate 一组产品策略与协议阈值
+type Candidate struct {
+	Products   []types.Products   `json:"products"`
+	Thresholds *config.Thresholds `json:"thresholds,omitempty"`
+}
+
+// Result 单次回放结果
+type Result struct {
+	Packets   int                     `json:"packets"`
+	Proxy     []types.ProxyRecord     `json:"proxy"`
+	Suspected []types.SuspectedRecord `json:"suspected"`
+}
+
+// Change 判定结果变化，按用户名(无用户名时为IP)
+type Change struct {
+	Added   []string `json:"added"`   // 仅候选策略判定
+	Removed []string `json:"removed"` // 仅当前策略判定
+	Kept    []string `json:"kept"`    // 两者均判定
+}
+
+// Report 模拟报告
+type Report struct {
+	Files     []string  `json:"files"`
+	Current   Result    `json:"current"`
+	Candidate Result    `json:"candidate"`
+	Proxy     Change    `json:"proxy"`
+	Suspected Change    `json:"suspected"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+// Current 当前生效的策略，产品策略只读取自mongo
+func Current() (Candidate, error) {
+	products, err := policy.Fetch()
+	if err != nil {
+		return Candidate{}, err
+	}
+	thresholds := config.Cfg.Thresholds
+	return Candidate{Products: products, Thresholds: &thresholds}, nil
+}
+
+// ReadCandidate 读取json格式的策略文件
+func ReadCandidate(path string) (Candidate, error) {
+	var c Candidate
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+// WriteJSON 写入json文件
+func WriteJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// ReadResult 读取回放结果
+func ReadResult(path string) (Result, error) {
+	var r Result
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return r, err
+	}
+	err = json.Unmarshal(data, &r)
+	return r, err
+}
+
+// Merge 候选策略未指定的部分沿用当前策略，候选产品覆盖同ID的当前产品
+func (c Candidate) Merge(current Candidate) Candidate {
+	merged := Candidate{Thresholds: c.Thresholds}
+	if merged.Thresholds == nil {
+		merged.Thresholds = current.Thresholds
+	}
+	override := make(map[string]types.Products, len(c.Products))
+	for _, p := range c.Products {
+		override[p.ProductsID] = p
+	}
+	for _, p := range current.Products {
+		if o, ok := override[p.ProductsID]; ok {
+			// 候选策略只填写限制时保留原有名称与控制策略
+			if o.Controls == (types.Controls{}) {
+				o.Controls = p.Controls
+			}
+			if o.ProductsName == "" {
+				o.ProductsName = p.ProductsName
+			}
+			p = o
+			delete(override, p.ProductsID)
+		}
+		merged.Products = append(merged.Products, p)
+	}
+	for _, p := range c.Products {
+		if _, ok := override[p.ProductsID]; ok {
+			merged.Products = append(merged.Products, p)
+		}
+	}
+	return merged
+}
+
+// Apply 使策略在当前进程生效，不持久化
+func (c Candidate) Apply() {
+	policy.Load(c.Products)
+	if c.Thresholds != nil {
+		config.Cfg.Thresholds = *c.Thresholds
+	}
+}
+
+// ReadUsers 读取用户名单 csv，每行 ip,user_name,products_id[,user_mac]
+func ReadUsers(path string) ([]types.User, error) {
+	list, err := users.ReadUserFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.New("no user found")
+	}
+	return list, nil
+}
+
+// Compare 对比两次回放结果
+func Compare(current, candidate Result) (proxy, suspected Change) {
+	proxy = diff(proxyKeys(current.Proxy), proxyKeys(candidate.Proxy))
+	suspected = diff(suspectedKeys(current.Suspected), suspectedKeys(candidate.Suspected))
+	return
+}
+
+func proxyKeys(records []types.ProxyRecord) map[string]struct{} {
+	keys := make(map[string]struct{}, len(records))
+	for _, r := range records {
+		keys[subject(r.Username, r.IP)] = struct{}{}
+	}
+	return keys
+}
+
+func suspectedKeys(records []types.SuspectedRecord) map[string]struct{} {
+	keys := make(map[string]struct{}, len(records))
+	for _, r := range records {
+		keys[subject(r.Username, r.IP)] = struct{}{}
+	}
+	return keys
+}
+
+func subject(username, ip string) string {
+	if username != "" {
+		return username
+	}
+	return ip
+}
+
+func diff(current, candidate map[string]struct{}) Change {
+	c := Change{Added: []string{}, Removed: []string{}, Kept: []string{}}
+	for k := range candidate {
+		if _, ok := current[k]; ok {
+			c.Kept = append(c.Kept, k)
+		} else {
+			c.Added = append(c.Added, k)
+		}
+	}
+	for k := range current {
+		if _, ok := candidate[k]; !ok {
+			c.Removed = append(c.Removed, k)
+		}
+	}
+	sort.Strings(c.Added)
+	sort.Strings(c.Removed)
+	sort.Strings(c.Kept)
+	return c
+}
@@ -18,6 +18,30 @@ const (
 	ConfigList
 	FeatureLibrary
 	FeatureUpdate
+	EnforcementList
+	EnforcementDetail
+	EnforcementReset
+	ExemptionList
+	ExemptionAdd
+	ExemptionDelete
+	ObserverHistory
+	AlertList
+	AlertTest
+	AlertSilenceList
+	AlertSilenceAdd
+	AlertSilenceDelete
+	BusStats
+	UserReconcileStats
+	UserReconcile
+	Storage
+	SpillStats
+	StateStats
+	RecordList
+	RecordStart
+	RecordStop
+	RecordDetail
+	RecordFile
+	RecordDelete
 )
 
 // Message unix 通信数据结构体
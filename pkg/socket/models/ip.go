@@ -6,6 +6,7 @@ type IPDetail struct {
 	Features    any         `json:"features"`
 	Devices     any         `json:"devices"`
 	DevicesLogs any         `json:"devices_logs"`
+	IPv6        any         `json:"ipv6"` // 关联到同一设备的 IPv6 地址
 }
 
 type History struct {
@@ -40,26 +40,21 @@ func StartServer() {
 // handleConnection 处理客户端连接
 func handleConnection(conn net.Conn) {
 	defer conn.Close()
-	buf := make([]byte, 10240)
-	n, err := conn.Read(buf)
-	if err != nil {
-		fmt.Println("read error:", err)
-		return
-	}
-
-	// 处理客户端发送的消息
-	zap.L().Debug("Received message", zap.String("message", string(buf[:n])))
 
+	// 按 JSON 流解码，请求大小不受单次读取限制
 	var req Message
-	err = json.Unmarshal(buf[:n], &req)
+	err := json.NewDecoder(conn).Decode(&req)
 	if err != nil {
 		fmt.Println("unmarshal error:", err)
 		return
 	}
+	zap.L().Debug("Received message", zap.Int("type", int(req.Type)))
+
 	// 获取处理函数
 	handler, err := req.handle()
 	if err != nil {
 		_, _ = conn.Write([]byte("Unknown message type"))
+		return
 	}
 
 	response := handler(req.Params)
@@ -0,0 +1,456 @@
+package spill
+
+import (
+	"context"
+	"errors"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 批量写入队列
+// 会话、UserAgent、特征与设备库等记录先进入内存队列，由消费者按集合批量写入存储，集合名在入队时按时间生成或固定；
+// 内存队列满时记录交给落盘协程暂存，写入失败时落盘，写入失败后新批次直接落盘，由重放在存储恢复后按原集合写入。
+// 记录写入前补齐 _id，由写入函数按集合批量写入：插入遇到已写入的记录(重复键)视为成功，按 _id 替换的数据集重放时按写入顺序覆盖；
+// 关闭暂存、暂存超过容量或无法编码的记录丢弃并按数据集计数
+
+const (
+	defaultMaxSize  = 1024
+	defaultInterval = 10 * time.Second
+	writeTimeout    = 10 * time.Second
+	replayBatch     = 1000
+	overflowSize    = 10000 // 内存队列满后等待落盘的记录上限
+)
+
+var errOverflow = errors.New("spill overflow is full")
+
+var (
+	queues []*Queue
+	mu     sync.RWMutex
+)
+
+// Writer 将同一集合的一批记录写入存储，记录已写入时应视为成功
+type Writer func(ctx context.Context, collection string, docs []bson.Raw) error
+
+// Queue 数据集写入队列
+type Queue struct {
+	name     string
+	database string
+	layout   string
+	fixed    string // 固定集合名，layout 为空时使用
+	writer   Writer
+	batch    int
+	queue    chan item
+	overMu   sync.Mutex
+	overflow []item        // 内存队列满时等待落盘的记录
+	signal   chan struct{} // 通知落盘协程
+	wal      *wal
+	down     atomic.Bool // 存储写入失败，恢复前新批次直接落盘
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	once     sync.Once
+	stopOnce sync.Once
+	errMu    sync.Mutex
+	lastErr  string
+	dropLog  atomic.Int64 // 上次记录丢弃日志的时间
+
+	written  atomic.Int64
+	spilled  atomic.Int64
+	replayed atomic.Int64
+	dropped  atomic.Int64
+}
+
+type item struct {
+	collection string
+	doc        any
+}
+
+// Stats 写入队列统计
+type Stats struct {
+	Name      string `json:"name"`
+	Database  string `json:"database"`
+	Queued    int    `json:"queued"`   // 内存队列及等待落盘的记录数
+	Written   int64  `json:"written"`  // 直接写入
+	Spilled   int64  `json:"spilled"`  // 落盘暂存
+	Replayed  int64  `json:"replayed"` // 由暂存重放写入
+	Dropped   int64  `json:"dropped"`  // 丢弃
+	Pending   int64  `json:"pending"`  // 待重放字节数
+	Down      bool   `json:"down"`     // 存储写入异常，新批次直接落盘
+	LastError string `json:"last_error,omitempty"`
+}
+
+// New 创建数据集写入队列，layout 为集合名时间格式，size 为内存队列长度，batch 为单次批量写入数量
+func New(name, database, layout string, size, batch int, writer Writer) *Queue {
+	q := &Queue{
+		name:     name,
+		database: database,
+		layout:   layout,
+		writer:   writer,
+		batch:    batch,
+		queue:    make(chan item, size),
+		signal:   make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+	mu.Lock()
+	queues = append(queues, q)
+	mu.Unlock()
+	return q
+}
+
+// NewFixed 创建写入固定集合的队列
+func NewFixed(name, database, collection string, size, batch int, writer Writer) *Queue {
+	q := New(name, database, "", size, batch, writer)
+	q.fixed = collection
+	return q
+}
+
+// Push 写入记录，不阻塞，内存队列满时交给落盘协程
+func (q *Queue) Push(doc any) {
+	it := item{collection: q.fixed, doc: doc}
+	if q.layout != "" {
+		it.collection = time.Now().Format(q.layout)
+	}
+	select {
+	case q.queue <- it:
+	default:
+		q.handoff(it)
+	}
+}
+
+// Start 打开磁盘暂存并启动消费者与重放，模拟回放等离线模式不落盘
+func (q *Queue) Start(workers int) {
+	q.once.Do(func() {
+		if !config.Cfg.Spill.Disable && !storage.Offline() {
+			w, err := openWAL(filepath.Join(dir(), q.name), maxSize())
+			if err != nil {
+				zap.L().Error("打开磁盘暂存失败，写入失败的记录将丢弃", zap.String("queue", q.name), zap.Error(err))
+			} else {
+				q.wal = w
+				if pending := w.size.Load(); pending > 0 {
+					zap.L().Info("发现待重放的暂存记录", zap.String("queue", q.name), zap.Int64("bytes", pending))
+				}
+				q.wg.Add(1)
+				go q.replayLoop()
+			}
+		}
+		q.wg.Add(1)
+		go q.spillLoop()
+		for i := 0; i < workers; i++ {
+			q.wg.Add(1)
+			go q.consume()
+		}
+	})
+}
+
+// 交给落盘协程，调用方不等待磁盘写入，等待落盘的记录超过上限时丢弃
+func (q *Queue) handoff(it item) {
+	q.overMu.Lock()
+	if len(q.overflow) >= overflowSize {
+		q.overMu.Unlock()
+		q.drop(1, errOverflow)
+		return
+	}
+	q.overflow = append(q.overflow, it)
+	q.overMu.Unlock()
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Queue) spillLoop() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.signal:
+			q.spillOverflow()
+		case <-q.stop:
+			q.spillOverflow()
+			return
+		}
+	}
+}
+
+func (q *Queue) spillOverflow() {
+	q.overMu.Lock()
+	items := q.overflow
+	q.overflow = nil
+	q.overMu.Unlock()
+	q.spill(q.encode(items))
+}
+
+func (q *Queue) consume() {
+	defer q.wg.Done()
+	buffer := make([]item, 0, q.batch)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case it := <-q.queue:
+			buffer = append(buffer, it)
+			if len(buffer) >= q.batch {
+				q.write(buffer)
+				buffer = buffer[:0]
+			}
+		case <-ticker.C:
+			if len(buffer) > 0 {
+				q.write(buffer)
+				buffer = buffer[:0]
+			}
+		case <-q.stop:
+			// 退出前将缓冲与队列中的记录落盘，下次启动重放
+			for {
+				select {
+				case it := <-q.queue:
+					buffer = append(buffer, it)
+				default:
+					if q.wal != nil {
+						q.spill(q.encode(buffer))
+					} else if len(buffer) > 0 {
+						q.write(buffer)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// 批量写入，失败时落盘
+func (q *Queue) write(items []item) {
+	records := q.encode(items)
+	if len(records) == 0 {
+		return
+	}
+	if q.down.Load() && q.wal != nil {
+		q.spill(records)
+		return
+	}
+	if err := q.insert(records); err != nil {
+		q.setError(err)
+		if !q.down.Swap(true) {
+			zap.L().Error("批量写入失败，记录转入磁盘暂存", zap.String("queue", q.name), zap.Error(err))
+		}
+		q.spill(records)
+		return
+	}
+	q.written.Add(int64(len(records)))
+}
+
+// 按集合分组写入
+func (q *Queue) insert(records []record) error {
+	groups := make(map[string][]bson.Raw)
+	var order []string
+	for _, r := range records {
+		if _, ok := groups[r.Collection]; !ok {
+			order = append(order, r.Collection)
+		}
+		groups[r.Collection] = append(groups[r.Collection], r.Doc)
+	}
+	for _, collection := range order {
+		docs := groups[collection]
+		for i := 0; i < len(docs); i += replayBatch {
+			end := min(i+replayBatch, len(docs))
+			ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+			err := q.writer(ctx, collection, docs[i:end])
+			cancel()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 落盘暂存，暂存未开启、未打开或超过容量时丢弃
+func (q *Queue) spill(records []record) {
+	if len(records) == 0 {
+		return
+	}
+	if q.wal == nil {
+		q.drop(len(records), errors.New("spill unavailable"))
+		return
+	}
+	n, err := q.wal.append(records)
+	q.spilled.Add(int64(n))
+	if err != nil {
+		q.drop(len(records)-n, err)
+	}
+}
+
+func (q *Queue) replayLoop() {
+	defer q.wg.Done()
+	ticker := time.NewTicker(interval())
+	defer ticker.Stop()
+	for {
+		q.replay()
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// 按序重放已关闭的段，写入失败时保留剩余段等待下次重放
+func (q *Queue) replay() {
+	if q.wal.size.Load() > 0 {
+		segments, err := q.wal.sealed()
+		if err != nil {
+			zap.L().Error("读取磁盘暂存失败", zap.String("queue", q.name), zap.Error(err))
+			return
+		}
+		for _, path := range segments {
+			select {
+			case <-q.stop:
+				return
+			default:
+			}
+			records, corrupt, err := readSegment(path)
+			if err != nil {
+				zap.L().Error("读取暂存段失败", zap.String("queue", q.name), zap.String("segment", path), zap.Error(err))
+				return
+			}
+			if corrupt > 0 {
+				zap.L().Warn("暂存段尾部不完整，已跳过", zap.String("queue", q.name), zap.String("segment", path), zap.Int("bytes", corrupt))
+			}
+			if err = q.insert(records); err != nil {
+				q.setError(err)
+				q.down.Store(true)
+				return
+			}
+			if err = q.wal.remove(path); err != nil {
+				zap.L().Error("删除暂存段失败", zap.String("queue", q.name), zap.String("segment", path), zap.Error(err))
+				return
+			}
+			q.replayed.Add(int64(len(records)))
+			zap.L().Info("暂存记录重放完成", zap.String("queue", q.name), zap.String("segment", filepath.Base(path)), zap.Int("records", len(records)))
+		}
+	}
+	if q.down.Swap(false) {
+		zap.L().Info("批量写入恢复", zap.String("queue", q.name))
+	}
+}
+
+// 编码为 bson 并补齐 _id，无法编码的记录丢弃
+func (q *Queue) encode(items []item) []record {
+	records := make([]record, 0, len(items))
+	for _, it := range items {
+		raw, err := bson.Marshal(it.doc)
+		if err != nil {
+			q.drop(1, err)
+			continue
+		}
+		doc, err := storage.EnsureID(raw)
+		if err != nil {
+			q.drop(1, err)
+			continue
+		}
+		records = append(records, record{Collection: it.collection, Doc: doc})
+	}
+	return records
+}
+
+// 丢弃计数，日志每分钟最多一条
+func (q *Queue) drop(n int, err error) {
+	if n <= 0 {
+		return
+	}
+	total := q.dropped.Add(int64(n))
+	q.setError(err)
+	now := time.Now().Unix()
+	last := q.dropLog.Load()
+	if now-last >= 60 && q.dropLog.CompareAndSwap(last, now) {
+		zap.L().Warn("写入队列丢弃记录", zap.String("queue", q.name), zap.Int("count", n), zap.Int64("total", total), zap.Error(err))
+	}
+}
+
+// 等待落盘的记录数
+func (q *Queue) pending() int {
+	q.overMu.Lock()
+	defer q.overMu.Unlock()
+	return len(q.overflow)
+}
+
+func (q *Queue) setError(err error) {
+	q.errMu.Lock()
+	q.lastErr = err.Error()
+	q.errMu.Unlock()
+}
+
+func (q *Queue) stats() Stats {
+	s := Stats{
+		Name:     q.name,
+		Database: q.database,
+		Queued:   len(q.queue) + q.pending(),
+		Written:  q.written.Load(),
+		Spilled:  q.spilled.Load(),
+		Replayed: q.replayed.Load(),
+		Dropped:  q.dropped.Load(),
+		Down:     q.down.Load(),
+	}
+	if q.wal != nil {
+		s.Pending = q.wal.size.Load()
+	}
+	q.errMu.Lock()
+	s.LastError = q.lastErr
+	q.errMu.Unlock()
+	return s
+}
+
+// GetStats 各数据集写入队列统计
+func GetStats() []Stats {
+	mu.RLock()
+	defer mu.RUnlock()
+	result := make([]Stats, 0, len(queues))
+	for _, q := range queues {
+		result = append(result, q.stats())
+	}
+	return result
+}
+
+// Close 停止消费者，内存中未写入的记录落盘
+func Close() error {
+	mu.RLock()
+	list := queues
+	mu.RUnlock()
+	var err error
+	for _, q := range list {
+		q.stopOnce.Do(func() { close(q.stop) })
+	}
+	for _, q := range list {
+		q.wg.Wait()
+		if q.wal != nil {
+			err = errors.Join(err, q.wal.close())
+		}
+	}
+	return err
+}
+
+func dir() string {
+	if config.Cfg.Spill.Path != "" {
+		return config.Cfg.Spill.Path
+	}
+	return filepath.Join(config.Home, "data", "spill")
+}
+
+func maxSize() int64 {
+	size := config.Cfg.Spill.MaxSize
+	if size <= 0 {
+		size = defaultMaxSize
+	}
+	return int64(size) << 20
+}
+
+func interval() time.Duration {
+	if config.Cfg.Spill.Interval > 0 {
+		return time.Duration(config.Cfg.Spill.Interval) * time.Second
+	}
+	return defaultInterval
+}
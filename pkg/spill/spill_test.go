@@ -0,0 +1,64 @@
+package spill
+
+import (
+	"context"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUpsertHandoff(t *testing.T) {
+	config.Cfg = &config.Yaml{}
+	config.Cfg.Spill.Path = t.TempDir()
+	config.Cfg.Spill.Interval = 1
+
+	// 按 _id 覆盖写入
+	var mu sync.Mutex
+	got := map[string]int{}
+	writer := func(_ context.Context, collection string, docs []bson.Raw) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, doc := range docs {
+			if collection == "devices" {
+				got[doc.Lookup("_id").StringValue()] = int(doc.Lookup("v").AsInt64())
+			}
+		}
+		return nil
+	}
+
+	// 内存队列长度为 0，启动前的记录全部交给落盘协程，按写入顺序重放
+	q := NewFixed("test", "test", "devices", 0, 10, writer)
+	start := time.Now()
+	q.Push(bson.M{"_id": "a", "v": 1})
+	q.Push(bson.M{"_id": "a", "v": 2})
+	q.Push(bson.M{"_id": "b", "v": 1})
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("Push blocked for %v", elapsed)
+	}
+	if s := q.stats(); s.Queued != 3 || s.Spilled != 0 {
+		t.Fatalf("before start: %+v", s)
+	}
+	q.Start(1)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for q.replayed.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("records not replayed: %+v", q.stats())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s := q.stats(); s.Spilled != 3 || s.Dropped != 0 || s.Pending != 0 {
+		t.Fatalf("after replay: %+v", s)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 2 || got["a"] != 2 || got["b"] != 1 {
+		t.Fatalf("upserted documents = %v", got)
+	}
+}
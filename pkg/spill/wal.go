@@ -0,0 +1,212 @@
+package spill
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 磁盘暂存段
+// 每个数据集一个目录，记录为连续的 bson 文档 {c: 集合名, d: 文档}。
+// 记录追加到当前段，超过段大小时切换新段；重放前关闭当前段，已关闭的段按序号重放，全部写入后删除
+
+const segmentSize = 16 << 20
+
+var errFull = errors.New("spill is full")
+
+// 暂存记录
+type record struct {
+	Collection string   `bson:"c"`
+	Doc        bson.Raw `bson:"d"`
+}
+
+type wal struct {
+	dir     string
+	maxSize int64
+	mu      sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	seq     uint64
+	current int64        // 当前段字节数
+	size    atomic.Int64 // 全部段字节数
+}
+
+func openWAL(dir string, maxSize int64) (*wal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	w := &wal{dir: dir, maxSize: maxSize}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		seq, ok := segmentSeq(entry.Name())
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		w.size.Add(info.Size())
+		w.seq = max(w.seq, seq)
+	}
+	return w, nil
+}
+
+func segmentName(seq uint64) string {
+	return fmt.Sprintf("%016d.wal", seq)
+}
+
+func segmentSeq(name string) (uint64, bool) {
+	if !strings.HasSuffix(name, ".wal") {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(strings.TrimSuffix(name, ".wal"), 10, 64)
+	return seq, err == nil
+}
+
+// append 追加记录，超出容量时返回已写入数量与 errFull
+func (w *wal) append(records []record) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, r := range records {
+		data, err := bson.Marshal(r)
+		if err != nil {
+			return i, err
+		}
+		if w.size.Load()+int64(len(data)) > w.maxSize {
+			if i > 0 {
+				err = w.writer.Flush()
+			}
+			return i, errors.Join(errFull, err)
+		}
+		if w.file == nil || w.current >= segmentSize {
+			if err = w.next(); err != nil {
+				return i, err
+			}
+		}
+		if _, err = w.writer.Write(data); err != nil {
+			return i, err
+		}
+		w.current += int64(len(data))
+		w.size.Add(int64(len(data)))
+	}
+	if w.writer == nil {
+		return len(records), nil
+	}
+	return len(records), w.writer.Flush()
+}
+
+// 切换到新段
+func (w *wal) next() error {
+	if err := w.closeSegment(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(w.dir, segmentName(w.seq+1)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w.seq++
+	w.file, w.writer, w.current = f, bufio.NewWriterSize(f, 64<<10), 0
+	return nil
+}
+
+func (w *wal) closeSegment() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.writer.Flush()
+	if syncErr := w.file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file, w.writer, w.current = nil, nil, 0
+	return err
+}
+
+// sealed 关闭当前段，返回待重放的段，按序号升序
+func (w *wal) sealed() ([]string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.current > 0 {
+		if err := w.closeSegment(); err != nil {
+			return nil, err
+		}
+	}
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []uint64
+	for _, entry := range entries {
+		seq, ok := segmentSeq(entry.Name())
+		// 当前打开的段为空，不参与重放
+		if !ok || (w.file != nil && seq == w.seq) {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	paths := make([]string, len(seqs))
+	for i, seq := range seqs {
+		paths[i] = filepath.Join(w.dir, segmentName(seq))
+	}
+	return paths, nil
+}
+
+// remove 删除已重放的段
+func (w *wal) remove(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); err != nil {
+		return err
+	}
+	w.size.Add(-info.Size())
+	return nil
+}
+
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closeSegment()
+}
+
+// readSegment 读取段内记录，进程异常退出导致尾部不完整时返回损坏的字节数
+func readSegment(path string) ([]record, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	var records []record
+	for off := 0; off < len(data); {
+		if len(data)-off < 5 {
+			return records, len(data) - off, nil
+		}
+		n := int(binary.LittleEndian.Uint32(data[off:]))
+		if n < 5 || off+n > len(data) {
+			return records, len(data) - off, nil
+		}
+		var r record
+		if err = bson.Unmarshal(data[off:off+n], &r); err != nil {
+			return records, len(data) - off, nil
+		}
+		records = append(records, r)
+		off += n
+	}
+	return records, 0, nil
+}
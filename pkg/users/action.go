@@ -0,0 +1,226 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/exemption"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+// 处置动作
+// 计费系统 redis 回调、RFC5176 CoA/Disconnect、HTTP 回调与本地脚本统一为 EnforcementAction，
+// 按控制策略名称 > 产品ID > 默认 选择，执行结果记录在对应的处置记录上
+
+const (
+	ActionTypeRedis  = "redis"
+	ActionTypeRadius = "radius"
+	ActionTypeHTTP   = "http"
+	ActionTypeScript = "script"
+
+	defaultActionTimeout = 10
+)
+
+// EnforceRequest 处置请求
+type EnforceRequest struct {
+	Action   string // warn disable escalate reapply
+	User     types.User
+	Record   *types.ProxyRecord
+	Controls types.Controls
+	Time     time.Time
+}
+
+// EnforcementAction 处置动作
+type EnforcementAction interface {
+	Name() string
+	Type() string
+	// Execute 下发处置，返回执行详情
+	Execute(ctx context.Context, req EnforceRequest) (string, error)
+}
+
+// 内置动作，未配置时使用
+var hookAction EnforcementAction = &redisAction{name: "hook"}
+
+var (
+	defaultActions []EnforcementAction
+	productActions map[string][]EnforcementAction
+	controlActions map[string][]EnforcementAction
+	actionTimeouts map[string]time.Duration
+)
+
+// 按配置创建处置动作
+func setupActions() error {
+	c := config.Cfg.Enforcement
+	actions := make(map[string]EnforcementAction)
+	timeouts := make(map[string]time.Duration)
+	for _, e := range c.Actions {
+		if e.Name == "" {
+			e.Name = e.Type
+		}
+		if _, ok := actions[e.Name]; ok {
+			return fmt.Errorf("duplicate enforcement action: %s", e.Name)
+		}
+		action, err := newAction(e)
+		if err != nil {
+			return fmt.Errorf("enforcement action %s: %w", e.Name, err)
+		}
+		actions[e.Name] = action
+		timeout := e.Timeout
+		if timeout <= 0 {
+			timeout = defaultActionTimeout
+		}
+		timeouts[e.Name] = time.Duration(timeout) * time.Second
+	}
+
+	lookup := func(names []string) ([]EnforcementAction, error) {
+		list := make([]EnforcementAction, 0, len(names))
+		for _, name := range names {
+			action, ok := actions[name]
+			if !ok {
+				return nil, fmt.Errorf("enforcement action not found: %s", name)
+			}
+			list = append(list, action)
+		}
+		return list, nil
+	}
+	defaults, err := lookup(c.Default)
+	if err != nil {
+		return err
+	}
+	products := make(map[string][]EnforcementAction)
+	for product, names := range c.Products {
+		if products[product], err = lookup(names); err != nil {
+			return fmt.Errorf("products %s: %w", product, err)
+		}
+	}
+	controls := make(map[string][]EnforcementAction)
+	for control, names := range c.Controls {
+		if controls[control], err = lookup(names); err != nil {
+			return fmt.Errorf("controls %s: %w", control, err)
+		}
+	}
+
+	defaultActions, productActions, controlActions, actionTimeouts = defaults, products, controls, timeouts
+	zap.L().Info("处置动作加载完成", zap.Int("actions", len(actions)), zap.Int("default", len(defaults)))
+	return nil
+}
+
+func newAction(e config.EnforceAction) (EnforcementAction, error) {
+	switch e.Type {
+	case ActionTypeRedis:
+		return &redisAction{name: e.Name}, nil
+	case ActionTypeRadius:
+		return newRadiusAction(e)
+	case ActionTypeHTTP:
+		return newHTTPAction(e)
+	case ActionTypeScript:
+		return newScriptAction(e)
+	default:
+		return nil, fmt.Errorf("unsupported enforcement action type: %s", e.Type)
+	}
+}
+
+// 选择处置动作
+func selectActions(user types.User, controls types.Controls) []EnforcementAction {
+	if list, ok := controlActions[controls.ControlName]; ok && controls.ControlName != "" {
+		return list
+	}
+	if list, ok := productActions[strconv.Itoa(user.ProductsID)]; ok {
+		return list
+	}
+	if len(defaultActions) > 0 {
+		return defaultActions
+	}
+	return []EnforcementAction{hookAction}
+}
+
+// 下发处置，模拟模式只记录不下发；动作可能涉及网络重试，异步执行后回写结果
+func dispatch(req EnforceRequest) {
+	if Simulating() {
+		return
+	}
+	if exemption.MatchUser(req.User) {
+		exemption.Skip(exemption.PointHook)
+		zap.L().Info("豁免用户，跳过下发", zap.String("user", req.User.UserName))
+		return
+	}
+	actions := selectActions(req.User, req.Controls)
+	go func() {
+		results := make([]types.EnforcementResult, 0, len(actions))
+		for _, action := range actions {
+			results = append(results, execute(action, req))
+		}
+		recordResults(req.User.UserName, req.Time, results)
+	}()
+}
+
+func execute(action EnforcementAction, req EnforceRequest) types.EnforcementResult {
+	timeout, ok := actionTimeouts[action.Name()]
+	if !ok {
+		timeout = defaultActionTimeout * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result := types.EnforcementResult{Time: time.Now(), Action: action.Name(), Type: action.Type()}
+	detail, err := action.Execute(ctx, req)
+	result.Detail = detail
+	if err != nil {
+		result.Error = err.Error()
+		zap.L().Error("处置下发失败", zap.String("user", req.User.UserName), zap.String("action", action.Name()), zap.Error(err))
+	} else {
+		result.Success = true
+		zap.L().Info("处置下发完成", zap.String("user", req.User.UserName), zap.String("action", action.Name()), zap.String("detail", detail))
+	}
+	return result
+}
+
+// 将执行结果写入对应的处置记录
+func recordResults(username string, at time.Time, results []types.EnforcementResult) {
+	if at.IsZero() || len(results) == 0 {
+		return
+	}
+	enforcementsLock.Lock()
+	state, ok := enforcements[username]
+	if !ok {
+		enforcementsLock.Unlock()
+		return
+	}
+	found := false
+	for i := len(state.Events) - 1; i >= 0; i-- {
+		if state.Events[i].Time.Equal(at) {
+			state.Events[i].Results = results
+			found = true
+			break
+		}
+	}
+	snapshot := copyState(state)
+	enforcementsLock.Unlock()
+
+	if found {
+		saveEnforcement(snapshot)
+	}
+}
+
+// 计费系统在线表回调
+type redisAction struct {
+	name string
+}
+
+func (a *redisAction) Name() string {
+	return a.name
+}
+
+func (a *redisAction) Type() string {
+	return ActionTypeRedis
+}
+
+func (a *redisAction) Execute(ctx context.Context, req EnforceRequest) (string, error) {
+	if err := HookDropUser(req.User, req.Record); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("rad_online_id=%d", req.User.RadOnlineID), nil
+}
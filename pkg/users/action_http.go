@@ -0,0 +1,100 @@
+package users
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTP 回调与本地脚本共用的处置内容
+
+type actionPayload struct {
+	Action      string    `json:"action"`
+	UserName    string    `json:"user_name"`
+	IP          string    `json:"ip"`
+	UserMac     string    `json:"user_mac"`
+	ProductsID  int       `json:"products_id"`
+	SessionID   string    `json:"session_id"`
+	NasIP       string    `json:"nas_ip"`
+	Control     string    `json:"control"`
+	PcCount     int       `json:"pc_count"`
+	MobileCount int       `json:"mobile_count"`
+	Time        time.Time `json:"time"`
+}
+
+func newActionPayload(req EnforceRequest) actionPayload {
+	p := actionPayload{
+		Action:     req.Action,
+		UserName:   req.User.UserName,
+		IP:         req.User.IP,
+		UserMac:    req.User.UserMac,
+		ProductsID: req.User.ProductsID,
+		SessionID:  req.User.SessionID,
+		NasIP:      req.User.NasIP,
+		Control:    req.Controls.ControlName,
+		Time:       req.Time,
+	}
+	if req.Record != nil {
+		p.PcCount, p.MobileCount = req.Record.PcCount, req.Record.MobileCount
+	}
+	if p.Time.IsZero() {
+		p.Time = time.Now()
+	}
+	return p
+}
+
+type httpAction struct {
+	cfg    config.EnforceAction
+	client *http.Client
+}
+
+func newHTTPAction(e config.EnforceAction) (*httpAction, error) {
+	if e.URL == "" {
+		return nil, errors.New("http callback url is empty")
+	}
+	if e.Method == "" {
+		e.Method = http.MethodPost
+	}
+	e.Method = strings.ToUpper(e.Method)
+	return &httpAction{cfg: e, client: &http.Client{}}, nil
+}
+
+func (a *httpAction) Name() string {
+	return a.cfg.Name
+}
+
+func (a *httpAction) Type() string {
+	return ActionTypeHTTP
+}
+
+func (a *httpAction) Execute(ctx context.Context, req EnforceRequest) (string, error) {
+	body, err := json.Marshal(newActionPayload(req))
+	if err != nil {
+		return "", err
+	}
+	request, err := http.NewRequestWithContext(ctx, a.cfg.Method, a.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for k, v := range a.cfg.Headers {
+		request.Header.Set(k, v)
+	}
+	resp, err := a.client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return resp.Status, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.Status, nil
+}
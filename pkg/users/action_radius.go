@@ -0,0 +1,165 @@
+package users
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/protocols"
+	"github.com/google/gopacket/layers"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// RADIUS 动态授权
+// 向 NAS 发送 RFC5176 Disconnect-Request 或 CoA-Request，超时按相同 Identifier 重传
+
+const (
+	radiusModeDisconnect = "disconnect"
+	radiusModeCoA        = "coa"
+
+	defaultRadiusDAPort    = "3799"
+	defaultRadiusRetries   = 3
+	radiusAttributeEventTS = layers.RADIUSAttributeType(55) // RFC5176 3.4. Event-Timestamp
+)
+
+// 单次等待应答的时长
+var radiusAttemptTimeout = 3 * time.Second
+
+type radiusAction struct {
+	cfg        config.EnforceAction
+	address    string
+	attributes []protocols.RadiusAttribute
+	identifier atomic.Uint32
+}
+
+func newRadiusAction(e config.EnforceAction) (*radiusAction, error) {
+	if e.Address == "" {
+		return nil, errors.New("radius nas address is empty")
+	}
+	if e.Secret == "" {
+		return nil, errors.New("radius secret is empty")
+	}
+	switch e.Mode {
+	case "":
+		e.Mode = radiusModeDisconnect
+	case radiusModeDisconnect, radiusModeCoA:
+	default:
+		return nil, fmt.Errorf("unsupported radius mode: %s", e.Mode)
+	}
+	address := e.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, defaultRadiusDAPort)
+	}
+	a := &radiusAction{cfg: e, address: address}
+	for key, value := range e.Attributes {
+		t, err := strconv.Atoi(key)
+		if err != nil || t <= 0 || t > 255 {
+			return nil, fmt.Errorf("invalid radius attribute: %s", key)
+		}
+		a.attributes = append(a.attributes, protocols.RadiusAttribute{Type: layers.RADIUSAttributeType(t), Value: []byte(value)})
+	}
+	return a, nil
+}
+
+func (a *radiusAction) Name() string {
+	return a.cfg.Name
+}
+
+func (a *radiusAction) Type() string {
+	return ActionTypeRadius
+}
+
+func (a *radiusAction) Execute(ctx context.Context, req EnforceRequest) (string, error) {
+	code := protocols.RadiusDisconnectRequest
+	if a.cfg.Mode == radiusModeCoA {
+		code = protocols.RadiusCoARequest
+	}
+	packet, err := protocols.BuildRadiusRequest(code, uint8(a.identifier.Add(1)), a.requestAttributes(req), a.cfg.Secret)
+	if err != nil {
+		return "", err
+	}
+	retries := a.cfg.Retries
+	if retries <= 0 {
+		retries = defaultRadiusRetries
+	}
+	return a.exchange(ctx, packet, retries)
+}
+
+// 会话标识：User-Name、Framed-IP-Address、Calling-Station-Id、Acct-Session-Id，CoA 再附加配置的授权属性
+func (a *radiusAction) requestAttributes(req EnforceRequest) []protocols.RadiusAttribute {
+	user := req.User
+	attrs := []protocols.RadiusAttribute{
+		{Type: layers.RADIUSAttributeTypeUserName, Value: []byte(user.UserName)},
+	}
+	if ip := net.ParseIP(user.IP).To4(); ip != nil {
+		attrs = append(attrs, protocols.RadiusAttribute{Type: layers.RADIUSAttributeTypeFramedIPAddress, Value: ip})
+	}
+	if ip := net.ParseIP(user.NasIP).To4(); ip != nil {
+		attrs = append(attrs, protocols.RadiusAttribute{Type: layers.RADIUSAttributeTypeNASIPAddress, Value: ip})
+	}
+	if user.UserMac != "" {
+		attrs = append(attrs, protocols.RadiusAttribute{Type: layers.RADIUSAttributeTypeCallingStationId, Value: []byte(user.UserMac)})
+	}
+	if user.SessionID != "" {
+		attrs = append(attrs, protocols.RadiusAttribute{Type: layers.RADIUSAttributeTypeAcctSessionId, Value: []byte(user.SessionID)})
+	}
+	timestamp := make([]byte, 4)
+	binary.BigEndian.PutUint32(timestamp, uint32(time.Now().Unix()))
+	attrs = append(attrs, protocols.RadiusAttribute{Type: radiusAttributeEventTS, Value: timestamp})
+	if a.cfg.Mode == radiusModeCoA {
+		attrs = append(attrs, a.attributes...)
+	}
+	return attrs
+}
+
+// 发送请求并等待应答，每次等待不超过 radiusAttemptTimeout 且不超过 ctx 截止时间
+func (a *radiusAction) exchange(ctx context.Context, packet []byte, retries int) (string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", a.address)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 4096)
+	lastErr := errors.New("no response")
+	for attempt := 1; attempt <= retries; attempt++ {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("%w after %d attempts: %v", ctx.Err(), attempt-1, lastErr)
+		}
+		if _, err = conn.Write(packet); err != nil {
+			return "", err
+		}
+		deadline := time.Now().Add(radiusAttemptTimeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		_ = conn.SetReadDeadline(deadline)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				lastErr = err
+				break
+			}
+			code, cause, err := protocols.ParseRadiusResponse(buf[:n], packet, a.cfg.Secret)
+			if err != nil {
+				// 过期或伪造的应答，继续等待
+				lastErr = err
+				continue
+			}
+			switch code {
+			case protocols.RadiusDisconnectACK, protocols.RadiusCoAACK:
+				return fmt.Sprintf("%s ack attempts=%d", a.cfg.Mode, attempt), nil
+			case protocols.RadiusDisconnectNAK, protocols.RadiusCoANAK:
+				return fmt.Sprintf("attempts=%d", attempt), fmt.Errorf("%s nak error-cause=%d", a.cfg.Mode, cause)
+			default:
+				lastErr = fmt.Errorf("unexpected radius code %d", code)
+			}
+		}
+	}
+	return "", fmt.Errorf("no response from %s after %d attempts: %v", a.address, retries, lastErr)
+}
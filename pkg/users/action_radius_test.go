@@ -0,0 +1,266 @@
+package users
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/protocols"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSecret = "testing123"
+
+var testUser = types.User{
+	UserName:  "alice",
+	IP:        "10.0.0.8",
+	NasIP:     "192.168.1.1",
+	UserMac:   "aa:bb:cc:dd:ee:ff",
+	SessionID: "5f3a0001",
+}
+
+// 本地 NAS，按收到的请求序号决定应答
+type fakeNAS struct {
+	conn     net.PacketConn
+	mu       sync.Mutex
+	requests [][]byte
+}
+
+func newFakeNAS(t *testing.T, reply func(n int, req []byte) [][]byte) *fakeNAS {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	nas := &fakeNAS{conn: conn}
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := append([]byte(nil), buf[:n]...)
+			nas.mu.Lock()
+			nas.requests = append(nas.requests, req)
+			count := len(nas.requests)
+			nas.mu.Unlock()
+			for _, resp := range reply(count, req) {
+				_, _ = conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	return nas
+}
+
+func (n *fakeNAS) received() [][]byte {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([][]byte(nil), n.requests...)
+}
+
+func (n *fakeNAS) action(t *testing.T, mode string, retries int) *radiusAction {
+	a, err := newRadiusAction(config.EnforceAction{
+		Name:       "nas",
+		Type:       ActionTypeRadius,
+		Address:    n.conn.LocalAddr().String(),
+		Secret:     testSecret,
+		Mode:       mode,
+		Retries:    retries,
+		Attributes: map[string]string{"11": "proxy-limit"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// 构造应答，Response Authenticator = MD5(Code+Identifier+Length+Request Authenticator+属性+密钥)
+func radiusResponse(code layers.RADIUSCode, req []byte, secret string, cause int) []byte {
+	p := []byte{byte(code), req[1], 0, 0}
+	p = append(p, make([]byte, 16)...)
+	if cause > 0 {
+		v := make([]byte, 4)
+		binary.BigEndian.PutUint32(v, uint32(cause))
+		p = append(p, byte(protocols.RadiusAttributeErrorCause), 6)
+		p = append(p, v...)
+	}
+	binary.BigEndian.PutUint16(p[2:4], uint16(len(p)))
+	h := md5.New()
+	h.Write(p[:4])
+	h.Write(req[4:20])
+	h.Write(p[20:])
+	h.Write([]byte(secret))
+	copy(p[4:20], h.Sum(nil))
+	return p
+}
+
+func setAttemptTimeout(t *testing.T, d time.Duration) {
+	old := radiusAttemptTimeout
+	radiusAttemptTimeout = d
+	t.Cleanup(func() { radiusAttemptTimeout = old })
+}
+
+func decodeRadius(t *testing.T, data []byte) *layers.RADIUS {
+	t.Helper()
+	r := &layers.RADIUS{}
+	if err := r.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func attribute(r *layers.RADIUS, typ layers.RADIUSAttributeType) ([]byte, bool) {
+	for _, attr := range r.Attributes {
+		if attr.Type == typ {
+			return attr.Value, true
+		}
+	}
+	return nil, false
+}
+
+func TestRadiusRequest(t *testing.T) {
+	for _, c := range []struct {
+		mode string
+		code layers.RADIUSCode
+		ack  layers.RADIUSCode
+	}{
+		{radiusModeDisconnect, protocols.RadiusDisconnectRequest, protocols.RadiusDisconnectACK},
+		{radiusModeCoA, protocols.RadiusCoARequest, protocols.RadiusCoAACK},
+	} {
+		t.Run(c.mode, func(t *testing.T) {
+			nas := newFakeNAS(t, func(_ int, req []byte) [][]byte {
+				return [][]byte{radiusResponse(c.ack, req, testSecret, 0)}
+			})
+			result, err := nas.action(t, c.mode, 1).Execute(context.Background(), EnforceRequest{User: testUser})
+			if err != nil || result != c.mode+" ack attempts=1" {
+				t.Fatalf("Execute = %q %v", result, err)
+			}
+
+			req := nas.received()[0]
+			// RFC5176 3. Request Authenticator = MD5(Code+Identifier+Length+16个0+属性+密钥)
+			h := md5.New()
+			h.Write(req[:4])
+			h.Write(make([]byte, 16))
+			h.Write(req[20:])
+			h.Write([]byte(testSecret))
+			if !bytes.Equal(h.Sum(nil), req[4:20]) {
+				t.Fatal("request authenticator mismatch")
+			}
+
+			r := decodeRadius(t, req)
+			if r.Code != c.code {
+				t.Fatalf("code = %d, want %d", r.Code, c.code)
+			}
+			want := map[layers.RADIUSAttributeType][]byte{
+				layers.RADIUSAttributeTypeUserName:         []byte("alice"),
+				layers.RADIUSAttributeTypeFramedIPAddress:  net.ParseIP("10.0.0.8").To4(),
+				layers.RADIUSAttributeTypeNASIPAddress:     net.ParseIP("192.168.1.1").To4(),
+				layers.RADIUSAttributeTypeCallingStationId: []byte("aa:bb:cc:dd:ee:ff"),
+				layers.RADIUSAttributeTypeAcctSessionId:    []byte("5f3a0001"),
+			}
+			for typ, value := range want {
+				if got, ok := attribute(r, typ); !ok || !bytes.Equal(got, value) {
+					t.Errorf("attribute %d = %v, want %v", typ, got, value)
+				}
+			}
+			if ts, ok := attribute(r, radiusAttributeEventTS); !ok || len(ts) != 4 {
+				t.Errorf("missing Event-Timestamp")
+			}
+			// 授权属性只在 CoA 中携带
+			filter, ok := attribute(r, layers.RADIUSAttributeTypeFilterId)
+			if c.mode == radiusModeCoA && (!ok || string(filter) != "proxy-limit") {
+				t.Errorf("CoA Filter-Id = %q", filter)
+			}
+			if c.mode == radiusModeDisconnect && ok {
+				t.Errorf("Disconnect carries Filter-Id")
+			}
+		})
+	}
+}
+
+func TestRadiusRetry(t *testing.T) {
+	setAttemptTimeout(t, 200*time.Millisecond)
+	// 丢弃第一个请求，应答重传
+	nas := newFakeNAS(t, func(n int, req []byte) [][]byte {
+		if n == 1 {
+			return nil
+		}
+		return [][]byte{radiusResponse(protocols.RadiusDisconnectACK, req, testSecret, 0)}
+	})
+	result, err := nas.action(t, radiusModeDisconnect, 3).Execute(context.Background(), EnforceRequest{User: testUser})
+	if err != nil || result != "disconnect ack attempts=2" {
+		t.Fatalf("Execute = %q %v", result, err)
+	}
+	requests := nas.received()
+	if len(requests) != 2 || !bytes.Equal(requests[0], requests[1]) {
+		t.Fatalf("retransmission should repeat the same packet, got %d requests", len(requests))
+	}
+}
+
+func TestRadiusNoResponse(t *testing.T) {
+	setAttemptTimeout(t, 100*time.Millisecond)
+	nas := newFakeNAS(t, func(int, []byte) [][]byte { return nil })
+	_, err := nas.action(t, radiusModeDisconnect, 2).Execute(context.Background(), EnforceRequest{User: testUser})
+	if err == nil || !strings.Contains(err.Error(), "after 2 attempts") {
+		t.Fatalf("Execute = %v", err)
+	}
+	if n := len(nas.received()); n != 2 {
+		t.Fatalf("sent %d requests, want 2", n)
+	}
+}
+
+func TestRadiusNAK(t *testing.T) {
+	nas := newFakeNAS(t, func(_ int, req []byte) [][]byte {
+		return [][]byte{radiusResponse(protocols.RadiusCoANAK, req, testSecret, 503)}
+	})
+	result, err := nas.action(t, radiusModeCoA, 1).Execute(context.Background(), EnforceRequest{User: testUser})
+	if err == nil || err.Error() != "coa nak error-cause=503" || result != "attempts=1" {
+		t.Fatalf("Execute = %q %v", result, err)
+	}
+}
+
+func TestRadiusIgnoresForgedResponse(t *testing.T) {
+	setAttemptTimeout(t, time.Second)
+	// 先返回密钥错误与标识不符的应答，再返回正确应答
+	nas := newFakeNAS(t, func(_ int, req []byte) [][]byte {
+		other := append([]byte(nil), req...)
+		other[1]++
+		return [][]byte{
+			radiusResponse(protocols.RadiusDisconnectACK, req, "wrong", 0),
+			radiusResponse(protocols.RadiusDisconnectACK, other, testSecret, 0),
+			radiusResponse(protocols.RadiusDisconnectNAK, req, testSecret, 0),
+		}
+	})
+	_, err := nas.action(t, radiusModeDisconnect, 1).Execute(context.Background(), EnforceRequest{User: testUser})
+	if err == nil || !strings.Contains(err.Error(), "disconnect nak") {
+		t.Fatalf("Execute = %v, want nak from the authentic response", err)
+	}
+}
+
+func TestParseRadiusResponse(t *testing.T) {
+	req, err := protocols.BuildRadiusRequest(protocols.RadiusDisconnectRequest, 7, nil, testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, cause, err := protocols.ParseRadiusResponse(radiusResponse(protocols.RadiusDisconnectNAK, req, testSecret, 201), req, testSecret)
+	if err != nil || code != protocols.RadiusDisconnectNAK || cause != 201 {
+		t.Fatalf("ParseRadiusResponse = %d %d %v", code, cause, err)
+	}
+	if _, _, err = protocols.ParseRadiusResponse(radiusResponse(protocols.RadiusDisconnectACK, req, "wrong", 0), req, testSecret); err != protocols.ErrAuthenticator {
+		t.Fatalf("wrong secret = %v", err)
+	}
+	other := append([]byte(nil), req...)
+	other[1] = 8
+	if _, _, err = protocols.ParseRadiusResponse(radiusResponse(protocols.RadiusDisconnectACK, other, testSecret, 0), req, testSecret); err != protocols.ErrResponse {
+		t.Fatalf("wrong identifier = %v", err)
+	}
+}
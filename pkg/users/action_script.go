@@ -0,0 +1,66 @@
+package users
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// 本地脚本
+// 处置内容以 DPI_ 开头的环境变量传入，同时以json写入标准输入，退出码非0视为失败
+
+const scriptOutputLimit = 512
+
+type scriptAction struct {
+	cfg config.EnforceAction
+}
+
+func newScriptAction(e config.EnforceAction) (*scriptAction, error) {
+	if e.Command == "" {
+		return nil, errors.New("script command is empty")
+	}
+	if _, err := exec.LookPath(e.Command); err != nil {
+		return nil, err
+	}
+	return &scriptAction{cfg: e}, nil
+}
+
+func (a *scriptAction) Name() string {
+	return a.cfg.Name
+}
+
+func (a *scriptAction) Type() string {
+	return ActionTypeScript
+}
+
+func (a *scriptAction) Execute(ctx context.Context, req EnforceRequest) (string, error) {
+	payload := newActionPayload(req)
+	stdin, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx, a.cfg.Command, a.cfg.Args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Env = append(os.Environ(),
+		"DPI_ACTION="+payload.Action,
+		"DPI_USER_NAME="+payload.UserName,
+		"DPI_IP="+payload.IP,
+		"DPI_USER_MAC="+payload.UserMac,
+		"DPI_PRODUCTS_ID="+strconv.Itoa(payload.ProductsID),
+		"DPI_SESSION_ID="+payload.SessionID,
+		"DPI_NAS_IP="+payload.NasIP,
+		"DPI_CONTROL="+payload.Control,
+	)
+	output, err := cmd.CombinedOutput()
+	detail := strings.TrimSpace(string(output))
+	if len(detail) > scriptOutputLimit {
+		detail = detail[:scriptOutputLimit]
+	}
+	return detail, err
+}
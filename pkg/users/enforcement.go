@@ -0,0 +1,306 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/clock"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"go.uber.org/zap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 代理处置阶梯
+// 1.窗口内首次违规仅警告
+// 2.窗口内再次违规，临时禁用 proxy_disable_time 分钟，到期自动解除
+// 3.临时禁用累计 proxy_times 次后，窗口内再次违规升级处置，需人工重置
+// 处置状态持久化至mongo，启动时恢复
+
+const (
+	defaultEnforceWindow      = 24 * time.Hour
+	defaultEnforceDisableTime = 30 * time.Minute
+	defaultEnforceHistory     = 50
+)
+
+var (
+	ErrEnforcementNotFound = errors.New("enforcement state not found")
+
+	enforcements     = make(map[string]*types.EnforcementState)
+	enforcementsLock sync.Mutex
+)
+
+// SetupEnforcement 加载处置动作与处置状态并启动自动解除
+func SetupEnforcement() error {
+	if err := setupActions(); err != nil {
+		zap.L().Error("加载处置动作失败", zap.Error(err))
+		return err
+	}
+	states, err := storage.Users().EnforcementStates(context.TODO())
+	if err != nil {
+		zap.L().Error("加载处置状态失败", zap.Error(err))
+		return err
+	}
+
+	enforcementsLock.Lock()
+	for i := range states {
+		enforcements[states[i].UserName] = &states[i]
+	}
+	enforcementsLock.Unlock()
+
+	zap.L().Info("加载处置状态完成", zap.Int("count", len(states)))
+	go startEnforcementRelease(time.Minute)
+	return nil
+}
+
+// Enforce 根据控制策略对代理用户进行处置，返回本次处置动作
+func Enforce(user types.User, pr *types.ProxyRecord, controls types.Controls) string {
+	now := clock.Now()
+
+	enforcementsLock.Lock()
+	state, ok := enforcements[user.UserName]
+	if !ok {
+		state = &types.EnforcementState{UserName: user.UserName}
+		enforcements[user.UserName] = state
+	}
+	// 升级处置期间不再重复计数，仅重新下发
+	if state.Level == types.LevelEscalate {
+		state.LastSeen = now
+		snapshot := copyState(state)
+		enforcementsLock.Unlock()
+		saveEnforcement(snapshot)
+		dispatch(EnforceRequest{Action: types.ActionReapply, User: user, Record: pr, Controls: controls})
+		return types.ActionReapply
+	}
+
+	state.Offences = append(trimOffences(state.Offences, now), now)
+	state.TotalOffences++
+	state.LastSeen = now
+
+	action := nextAction(state, controls)
+	switch action {
+	case types.ActionWarn:
+		state.Level = types.LevelWarn
+	case types.ActionDisable:
+		state.Level = types.LevelDisable
+		state.Disables++
+		state.DisabledUntil = now.Add(getDisableTime(controls))
+	case types.ActionEscalate:
+		state.Level = types.LevelEscalate
+		state.Disables++
+		state.DisabledUntil = time.Time{}
+	}
+	addEnforcementEvent(state, types.EnforcementEvent{
+		Time:     now,
+		Action:   action,
+		IP:       pr.IP,
+		Offences: len(state.Offences),
+		Remark:   controls.ControlName,
+	})
+	snapshot := copyState(state)
+	enforcementsLock.Unlock()
+
+	zap.L().Info("代理处置", zap.String("user", user.UserName), zap.String("ip", pr.IP), zap.String("action", action), zap.Int("offences", len(snapshot.Offences)))
+	saveEnforcement(snapshot)
+	if action != types.ActionWarn {
+		dispatch(EnforceRequest{Action: action, User: user, Record: pr, Controls: controls, Time: now})
+	}
+	return action
+}
+
+// 根据窗口内违规次数与已临时禁用次数计算处置动作
+func nextAction(state *types.EnforcementState, controls types.Controls) string {
+	maxLevel := types.EnforcementLevel(config.Cfg.Enforcement.MaxLevel)
+	if maxLevel <= types.LevelNone || maxLevel > types.LevelEscalate {
+		maxLevel = types.LevelEscalate
+	}
+	// 未开启禁止代理，只做警告
+	if controls.DisableProxy != 1 {
+		return types.ActionWarn
+	}
+	switch {
+	case len(state.Offences) <= 1:
+		return types.ActionWarn
+	case controls.ProxyTimes > 0 && state.Disables >= controls.ProxyTimes && maxLevel >= types.LevelEscalate:
+		return types.ActionEscalate
+	case maxLevel >= types.LevelDisable:
+		return types.ActionDisable
+	default:
+		return types.ActionWarn
+	}
+}
+
+// IsDisabled 用户是否处于禁用中
+func IsDisabled(username string) bool {
+	enforcementsLock.Lock()
+	defer enforcementsLock.Unlock()
+
+	state, ok := enforcements[username]
+	if !ok {
+		return false
+	}
+	return disabled(state, clock.Now())
+}
+
+func disabled(state *types.EnforcementState, now time.Time) bool {
+	switch state.Level {
+	case types.LevelEscalate:
+		return true
+	case types.LevelDisable:
+		return now.Before(state.DisabledUntil)
+	default:
+		return false
+	}
+}
+
+// GetEnforcement 获取用户处置状态
+func GetEnforcement(username string) (types.EnforcementState, error) {
+	enforcementsLock.Lock()
+	defer enforcementsLock.Unlock()
+
+	state, ok := enforcements[username]
+	if !ok {
+		return types.EnforcementState{}, ErrEnforcementNotFound
+	}
+	return copyState(state), nil
+}
+
+// ListEnforcement 获取处置状态列表，按最近违规时间倒序
+func ListEnforcement() []types.EnforcementState {
+	enforcementsLock.Lock()
+	result := make([]types.EnforcementState, 0, len(enforcements))
+	for _, state := range enforcements {
+		result = append(result, copyState(state))
+	}
+	enforcementsLock.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastSeen.After(result[j].LastSeen)
+	})
+	return result
+}
+
+// ResetEnforcement 人工重置用户处置状态
+func ResetEnforcement(username, remark string) error {
+	enforcementsLock.Lock()
+	state, ok := enforcements[username]
+	if !ok {
+		enforcementsLock.Unlock()
+		return ErrEnforcementNotFound
+	}
+	state.Level = types.LevelNone
+	state.Offences = nil
+	state.Disables = 0
+	state.DisabledUntil = time.Time{}
+	addEnforcementEvent(state, types.EnforcementEvent{Time: time.Now(), Action: types.ActionReset, Remark: remark})
+	snapshot := copyState(state)
+	enforcementsLock.Unlock()
+
+	zap.L().Info("重置处置状态", zap.String("user", username), zap.String("remark", remark))
+	saveEnforcement(snapshot)
+	return nil
+}
+
+// 登录时若仍在禁用期，重新下发
+// 判断与记录在同一把锁内完成，避免与 Enforce、重置、自动解除交错
+func reapplyEnforcement(user types.User) {
+	now := clock.Now()
+	enforcementsLock.Lock()
+	state, ok := enforcements[user.UserName]
+	if !ok || !disabled(state, now) {
+		enforcementsLock.Unlock()
+		return
+	}
+	addEnforcementEvent(state, types.EnforcementEvent{Time: now, Action: types.ActionReapply, IP: user.IP})
+	snapshot := copyState(state)
+	enforcementsLock.Unlock()
+
+	zap.L().Info("用户处于禁用期，重新下发", zap.String("user", user.UserName), zap.String("ip", user.IP))
+	pr := &types.ProxyRecord{IP: user.IP, Username: user.UserName, LastSeen: now}
+	saveEnforcement(snapshot)
+	dispatch(EnforceRequest{Action: types.ActionReapply, User: user, Record: pr, Time: now})
+}
+
+// 定期解除到期的临时禁用，并清理窗口外的违规记录
+func startEnforcementRelease(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := clock.Now()
+		var released []types.EnforcementState
+		enforcementsLock.Lock()
+		for _, state := range enforcements {
+			if state.Level != types.LevelDisable || disabled(state, now) {
+				continue
+			}
+			state.Level = types.LevelWarn
+			state.Offences = trimOffences(state.Offences, now)
+			state.DisabledUntil = time.Time{}
+			addEnforcementEvent(state, types.EnforcementEvent{Time: now, Action: types.ActionRelease, Offences: len(state.Offences)})
+			released = append(released, copyState(state))
+		}
+		enforcementsLock.Unlock()
+
+		for _, state := range released {
+			zap.L().Info("自动解除禁用", zap.String("user", state.UserName))
+			saveEnforcement(state)
+		}
+	}
+}
+
+// 剔除窗口外的违规记录
+func trimOffences(offences []time.Time, now time.Time) []time.Time {
+	border := now.Add(-getEnforceWindow())
+	result := offences[:0]
+	for _, t := range offences {
+		if t.After(border) {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+func addEnforcementEvent(state *types.EnforcementState, event types.EnforcementEvent) {
+	state.LastAction = event.Action
+	state.Events = append(state.Events, event)
+	history := config.Cfg.Enforcement.History
+	if history <= 0 {
+		history = defaultEnforceHistory
+	}
+	if len(state.Events) > history {
+		state.Events = state.Events[len(state.Events)-history:]
+	}
+}
+
+func copyState(state *types.EnforcementState) types.EnforcementState {
+	s := *state
+	s.Offences = append([]time.Time(nil), state.Offences...)
+	s.Events = append([]types.EnforcementEvent(nil), state.Events...)
+	return s
+}
+
+func saveEnforcement(state types.EnforcementState) {
+	if Simulating() {
+		return
+	}
+	if err := storage.Users().SaveEnforcementState(context.TODO(), state); err != nil {
+		zap.L().Error("保存处置状态失败", zap.String("user", state.UserName), zap.Error(err))
+	}
+}
+
+func getEnforceWindow() time.Duration {
+	if config.Cfg.Enforcement.Window <= 0 {
+		return defaultEnforceWindow
+	}
+	return time.Duration(config.Cfg.Enforcement.Window) * time.Minute
+}
+
+func getDisableTime(controls types.Controls) time.Duration {
+	if controls.ProxyDisableTime <= 0 {
+		return defaultEnforceDisableTime
+	}
+	return time.Duration(controls.ProxyDisableTime) * time.Minute
+}
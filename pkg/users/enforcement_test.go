@@ -0,0 +1,137 @@
+package users
+
+import (
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"testing"
+	"time"
+)
+
+// 模拟模式下不持久化、不下发，只计算处置阶梯
+func setupEnforceTest(t *testing.T, maxLevel int) {
+	t.Helper()
+	if config.Cfg == nil {
+		config.Cfg = &config.Yaml{}
+	}
+	enabled := simulation.enabled
+	simulation.enabled = true
+	config.Cfg.Enforcement.MaxLevel = maxLevel
+	enforcementsLock.Lock()
+	clear(enforcements)
+	enforcementsLock.Unlock()
+	t.Cleanup(func() {
+		simulation.enabled = enabled
+		config.Cfg.Enforcement.MaxLevel = 0
+	})
+}
+
+func enforceUser(name string) (types.User, *types.ProxyRecord) {
+	user := types.User{UserName: name, IP: "10.0.27.1"}
+	return user, &types.ProxyRecord{IP: user.IP, Username: name}
+}
+
+func TestEnforceLadder(t *testing.T) {
+	const (
+		warn     = types.ActionWarn
+		disable  = types.ActionDisable
+		escalate = types.ActionEscalate
+		reapply  = types.ActionReapply
+	)
+	tests := []struct {
+		name     string
+		controls types.Controls
+		maxLevel int
+		want     []string
+	}{
+		{"proxy_times=1", types.Controls{DisableProxy: 1, ProxyTimes: 1}, 0, []string{warn, disable, escalate, reapply}},
+		{"proxy_times=2", types.Controls{DisableProxy: 1, ProxyTimes: 2}, 0, []string{warn, disable, disable, escalate, reapply}},
+		{"proxy_times=3", types.Controls{DisableProxy: 1, ProxyTimes: 3}, 0, []string{warn, disable, disable, disable, escalate}},
+		{"proxy_times=0", types.Controls{DisableProxy: 1}, 0, []string{warn, disable, disable, disable}},
+		{"disable_proxy=0", types.Controls{ProxyTimes: 1}, 0, []string{warn, warn, warn}},
+		{"max_level=warn", types.Controls{DisableProxy: 1, ProxyTimes: 1}, int(types.LevelWarn), []string{warn, warn, warn}},
+		{"max_level=disable", types.Controls{DisableProxy: 1, ProxyTimes: 1}, int(types.LevelDisable), []string{warn, disable, disable, disable}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupEnforceTest(t, tt.maxLevel)
+			user, pr := enforceUser("ladder")
+			for n, want := range tt.want {
+				if got := Enforce(user, pr, tt.controls); got != want {
+					t.Fatalf("offence %d: %s, want %s", n+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEnforceState(t *testing.T) {
+	setupEnforceTest(t, 0)
+	controls := types.Controls{DisableProxy: 1, ProxyTimes: 2, ProxyDisableTime: 10}
+	user, pr := enforceUser("state")
+
+	Enforce(user, pr, controls)
+	if IsDisabled(user.UserName) {
+		t.Fatal("disabled after warning")
+	}
+	before := time.Now()
+	Enforce(user, pr, controls)
+	state, err := GetEnforcement(user.UserName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Level != types.LevelDisable || state.Disables != 1 || !IsDisabled(user.UserName) {
+		t.Fatalf("after disable %+v", state)
+	}
+	if until := state.DisabledUntil.Sub(before); until < 10*time.Minute || until > 11*time.Minute {
+		t.Fatalf("disabled until +%v, want proxy_disable_time", until)
+	}
+}
+
+func TestEnforceReset(t *testing.T) {
+	setupEnforceTest(t, 0)
+	controls := types.Controls{DisableProxy: 1, ProxyTimes: 1}
+	user, pr := enforceUser("reset")
+
+	for range 3 {
+		Enforce(user, pr, controls)
+	}
+	if err := ResetEnforcement(user.UserName, "test"); err != nil {
+		t.Fatal(err)
+	}
+	state, _ := GetEnforcement(user.UserName)
+	if state.Level != types.LevelNone || state.Disables != 0 || len(state.Offences) != 0 || IsDisabled(user.UserName) {
+		t.Fatalf("after reset %+v", state)
+	}
+	// 重置后重新从警告开始
+	for n, want := range []string{types.ActionWarn, types.ActionDisable, types.ActionEscalate} {
+		if got := Enforce(user, pr, controls); got != want {
+			t.Fatalf("offence %d after reset: %s, want %s", n+1, got, want)
+		}
+	}
+	if err := ResetEnforcement("nobody", ""); err != ErrEnforcementNotFound {
+		t.Fatalf("reset unknown user: %v", err)
+	}
+}
+
+func TestEnforceWindow(t *testing.T) {
+	setupEnforceTest(t, 0)
+	controls := types.Controls{DisableProxy: 1, ProxyTimes: 2}
+	user, pr := enforceUser("window")
+
+	Enforce(user, pr, controls)
+	Enforce(user, pr, controls)
+	// 违规记录移出窗口
+	enforcementsLock.Lock()
+	state := enforcements[user.UserName]
+	for i := range state.Offences {
+		state.Offences[i] = state.Offences[i].Add(-defaultEnforceWindow - time.Minute)
+	}
+	enforcementsLock.Unlock()
+
+	// 窗口内首次违规仍为警告，再次违规时已禁用次数累计，继续禁用直至升级
+	for n, want := range []string{types.ActionWarn, types.ActionDisable, types.ActionEscalate} {
+		if got := Enforce(user, pr, controls); got != want {
+			t.Fatalf("offence %d after window: %s, want %s", n+1, got, want)
+		}
+	}
+}
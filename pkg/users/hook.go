@@ -8,6 +8,7 @@ import (
 	"go.uber.org/zap"
 )
 
+// HookDropUser 修改计费系统在线表设备数并推送虚拟更新报文
 func HookDropUser(user types.User, pr *types.ProxyRecord) error {
 	// 这里不再次查询在线表了，直接写
 	rdb := redis.GetOnlineRedisClient()
@@ -17,7 +18,7 @@ func HookDropUser(user types.User, pr *types.ProxyRecord) error {
 	if ok := rdb.Exists(ctx, onlineKey).Val(); ok == 0 {
 		zap.L().Error("在线信息不存在", zap.String("key", onlineKey))
 		// 清空程序里该用户信息
-		DropUser(user.IP)
+		DropUser(UserKey(user))
 		return nil
 	}
 	// 修改用户在线表 设备数
@@ -0,0 +1,175 @@
+package users
+
+import (
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// IPv6 地址归属
+// 用户以标识(有IPv4时为IPv4，否则为首个IPv6地址或前缀)存储，IPv6 地址与委派前缀按最长前缀匹配到标识；
+// 终端地址同时登记其所在前缀，SLAAC 隐私地址随前缀归属同一用户。
+// 同一前缀被多个用户登记时以最后登记为准，注销时仅删除自己登记的前缀
+
+const defaultPrivacyPrefix = 64
+
+type prefixTable struct {
+	mu       sync.RWMutex
+	prefixes map[int]map[netip.Prefix]string // 前缀长度 -> 前缀 -> 用户标识
+	lengths  []int                           // 已登记的前缀长度，降序
+}
+
+var ipv6Table = &prefixTable{prefixes: make(map[int]map[netip.Prefix]string)}
+
+// UserKey 用户标识，在线表及各项IP状态均以此为键
+func UserKey(user types.User) string {
+	if user.IP != "" {
+		return user.IP
+	}
+	if len(user.IP6) > 0 {
+		return user.IP6[0]
+	}
+	return ""
+}
+
+// ResolveUser 查找地址所属用户标识，IPv4 精确匹配，IPv6 按最长前缀匹配
+func ResolveUser(ip string) (string, bool) {
+	if _, ok := OnlineUsers.Load(ip); ok {
+		return ip, true
+	}
+	if !strings.Contains(ip, ":") {
+		return "", false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", false
+	}
+	if addr.Is4In6() {
+		key := addr.Unmap().String()
+		_, ok := OnlineUsers.Load(key)
+		return key, ok
+	}
+	return ipv6Table.lookup(addr)
+}
+
+// 解析用户的 IPv6 地址与前缀
+func userPrefixes(user types.User) []netip.Prefix {
+	c := config.Cfg.UserSource.IPv6
+	privacy := c.PrivacyPrefix
+	if privacy <= 0 || privacy > 128 {
+		privacy = defaultPrivacyPrefix
+	}
+	var list []netip.Prefix
+	for _, value := range user.IP6 {
+		if !usableIP6(value) {
+			continue
+		}
+		if strings.Contains(value, "/") {
+			if prefix, err := netip.ParsePrefix(value); err == nil && prefix.Addr().Is6() {
+				list = append(list, prefix.Masked())
+			}
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil || !addr.Is6() {
+			continue
+		}
+		list = append(list, netip.PrefixFrom(addr, 128))
+		if !c.DisablePrivacy {
+			if prefix, err := addr.Prefix(privacy); err == nil {
+				list = append(list, prefix)
+			}
+		}
+	}
+	return list
+}
+
+func registerIPv6(key string, user types.User) {
+	prefixes := userPrefixes(user)
+	if len(prefixes) == 0 {
+		return
+	}
+	t := ipv6Table
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, prefix := range prefixes {
+		bits := prefix.Bits()
+		m, ok := t.prefixes[bits]
+		if !ok {
+			m = make(map[netip.Prefix]string)
+			t.prefixes[bits] = m
+			t.lengths = append(t.lengths, bits)
+			sort.Sort(sort.Reverse(sort.IntSlice(t.lengths)))
+		}
+		m[prefix] = key
+	}
+}
+
+func unregisterIPv6(key string, user types.User) {
+	prefixes := userPrefixes(user)
+	if len(prefixes) == 0 {
+		return
+	}
+	t := ipv6Table
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, prefix := range prefixes {
+		bits := prefix.Bits()
+		if m, ok := t.prefixes[bits]; ok && m[prefix] == key {
+			delete(m, prefix)
+		}
+	}
+}
+
+func (t *prefixTable) lookup(addr netip.Addr) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, bits := range t.lengths {
+		m := t.prefixes[bits]
+		if len(m) == 0 {
+			continue
+		}
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if key, ok := m[prefix]; ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// 事件中的 IPv6 地址与前缀
+func eventIP6(e *UserEvent) []string {
+	var list []string
+	for _, value := range []string{e.Ip6, e.Ip61, e.Ip62, e.Ip63} {
+		if value = strings.TrimSpace(value); usableIP6(value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// usableIP6 可用于归属的 IPv6 地址或前缀，计费系统以 :: 表示无地址，链路本地与组播地址不唯一
+func usableIP6(value string) bool {
+	value = strings.TrimSpace(value)
+	var addr netip.Addr
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return false
+		}
+		addr = prefix.Addr()
+	} else {
+		var err error
+		if addr, err = netip.ParseAddr(value); err != nil {
+			return false
+		}
+	}
+	return addr.Is6() && !addr.Is4In6() && !addr.IsUnspecified() &&
+		!addr.IsLinkLocalUnicast() && !addr.IsMulticast()
+}
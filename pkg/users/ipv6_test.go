@@ -0,0 +1,43 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	v9 "github.com/redis/go-redis/v9"
+	"slices"
+	"testing"
+)
+
+func TestEventIP6(t *testing.T) {
+	e := &UserEvent{Ip6: "::", Ip61: "fe80::1", Ip62: " 2001:db8:1::10 ", Ip63: "2001:db8:2::/56"}
+	want := []string{"2001:db8:1::10", "2001:db8:2::/56"}
+	if got := eventIP6(e); !slices.Equal(got, want) {
+		t.Fatalf("eventIP6 = %q, want %q", got, want)
+	}
+	for _, value := range []string{"", "0", "::", "::/0", "fe80::1", "fe80::/64", "ff02::1", "::ffff:10.0.0.1", "10.0.0.1"} {
+		if usableIP6(value) {
+			t.Errorf("usableIP6(%q) = true", value)
+		}
+	}
+}
+
+func TestSrunHashIP6(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := v9.NewClient(&v9.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	rdb.HSet(ctx, fmt.Sprintf(types.HashRadOnline, 1),
+		"rad_online_id", 1, "user_name", "alice", "ip", "10.0.0.8",
+		"ip6", "2001:db8::8", "ip6_1", "::", "ip6_2", "fe80::8", "ip6_3", "2001:db8:1::/56")
+	user, err := getHash(ctx, "1", rdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2001:db8::8", "2001:db8:1::/56"}
+	if user.UserName != "alice" || user.IP != "10.0.0.8" || !slices.Equal(user.IP6, want) {
+		t.Fatalf("getHash = %+v", user)
+	}
+}
@@ -0,0 +1,276 @@
+package users
+
+import (
+	"context"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/redis"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"go.uber.org/zap"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 在线用户对账
+// 以各来源的全量快照为准，与内存在线表比较出新增、下线与变更的用户并同步，
+// 补记 origin=reconcile 的上下线事件；读取失败的来源其用户保持不变。
+// 快照期间收到上下线事件的IP以事件为准，不参与本次对账
+
+const (
+	TriggerStartup   = "startup"
+	TriggerSchedule  = "schedule"
+	TriggerReconnect = "reconnect"
+	TriggerManual    = "manual"
+
+	originReconcile = "reconcile"
+
+	defaultHealthCheck = 10
+)
+
+// ReconcileResult 单次对账结果
+type ReconcileResult struct {
+	Trigger  string        `json:"trigger"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+	Online   int           `json:"online"` // 来源中的在线用户数
+	Added    int           `json:"added"`
+	Removed  int           `json:"removed"`
+	Changed  int           `json:"changed"`
+	Kept     int           `json:"kept"`    // 来源读取失败而保留的用户
+	Skipped  int           `json:"skipped"` // 对账期间有事件而跳过的IP
+	Error    string        `json:"error,omitempty"`
+}
+
+// ReconcileStats 对账统计，累计值反映事件通道的漂移程度
+type ReconcileStats struct {
+	Runs         int64           `json:"runs"`
+	Failures     int64           `json:"failures"`
+	TotalAdded   int64           `json:"total_added"`
+	TotalRemoved int64           `json:"total_removed"`
+	TotalChanged int64           `json:"total_changed"`
+	Reconnects   int64           `json:"reconnects"`
+	Last         ReconcileResult `json:"last"`
+}
+
+var (
+	reconcileMu    sync.Mutex // 同一时间仅运行一次对账
+	reconcileStats ReconcileStats
+	statsMu        sync.Mutex
+	// 最近一次上下线事件时间 ip -> time.Time
+	lastEvent sync.Map
+)
+
+// SyncOnlineUsers 启动时全量加载在线用户，不补记事件
+func SyncOnlineUsers() error {
+	_, err := Reconcile(TriggerStartup)
+	return err
+}
+
+// Reconcile 对账在线用户，全部来源失败时不做任何修改并返回错误
+func Reconcile(trigger string) (ReconcileResult, error) {
+	reconcileMu.Lock()
+	defer reconcileMu.Unlock()
+
+	started := time.Now()
+	result := ReconcileResult{Trigger: trigger, Time: started}
+	online, failed, err := snapshotSources(context.TODO())
+	if err != nil {
+		result.Duration = time.Since(started)
+		result.Error = err.Error()
+		recordReconcile(result)
+		return result, err
+	}
+	result.Online = len(online)
+	events := trigger != TriggerStartup
+
+	// 下线与变更
+	OnlineUsers.Range(func(key, value any) bool {
+		ip, current := key.(string), value.(types.User)
+		user, ok := online[ip]
+		delete(online, ip)
+		if eventAfter(ip, started) {
+			result.Skipped++
+			return true
+		}
+		switch {
+		case !ok && failed[current.Source]:
+			result.Kept++
+		case !ok:
+			result.Removed++
+			DropUser(ip)
+			if events {
+				reconcileEvent(2, current)
+			}
+		case user.UserName != current.UserName:
+			// 同一IP换了用户，按先下线再上线处理
+			result.Changed++
+			DropUser(ip)
+			storeUser(ip, user)
+			if events {
+				reconcileEvent(2, current)
+				reconcileEvent(1, user)
+				reapplyEnforcement(user)
+			}
+		case userChanged(current, user):
+			result.Changed++
+			storeUser(ip, user)
+			if events {
+				reconcileEvent(1, user)
+			}
+		case trigger == TriggerReconnect:
+			// redis 可能已重启，重新写入在线表
+			storeUser(ip, current)
+		}
+		return true
+	})
+
+	// 新增
+	for ip, user := range online {
+		if eventAfter(ip, started) {
+			result.Skipped++
+			continue
+		}
+		result.Added++
+		storeUser(ip, user)
+		if events {
+			reconcileEvent(1, user)
+			reapplyEnforcement(user)
+		}
+	}
+
+	// 清理早于本次对账的事件时间
+	lastEvent.Range(func(key, value any) bool {
+		if value.(time.Time).Before(started) {
+			lastEvent.Delete(key)
+		}
+		return true
+	})
+
+	result.Duration = time.Since(started)
+	recordReconcile(result)
+	zap.L().Info("在线用户对账完成",
+		zap.String("trigger", trigger),
+		zap.Int("online", result.Online),
+		zap.Int("added", result.Added),
+		zap.Int("removed", result.Removed),
+		zap.Int("changed", result.Changed),
+		zap.Int("kept", result.Kept),
+		zap.Duration("duration", result.Duration))
+	return result, nil
+}
+
+// GetReconcileStats 对账统计
+func GetReconcileStats() ReconcileStats {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	return reconcileStats
+}
+
+func recordReconcile(result ReconcileResult) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	reconcileStats.Runs++
+	if result.Error != "" {
+		reconcileStats.Failures++
+	}
+	if result.Trigger == TriggerReconnect {
+		reconcileStats.Reconnects++
+	}
+	// 启动加载不计入漂移
+	if result.Trigger != TriggerStartup {
+		reconcileStats.TotalAdded += int64(result.Added)
+		reconcileStats.TotalRemoved += int64(result.Removed)
+		reconcileStats.TotalChanged += int64(result.Changed)
+	}
+	reconcileStats.Last = result
+}
+
+// 记录上下线事件时间
+func markEvent(ip string) {
+	lastEvent.Store(ip, time.Now())
+}
+
+func eventAfter(ip string, t time.Time) bool {
+	v, ok := lastEvent.Load(ip)
+	return ok && !v.(time.Time).Before(t)
+}
+
+// 比较来源提供的字段，add_time 可能由来源按读取时间补全，不参与比较
+func userChanged(current, user types.User) bool {
+	return current.RadOnlineID != user.RadOnlineID ||
+		current.UserMac != user.UserMac ||
+		current.LineType != user.LineType ||
+		current.ProductsID != user.ProductsID ||
+		current.BillingID != user.BillingID ||
+		current.ContractID != user.ContractID ||
+		current.Source != user.Source ||
+		!slices.Equal(current.IP6, user.IP6)
+}
+
+// 补记对账产生的上下线事件
+func reconcileEvent(action int, user types.User) {
+	e := UserEvent{
+		Action:      action,
+		Origin:      originReconcile,
+		SessionId:   user.SessionID,
+		NasIp:       user.NasIP,
+		UserName:    user.UserName,
+		Ip:          user.IP,
+		UserMac:     user.UserMac,
+		ProductsId:  user.ProductsID,
+		BillingId:   user.BillingID,
+		ControlId:   user.ContractID,
+		RadOnlineId: user.RadOnlineID,
+		LineType:    user.LineType,
+		AddTime:     user.AddTime,
+	}
+	for i, ip6 := range user.IP6 {
+		switch i {
+		case 0:
+			e.Ip6 = ip6
+		case 1:
+			e.Ip61 = ip6
+		case 2:
+			e.Ip62 = ip6
+		case 3:
+			e.Ip63 = ip6
+		}
+	}
+	e.Save2Mongo()
+}
+
+// WatchRedis 定期检测 redis 连接，中断恢复后立即对账
+func WatchRedis() {
+	interval := config.Cfg.UserSource.HealthCheck
+	if interval <= 0 {
+		interval = defaultHealthCheck
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	down := false
+	for range ticker.C {
+		err := pingRedis()
+		switch {
+		case err != nil && !down:
+			down = true
+			zap.L().Warn("redis 连接中断", zap.Error(err))
+		case err == nil && down:
+			down = false
+			zap.L().Info("redis 连接恢复，开始对账")
+			_, _ = Reconcile(TriggerReconnect)
+		}
+	}
+}
+
+func pingRedis() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := redis.GetRedisClient().Ping(ctx).Err(); err != nil {
+		return err
+	}
+	if err := redis.GetOnlineRedisClient().Ping(ctx).Err(); err != nil {
+		return err
+	}
+	return redis.GetCacheRedisClient().Ping(ctx).Err()
+}
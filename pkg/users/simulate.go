@@ -0,0 +1,32 @@
+package users
+
+import "github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+
+// 模拟模式
+// 回放历史数据时使用，用户来自名单或按默认产品生成，处置结果只记录不下发
+
+var simulation struct {
+	enabled bool
+	product int
+}
+
+// SetupSimulation 开启模拟模式并载入用户名单，product 不为0时名单外的IP按该产品生成用户
+func SetupSimulation(list []types.User, product int) {
+	simulation.enabled, simulation.product = true, product
+	for _, user := range list {
+		storeUser(UserKey(user), user)
+	}
+}
+
+// Simulating 是否处于模拟模式
+func Simulating() bool {
+	return simulation.enabled
+}
+
+// 名单外的IP以IP作为用户名
+func simulatedUser(ip string) (types.User, bool) {
+	if !simulation.enabled || simulation.product == 0 {
+		return types.User{}, false
+	}
+	return types.User{UserName: ip, IP: ip, ProductsID: simulation.product}, true
+}
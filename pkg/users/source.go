@@ -0,0 +1,185 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/i18n"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// 在线用户来源
+// 计费系统、静态映射、DHCP 租约、HTTP 接口与 RADIUS 计费报文统一为 UserSource，按配置顺序合并
+
+const (
+	SourceSrun   = "srun"
+	SourceStatic = "static"
+	SourceDHCP   = "dhcp"
+	SourceHTTP   = "http"
+
+	defaultSyncInterval = 30
+)
+
+// UserSource 在线用户来源
+type UserSource interface {
+	Name() string
+	// Snapshot 全量在线用户
+	Snapshot(ctx context.Context) ([]types.User, error)
+	// Watch 持续推送上下线事件直到 ctx 结束，不支持增量的来源直接返回 nil
+	Watch(ctx context.Context, events chan<- types.UserEvent) error
+}
+
+var (
+	sources   []UserSource
+	sourcesMu sync.RWMutex
+)
+
+// SetupSources 按配置创建用户来源，未配置时使用计费系统
+func SetupSources() error {
+	entries := config.Cfg.UserSource.Sources
+	if len(entries) == 0 {
+		entries = []config.UserSourceEntry{{Name: SourceSrun, Type: SourceSrun}}
+	}
+	list := make([]UserSource, 0, len(entries))
+	names := make(map[string]bool)
+	for _, e := range entries {
+		if e.Name == "" {
+			e.Name = e.Type
+		}
+		if names[e.Name] {
+			return fmt.Errorf("duplicate user source: %s", e.Name)
+		}
+		names[e.Name] = true
+		source, err := newSource(e)
+		if err != nil {
+			return fmt.Errorf("user source %s: %w", e.Name, err)
+		}
+		list = append(list, source)
+	}
+	sourcesMu.Lock()
+	sources = list
+	sourcesMu.Unlock()
+	zap.L().Info("用户来源加载完成", zap.Strings("sources", sourceNames(list)))
+	return nil
+}
+
+func newSource(e config.UserSourceEntry) (UserSource, error) {
+	switch e.Type {
+	case SourceSrun:
+		return &srunSource{name: e.Name}, nil
+	case SourceStatic:
+		return newStaticSource(e)
+	case SourceDHCP:
+		return newDHCPSource(e)
+	case SourceHTTP:
+		return newHTTPSource(e)
+	case SourceRadius:
+		return newRadiusSource(e)
+	default:
+		return nil, fmt.Errorf("unsupported user source type: %s", e.Type)
+	}
+}
+
+func sourceNames(list []UserSource) []string {
+	names := make([]string, 0, len(list))
+	for _, s := range list {
+		names = append(names, s.Name())
+	}
+	return names
+}
+
+func getSources() []UserSource {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+	return sources
+}
+
+// SyncInterval 全量同步间隔
+func SyncInterval() time.Duration {
+	interval := config.Cfg.UserSource.Interval
+	if interval <= 0 {
+		interval = defaultSyncInterval
+	}
+	return time.Duration(interval) * time.Minute
+}
+
+// 从各来源读取全量在线用户，返回 用户标识 -> 用户及读取失败的来源，全部来源失败时返回错误
+func snapshotSources(ctx context.Context) (map[string]types.User, map[string]bool, error) {
+	list := getSources()
+	if len(list) == 0 {
+		return nil, nil, errors.New("no user source")
+	}
+	online := make(map[string]types.User)
+	failed := make(map[string]bool)
+	var lastErr error
+	for _, source := range list {
+		users, err := source.Snapshot(ctx)
+		if err != nil {
+			zap.L().Error(i18n.T("SyncOnlineUsers error"), zap.String("source", source.Name()), zap.Error(err))
+			failed[source.Name()] = true
+			lastErr = err
+			continue
+		}
+		for _, user := range users {
+			// 同一IP以靠前的来源为准
+			key := UserKey(user)
+			if _, ok := online[key]; ok || user.UserName == "" || key == "" {
+				continue
+			}
+			user.Source = source.Name()
+			online[key] = user
+		}
+	}
+	if len(failed) == len(list) {
+		return nil, nil, lastErr
+	}
+	return online, failed, nil
+}
+
+// ListenUserEvents 监听各来源的上下线事件
+func ListenUserEvents() {
+	events := make(chan types.UserEvent, 100)
+	for _, source := range getSources() {
+		go func(source UserSource) {
+			// 标记事件来源，对账时据此判断来源是否可用
+			watched := make(chan types.UserEvent)
+			go func() {
+				for e := range watched {
+					e.Origin = source.Name()
+					events <- e
+				}
+			}()
+			if err := source.Watch(context.Background(), watched); err != nil {
+				zap.L().Error("Watch user source failed", zap.String("source", source.Name()), zap.Error(err))
+			}
+			close(watched)
+		}(source)
+	}
+	for e := range events {
+		markEvent(e.Ip)
+		userEvent := UserEvent(e)
+		zap.L().Debug(i18n.T("Listen user events"), zap.Int("action", userEvent.Action), zap.String("username", userEvent.UserName))
+		if userEvent.Action == 1 {
+			// 上线
+			userEvent.LoadEvent()
+		} else if userEvent.Action == 2 {
+			// 下线
+			userEvent.DropEvent()
+		}
+	}
+}
+
+// 补全来源未提供的字段
+func completeUser(user types.User, productsID int) types.User {
+	if user.ProductsID == 0 {
+		user.ProductsID = productsID
+	}
+	if user.AddTime == 0 {
+		user.AddTime = int(time.Now().Unix())
+	}
+	return user
+}
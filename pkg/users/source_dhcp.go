@@ -0,0 +1,271 @@
+package users
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DHCP 租约来源
+// 读取 ISC dhcpd、dnsmasq 与 Kea(memfile csv) 的租约文件，仅保留未过期的租约，每次同步重新读取
+
+const (
+	LeaseISC     = "isc"
+	LeaseDnsmasq = "dnsmasq"
+	LeaseKea     = "kea"
+
+	usernameHostname = "hostname"
+	usernameMac      = "mac"
+)
+
+type lease struct {
+	IP       string
+	Mac      string
+	Hostname string
+	Start    time.Time
+	Expire   time.Time // 零值表示永不过期
+}
+
+type dhcpSource struct {
+	cfg   config.UserSourceEntry
+	parse func(r io.Reader) ([]lease, error)
+}
+
+func newDHCPSource(c config.UserSourceEntry) (*dhcpSource, error) {
+	if c.Path == "" {
+		return nil, fmt.Errorf("dhcp leases path is empty")
+	}
+	s := &dhcpSource{cfg: c}
+	switch c.Format {
+	case LeaseISC:
+		s.parse = parseISCLeases
+	case LeaseDnsmasq:
+		s.parse = parseDnsmasqLeases
+	case LeaseKea:
+		s.parse = parseKeaLeases
+	default:
+		return nil, fmt.Errorf("unsupported dhcp leases format: %s", c.Format)
+	}
+	switch c.Username {
+	case "":
+		s.cfg.Username = usernameHostname
+	case usernameHostname, usernameMac:
+	default:
+		return nil, fmt.Errorf("unsupported dhcp username: %s", c.Username)
+	}
+	return s, nil
+}
+
+func (s *dhcpSource) Name() string {
+	return s.cfg.Name
+}
+
+func (s *dhcpSource) Snapshot(ctx context.Context) ([]types.User, error) {
+	file, err := os.Open(s.cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	leases, err := s.parse(file)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	list := make([]types.User, 0, len(leases))
+	for _, l := range leases {
+		if !l.Expire.IsZero() && l.Expire.Before(now) {
+			continue
+		}
+		username := l.Hostname
+		if s.cfg.Username == usernameMac || username == "" {
+			username = l.Mac
+		}
+		user := types.User{
+			UserName: username,
+			IP:       l.IP,
+			UserMac:  l.Mac,
+		}
+		if !l.Start.IsZero() {
+			user.AddTime = int(l.Start.Unix())
+		}
+		list = append(list, completeUser(user, s.cfg.ProductsID))
+	}
+	return list, nil
+}
+
+func (s *dhcpSource) Watch(ctx context.Context, events chan<- types.UserEvent) error {
+	return nil
+}
+
+// dnsmasq: 到期时间戳 MAC IP 主机名 客户端ID，到期为0表示永久，主机名未知为 *
+func parseDnsmasqLeases(r io.Reader) ([]lease, error) {
+	var leases []lease
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// duid 行只有两列
+		if len(fields) < 4 {
+			continue
+		}
+		expire, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		l := lease{IP: fields[2], Mac: strings.ToLower(fields[1])}
+		if expire > 0 {
+			l.Expire = time.Unix(expire, 0)
+		}
+		if fields[3] != "*" {
+			l.Hostname = fields[3]
+		}
+		leases = append(leases, l)
+	}
+	return leases, scanner.Err()
+}
+
+// Kea memfile: 带表头的csv，state 为0时租约有效
+func parseKeaLeases(r io.Reader) ([]lease, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	index := make(map[string]int)
+	for i, name := range rows[0] {
+		index[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"address", "hwaddr", "expire"} {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("kea leases missing column: %s", name)
+		}
+	}
+	get := func(row []string, name string) string {
+		i, ok := index[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	// 同一地址以文件中最后一条为准
+	latest := make(map[string]lease)
+	var order []string
+	for _, row := range rows[1:] {
+		if state := get(row, "state"); state != "" && state != "0" {
+			delete(latest, get(row, "address"))
+			continue
+		}
+		expire, err := strconv.ParseInt(get(row, "expire"), 10, 64)
+		if err != nil {
+			continue
+		}
+		l := lease{
+			IP:       get(row, "address"),
+			Mac:      strings.ToLower(get(row, "hwaddr")),
+			Hostname: strings.TrimSuffix(get(row, "hostname"), "."),
+			Expire:   time.Unix(expire, 0),
+		}
+		if lifetime, err := strconv.ParseInt(get(row, "valid_lifetime"), 10, 64); err == nil {
+			l.Start = l.Expire.Add(-time.Duration(lifetime) * time.Second)
+		}
+		order = append(order, l.IP)
+		latest[l.IP] = l
+	}
+	return collectLeases(order, latest), nil
+}
+
+// ISC dhcpd.leases: lease <ip> { ... } 块，同一地址以最后一块为准，仅保留 binding state active
+func parseISCLeases(r io.Reader) ([]lease, error) {
+	latest := make(map[string]lease)
+	var order []string
+	var (
+		current *lease
+		active  bool
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if current == nil {
+			if strings.HasPrefix(line, "lease ") && strings.HasSuffix(line, "{") {
+				fields := strings.Fields(line)
+				current, active = &lease{IP: fields[1]}, true
+			}
+			continue
+		}
+		if line == "}" {
+			if active {
+				order = append(order, current.IP)
+				latest[current.IP] = *current
+			} else {
+				delete(latest, current.IP)
+			}
+			current = nil
+			continue
+		}
+		// 去除结尾分号及其后的注释
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		switch {
+		case strings.HasPrefix(line, "starts "):
+			current.Start = parseISCTime(fields[1:])
+		case strings.HasPrefix(line, "ends "):
+			current.Expire = parseISCTime(fields[1:])
+		case strings.HasPrefix(line, "binding state "):
+			active = len(fields) > 2 && fields[2] == "active"
+		case strings.HasPrefix(line, "hardware ethernet "):
+			current.Mac = strings.ToLower(fields[2])
+		case strings.HasPrefix(line, "client-hostname "):
+			current.Hostname = strings.Trim(strings.TrimPrefix(line, "client-hostname "), `"`)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return collectLeases(order, latest), nil
+}
+
+// 按首次出现顺序输出仍有效的租约
+func collectLeases(order []string, latest map[string]lease) []lease {
+	leases := make([]lease, 0, len(latest))
+	for _, ip := range order {
+		if l, ok := latest[ip]; ok {
+			leases = append(leases, l)
+			delete(latest, ip)
+		}
+	}
+	return leases
+}
+
+// 时间格式为 "<weekday> yyyy/mm/dd hh:mm:ss"(UTC)、"epoch <秒>" 或 "never"
+func parseISCTime(fields []string) time.Time {
+	if len(fields) >= 2 && fields[0] == "epoch" {
+		if sec, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			return time.Unix(sec, 0)
+		}
+		return time.Time{}
+	}
+	if len(fields) >= 3 {
+		if t, err := time.Parse("2006/01/02 15:04:05", fields[1]+" "+fields[2]); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
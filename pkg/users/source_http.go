@@ -0,0 +1,181 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTP 来源
+// 定时拉取第三方接口返回的在线用户json，root 指定列表所在路径，fields 指定字段映射
+
+const (
+	fieldIP         = "ip"
+	fieldUserName   = "user_name"
+	fieldUserMac    = "user_mac"
+	fieldProductsID = "products_id"
+	fieldAddTime    = "add_time"
+	fieldIP6        = "ip6"
+
+	defaultHTTPTimeout = 10
+)
+
+type httpSource struct {
+	cfg    config.UserSourceEntry
+	fields map[string]string
+	client *http.Client
+}
+
+func newHTTPSource(c config.UserSourceEntry) (*httpSource, error) {
+	if c.URL == "" {
+		return nil, fmt.Errorf("http user source url is empty")
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+	fields := map[string]string{
+		fieldIP:         fieldIP,
+		fieldUserName:   fieldUserName,
+		fieldUserMac:    fieldUserMac,
+		fieldProductsID: fieldProductsID,
+		fieldAddTime:    fieldAddTime,
+		fieldIP6:        fieldIP6,
+	}
+	for k, v := range c.Fields {
+		fields[k] = v
+	}
+	return &httpSource{cfg: c, fields: fields, client: &http.Client{Timeout: time.Duration(timeout) * time.Second}}, nil
+}
+
+func (s *httpSource) Name() string {
+	return s.cfg.Name
+}
+
+func (s *httpSource) Snapshot(ctx context.Context) ([]types.User, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range s.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	var body any
+	if err = decoder.Decode(&body); err != nil {
+		return nil, err
+	}
+	items, err := lookupList(body, s.cfg.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]types.User, 0, len(items))
+	for _, item := range items {
+		obj, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		user := types.User{
+			IP:         jsonString(obj[s.fields[fieldIP]]),
+			UserName:   jsonString(obj[s.fields[fieldUserName]]),
+			UserMac:    jsonString(obj[s.fields[fieldUserMac]]),
+			ProductsID: jsonInt(obj[s.fields[fieldProductsID]]),
+			AddTime:    jsonInt(obj[s.fields[fieldAddTime]]),
+			IP6:        jsonStrings(obj[s.fields[fieldIP6]]),
+		}
+		list = append(list, completeUser(user, s.cfg.ProductsID))
+	}
+	return list, nil
+}
+
+func (s *httpSource) Watch(ctx context.Context, events chan<- types.UserEvent) error {
+	return nil
+}
+
+// 按点分路径取出列表
+func lookupList(body any, root string) ([]any, error) {
+	node := body
+	if root != "" {
+		for _, key := range strings.Split(root, ".") {
+			obj, ok := node.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("root %s: %s is not an object", root, key)
+			}
+			node = obj[key]
+		}
+	}
+	list, ok := node.([]any)
+	if !ok {
+		return nil, fmt.Errorf("root %q is not a list", root)
+	}
+	return list, nil
+}
+
+func jsonString(v any) string {
+	switch value := v.(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case json.Number:
+		return value.String()
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// 字符串数组或逗号分隔的字符串
+func jsonStrings(v any) []string {
+	var list []string
+	switch value := v.(type) {
+	case []any:
+		for _, item := range value {
+			if s := jsonString(item); s != "" {
+				list = append(list, s)
+			}
+		}
+	case string:
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
+
+func jsonInt(v any) int {
+	switch value := v.(type) {
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return int(n)
+		}
+		if f, err := value.Float64(); err == nil {
+			return int(f)
+		}
+	case string:
+		n, _ := strconv.Atoi(strings.TrimSpace(value))
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,186 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/protocols"
+	"go.uber.org/zap"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RADIUS 计费来源
+// 从镜像流量中解析 Accounting-Request，Start/Interim 上线，Stop 下线，无需轮询计费系统
+
+const (
+	SourceRadius = "radius"
+
+	// 超过该时长未收到计费更新的会话视为失效
+	radiusSessionTTL = 24 * time.Hour
+)
+
+var defaultRadiusPorts = []int{1813, 1646}
+
+// 抓包服务中仅存在一个 radius 来源
+var radius atomic.Pointer[radiusSource]
+
+type radiusSession struct {
+	user      types.User
+	sessionID string
+	lastSeen  time.Time
+}
+
+type radiusSource struct {
+	cfg      config.UserSourceEntry
+	ports    map[string]bool
+	events   chan types.UserEvent
+	sessions map[string]*radiusSession // ip -> 会话
+	mu       sync.Mutex
+	invalid  atomic.Int64
+}
+
+func newRadiusSource(c config.UserSourceEntry) (*radiusSource, error) {
+	if radius.Load() != nil {
+		return nil, errors.New("only one radius user source is allowed")
+	}
+	ports := c.Ports
+	if len(ports) == 0 {
+		ports = defaultRadiusPorts
+	}
+	s := &radiusSource{
+		cfg:      c,
+		ports:    make(map[string]bool),
+		events:   make(chan types.UserEvent, 1000),
+		sessions: make(map[string]*radiusSession),
+	}
+	for _, port := range ports {
+		s.ports[strconv.Itoa(port)] = true
+	}
+	radius.Store(s)
+	return s, nil
+}
+
+func (s *radiusSource) Name() string {
+	return s.cfg.Name
+}
+
+// Snapshot 当前计费会话，清理长时间未更新的会话
+func (s *radiusSource) Snapshot(ctx context.Context) ([]types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	list := make([]types.User, 0, len(s.sessions))
+	for ip, session := range s.sessions {
+		if now.Sub(session.lastSeen) > radiusSessionTTL {
+			delete(s.sessions, ip)
+			continue
+		}
+		list = append(list, session.user)
+	}
+	return list, nil
+}
+
+func (s *radiusSource) Watch(ctx context.Context, events chan<- types.UserEvent) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-s.events:
+			events <- e
+		}
+	}
+}
+
+// HandleRadius 处理抓包中的 RADIUS 计费报文，目的端口为计费端口时返回 true
+func HandleRadius(dstPort string, payload []byte) bool {
+	s := radius.Load()
+	if s == nil || !s.ports[dstPort] {
+		return false
+	}
+	acct, err := protocols.ParseRadiusAccounting(payload, s.cfg.Secret)
+	if err != nil {
+		if errors.Is(err, protocols.ErrAuthenticator) {
+			if n := s.invalid.Add(1); n == 1 || n%1000 == 0 {
+				zap.L().Warn("radius accounting authenticator mismatch", zap.Int64("count", n))
+			}
+		}
+		return true
+	}
+	for _, e := range s.handle(acct) {
+		select {
+		case s.events <- e:
+		default:
+			zap.L().Warn("radius event queue is full", zap.String("user", e.UserName), zap.String("ip", e.Ip))
+		}
+	}
+	return true
+}
+
+// 更新会话，返回需要处理的上下线事件
+func (s *radiusSource) handle(acct protocols.RadiusAccounting) []types.UserEvent {
+	if acct.FramedIP == "" || acct.UserName == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[acct.FramedIP]
+	switch acct.StatusType {
+	case protocols.AcctStart, protocols.AcctInterim:
+		// 计费更新且会话未变化时仅刷新时间
+		if exists && session.user.UserName == acct.UserName && session.sessionID == acct.AcctSessionID {
+			session.lastSeen = time.Now()
+			return nil
+		}
+		var events []types.UserEvent
+		if exists {
+			// 地址已分配给新会话，旧会话先下线
+			events = append(events, radiusEvent(2, protocols.RadiusAccounting{AcctSessionID: session.sessionID}, session.user))
+		}
+		user := completeUser(types.User{
+			UserName:  acct.UserName,
+			IP:        acct.FramedIP,
+			UserMac:   acct.CallingStationID,
+			Source:    s.cfg.Name,
+			SessionID: acct.AcctSessionID,
+			NasIP:     acct.NasIP,
+			IP6:       ip6(acct.FramedIPv6Prefix),
+		}, s.cfg.ProductsID)
+		s.sessions[acct.FramedIP] = &radiusSession{user: user, sessionID: acct.AcctSessionID, lastSeen: time.Now()}
+		return append(events, radiusEvent(1, acct, user))
+	case protocols.AcctStop:
+		if !exists || session.sessionID != acct.AcctSessionID {
+			// 未知会话或已被新会话替换
+			return nil
+		}
+		delete(s.sessions, acct.FramedIP)
+		return []types.UserEvent{radiusEvent(2, acct, session.user)}
+	default:
+		return nil
+	}
+}
+
+func radiusEvent(action int, acct protocols.RadiusAccounting, user types.User) types.UserEvent {
+	return types.UserEvent{
+		Action:     action,
+		SessionId:  acct.AcctSessionID,
+		NasIp:      acct.NasIP,
+		UserName:   user.UserName,
+		Ip:         user.IP,
+		Ip6:        acct.FramedIPv6Prefix,
+		UserMac:    user.UserMac,
+		ProductsId: user.ProductsID,
+		AddTime:    user.AddTime,
+	}
+}
+
+func ip6(prefix string) []string {
+	if prefix == "" {
+		return nil
+	}
+	return []string{prefix}
+}
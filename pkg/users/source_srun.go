@@ -0,0 +1,96 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/redis"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	v9 "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 计费系统来源
+// 全量读取在线表 list:rad_online 与 hash:rad_online:%d，增量监听 list:antiproxy:%s
+
+var hashFields = []string{"rad_online_id", "user_name", "ip", "user_mac", "line_type", "add_time", "products_id", "billing_id", "control_id",
+	"ip6", "ip6_1", "ip6_2", "ip6_3"}
+
+// 在线表中的 IPv6 字段，与事件中的字段一致
+var ip6Fields = hashFields[len(hashFields)-4:]
+
+type srunSource struct {
+	name string
+}
+
+func (s *srunSource) Name() string {
+	return s.name
+}
+
+func (s *srunSource) Snapshot(ctx context.Context) ([]types.User, error) {
+	rdb := redis.GetOnlineRedisClient()
+
+	ids, err := rdb.LRange(ctx, types.ListRadOnline, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]types.User, 0, len(ids))
+	for _, id := range ids {
+		// 读取失败时放弃本次快照，避免对账时误删在线用户
+		user, err := getHash(ctx, id, rdb)
+		if err != nil {
+			return nil, err
+		}
+		if user.UserName != "" {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (s *srunSource) Watch(ctx context.Context, events chan<- types.UserEvent) error {
+	rdb := redis.GetCacheRedisClient()
+
+	listKey := fmt.Sprintf(types.ListAntiProxy, config.Cfg.Redis.DPI.Host)
+
+	for ctx.Err() == nil {
+		event, err := rdb.BLPop(ctx, time.Minute, listKey).Result()
+		if err != nil {
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		userEvent := types.UserEvent{}
+		_ = json.Unmarshal([]byte(event[1]), &userEvent)
+		if userEvent.UserName == "" {
+			zap.L().Warn("user event is empty", zap.Strings("event", event))
+			continue
+		}
+		events <- userEvent
+		time.Sleep(time.Second)
+	}
+	return nil
+}
+
+func getHash(ctx context.Context, id string, rdb *v9.Client) (types.User, error) {
+	idInt, _ := strconv.Atoi(id)
+	hashKey := fmt.Sprintf(types.HashRadOnline, idInt)
+	var user types.User
+	cmd := rdb.HMGet(ctx, hashKey, hashFields...)
+	if err := cmd.Scan(&user); err != nil {
+		zap.L().Error("Error getting hash", zap.String("hashKey", hashKey), zap.Error(err))
+		return types.User{}, err
+	}
+	values := cmd.Val()[len(hashFields)-len(ip6Fields):]
+	for _, v := range values {
+		if value, ok := v.(string); ok && usableIP6(value) {
+			user.IP6 = append(user.IP6, strings.TrimSpace(value))
+		}
+	}
+	return user, nil
+}
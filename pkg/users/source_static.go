@@ -0,0 +1,130 @@
+package users
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/config"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 静态映射来源
+// 实验环境或无计费系统的网络中，从 csv/yaml 文件读取 IP 与用户的对应关系，每次同步重新读取
+
+type staticSource struct {
+	cfg config.UserSourceEntry
+}
+
+// staticUser yaml 映射条目
+type staticUser struct {
+	IP         string `yaml:"ip"`
+	UserName   string `yaml:"user_name"`
+	UserMac    string `yaml:"user_mac"`
+	ProductsID int    `yaml:"products_id"`
+}
+
+func newStaticSource(c config.UserSourceEntry) (*staticSource, error) {
+	if c.Path == "" {
+		return nil, fmt.Errorf("static user source path is empty")
+	}
+	if c.Format == "" {
+		c.Format = strings.TrimPrefix(filepath.Ext(c.Path), ".")
+	}
+	switch c.Format {
+	case "csv", "yaml", "yml":
+	default:
+		return nil, fmt.Errorf("unsupported static user format: %s", c.Format)
+	}
+	return &staticSource{cfg: c}, nil
+}
+
+func (s *staticSource) Name() string {
+	return s.cfg.Name
+}
+
+func (s *staticSource) Snapshot(ctx context.Context) ([]types.User, error) {
+	var (
+		list []types.User
+		err  error
+	)
+	if s.cfg.Format == "csv" {
+		list, err = ReadUserFile(s.cfg.Path)
+	} else {
+		list, err = readUserYaml(s.cfg.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		list[i] = completeUser(list[i], s.cfg.ProductsID)
+	}
+	return list, nil
+}
+
+func (s *staticSource) Watch(ctx context.Context, events chan<- types.UserEvent) error {
+	return nil
+}
+
+// ReadUserFile 读取用户名单csv，每行 ip,user_name,products_id[,mac]，# 开头为注释，产品非数字的行视为表头
+func ReadUserFile(path string) ([]types.User, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var list []types.User
+	for _, row := range rows {
+		if len(row) < 3 {
+			continue
+		}
+		product, err := strconv.Atoi(strings.TrimSpace(row[2]))
+		if err != nil {
+			// 表头
+			continue
+		}
+		user := types.User{
+			IP:         strings.TrimSpace(row[0]),
+			UserName:   strings.TrimSpace(row[1]),
+			ProductsID: product,
+		}
+		if len(row) > 3 {
+			user.UserMac = strings.TrimSpace(row[3])
+		}
+		list = append(list, completeUser(user, 0))
+	}
+	return list, nil
+}
+
+func readUserYaml(path string) ([]types.User, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []staticUser
+	if err = yaml.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	list := make([]types.User, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, types.User{
+			IP:         e.IP,
+			UserName:   e.UserName,
+			UserMac:    e.UserMac,
+			ProductsID: e.ProductsID,
+		})
+	}
+	return list, nil
+}
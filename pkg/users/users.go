@@ -3,10 +3,11 @@ package users
 import (
 	"context"
 	"fmt"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/bus"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/member"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/capture/observer"
-	mongodb "github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/mongo"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/redis"
+	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/db/storage"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/i18n"
 	"github.com/dot-xiaoyuan/dpi-analyze/pkg/component/types"
 	v9 "github.com/redis/go-redis/v9"
@@ -17,28 +18,16 @@ import (
 	"time"
 )
 
-var (
-	OnlineUsers sync.Map
-	hashFields  = []string{"rad_online_id", "user_name", "ip", "user_mac", "line_type", "add_time", "products_id", "billing_id", "control_id"}
-)
+var OnlineUsers sync.Map
 
 type UserEvent types.UserEvent
 
-func getHash(id string, rdb *v9.Client) types.User {
-	idInt, _ := strconv.Atoi(id)
-	hashKey := fmt.Sprintf(types.HashRadOnline, idInt)
-	var user types.User
-	if err := rdb.HMGet(context.TODO(), hashKey, hashFields...).Scan(&user); err != nil {
-		zap.L().Error("Error getting hash", zap.String("hashKey", hashKey), zap.Error(err))
-		return types.User{}
-	}
-
-	return user
-}
-
-// 记录用户，内部用sync.map。有序列表使用z set
+// 记录用户，内部用sync.map。有序列表使用z set，ip 为用户标识
 func storeUser(ip string, user types.User) {
-	OnlineUsers.LoadOrStore(ip, user)
+	if old, loaded := OnlineUsers.Swap(ip, user); loaded {
+		unregisterIPv6(ip, old.(types.User))
+	}
+	registerIPv6(ip, user)
 	rdb := redis.GetRedisClient()
 	ctx := context.TODO()
 
@@ -49,9 +38,11 @@ func storeUser(ip string, user types.User) {
 	rdb.HMSet(ctx, fmt.Sprintf(types.HashAnalyzeIP, ip), "username", user.UserName, "mac", user.UserMac).Val()
 }
 
-// DropUser 记录用户，下线删除在线表中的IP
+// DropUser 记录用户，下线删除在线表中的IP，ip 为用户标识
 func DropUser(ip string) {
-	OnlineUsers.Delete(ip)
+	if old, loaded := OnlineUsers.LoadAndDelete(ip); loaded {
+		unregisterIPv6(ip, old.(types.User))
+	}
 	rdb := redis.GetRedisClient()
 	ctx := context.TODO()
 
@@ -61,6 +52,7 @@ func DropUser(ip string) {
 	pipe.ZRem(ctx, types.ZSetOnlineUsers, ip)
 	pipe.Del(ctx, fmt.Sprintf(types.HashAnalyzeIP, ip))
 	pipe.Del(ctx, fmt.Sprintf(types.SetIPDevices, ip))
+	pipe.Del(ctx, fmt.Sprintf(types.ZSetIPDevices, ip))
 	pipe.Del(ctx, fmt.Sprintf(types.KeyDevicesAllIP, ip))
 	pipe.Del(ctx, fmt.Sprintf(types.KeyDevicesMobileIP, ip))
 	pipe.Del(ctx, fmt.Sprintf(types.KeyDevicesPcIP, ip))
@@ -68,6 +60,7 @@ func DropUser(ip string) {
 	pipe.ZRem(ctx, observer.MacObserver.Table, ip)
 	pipe.ZRem(ctx, observer.UaObserver.Table, ip)
 	pipe.ZRem(ctx, observer.DeviceObserver.Table, ip)
+	pipe.ZRem(ctx, observer.RandomMacObserver.Table, ip)
 	pipe.ZRem(ctx, types.ZSetRealtimeShored, ip)
 
 	_, err := pipe.Exec(ctx)
@@ -76,13 +69,19 @@ func DropUser(ip string) {
 	}
 	member.DelMemory(ip)
 	member.DelFeatureSet(ip)
+	member.DelWindow(ip)
+	observer.Prune(ip)
 }
 
-// FindUser 查找用户
+// FindUser 查找用户，ip 可以是用户标识或用户的任一IPv6地址
 func FindUser(ip string) types.User {
-	user, ok := OnlineUsers.Load(ip)
-	if ok {
-		return user.(types.User)
+	if key, ok := ResolveUser(ip); ok {
+		if user, ok := OnlineUsers.Load(key); ok {
+			return user.(types.User)
+		}
+	}
+	if user, ok := simulatedUser(ip); ok {
+		return user
 	}
 	return types.User{}
 }
@@ -95,16 +94,17 @@ func GetTotalCount() int64 {
 
 // FindUserName 根据ip查找用户名
 func FindUserName(ip string) string {
-	user, ok := OnlineUsers.Load(ip)
-	if ok {
-		return user.(types.User).UserName
+	if key, ok := ResolveUser(ip); ok {
+		if user, ok := OnlineUsers.Load(key); ok {
+			return user.(types.User).UserName
+		}
 	}
 	return ""
 }
 
 // ExitsUser 用户是否存在
 func ExitsUser(ip string) bool {
-	_, ok := OnlineUsers.Load(ip)
+	_, ok := ResolveUser(ip)
 	return ok
 }
 
@@ -145,8 +145,9 @@ func Traversal(c types.Condition) (int64, interface{}, error) {
 // LoadEvent 上线事件
 // 1.更新在线表
 // 2.记录事件日志2mongo
+// 3.检查处置状态
 func (u *UserEvent) LoadEvent() {
-	storeUser(u.Ip, types.User{
+	user := types.User{
 		UserName:    u.UserName,
 		IP:          u.Ip,
 		UserMac:     u.UserMac,
@@ -156,20 +157,34 @@ func (u *UserEvent) LoadEvent() {
 		BillingID:   u.BillingId,
 		ContractID:  u.ControlId,
 		RadOnlineID: u.RadOnlineId,
-	})
+		SessionID:   u.SessionId,
+		NasIP:       u.NasIp,
+		Source:      u.Origin,
+		IP6:         eventIP6(u),
+	}
+	key := UserKey(user)
+	if key == "" {
+		return
+	}
+	storeUser(key, user)
 	u.Save2Mongo()
+	// 禁用期内重新上线，再次下发
+	reapplyEnforcement(user)
 }
 
 // DropEvent 下线事件
 func (u *UserEvent) DropEvent() {
-	DropUser(u.Ip)
+	if key := UserKey(types.User{IP: u.Ip, IP6: eventIP6(u)}); key != "" {
+		DropUser(key)
+	}
 	u.Save2Mongo()
 }
 
 func (u *UserEvent) Save2Mongo() {
 	ctx := context.TODO()
+	bus.UserEvents.Publish(types.UserEvent(*u))
 
-	_, err := mongodb.GetMongoClient().Database(types.MongoDatabaseUserEvents).Collection(time.Now().Format("06_01")).InsertOne(ctx, u)
+	err := storage.Users().InsertUserEvent(ctx, time.Now().Format(types.MongoCollectionMonthlyLayout), types.UserEvent(*u))
 	if err != nil {
 		zap.L().Error(i18n.T("Error inserting event"), zap.Error(err))
 		os.Exit(1)